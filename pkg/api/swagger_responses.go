@@ -37,6 +37,11 @@ type OKResponse struct {
 	Body SuccessResponseBody `json:"body"`
 }
 
+// NotModifiedResponse is returned if the requested resource hasn't changed since it was last fetched.
+//
+// swagger:response notModifiedResponse
+type NotModifiedResponse struct{}
+
 // ForbiddenError is returned if the user/token has insufficient permissions to access the requested resource.
 //
 // swagger:response forbiddenError
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/grafana/grafana/pkg/api/dtos"
 	"github.com/grafana/grafana/pkg/api/response"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards"
+	"github.com/grafana/grafana/pkg/services/guardian"
 	"github.com/grafana/grafana/pkg/util"
 	"github.com/grafana/grafana/pkg/web"
 )
@@ -18,8 +23,10 @@ import (
 //
 // Responses:
 // 200: createTeamResponse
+// 400: badRequestError
 // 401: unauthorisedError
 // 403: forbiddenError
+// 404: notFoundError
 // 409: conflictError
 // 500: internalServerError
 func (hs *HTTPServer) CreateTeam(c *models.ReqContext) response.Response {
@@ -32,14 +39,41 @@ func (hs *HTTPServer) CreateTeam(c *models.ReqContext) response.Response {
 		return response.Error(403, "Not allowed to create team.", nil)
 	}
 
+	grants, err := hs.getTeamFolderGrants(c.Req.Context(), c.SignedInUser, c.OrgId, cmd.GrantFolderAccess)
+	if err != nil {
+		if errors.Is(err, dashboards.ErrFolderNotFound) {
+			return response.Error(404, "Folder not found", err)
+		}
+		if errors.Is(err, dashboards.ErrFolderAccessDenied) {
+			return response.Error(403, "Not allowed to grant access to folder", err)
+		}
+		if errors.Is(err, models.ErrFolderPermissionFolderEmpty) || errors.Is(err, models.ErrInvalidFolderPermission) {
+			return response.Error(400, err.Error(), err)
+		}
+		return response.Error(500, "Failed to check folder permissions", err)
+	}
+
 	team, err := hs.SQLStore.CreateTeam(cmd.Name, cmd.Email, c.OrgId)
 	if err != nil {
 		if errors.Is(err, models.ErrTeamNameTaken) {
 			return response.Error(409, "Team name taken", err)
 		}
+		if errors.Is(err, models.ErrOrgTeamLimitReached) {
+			return response.Error(403, err.Error(), err)
+		}
 		return response.Error(500, "Failed to create Team", err)
 	}
 
+	for _, grant := range grants {
+		if err := hs.grantTeamFolderAccess(c.Req.Context(), c.SignedInUser, c.OrgId, team.Id, grant); err != nil {
+			// the team is removed so that it's never left without its intended folder access
+			if err := hs.SQLStore.DeleteTeam(c.Req.Context(), &models.DeleteTeamCommand{OrgId: c.OrgId, Id: team.Id}); err != nil {
+				c.Logger.Error("Could not remove team after failing to grant folder access", "error", err)
+			}
+			return response.Error(500, "Failed to grant folder access", err)
+		}
+	}
+
 	if accessControlEnabled || (c.OrgRole == models.ROLE_EDITOR && hs.Cfg.EditorsCanAdmin) {
 		// if the request is authenticated using API tokens
 		// the SignedInUser is an empty struct therefore
@@ -47,6 +81,8 @@ func (hs *HTTPServer) CreateTeam(c *models.ReqContext) response.Response {
 		if c.SignedInUser.IsRealUser() {
 			if err := addOrUpdateTeamMember(c.Req.Context(), hs.teamPermissionsService, c.SignedInUser.UserId, c.OrgId, team.Id, models.PERMISSION_ADMIN.String()); err != nil {
 				c.Logger.Error("Could not add creator to team", "error", err)
+			} else if err := hs.SQLStore.SetTeamMemberCreatedBy(c.Req.Context(), c.OrgId, team.Id, c.SignedInUser.UserId, c.SignedInUser.UserId); err != nil {
+				c.Logger.Warn("Could not record who added the team member", "error", err)
 			}
 		} else {
 			c.Logger.Warn("Could not add creator to team because is not a real user")
@@ -58,6 +94,105 @@ func (hs *HTTPServer) CreateTeam(c *models.ReqContext) response.Response {
 	})
 }
 
+type teamFolderGrant struct {
+	folder     *models.Dashboard
+	permission models.PermissionType
+}
+
+// getTeamFolderGrants validates the folder access requested for a new team, the signed in user has to be able to
+// admin every folder. The same folder can be listed more than once, the highest permission wins
+func (hs *HTTPServer) getTeamFolderGrants(ctx context.Context, user *models.SignedInUser, orgID int64, folderAccess []models.FolderPermission) ([]teamFolderGrant, error) {
+	grants := make(map[int64]*teamFolderGrant, len(folderAccess))
+	for _, access := range folderAccess {
+		if access.FolderID <= 0 {
+			return nil, models.ErrFolderPermissionFolderEmpty
+		}
+		if access.Permission != models.PERMISSION_VIEW && access.Permission != models.PERMISSION_EDIT && access.Permission != models.PERMISSION_ADMIN {
+			return nil, models.ErrInvalidFolderPermission
+		}
+
+		if grant, ok := grants[access.FolderID]; ok {
+			if access.Permission > grant.permission {
+				grant.permission = access.Permission
+			}
+			continue
+		}
+
+		query := &models.GetDashboardQuery{Id: access.FolderID, OrgId: orgID}
+		if err := hs.DashboardService.GetDashboard(ctx, query); err != nil {
+			if errors.Is(err, dashboards.ErrDashboardNotFound) {
+				return nil, dashboards.ErrFolderNotFound
+			}
+			return nil, err
+		}
+		if !query.Result.IsFolder {
+			return nil, dashboards.ErrFolderNotFound
+		}
+
+		g := guardian.New(ctx, access.FolderID, orgID, user)
+		if canAdmin, err := g.CanAdmin(); err != nil {
+			return nil, err
+		} else if !canAdmin {
+			return nil, dashboards.ErrFolderAccessDenied
+		}
+
+		grants[access.FolderID] = &teamFolderGrant{folder: query.Result, permission: access.Permission}
+	}
+
+	result := make([]teamFolderGrant, 0, len(grants))
+	for _, grant := range grants {
+		result = append(result, *grant)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].folder.Id < result[j].folder.Id
+	})
+
+	return result, nil
+}
+
+// grantTeamFolderAccess grants the team a permission on the folder the same way the folder permissions API does.
+// Without access control, the folder's current permissions are kept, including the default role permissions
+// which otherwise stop applying once the folder has its own permissions
+func (hs *HTTPServer) grantTeamFolderAccess(ctx context.Context, user *models.SignedInUser, orgID, teamID int64, grant teamFolderGrant) error {
+	if !hs.AccessControl.IsDisabled() {
+		_, err := hs.folderPermissionsService.SetTeamPermission(ctx, orgID, teamID, grant.folder.Uid, grant.permission.String())
+		return err
+	}
+
+	g := guardian.New(ctx, grant.folder.Id, orgID, user)
+	acl, err := g.GetACL()
+	if err != nil {
+		return err
+	}
+
+	items := make([]*models.DashboardACL, 0, len(acl)+1)
+	for _, item := range acl {
+		if item.Inherited || item.TeamId == teamID {
+			continue
+		}
+		items = append(items, &models.DashboardACL{
+			OrgID:       orgID,
+			DashboardID: grant.folder.Id,
+			UserID:      item.UserId,
+			TeamID:      item.TeamId,
+			Role:        item.Role,
+			Permission:  item.Permission,
+			Created:     time.Now(),
+			Updated:     time.Now(),
+		})
+	}
+	items = append(items, &models.DashboardACL{
+		OrgID:       orgID,
+		DashboardID: grant.folder.Id,
+		TeamID:      teamID,
+		Permission:  grant.permission,
+		Created:     time.Now(),
+		Updated:     time.Now(),
+	})
+
+	return hs.DashboardService.UpdateDashboardACL(ctx, grant.folder.Id, items)
+}
+
 // swagger:route PUT /teams/{team_id} teams updateTeam
 //
 // Update Team.
@@ -140,9 +275,13 @@ func (hs *HTTPServer) DeleteTeamByID(c *models.ReqContext) response.Response {
 // 403: forbiddenError
 // 500: internalServerError
 func (hs *HTTPServer) SearchTeams(c *models.ReqContext) response.Response {
+	prefixQuery := c.QueryBool("prefix")
 	perPage := c.QueryInt("perpage")
 	if perPage <= 0 {
 		perPage = 1000
+		if prefixQuery {
+			perPage = models.DefaultTeamPrefixSearchLimit
+		}
 	}
 	page := c.QueryInt("page")
 	if page < 1 {
@@ -158,8 +297,10 @@ func (hs *HTTPServer) SearchTeams(c *models.ReqContext) response.Response {
 	query := models.SearchTeamsQuery{
 		OrgId:        c.OrgId,
 		Query:        c.Query("query"),
+		PrefixQuery:  prefixQuery,
 		Name:         c.Query("name"),
 		UserIdFilter: userIdFilter,
+		SortBy:       c.Query("sort"),
 		Page:         page,
 		Limit:        perPage,
 		SignedInUser: c.SignedInUser,
@@ -167,6 +308,9 @@ func (hs *HTTPServer) SearchTeams(c *models.ReqContext) response.Response {
 	}
 
 	if err := hs.SQLStore.SearchTeams(c.Req.Context(), &query); err != nil {
+		if errors.Is(err, models.ErrInvalidTeamSort) {
+			return response.Error(http.StatusBadRequest, "Invalid sort", err)
+		}
 		return response.Error(500, "Failed to search Teams", err)
 	}
 
@@ -348,6 +492,15 @@ type SearchTeamsParams struct {
 	// If set it will return results where the query value is contained in the name field. Query values with spaces need to be URL encoded.
 	// required:false
 	Query string `json:"query"`
+	// If set the query value is matched as a prefix of the name field, with exact matches first. Defaults to 10 results per page.
+	// in:query
+	// required:false
+	Prefix bool `json:"prefix"`
+	// If set to aclcount-desc, the teams are sorted by the number of dashboard and folder permissions granted to them, most first.
+	// in:query
+	// required:false
+	// Enum: aclcount-desc
+	Sort string `json:"sort"`
 }
 
 // swagger:parameters createTeam
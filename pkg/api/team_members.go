@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/grafana/grafana/pkg/api/dtos"
 	"github.com/grafana/grafana/pkg/api/response"
@@ -31,7 +32,13 @@ func (hs *HTTPServer) GetTeamMembers(c *models.ReqContext) response.Response {
 		return response.Error(http.StatusBadRequest, "teamId is invalid", err)
 	}
 
-	query := models.GetTeamMembersQuery{OrgId: c.OrgId, TeamId: teamId, SignedInUser: c.SignedInUser}
+	query := models.GetTeamMembersQuery{
+		OrgId:        c.OrgId,
+		TeamId:       teamId,
+		Query:        c.Query("query"),
+		WithOrgAdmin: c.QueryBool("withOrgAdmin"),
+		SignedInUser: c.SignedInUser,
+	}
 
 	// With accesscontrol the permission check has been done at middleware layer
 	// and the membership filtering will be done at DB layer based on user permissions
@@ -93,6 +100,10 @@ func (hs *HTTPServer) AddTeamMember(c *models.ReqContext) response.Response {
 		}
 	}
 
+	if cmd.ExpiresAt != nil && !cmd.ExpiresAt.After(time.Now()) {
+		return response.Error(http.StatusBadRequest, "expiresAt must be in the future", nil)
+	}
+
 	isTeamMember, err := hs.SQLStore.IsTeamMember(c.OrgId, cmd.TeamId, cmd.UserId)
 	if err != nil {
 		return response.Error(500, "Failed to add team member.", err)
@@ -106,6 +117,22 @@ func (hs *HTTPServer) AddTeamMember(c *models.ReqContext) response.Response {
 		return response.Error(500, "Failed to add Member to Team", err)
 	}
 
+	if c.SignedInUser.IsRealUser() {
+		if err := hs.SQLStore.SetTeamMemberCreatedBy(c.Req.Context(), cmd.OrgId, cmd.TeamId, cmd.UserId, c.SignedInUser.UserId); err != nil {
+			c.Logger.Warn("Could not record who added the team member", "error", err)
+		}
+	}
+
+	if cmd.ExpiresAt != nil {
+		if err := hs.SQLStore.SetTeamMemberExpiry(c.Req.Context(), cmd.OrgId, cmd.TeamId, cmd.UserId, cmd.ExpiresAt); err != nil {
+			// the member is removed again so that a failed request never leaves a permanent member behind
+			if err := addOrUpdateTeamMember(c.Req.Context(), hs.teamPermissionsService, cmd.UserId, cmd.OrgId, cmd.TeamId, ""); err != nil {
+				c.Logger.Error("Could not remove team member after failing to set its expiry", "error", err)
+			}
+			return response.Error(500, "Failed to set expiry of team member", err)
+		}
+	}
+
 	return response.JSON(http.StatusOK, &util.DynMap{
 		"message": "Member added to Team",
 	})
@@ -136,6 +163,10 @@ func (hs *HTTPServer) UpdateTeamMember(c *models.ReqContext) response.Response {
 	}
 	orgId := c.OrgId
 
+	if cmd.ExpiresAt != nil && !cmd.ExpiresAt.After(time.Now()) {
+		return response.Error(http.StatusBadRequest, "expiresAt must be in the future", nil)
+	}
+
 	if hs.AccessControl.IsDisabled() {
 		if err := hs.teamGuardian.CanAdmin(c.Req.Context(), orgId, teamId, c.SignedInUser); err != nil {
 			return response.Error(403, "Not allowed to update team member", err)
@@ -154,6 +185,12 @@ func (hs *HTTPServer) UpdateTeamMember(c *models.ReqContext) response.Response {
 	if err != nil {
 		return response.Error(500, "Failed to update team member.", err)
 	}
+
+	if cmd.ExpiresAt != nil {
+		if err := hs.SQLStore.SetTeamMemberExpiry(c.Req.Context(), orgId, teamId, userId, cmd.ExpiresAt); err != nil {
+			return response.Error(500, "Failed to update team member.", err)
+		}
+	}
 	return response.Success("Team member updated")
 }
 
@@ -225,6 +262,14 @@ type GetTeamMembersParams struct {
 	// in:path
 	// required:true
 	TeamID string `json:"team_id"`
+	// Only return members whose login, email or name contain the query.
+	// in:query
+	// required:false
+	Query string `json:"query"`
+	// Set isOrgAdmin on the members that are admins of the org.
+	// in:query
+	// required:false
+	WithOrgAdmin bool `json:"withOrgAdmin"`
 }
 
 // swagger:parameters addTeamMember
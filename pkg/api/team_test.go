@@ -11,10 +11,14 @@ import (
 	"github.com/grafana/grafana/pkg/infra/log/logtest"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/accesscontrol"
+	accesscontrolmock "github.com/grafana/grafana/pkg/services/accesscontrol/mock"
+	"github.com/grafana/grafana/pkg/services/guardian"
 	pref "github.com/grafana/grafana/pkg/services/preference"
 	"github.com/grafana/grafana/pkg/services/preference/preftest"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
@@ -208,6 +212,102 @@ func TestTeamAPIEndpoint_CreateTeam_RBAC(t *testing.T) {
 	})
 }
 
+func TestTeamAPIEndpoint_CreateTeam_GrantFolderAccess_LegacyAccessControl(t *testing.T) {
+	sc := setupHTTPServer(t, true, false)
+	origNewGuardian := guardian.New
+	t.Cleanup(func() {
+		guardian.New = origNewGuardian
+	})
+	guardian.InitLegacyGuardian(sc.db, sc.hs.DashboardService)
+	setInitCtxSignedInOrgAdmin(sc.initCtx)
+
+	folder, err := sc.dashboardsStore.SaveDashboard(models.SaveDashboardCommand{
+		OrgId:    testOrgID,
+		IsFolder: true,
+		Dashboard: simplejson.NewFromAny(map[string]interface{}{
+			"title": "team folder",
+		}),
+	})
+	require.NoError(t, err)
+
+	input := strings.NewReader(fmt.Sprintf(`{"name": "MyTestTeam", "grantFolderAccess": [{"folderId": %d, "permission": 1}, {"folderId": %d, "permission": 2}]}`, folder.Id, folder.Id))
+	response := callAPI(sc.server, http.MethodPost, createTeamURL, input, t)
+	require.Equal(t, http.StatusOK, response.Code)
+	var created struct {
+		TeamID int64 `json:"teamId"`
+	}
+	require.NoError(t, json.Unmarshal(response.Body.Bytes(), &created))
+
+	query := &models.GetDashboardACLInfoListQuery{DashboardID: folder.Id, OrgID: testOrgID}
+	require.NoError(t, sc.hs.DashboardService.GetDashboardACLInfoList(context.Background(), query))
+	var teamPermission models.PermissionType
+	for _, item := range query.Result {
+		if item.TeamId == created.TeamID {
+			teamPermission = item.Permission
+		}
+	}
+	assert.Equal(t, models.PERMISSION_EDIT, teamPermission)
+
+	t.Run("Viewers and editors keep their default access to the folder", func(t *testing.T) {
+		viewer := &models.SignedInUser{UserId: 2, OrgId: testOrgID, OrgRole: models.ROLE_VIEWER}
+		canView, err := guardian.New(context.Background(), folder.Id, testOrgID, viewer).CanView()
+		require.NoError(t, err)
+		assert.True(t, canView)
+
+		editor := &models.SignedInUser{UserId: 3, OrgId: testOrgID, OrgRole: models.ROLE_EDITOR}
+		canEdit, err := guardian.New(context.Background(), folder.Id, testOrgID, editor).CanEdit()
+		require.NoError(t, err)
+		assert.True(t, canEdit)
+	})
+
+	t.Run("The team isn't created when the folder doesn't exist", func(t *testing.T) {
+		input := strings.NewReader(`{"name": "MyOtherTestTeam", "grantFolderAccess": [{"folderId": 999, "permission": 1}]}`)
+		response := callAPI(sc.server, http.MethodPost, createTeamURL, input, t)
+		assert.Equal(t, http.StatusNotFound, response.Code)
+
+		query := &models.SearchTeamsQuery{OrgId: testOrgID, Name: "MyOtherTestTeam", SignedInUser: &models.SignedInUser{OrgId: testOrgID, OrgRole: models.ROLE_ADMIN}}
+		require.NoError(t, sc.db.SearchTeams(context.Background(), query))
+		assert.Empty(t, query.Result.Teams)
+	})
+}
+
+func TestTeamAPIEndpoint_CreateTeam_GrantFolderAccess_RBAC(t *testing.T) {
+	sc := setupHTTPServer(t, true, true)
+	origNewGuardian := guardian.New
+	t.Cleanup(func() {
+		guardian.New = origNewGuardian
+	})
+	guardian.MockDashboardGuardian(&guardian.FakeDashboardGuardian{CanAdminValue: true})
+	folderPermissions := accesscontrolmock.NewMockedPermissionsService()
+	sc.hs.folderPermissionsService = folderPermissions
+	setInitCtxSignedInViewer(sc.initCtx)
+	setAccessControlPermissions(sc.acmock, []accesscontrol.Permission{{Action: accesscontrol.ActionTeamsCreate}}, 1)
+
+	folder, err := sc.dashboardsStore.SaveDashboard(models.SaveDashboardCommand{
+		OrgId:    testOrgID,
+		IsFolder: true,
+		Dashboard: simplejson.NewFromAny(map[string]interface{}{
+			"title": "team folder",
+		}),
+	})
+	require.NoError(t, err)
+
+	folderPermissions.On("SetTeamPermission", mock.Anything, testOrgID, mock.Anything, folder.Uid, "View").
+		Return(&accesscontrol.ResourcePermission{}, nil).Once()
+
+	input := strings.NewReader(fmt.Sprintf(`{"name": "MyTestTeam", "grantFolderAccess": [{"folderId": %d, "permission": 1}]}`, folder.Id))
+	response := callAPI(sc.server, http.MethodPost, createTeamURL, input, t)
+	require.Equal(t, http.StatusOK, response.Code)
+	folderPermissions.AssertExpectations(t)
+
+	// the folder's permissions are only managed through the folder permissions service
+	query := &models.GetDashboardACLInfoListQuery{DashboardID: folder.Id, OrgID: testOrgID}
+	require.NoError(t, sc.hs.DashboardService.GetDashboardACLInfoList(context.Background(), query))
+	for _, item := range query.Result {
+		assert.Zero(t, item.TeamId)
+	}
+}
+
 func TestTeamAPIEndpoint_SearchTeams_RBAC(t *testing.T) {
 	sc := setupHTTPServer(t, true, true)
 	// Seed three teams
@@ -38,6 +38,12 @@ func RunCLI(version string) int {
 				Value:   "https://grafana.com/api/plugins",
 				EnvVars: []string{"GF_PLUGIN_REPO"},
 			},
+			&cli.StringFlag{
+				Name:    "repo-token",
+				Usage:   "Token sent as bearer token to the plugin repository, for repositories that require authentication",
+				Value:   "",
+				EnvVars: []string{"GF_PLUGIN_REPO_TOKEN"},
+			},
 			&cli.StringFlag{
 				Name:    "pluginUrl",
 				Usage:   "Full url to the plugin zip file instead of downloading the plugin from grafana.com/api",
@@ -71,7 +77,7 @@ func RunCLI(version string) int {
 
 	app.Before = func(c *cli.Context) error {
 		services.Init(version, c.Bool("insecure"), c.Bool("debug"))
-		return nil
+		return services.SetRepoToken(c.String("repo"), c.String("repo-token"))
 	}
 
 	if err := app.Run(os.Args); err != nil {
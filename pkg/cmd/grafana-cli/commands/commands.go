@@ -98,11 +98,23 @@ func runPluginCommand(command func(commandLine utils.CommandLine) error) func(co
 			return err
 		}
 
+		// the output of a command asked for JSON output must stay parseable
+		if cmd.String("output") == "json" {
+			return nil
+		}
+
 		logger.Info(color.GreenString("Please restart Grafana after installing plugins. Refer to Grafana documentation for instructions if necessary.\n\n"))
 		return nil
 	}
 }
 
+// runPluginQueryCommand runs a plugin command that doesn't change the installed plugins, so no restart is needed
+func runPluginQueryCommand(command func(commandLine utils.CommandLine) error) func(context *cli.Context) error {
+	return func(context *cli.Context) error {
+		return command(&utils.ContextCommandLine{Context: context})
+	}
+}
+
 // Command contains command state.
 type Command struct {
 	Client utils.ApiClient
@@ -117,6 +129,124 @@ var pluginCommands = []*cli.Command{
 		Name:   "install",
 		Usage:  "install <plugin id> <plugin version (optional)>",
 		Action: runPluginCommand(cmd.installCommand),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "lockfile",
+				Usage: "Path to a lockfile pinning the versions of the plugin and its dependencies. Missing entries are added after install",
+			},
+			&cli.StringFlag{
+				Name:  "catalog",
+				Usage: "Path to a catalog file listing the approved plugins and their download URLs. Only cataloged plugins can be installed",
+			},
+			&cli.StringFlag{
+				Name:  "checksums",
+				Usage: "Path to a checksum manifest listing the SHA256 checksum of each plugin version. The archives of the plugin and of its dependencies are verified against it",
+			},
+			&cli.BoolFlag{
+				Name:  "strict-checksums",
+				Usage: "Refuse to install plugin archives that are not in the checksum manifest",
+			},
+			&cli.StringFlag{
+				Name:  "policy",
+				Usage: "Path to a JSON file with the \"allow\" and \"deny\" lists of plugin IDs that can and can't be installed, dependencies included",
+			},
+			&cli.StringSliceFlag{
+				Name:  "allow-plugin",
+				Usage: "ID of a plugin that can be installed, dependencies included. When set, only allowed plugins can be installed",
+			},
+			&cli.StringSliceFlag{
+				Name:  "deny-plugin",
+				Usage: "ID of a plugin that can't be installed, dependencies included",
+			},
+			&cli.StringFlag{
+				Name:  "signature-key",
+				Usage: "Path to the armored GPG public key the detached signature of the plugin archive must be made with",
+			},
+			&cli.StringFlag{
+				Name:  "signature-url",
+				Usage: "URL of the detached GPG signature of the plugin archive, verified with --signature-key before extraction",
+			},
+			&cli.StringFlag{
+				Name:  "signature-file",
+				Usage: "Path to the detached GPG signature of the plugin archive, verified with --signature-key before extraction",
+			},
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "Output format, text or json. With json, the outcome of the install, errors included, is written to stdout as JSON",
+				Value: "text",
+			},
+			&cli.StringFlag{
+				Name:  "plugins-file",
+				Usage: "Path to a file listing the plugins to install as id[@version], one per line or as a JSON array",
+			},
+			&cli.BoolFlag{
+				Name:  "progress",
+				Usage: "Show the consolidated progress of the plugins of the plugins file instead of the install logs, with a line per plugin when not attached to a terminal",
+			},
+			&cli.BoolFlag{
+				Name:  "fail-fast",
+				Usage: "Stop installing the plugins of the plugins file after the first failure",
+			},
+			&cli.BoolFlag{
+				Name:  "versioned",
+				Usage: "Install into a directory per version and keep the previous version, so that the plugin can be rolled back",
+			},
+			&cli.BoolFlag{
+				Name:  "sandbox",
+				Usage: "Extract and verify plugins in a sandbox directory next to the plugins directory, and only move them into the plugins directory once verified",
+			},
+			&cli.BoolFlag{
+				Name:  "backup-existing",
+				Usage: "Move an installed plugin to a plugin-id.bak-<timestamp> directory instead of deleting it when it's replaced",
+			},
+			&cli.IntFlag{
+				Name:  "backup-keep",
+				Usage: "Number of backups to keep per plugin with --backup-existing, or 0 to keep them all",
+				Value: 3,
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Install the plugin even if no version is compatible with this Grafana version or system",
+			},
+			&cli.BoolFlag{
+				Name:  "force-deps",
+				Usage: "Download and extract the dependencies of the plugin even if the required version is already installed",
+			},
+			&cli.BoolFlag{
+				Name:  "only-compatible",
+				Usage: "Install the latest compatible version instead of a requested version that isn't compatible with this Grafana version or system",
+			},
+			&cli.StringFlag{
+				Name:  "grafana-version",
+				Usage: "Select the plugin versions compatible with this Grafana version instead of the running one, to install plugins ahead of an upgrade",
+			},
+			&cli.BoolFlag{
+				Name:  "current-platform-only",
+				Usage: "Only extract the backend plugin executables built for this system, and fail if a plugin has none",
+			},
+			&cli.BoolFlag{
+				Name:  "best-effort",
+				Usage: "Keep the plugin installed when some of its dependencies fail to install, and list the failed dependencies",
+			},
+		},
+	}, {
+		Name:   "deps",
+		Usage:  "deps <plugin id> <plugin version (optional)>",
+		Action: runPluginQueryCommand(cmd.depsCommand),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "lockfile",
+				Usage: "Path to a lockfile pinning the versions of the plugin and its dependencies",
+			},
+			&cli.StringFlag{
+				Name:  "catalog",
+				Usage: "Path to a catalog file listing the approved plugins and their download URLs",
+			},
+		},
+	}, {
+		Name:   "rollback",
+		Usage:  "rollback <plugin id>",
+		Action: runPluginCommand(cmd.rollbackCommand),
 	}, {
 		Name:   "list-remote",
 		Usage:  "list remote available plugins",
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/logger"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/utils"
+	"github.com/grafana/grafana/pkg/plugins/manager/installer"
+)
+
+// depsCommand prints the dependency tree a plugin install would resolve, without installing anything.
+func (cmd Command) depsCommand(c utils.CommandLine) error {
+	pluginID := c.Args().First()
+	if pluginID == "" {
+		return errors.New("missing plugin parameter")
+	}
+
+	i, _, err := newInstaller(c)
+	if err != nil {
+		return err
+	}
+
+	tree, err := i.DependencyTree(context.Background(), pluginID, c.Args().Get(1), c.PluginDirectory(), c.PluginURL(), c.PluginRepoURL())
+	if err != nil {
+		return err
+	}
+
+	for _, line := range formatDependencyTree(tree, 0) {
+		logger.Info(line + "\n")
+	}
+
+	return nil
+}
+
+// formatDependencyTree returns a line per plugin of the tree, indented by its depth.
+func formatDependencyTree(node *installer.DependencyNode, depth int) []string {
+	line := strings.Repeat("  ", depth) + node.ID
+	if node.Version != "" {
+		line += " v" + node.Version
+	} else if node.RequiredVersion != "" {
+		line += " v" + node.RequiredVersion
+	}
+
+	switch {
+	case node.InstalledVersion == "":
+		line += " (not installed)"
+	case node.InstalledVersion == node.Version:
+		line += " (installed)"
+	default:
+		line += fmt.Sprintf(" (v%s installed)", node.InstalledVersion)
+	}
+
+	if node.Cycle {
+		line += color.YellowString(" [cycle]")
+	}
+	if node.Err != nil {
+		line += color.RedString(" [%v]", node.Err)
+	}
+
+	lines := []string{line}
+	for _, dep := range node.Dependencies {
+		lines = append(lines, formatDependencyTree(dep, depth+1)...)
+	}
+
+	return lines
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/plugins/manager/installer"
+)
+
+func TestFormatDependencyTree(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = noColor })
+
+	tree := &installer.DependencyNode{
+		ID:      "a-app",
+		Version: "1.0.0",
+		Dependencies: []*installer.DependencyNode{
+			{ID: "test-app", RequiredVersion: "2.0.0", Version: "2.0.0", InstalledVersion: "2.0.0"},
+			{
+				ID:               "b-app",
+				Version:          "1.1.0",
+				InstalledVersion: "1.0.0",
+				Dependencies: []*installer.DependencyNode{
+					{ID: "a-app", Cycle: true},
+				},
+			},
+		},
+	}
+
+	require.Equal(t, []string{
+		"a-app v1.0.0 (not installed)",
+		"  test-app v2.0.0 (installed)",
+		"  b-app v1.1.0 (v1.0.0 installed)",
+		"    a-app (not installed) [cycle]",
+	}, formatDependencyTree(tree, 0))
+}
@@ -1,22 +1,29 @@
 package commands
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"runtime"
 	"strings"
 
+	"github.com/Masterminds/semver"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/logger"
 	"github.com/grafana/grafana/pkg/cmd/grafana-cli/models"
 	"github.com/grafana/grafana/pkg/cmd/grafana-cli/services"
 	"github.com/grafana/grafana/pkg/cmd/grafana-cli/utils"
 	"github.com/grafana/grafana/pkg/plugins/manager/installer"
+	"github.com/mattn/go-isatty"
+	"github.com/urfave/cli/v2"
 )
 
 func validateInput(c utils.CommandLine, pluginFolder string) error {
 	arg := c.Args().First()
-	if arg == "" {
+	if arg == "" && c.String("plugins-file") == "" {
 		return errors.New("please specify plugin to install")
 	}
 
@@ -41,11 +48,26 @@ func validateInput(c utils.CommandLine, pluginFolder string) error {
 }
 
 func (cmd Command) installCommand(c utils.CommandLine) error {
+	switch output := c.String("output"); output {
+	case "", "text":
+	case "json":
+		return installPluginJSON(c)
+	default:
+		return fmt.Errorf("unknown output format %q, must be text or json", output)
+	}
+
 	pluginFolder := c.PluginDirectory()
 	if err := validateInput(c, pluginFolder); err != nil {
 		return err
 	}
 
+	if pluginsFile := c.String("plugins-file"); pluginsFile != "" {
+		if c.String("signature-url") != "" || c.String("signature-file") != "" {
+			return errors.New("the archive signature of a single plugin can't be verified when installing a plugins file")
+		}
+		return installPluginsFromFile(pluginsFile, c)
+	}
+
 	pluginID := c.Args().First()
 	version := c.Args().Get(1)
 	return InstallPlugin(pluginID, version, c)
@@ -54,10 +76,375 @@ func (cmd Command) installCommand(c utils.CommandLine) error {
 // InstallPlugin downloads the plugin code as a zip file from the Grafana.com API
 // and then extracts the zip into the plugins directory.
 func InstallPlugin(pluginID, version string, c utils.CommandLine) error {
+	err := installPlugin(pluginID, version, c)
+	var depErr installer.ErrDependenciesFailed
+	if errors.As(err, &depErr) {
+		logFailedDependencies(depErr)
+	}
+
+	return err
+}
+
+// installPlugin installs the plugin and updates the lockfile, unless the plugin itself failed to install.
+func installPlugin(pluginID, version string, c utils.CommandLine, opts ...installer.Option) error {
+	if signature, err := readArchiveSignature(c, pluginID); err != nil {
+		return err
+	} else if signature != nil {
+		opts = append(opts, installer.WithArchiveSignature(signature))
+	}
+
+	i, lockfile, err := newInstaller(c, opts...)
+	if err != nil {
+		return err
+	}
+
+	err = i.Install(context.Background(), pluginID, version, c.PluginDirectory(), c.PluginURL(), c.PluginRepoURL())
+	var depErr installer.ErrDependenciesFailed
+	if err != nil && !errors.As(err, &depErr) {
+		return err
+	}
+
+	if lockfile != nil {
+		if err := lockfile.Write(c.String("lockfile")); err != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// installOutput is the outcome of an install written to stdout with --output json.
+type installOutput struct {
+	PluginID string `json:"pluginId"`
+	Version  string `json:"version,omitempty"`
+	// Dir is the directory the plugin was extracted to
+	Dir                string                     `json:"dir,omitempty"`
+	SHA256             string                     `json:"sha256,omitempty"`
+	Dependencies       []installer.ReportedPlugin `json:"dependencies"`
+	FailedDependencies []failedDependencyOutput   `json:"failedDependencies,omitempty"`
+	Error              string                     `json:"error,omitempty"`
+}
+
+type failedDependencyOutput struct {
+	ID      string `json:"id"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error"`
+}
+
+// installPluginJSON installs the plugin like InstallPlugin, but writes the outcome as JSON to stdout instead of logging it.
+// Since the error is part of the JSON, the command fails without printing it again.
+func installPluginJSON(c utils.CommandLine) error {
+	pluginID := c.Args().First()
+	report := &installer.InstallReport{}
+
+	var err error
+	if c.String("plugins-file") != "" {
+		err = errors.New("--output json can't be used when installing a plugins file")
+	} else if err = validateInput(c, c.PluginDirectory()); err == nil {
+		err = installPlugin(pluginID, c.Args().Get(1), c, installer.WithInstallReport(report))
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if encErr := enc.Encode(newInstallOutput(pluginID, report, err)); encErr != nil {
+		return encErr
+	}
+	if err != nil {
+		return cli.Exit("", 1)
+	}
+
+	return nil
+}
+
+func newInstallOutput(pluginID string, report *installer.InstallReport, err error) installOutput {
+	out := installOutput{PluginID: pluginID, Dependencies: []installer.ReportedPlugin{}}
+	for _, p := range report.Plugins {
+		if p.ID == pluginID && out.Version == "" {
+			out.Version, out.Dir, out.SHA256 = p.Version, p.Dir, p.SHA256
+			continue
+		}
+		out.Dependencies = append(out.Dependencies, p)
+	}
+
+	if err != nil {
+		out.Error = err.Error()
+	}
+	var depErr installer.ErrDependenciesFailed
+	if errors.As(err, &depErr) {
+		for _, dep := range depErr.Failed {
+			out.FailedDependencies = append(out.FailedDependencies, failedDependencyOutput{ID: dep.ID, Version: dep.Version, Error: dep.Err.Error()})
+		}
+	}
+
+	return out
+}
+
+// logFailedDependencies lists the dependencies that failed to install in best effort mode, so that they can be retried.
+func logFailedDependencies(depErr installer.ErrDependenciesFailed) {
+	logger.Errorf("%s was installed, but the following dependencies were not:\n", depErr.PluginID)
+	for _, dep := range depErr.Failed {
+		logger.Errorf("  %s: %v\n", pluginsFileEntry{ID: dep.ID, Version: dep.Version}, dep.Err)
+	}
+}
+
+type pluginsFileEntry struct {
+	ID      string
+	Version string
+}
+
+func (e pluginsFileEntry) String() string {
+	if e.Version == "" {
+		return e.ID
+	}
+	return e.ID + "@" + e.Version
+}
+
+// readPluginsFile reads a list of id[@version] entries, either as a JSON array or one entry per line.
+// Empty lines and lines starting with # are ignored.
+func readPluginsFile(path string) ([]pluginsFileEntry, error) {
+	// We can ignore the gosec G304 warning since the path stems from the command line flag "plugins-file"
+	// nolint:gosec
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to read plugins file", err)
+	}
+
+	var lines []string
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &lines); err != nil {
+			return nil, fmt.Errorf("%v: %w", "failed to parse plugins file", err)
+		}
+	} else {
+		lines = strings.Split(string(data), "\n")
+	}
+
+	entries := make([]pluginsFileEntry, 0, len(lines))
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry := pluginsFileEntry{ID: line}
+		if idx := strings.Index(line, "@"); idx >= 0 {
+			entry = pluginsFileEntry{ID: line[:idx], Version: line[idx+1:]}
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// installPluginsFromFile installs all plugins listed in the file with a single installer,
+// so that dependencies shared between the plugins are only installed once. The plugins are installed one after the other.
+// A failing plugin doesn't stop the remaining plugins from being installed unless the fail-fast flag is set.
+func installPluginsFromFile(path string, c utils.CommandLine) error {
+	entries, err := readPluginsFile(path)
+	if err != nil {
+		return err
+	}
+
+	opts := []installer.Option{installer.WithBatch()}
+	var progress *installer.Progress
+	if c.Bool("progress") {
+		pluginIDs := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			pluginIDs = append(pluginIDs, entry.ID)
+		}
+		progress = installer.NewProgress(os.Stdout, isatty.IsTerminal(os.Stdout.Fd()), pluginIDs...)
+		opts = append(opts, installer.WithProgress(progress))
+	}
+
+	i, lockfile, err := newInstaller(c, opts...)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, entry := range entries {
+		if err := i.Install(context.Background(), entry.ID, entry.Version, c.PluginDirectory(), "", c.PluginRepoURL()); err != nil {
+			// the progress reports the failed plugins and dependencies itself
+			if progress == nil {
+				var depErr installer.ErrDependenciesFailed
+				if errors.As(err, &depErr) {
+					logFailedDependencies(depErr)
+				} else {
+					logger.Errorf("Failed to install %s: %v\n", entry, err)
+				}
+			}
+			failed = append(failed, entry.String())
+			if c.Bool("fail-fast") {
+				break
+			}
+		}
+	}
+
+	if lockfile != nil {
+		if err := lockfile.Write(c.String("lockfile")); err != nil {
+			return err
+		}
+	}
+
+	if progress != nil {
+		progress.Finish()
+	} else {
+		logger.Infof("Installed %d of %d plugins\n", len(entries)-len(failed), len(entries))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to install %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func newInstaller(c utils.CommandLine, opts ...installer.Option) (installer.Service, *installer.Lockfile, error) {
 	skipTLSVerify := c.Bool("insecure")
 
-	i := installer.New(skipTLSVerify, services.GrafanaVersion, services.Logger)
-	return i.Install(context.Background(), pluginID, version, c.PluginDirectory(), c.PluginURL(), c.PluginRepoURL())
+	var lockfile *installer.Lockfile
+	if lockfilePath := c.String("lockfile"); lockfilePath != "" {
+		var err error
+		if lockfile, err = installer.ReadLockfile(lockfilePath); err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, installer.WithLockfile(lockfile))
+	}
+
+	if catalogPath := c.String("catalog"); catalogPath != "" {
+		catalog, err := installer.ReadCatalog(catalogPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, installer.WithCatalog(catalog))
+	}
+
+	if checksumsPath := c.String("checksums"); checksumsPath != "" {
+		manifest, err := installer.ReadChecksumManifest(checksumsPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, installer.WithChecksumManifest(manifest, c.Bool("strict-checksums")))
+	} else if c.Bool("strict-checksums") {
+		return nil, nil, errors.New("--strict-checksums requires --checksums")
+	}
+
+	if policy, err := readPolicy(c); err != nil {
+		return nil, nil, err
+	} else if policy != nil {
+		opts = append(opts, installer.WithPolicy(policy))
+	}
+
+	if c.Bool("versioned") {
+		opts = append(opts, installer.WithVersioned())
+	}
+
+	if c.Bool("sandbox") {
+		opts = append(opts, installer.WithSandbox())
+	}
+
+	if c.Bool("backup-existing") {
+		opts = append(opts, installer.WithBackupExisting(c.Int("backup-keep")))
+	}
+
+	if c.Bool("force") {
+		opts = append(opts, installer.WithForce())
+	}
+
+	if c.Bool("force-deps") {
+		opts = append(opts, installer.WithForceDeps())
+	}
+
+	if c.Bool("only-compatible") {
+		opts = append(opts, installer.WithOnlyCompatible())
+	}
+
+	if c.Bool("current-platform-only") {
+		opts = append(opts, installer.WithCurrentPlatformOnly())
+	}
+
+	if repoToken := c.String("repo-token"); repoToken != "" {
+		opts = append(opts, installer.WithRepoToken(c.PluginRepoURL(), repoToken))
+	}
+
+	if c.Bool("best-effort") {
+		opts = append(opts, installer.WithBestEffort())
+	}
+
+	var log installer.Logger = services.Logger
+	if c.String("output") == "json" || (c.Bool("progress") && c.String("plugins-file") != "") {
+		log = stderrLogger{}
+	}
+
+	grafanaVersion := services.GrafanaVersion
+	if targetVersion := c.String("grafana-version"); targetVersion != "" {
+		if _, err := semver.NewVersion(targetVersion); err != nil {
+			return nil, nil, fmt.Errorf("invalid --grafana-version %q: %w", targetVersion, err)
+		}
+		grafanaVersion = targetVersion
+	}
+
+	return installer.New(skipTLSVerify, grafanaVersion, log, opts...), lockfile, nil
+}
+
+// stderrLogger keeps stdout free for the JSON output or the install progress by only logging warnings and errors, to stderr.
+type stderrLogger struct{}
+
+func (stderrLogger) Successf(_ string, _ ...interface{}) {}
+func (stderrLogger) Failuref(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+func (stderrLogger) Info(_ ...interface{})             {}
+func (stderrLogger) Infof(_ string, _ ...interface{})  {}
+func (stderrLogger) Debug(_ ...interface{})            {}
+func (stderrLogger) Debugf(_ string, _ ...interface{}) {}
+func (stderrLogger) Warn(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+}
+func (stderrLogger) Warnf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+func (stderrLogger) Error(args ...interface{}) {
+	fmt.Fprintln(os.Stderr, args...)
+}
+func (stderrLogger) Errorf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// readArchiveSignature reads the public key the archive of the plugin must be signed with.
+// It returns nil if no signature is set.
+func readArchiveSignature(c utils.CommandLine, pluginID string) (*installer.ArchiveSignature, error) {
+	signatureURL, signatureFile := c.String("signature-url"), c.String("signature-file")
+	if signatureURL == "" && signatureFile == "" {
+		return nil, nil
+	}
+	if signatureURL != "" && signatureFile != "" {
+		return nil, errors.New("only one of --signature-url and --signature-file can be set")
+	}
+
+	publicKeyPath := c.String("signature-key")
+	if publicKeyPath == "" {
+		return nil, errors.New("--signature-key is required to verify the archive signature")
+	}
+
+	return installer.NewArchiveSignature(pluginID, publicKeyPath, signatureURL, signatureFile)
+}
+
+// readPolicy reads the plugin install policy from the policy file, and adds the plugins allowed and denied by flags.
+// It returns nil if no policy is set.
+func readPolicy(c utils.CommandLine) (*installer.Policy, error) {
+	policy := &installer.Policy{}
+	if policyPath := c.String("policy"); policyPath != "" {
+		var err error
+		if policy, err = installer.ReadPolicy(policyPath); err != nil {
+			return nil, err
+		}
+	}
+	policy.Allow = append(policy.Allow, c.StringSlice("allow-plugin")...)
+	policy.Deny = append(policy.Deny, c.StringSlice("deny-plugin")...)
+
+	if len(policy.Allow) == 0 && len(policy.Deny) == 0 {
+		return nil, nil
+	}
+	return policy, nil
 }
 
 func osAndArchString() string {
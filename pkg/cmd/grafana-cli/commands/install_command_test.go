@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/commands/commandstest"
+	"github.com/grafana/grafana/pkg/plugins/manager/installer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPluginsFile(t *testing.T) {
+	expected := []pluginsFileEntry{
+		{ID: "grafana-clock-panel"},
+		{ID: "grafana-piechart-panel", Version: "1.6.2"},
+	}
+
+	tests := []struct {
+		description string
+		content     string
+	}{
+		{
+			description: "newline delimited",
+			content:     "# dashboards\ngrafana-clock-panel\n\n  grafana-piechart-panel@1.6.2  \n",
+		},
+		{
+			description: "JSON array",
+			content:     `["grafana-clock-panel", "grafana-piechart-panel@1.6.2"]`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "plugins.txt")
+			err := ioutil.WriteFile(path, []byte(tc.content), 0600)
+			require.NoError(t, err)
+
+			entries, err := readPluginsFile(path)
+			require.NoError(t, err)
+			require.Equal(t, expected, entries)
+		})
+	}
+}
+
+func TestNewInstaller(t *testing.T) {
+	t.Run("Should accept a semver Grafana version", func(t *testing.T) {
+		c, err := commandstest.NewCliContext(map[string]string{"grafana-version": "9.1.0"})
+		require.NoError(t, err)
+
+		_, _, err = newInstaller(c)
+		require.NoError(t, err)
+	})
+
+	t.Run("Should reject an invalid Grafana version", func(t *testing.T) {
+		c, err := commandstest.NewCliContext(map[string]string{"grafana-version": "latest"})
+		require.NoError(t, err)
+
+		i, _, err := newInstaller(c)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `invalid --grafana-version "latest"`)
+		require.Nil(t, i)
+	})
+}
+
+func TestNewInstallOutput(t *testing.T) {
+	report := &installer.InstallReport{Plugins: []installer.ReportedPlugin{
+		{ID: "main-app", Version: "1.0.0", Dir: "/plugins/main-app", SHA256: "abc"},
+		{ID: "test-app", Version: "2.0.0", Dir: "/plugins/test-app", SHA256: "def"},
+	}}
+
+	t.Run("Should split the installed plugin from its dependencies", func(t *testing.T) {
+		out := newInstallOutput("main-app", report, nil)
+		require.Equal(t, installOutput{
+			PluginID:     "main-app",
+			Version:      "1.0.0",
+			Dir:          "/plugins/main-app",
+			SHA256:       "abc",
+			Dependencies: []installer.ReportedPlugin{report.Plugins[1]},
+		}, out)
+	})
+
+	t.Run("Should report the failed dependencies", func(t *testing.T) {
+		err := installer.ErrDependenciesFailed{PluginID: "main-app", Failed: []installer.FailedDependency{
+			{ID: "missing-app", Version: "1.0.0", Err: errors.New("not found")},
+		}}
+		out := newInstallOutput("main-app", report, err)
+		require.Equal(t, err.Error(), out.Error)
+		require.Equal(t, []failedDependencyOutput{{ID: "missing-app", Version: "1.0.0", Error: "not found"}}, out.FailedDependencies)
+	})
+
+	t.Run("Should report an error when nothing was installed", func(t *testing.T) {
+		out := newInstallOutput("main-app", &installer.InstallReport{}, errors.New("failed"))
+		require.Equal(t, installOutput{PluginID: "main-app", Dependencies: []installer.ReportedPlugin{}, Error: "failed"}, out)
+	})
+}
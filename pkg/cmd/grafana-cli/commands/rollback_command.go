@@ -0,0 +1,26 @@
+package commands
+
+import (
+	"errors"
+
+	"github.com/fatih/color"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/logger"
+	"github.com/grafana/grafana/pkg/cmd/grafana-cli/utils"
+	"github.com/grafana/grafana/pkg/plugins/manager/installer"
+)
+
+// rollbackCommand points a plugin installed with --versioned back to the version it had before the last install.
+func (cmd Command) rollbackCommand(c utils.CommandLine) error {
+	pluginID := c.Args().First()
+	if pluginID == "" {
+		return errors.New("missing plugin parameter")
+	}
+
+	version, err := installer.Rollback(c.PluginDirectory(), pluginID)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("%s %s rolled back to v%s\n", color.GreenString("✔"), pluginID, version)
+	return nil
+}
@@ -177,6 +177,9 @@ func createRequest(repoUrl string, subPaths ...string) (*http.Request, error) {
 	req.Header.Set("grafana-os", runtime.GOOS)
 	req.Header.Set("grafana-arch", runtime.GOARCH)
 	req.Header.Set("User-Agent", "grafana "+GrafanaVersion)
+	if repoToken != "" && u.Scheme == repoURL.Scheme && u.Host == repoURL.Host {
+		req.Header.Set("Authorization", "Bearer "+repoToken)
+	}
 
 	return req, err
 }
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"time"
 
@@ -21,6 +22,9 @@ var (
 	GrafanaVersion      string
 	ErrNotFoundError    = errors.New("404 not found error")
 	Logger              *logger.CLILogger
+	// repoToken is only sent to repoURL's host
+	repoToken string
+	repoURL   *url.URL
 )
 
 type BadRequestError struct {
@@ -43,6 +47,20 @@ func Init(version string, skipTLSVerify bool, debugMode bool) {
 	Logger = logger.New(debugMode)
 }
 
+// SetRepoToken makes requests to the host of the plugin repository authenticate with the token.
+func SetRepoToken(repo, token string) error {
+	if token == "" {
+		return nil
+	}
+
+	u, err := url.Parse(repo)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("can't use a repository token with the repository URL %q", repo)
+	}
+	repoURL, repoToken = u, token
+	return nil
+}
+
 func makeHttpClient(skipTLSVerify bool, timeout time.Duration) http.Client {
 	tr := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -11,3 +11,5 @@ const (
 )
 
 const LibraryElementConnectionTableName = "library_element_connection"
+const LibraryElementTagTableName = "library_element_tag"
+const LibraryElementVersionTableName = "library_element_version"
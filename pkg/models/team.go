@@ -3,6 +3,8 @@ package models
 import (
 	"errors"
 	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
 )
 
 // Typed errors
@@ -13,6 +15,16 @@ var (
 	ErrLastTeamAdmin                        = errors.New("not allowed to remove last admin")
 	ErrNotAllowedToUpdateTeam               = errors.New("user not allowed to update team")
 	ErrNotAllowedToUpdateTeamInDifferentOrg = errors.New("user not allowed to update team in another org")
+	ErrTeamMergeIntoItself                  = errors.New("not allowed to merge a team into itself")
+	ErrInvalidFolderPermission              = errors.New("folder permission must be View, Edit or Admin")
+	ErrTeamMemberNotAdmin                   = errors.New("team member is not an admin")
+	ErrInvalidTimeRange                     = errors.New("start of time range must not be after its end")
+	ErrInvalidTeamNamePattern               = errors.New("team name pattern is not a valid regular expression")
+	ErrInvalidTeamSort                      = errors.New("invalid team sort")
+	ErrTeamNotOpenJoin                      = errors.New("team does not allow users to join by themselves")
+	ErrOrgTeamLimitReached                  = errors.New("maximum number of teams in the organization reached")
+	ErrTeamAdminLimitExceeded               = errors.New("maximum number of team admins exceeded")
+	ErrInvalidTeamLabel                     = errors.New("invalid team label")
 )
 
 // Team model
@@ -21,11 +33,128 @@ type Team struct {
 	OrgId int64  `json:"orgId"`
 	Name  string `json:"name"`
 	Email string `json:"email"`
+	// Settings holds team-level configuration, such as the alert notification throttling of the team
+	Settings *simplejson.Json `json:"settings,omitempty"`
+	// OpenJoin allows users to join the team by themselves
+	OpenJoin bool `json:"openJoin"`
 
 	Created time.Time `json:"created"`
 	Updated time.Time `json:"updated"`
 }
 
+// TeamLabel is a key/value pair attached to a team, used to select teams for bulk operations
+type TeamLabel struct {
+	Id     int64
+	OrgId  int64
+	TeamId int64
+	Key    string
+	Value  string
+}
+
+// TeamSnapshot is a point-in-time copy of a team and everything attached to it, for backups
+// Members and permissions carry the user logins and dashboard UIDs along with the IDs, so that the team can be restored
+// on another instance where the IDs differ
+type TeamSnapshot struct {
+	Team        Team                      `json:"team"`
+	Members     []*TeamSnapshotMember     `json:"members"`
+	Labels      map[string]string         `json:"labels"`
+	Permissions []*TeamSnapshotPermission `json:"permissions"`
+	TakenAt     time.Time                 `json:"takenAt"`
+}
+
+// TeamSnapshotMember is a membership of a TeamSnapshot
+type TeamSnapshotMember struct {
+	UserId     int64          `json:"userId"`
+	Login      string         `json:"login"`
+	Email      string         `json:"email"`
+	External   bool           `json:"external"`
+	Permission PermissionType `json:"permission"`
+	ExpiresAt  *time.Time     `json:"expiresAt,omitempty"`
+}
+
+// TeamSnapshotPermission is a dashboard or folder permission of a TeamSnapshot
+type TeamSnapshotPermission struct {
+	DashboardId  int64          `json:"dashboardId"`
+	DashboardUid string         `json:"dashboardUid"`
+	IsFolder     bool           `json:"isFolder"`
+	Permission   PermissionType `json:"permission"`
+}
+
+// TeamTombstone records a deleted team so that external systems can mirror the deletion
+type TeamTombstone struct {
+	Id        int64     `json:"id"`
+	OrgId     int64     `json:"orgId"`
+	TeamId    int64     `json:"teamId"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// TeamMemberRemoved is the action of a team member history entry recording a removal
+const TeamMemberRemoved = "removed"
+
+// TeamMemberHistory records a change to the members of a team
+type TeamMemberHistory struct {
+	Id     int64
+	OrgId  int64
+	TeamId int64
+	UserId int64
+	Action string
+	// ActorId is the user who made the change, or 0 if it's unknown
+	ActorId int64
+	Created time.Time
+}
+
+// TeamMemberRemoval is a team a user was removed from, and who removed them
+type TeamMemberRemoval struct {
+	TeamId int64 `json:"teamId"`
+	// TeamName is empty if the team has been deleted since
+	TeamName string `json:"teamName"`
+	// ActorId is the user who removed the member, or 0 if it's unknown
+	ActorId    int64     `json:"actorId"`
+	ActorLogin string    `json:"actorLogin"`
+	RemovedAt  time.Time `json:"removedAt"`
+}
+
+// MergeTeamsResult summarizes the members of the source team after a merge
+type MergeTeamsResult struct {
+	MembersMoved          int64 `json:"membersMoved"`
+	MembersAlreadyPresent int64 `json:"membersAlreadyPresent"`
+}
+
+// FolderPermission grants a team a permission on a folder
+type FolderPermission struct {
+	FolderID   int64          `json:"folderId" xorm:"folder_id"`
+	Permission PermissionType `json:"permission"`
+	// FolderUID and FolderTitle are only set when reading the permissions of a team
+	FolderUID   string `json:"folderUid,omitempty" xorm:"folder_uid"`
+	FolderTitle string `json:"folderTitle,omitempty"`
+}
+
+// TeamStats aggregates the teams of an org
+type TeamStats struct {
+	TeamCount         int64   `json:"teamCount"`
+	TotalMemberships  int64   `json:"totalMemberships"`
+	AverageTeamSize   float64 `json:"averageTeamSize"`
+	MaxTeamSize       int64   `json:"maxTeamSize"`
+	EmptyTeams        int64   `json:"emptyTeams"`
+	TeamsWithoutAdmin int64   `json:"teamsWithoutAdmin"`
+}
+
+// TeamConsistencyReport lists the problems found in the team data of an org
+type TeamConsistencyReport struct {
+	// Stats are the team statistics of the org, including the number of teams without any member or without an admin
+	Stats *TeamStats `json:"stats"`
+	// OrphanedMembers are the team memberships whose user no longer exists
+	OrphanedMembers []TeamMember `json:"orphanedMembers"`
+	// DuplicateNames groups the teams whose names only differ by case, keyed by the lowercased name
+	DuplicateNames map[string][]*TeamDTO `json:"duplicateNames"`
+}
+
+// IsConsistent reports whether no problem was found
+func (r *TeamConsistencyReport) IsConsistent() bool {
+	return r.Stats.EmptyTeams == 0 && r.Stats.TeamsWithoutAdmin == 0 && len(r.OrphanedMembers) == 0 && len(r.DuplicateNames) == 0
+}
+
 // ---------------------
 // COMMANDS
 
@@ -33,6 +162,8 @@ type CreateTeamCommand struct {
 	Name  string `json:"name" binding:"Required"`
 	Email string `json:"email"`
 	OrgId int64  `json:"-"`
+	// GrantFolderAccess lists folders the team is granted access to when it's created
+	GrantFolderAccess []FolderPermission `json:"grantFolderAccess"`
 
 	Result Team `json:"-"`
 }
@@ -56,8 +187,16 @@ type GetTeamByIdQuery struct {
 	HiddenUsers  map[string]struct{}
 	Result       *TeamDTO
 	UserIdFilter int64
+	// WithSettings includes the settings of the team in the result
+	WithSettings bool
 }
 
+// DefaultTeamPrefixSearchLimit is the number of teams returned by a prefix search when no limit is set
+const DefaultTeamPrefixSearchLimit = 10
+
+// TeamSortAclCountDesc sorts teams by the number of dashboard and folder permissions granted to them, most first
+const TeamSortAclCountDesc = "aclcount-desc"
+
 // FilterIgnoreUser is used in a get / search teams query when the caller does not want to filter teams by user ID / membership
 const FilterIgnoreUser int64 = 0
 
@@ -69,12 +208,20 @@ type GetTeamsByUserQuery struct {
 }
 
 type SearchTeamsQuery struct {
-	Query        string
+	Query string
+	// PrefixQuery matches Query as a prefix of the team name instead of a substring, with exact matches first
+	PrefixQuery  bool
 	Name         string
 	Limit        int
 	Page         int
 	OrgId        int64
 	UserIdFilter int64
+	// ExcludeUserIdMemberships excludes teams the given user is already a member of
+	ExcludeUserIdMemberships int64
+	// StaleExternalBefore only includes teams with external members, none of which were synced after the bound
+	StaleExternalBefore *time.Time
+	// SortBy orders the teams by TeamSortAclCountDesc instead of by name, and sets their AclCount
+	SortBy       string
 	SignedInUser *SignedInUser
 	HiddenUsers  map[string]struct{}
 
@@ -82,14 +229,16 @@ type SearchTeamsQuery struct {
 }
 
 type TeamDTO struct {
-	Id            int64           `json:"id"`
-	OrgId         int64           `json:"orgId"`
-	Name          string          `json:"name"`
-	Email         string          `json:"email"`
-	AvatarUrl     string          `json:"avatarUrl"`
-	MemberCount   int64           `json:"memberCount"`
-	Permission    PermissionType  `json:"permission"`
-	AccessControl map[string]bool `json:"accessControl"`
+	Id            int64            `json:"id"`
+	OrgId         int64            `json:"orgId"`
+	Name          string           `json:"name"`
+	Email         string           `json:"email"`
+	AvatarUrl     string           `json:"avatarUrl"`
+	MemberCount   int64            `json:"memberCount"`
+	AclCount      int64            `json:"aclCount,omitempty"`
+	Permission    PermissionType   `json:"permission"`
+	AccessControl map[string]bool  `json:"accessControl"`
+	Settings      *simplejson.Json `json:"settings,omitempty"`
 }
 
 type SearchTeamQueryResult struct {
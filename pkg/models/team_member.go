@@ -18,11 +18,21 @@ type TeamMember struct {
 	UserId     int64
 	External   bool // Signals that the membership has been created by an external systems, such as LDAP
 	Permission PermissionType
+	CreatedBy  int64      // The user that added the member, zero if unknown
+	ExpiresAt  *time.Time // The membership is removed once expired, nil if it never expires
+	// ExternalSynced is the last time the membership was synced from the external system, nil for internal members
+	ExternalSynced *time.Time
 
 	Created time.Time
 	Updated time.Time
 }
 
+// TeamUserPair identifies a potential membership of a user in a team
+type TeamUserPair struct {
+	TeamId int64
+	UserId int64
+}
+
 // ---------------------
 // COMMANDS
 
@@ -32,6 +42,7 @@ type AddTeamMemberCommand struct {
 	TeamId     int64          `json:"-"`
 	External   bool           `json:"-"`
 	Permission PermissionType `json:"-"`
+	ExpiresAt  *time.Time     `json:"expiresAt"`
 }
 
 type UpdateTeamMemberCommand struct {
@@ -39,29 +50,54 @@ type UpdateTeamMemberCommand struct {
 	OrgId      int64          `json:"-"`
 	TeamId     int64          `json:"-"`
 	Permission PermissionType `json:"permission"`
+	// ExpiresAt changes when the membership expires, the expiry is kept if not set
+	ExpiresAt *time.Time `json:"expiresAt"`
 }
 
 type RemoveTeamMemberCommand struct {
 	OrgId  int64 `json:"-"`
 	UserId int64
 	TeamId int64
+	// ActorId is the user removing the member, recorded in the team member history
+	ActorId int64 `json:"-"`
 }
 
 // ----------------------
 // QUERIES
 
 type GetTeamMembersQuery struct {
-	OrgId        int64
-	TeamId       int64
-	UserId       int64
-	External     bool
+	OrgId    int64
+	TeamId   int64
+	UserId   int64
+	External bool
+	Query    string
+	// WithOrgAdmin sets IsOrgAdmin on the members, which joins the org users
+	WithOrgAdmin bool
+	// Limit is the size of the pages of GetTeamMembers and GetTeamMembersAfter, all members are returned if it's not set
+	Limit int
+	// Page is the page of GetTeamMembers to return when Limit is set, starting at 1
+	Page         int
 	SignedInUser *SignedInUser
 	Result       []*TeamMemberDTO
+	// TotalCount is the number of members matching the query, across all pages
+	TotalCount int64
 }
 
 // ----------------------
 // Projections and DTOs
 
+// TeamMembershipExport is a membership of a team, along with the names needed to export it
+type TeamMembershipExport struct {
+	TeamId     int64          `json:"teamId"`
+	TeamName   string         `json:"teamName"`
+	UserId     int64          `json:"userId"`
+	Login      string         `json:"login"`
+	Email      string         `json:"email"`
+	Name       string         `json:"name"`
+	External   bool           `json:"external"`
+	Permission PermissionType `json:"permission"`
+}
+
 type TeamMemberDTO struct {
 	OrgId      int64          `json:"orgId"`
 	TeamId     int64          `json:"teamId"`
@@ -74,4 +110,9 @@ type TeamMemberDTO struct {
 	AvatarUrl  string         `json:"avatarUrl"`
 	Labels     []string       `json:"labels"`
 	Permission PermissionType `json:"permission"`
+	ExpiresAt  *time.Time     `json:"expiresAt,omitempty"`
+	// IsOrgAdmin is only set when requested by GetTeamMembersQuery.WithOrgAdmin
+	IsOrgAdmin bool `json:"isOrgAdmin,omitempty"`
+	// OrgRole is the role of the member in the org of the team, used to set IsOrgAdmin
+	OrgRole RoleType `json:"-" xorm:"'role'"`
 }
@@ -0,0 +1,61 @@
+package installer
+
+import (
+	"sync"
+)
+
+const (
+	// maxArchiveCacheSize is the upper bound (in bytes) of plugin archives kept in memory during a single install.
+	maxArchiveCacheSize = 256 << 20
+)
+
+// archiveCache keeps downloaded plugin archives in memory, keyed by plugin ID and version,
+// so that dependencies shared by several plugins are only downloaded once per install.
+type archiveCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	size    int
+}
+
+func archiveCacheKey(pluginID, version string) string {
+	return pluginID + "@" + version
+}
+
+func (c *archiveCache) get(pluginID, version string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, exists := c.entries[archiveCacheKey(pluginID, version)]
+	return data, exists
+}
+
+// add stores the archive unless doing so would exceed maxArchiveCacheSize.
+func (c *archiveCache) add(pluginID, version string, data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := archiveCacheKey(pluginID, version)
+	if _, exists := c.entries[key]; exists {
+		return true
+	}
+
+	if c.size+len(data) > maxArchiveCacheSize {
+		return false
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[string][]byte)
+	}
+	c.entries[key] = data
+	c.size += len(data)
+
+	return true
+}
+
+func (c *archiveCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = nil
+	c.size = 0
+}
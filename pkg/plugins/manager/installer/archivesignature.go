@@ -0,0 +1,127 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// ArchiveSignature is a detached GPG signature the archive of a plugin is verified against before it's extracted.
+// The signature is read from File if it's set, or downloaded from URL otherwise.
+type ArchiveSignature struct {
+	PluginID string
+	URL      string
+	File     string
+	keyring  openpgp.EntityList
+	// keyName identifies the public key in errors
+	keyName string
+}
+
+type ErrArchiveSignatureInvalid struct {
+	PluginID string
+	Key      string
+	Err      error
+}
+
+func (e ErrArchiveSignatureInvalid) Error() string {
+	return fmt.Sprintf("archive of %s is not signed by %s: %v", e.PluginID, e.Key, e.Err)
+}
+
+func (e ErrArchiveSignatureInvalid) Unwrap() error {
+	return e.Err
+}
+
+// NewArchiveSignature reads the armored public key at publicKeyPath that the archive of the plugin must be signed with.
+func NewArchiveSignature(pluginID, publicKeyPath, signatureURL, signatureFile string) (*ArchiveSignature, error) {
+	// We can ignore the gosec G304 warning since the path stems from the command line flag "signature-key"
+	// nolint:gosec
+	data, err := ioutil.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to read signature public key", err)
+	}
+
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to parse signature public key", err)
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("no public key found in %s", publicKeyPath)
+	}
+
+	return &ArchiveSignature{
+		PluginID: pluginID,
+		URL:      signatureURL,
+		File:     signatureFile,
+		keyring:  keyring,
+		keyName:  keyName(keyring[0]),
+	}, nil
+}
+
+// WithArchiveSignature makes the Installer refuse to install the plugin of the signature if its archive isn't signed
+// with the public key of the signature. The dependencies of the plugin are not verified.
+func WithArchiveSignature(signature *ArchiveSignature) Option {
+	return func(i *Installer) {
+		i.archiveSignature = signature
+	}
+}
+
+// verifyArchiveSignature returns an ErrArchiveSignatureInvalid if the archive doesn't match the detached signature.
+func (i *Installer) verifyArchiveSignature(archiveFile string) error {
+	s := i.archiveSignature
+	signature, err := i.readArchiveSignature()
+	if err != nil {
+		return fmt.Errorf("%v: %w", "failed to read archive signature", err)
+	}
+
+	// We can ignore the gosec G304 warning since the archive is the temporary file we just downloaded to
+	// nolint:gosec
+	archive, err := os.Open(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := archive.Close(); err != nil {
+			i.log.Warn("Failed to close file", "err", err)
+		}
+	}()
+
+	if bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(s.keyring, archive, bytes.NewReader(signature))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(s.keyring, archive, bytes.NewReader(signature))
+	}
+	if err != nil {
+		return ErrArchiveSignatureInvalid{PluginID: s.PluginID, Key: s.keyName, Err: err}
+	}
+
+	i.log.Debugf("Verified the archive signature of %s with %s", s.PluginID, s.keyName)
+	return nil
+}
+
+func (i *Installer) readArchiveSignature() ([]byte, error) {
+	if i.archiveSignature.File != "" {
+		// We can ignore the gosec G304 warning since the path stems from the command line flag "signature-file"
+		// nolint:gosec
+		return ioutil.ReadFile(i.archiveSignature.File)
+	}
+
+	return i.sendRequestGetBytes(i.archiveSignature.URL)
+}
+
+// keyName returns the alphabetically first identity of the key along with its ID.
+func keyName(entity *openpgp.Entity) string {
+	names := make([]string, 0, len(entity.Identities))
+	for name := range entity.Identities {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return entity.PrimaryKey.KeyIdString()
+	}
+
+	sort.Strings(names)
+	return fmt.Sprintf("%s (%s)", names[0], entity.PrimaryKey.KeyIdString())
+}
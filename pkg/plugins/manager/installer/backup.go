@@ -0,0 +1,69 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// backupMarker separates the plugin ID from the time of the backup in the name of a backup directory.
+	backupMarker = ".bak-"
+	// backupTimeFormat sorts backups from oldest to newest by name.
+	backupTimeFormat = "20060102T150405.000000000"
+)
+
+// WithBackupExisting makes the Installer move an installed plugin to a plugin-id.bak-<timestamp> directory
+// next to it instead of deleting it when the plugin is replaced, so that a failed upgrade can be restored by hand.
+// Only the keep most recent backups of a plugin are kept, or all of them if keep isn't positive.
+// Plugins installed in versioned mode aren't backed up, since their previous version is kept anyway.
+func WithBackupExisting(keep int) Option {
+	return func(i *Installer) {
+		i.backupExisting = true
+		i.backupKeep = keep
+	}
+}
+
+// backupPlugin moves the plugin directory to a new backup directory and removes the backups beyond the ones to keep.
+// Plugins that aren't installed yet have nothing to back up.
+func (i *Installer) backupPlugin(pluginsDir, pluginID string) error {
+	pluginDir := filepath.Join(pluginsDir, pluginID)
+	if _, err := os.Stat(pluginDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	backupDir := filepath.Join(pluginsDir, pluginID+backupMarker+time.Now().UTC().Format(backupTimeFormat))
+	if err := os.Rename(pluginDir, backupDir); err != nil {
+		return fmt.Errorf("%v: %w", "failed to back up installed plugin", err)
+	}
+	i.log.Infof("Backed up the installed %s to %s", pluginID, backupDir)
+
+	return i.pruneBackups(pluginsDir, pluginID)
+}
+
+// pruneBackups removes the oldest backups of the plugin beyond the ones to keep.
+func (i *Installer) pruneBackups(pluginsDir, pluginID string) error {
+	if i.backupKeep <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(filepath.Join(pluginsDir, pluginID+backupMarker+"*"))
+	if err != nil {
+		return err
+	}
+	if len(backups) <= i.backupKeep {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-i.backupKeep] {
+		i.log.Debugf("Removing old backup %s", backup)
+		if err := os.RemoveAll(backup); err != nil {
+			i.log.Warn("Failed to remove old backup", "backup", backup, "err", err)
+		}
+	}
+
+	return nil
+}
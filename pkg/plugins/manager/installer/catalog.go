@@ -0,0 +1,65 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Catalog lists the plugins approved for installation along with where to download them from.
+// When a catalog is used, plugins are resolved against it instead of the plugin repository,
+// and plugins that are not in the catalog can't be installed.
+type Catalog struct {
+	// Plugins maps plugin IDs to their available versions, newest version first.
+	Plugins map[string][]CatalogVersion `json:"plugins"`
+}
+
+type CatalogVersion struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+type ErrNotInCatalog struct {
+	PluginID         string
+	RequestedVersion string
+}
+
+func (e ErrNotInCatalog) Error() string {
+	if e.RequestedVersion != "" {
+		return fmt.Sprintf("%s v%s is not in the catalog", e.PluginID, e.RequestedVersion)
+	}
+	return fmt.Sprintf("%s is not in the catalog", e.PluginID)
+}
+
+// ReadCatalog reads the catalog at the provided path.
+func ReadCatalog(path string) (*Catalog, error) {
+	// We can ignore the gosec G304 warning since the path stems from the command line flag "catalog"
+	// nolint:gosec
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to read catalog", err)
+	}
+
+	catalog := &Catalog{}
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to parse catalog", err)
+	}
+
+	return catalog, nil
+}
+
+// resolve returns the version, download URL and checksum of the requested plugin version in the catalog,
+// or of the newest cataloged version if no version is requested.
+func (c *Catalog) resolve(pluginID, version string) (string, string, string, error) {
+	for _, v := range c.Plugins[pluginID] {
+		if version == "" || normalizeVersion(v.Version) == normalizeVersion(version) {
+			if v.URL == "" {
+				return "", "", "", fmt.Errorf("catalog entry for %s v%s has no download URL", pluginID, v.Version)
+			}
+			return v.Version, v.URL, v.SHA256, nil
+		}
+	}
+
+	return "", "", "", ErrNotInCatalog{PluginID: pluginID, RequestedVersion: version}
+}
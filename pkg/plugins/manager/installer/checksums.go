@@ -0,0 +1,105 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// ChecksumManifest lists the expected SHA256 checksums of plugin archives, so that the archive of the plugin
+// and of each of its dependencies can be verified, whatever they are downloaded from.
+type ChecksumManifest struct {
+	// Plugins maps plugin IDs to the checksums of their versions.
+	Plugins map[string]map[string]string `json:"plugins"`
+}
+
+type ErrChecksumMismatch struct {
+	PluginID string
+	Version  string
+	Expected string
+	Actual   string
+}
+
+func (e ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("SHA256 checksum %s of the archive of %s v%s does not match the checksum %s in the checksum manifest",
+		e.Actual, e.PluginID, e.Version, e.Expected)
+}
+
+type ErrChecksumMissing struct {
+	PluginID string
+	Version  string
+}
+
+func (e ErrChecksumMissing) Error() string {
+	if e.Version == "" {
+		return fmt.Sprintf("%s has no version to look up in the checksum manifest", e.PluginID)
+	}
+	return fmt.Sprintf("%s v%s is not in the checksum manifest", e.PluginID, e.Version)
+}
+
+// ReadChecksumManifest reads the checksum manifest at the provided path.
+func ReadChecksumManifest(path string) (*ChecksumManifest, error) {
+	// We can ignore the gosec G304 warning since the path stems from the command line flag "checksums"
+	// nolint:gosec
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to read checksum manifest", err)
+	}
+
+	manifest := &ChecksumManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to parse checksum manifest", err)
+	}
+
+	return manifest, nil
+}
+
+// WithChecksumManifest makes the Installer verify the archive of the plugin and of each of its dependencies
+// against the checksum manifest. If strict is set, archives that are not in the manifest can't be installed either.
+func WithChecksumManifest(manifest *ChecksumManifest, strict bool) Option {
+	return func(i *Installer) {
+		i.checksums = manifest
+		i.strictChecksums = strict
+	}
+}
+
+func (m *ChecksumManifest) get(pluginID, version string) (string, bool) {
+	if m == nil || version == "" {
+		return "", false
+	}
+
+	for v, checksum := range m.Plugins[pluginID] {
+		if normalizeVersion(v) == normalizeVersion(version) {
+			return strings.ToLower(checksum), true
+		}
+	}
+	return "", false
+}
+
+// verifyChecksum returns an ErrChecksumMismatch if the archive doesn't match the checksum manifest,
+// or an ErrChecksumMissing if the archive isn't in the manifest and checksums are strict.
+func (i *Installer) verifyChecksum(archiveFile, pluginID, version string) error {
+	if i.checksums == nil {
+		return nil
+	}
+
+	expected, exists := i.checksums.get(pluginID, version)
+	if !exists {
+		if i.strictChecksums {
+			return ErrChecksumMissing{PluginID: pluginID, Version: version}
+		}
+		i.log.Debugf("Not verifying the archive of %s v%s since it is not in the checksum manifest", pluginID, version)
+		return nil
+	}
+
+	actual, err := fileSHA256(archiveFile)
+	if err != nil {
+		return fmt.Errorf("%v: %w", "failed to compute SHA256 checksum", err)
+	}
+	if actual != expected {
+		return ErrChecksumMismatch{PluginID: pluginID, Version: version, Expected: expected, Actual: actual}
+	}
+
+	return nil
+}
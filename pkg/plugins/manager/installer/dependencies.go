@@ -0,0 +1,169 @@
+package installer
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DependencyNode is a plugin of a resolved dependency tree.
+type DependencyNode struct {
+	ID string
+	// RequiredVersion is the version required by the dependent plugin, or the requested version of the root plugin.
+	RequiredVersion string
+	// Version is the version that would be installed.
+	Version string
+	// InstalledVersion is the version that is currently installed, if any.
+	InstalledVersion string
+	// Cycle marks a plugin that is also one of its own dependents. Its dependencies are not walked again.
+	Cycle bool
+	// Err is set if the plugin could not be resolved.
+	Err          error
+	Dependencies []*DependencyNode
+}
+
+// DependencyTree resolves the plugin and its transitive dependencies the same way Install does, without installing them.
+// Dependencies that can't be resolved are reported on their node, so that the rest of the tree can still be shown.
+func (i *Installer) DependencyTree(ctx context.Context, pluginID, version, pluginsDir, pluginZipURL, pluginRepoURL string) (*DependencyNode, error) {
+	if !i.batch {
+		defer i.archives.clear()
+	}
+
+	root := i.resolveDependencyNode(ctx, pluginID, version, pluginsDir, pluginZipURL, pluginRepoURL, map[string]bool{})
+	if root.Err != nil {
+		return nil, root.Err
+	}
+
+	return root, nil
+}
+
+// resolveDependencyNode resolves the plugin and recursively its dependencies. The dependents maps the IDs of the
+// plugins on the path from the root, which is how cycles are detected.
+func (i *Installer) resolveDependencyNode(ctx context.Context, pluginID, version, pluginsDir, pluginZipURL, pluginRepoURL string, dependents map[string]bool) *DependencyNode {
+	node := &DependencyNode{
+		ID:               pluginID,
+		RequiredVersion:  version,
+		InstalledVersion: installedVersion(pluginsDir, pluginID),
+	}
+	if dependents[pluginID] {
+		node.Cycle = true
+		return node
+	}
+
+	fromRepo := pluginZipURL == ""
+	resolvedVersion, pluginZipURL, checksum, err := i.resolve(pluginID, version, pluginZipURL, pluginRepoURL)
+	if err != nil {
+		node.Err = err
+		return node
+	}
+	node.Version = resolvedVersion
+
+	archiveFile, err := i.downloadArchive(pluginID, resolvedVersion, pluginZipURL, checksum, fromRepo)
+	if err != nil {
+		node.Err = err
+		return node
+	}
+	defer func() {
+		if err := os.Remove(archiveFile); err != nil {
+			i.log.Warn("Failed to remove temporary file", "file", archiveFile, "err", err)
+		}
+	}()
+
+	plugin, err := readArchivePluginJSON(archiveFile)
+	if err != nil {
+		node.Err = err
+		return node
+	}
+	if plugin.ID != pluginID {
+		node.Err = ErrPluginMismatch{PluginID: pluginID, RequestedVersion: version, ActualID: plugin.ID, ActualVersion: plugin.Info.Version}
+		return node
+	}
+	if node.Version == "" {
+		node.Version = plugin.Info.Version
+	}
+
+	dependents[pluginID] = true
+	defer delete(dependents, pluginID)
+	for _, dep := range plugin.Dependencies.Plugins {
+		node.Dependencies = append(node.Dependencies,
+			i.resolveDependencyNode(ctx, dep.ID, normalizeVersion(dep.Version), pluginsDir, "", pluginRepoURL, dependents))
+	}
+
+	return node
+}
+
+// readArchivePluginJSON reads the plugin.json closest to the root of the archive, preferring the one in dist like toPluginDTO.
+func readArchivePluginJSON(archiveFile string) (InstalledPlugin, error) {
+	r, err := zip.OpenReader(archiveFile)
+	if err != nil {
+		return InstalledPlugin{}, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	var (
+		pluginJSON *zip.File
+		minDepth   int
+	)
+	for _, zf := range r.File {
+		name := path.Clean(zf.Name)
+		if path.Base(name) != "plugin.json" || zf.FileInfo().IsDir() {
+			continue
+		}
+
+		dir := path.Dir(name)
+		depth := strings.Count(name, "/")
+		if path.Base(dir) == "dist" {
+			// dist/plugin.json is at the same level as the plugin.json it's preferred to
+			depth--
+		}
+		if pluginJSON == nil || depth < minDepth || (depth == minDepth && path.Base(dir) == "dist") {
+			pluginJSON = zf
+			minDepth = depth
+		}
+	}
+	if pluginJSON == nil {
+		return InstalledPlugin{}, fmt.Errorf("could not find plugin.json in %s", archiveFile)
+	}
+
+	f, err := pluginJSON.Open()
+	if err != nil {
+		return InstalledPlugin{}, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return InstalledPlugin{}, err
+	}
+
+	res := InstalledPlugin{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return InstalledPlugin{}, fmt.Errorf("%v: %w", "failed to parse plugin.json", err)
+	}
+
+	return res, nil
+}
+
+// installedVersion returns the version of the plugin in the plugins directory, or an empty string if it's not installed.
+func installedVersion(pluginsDir, pluginID string) string {
+	pluginDir := filepath.Join(pluginsDir, pluginID)
+	res, err := toPluginDTO(pluginsDir, pluginID)
+	if IsVersioned(pluginDir) {
+		res, err = toPluginDTO(pluginDir, currentVersionLink)
+	}
+	if err != nil {
+		return ""
+	}
+
+	return res.Info.Version
+}
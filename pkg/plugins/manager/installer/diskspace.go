@@ -0,0 +1,107 @@
+package installer
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// unknownSizeFactor is the number of times the size of an archive that's assumed to be needed to extract it,
+// when the extracted size can't be read from the archive.
+const unknownSizeFactor = 3
+
+// errDiskSpaceUnknown is returned when the free disk space can't be determined on the platform.
+var errDiskSpaceUnknown = errors.New("free disk space can't be determined")
+
+type ErrInsufficientDiskSpace struct {
+	PluginID  string
+	Dir       string
+	Required  uint64
+	Available uint64
+}
+
+func (e ErrInsufficientDiskSpace) Error() string {
+	return fmt.Sprintf("insufficient disk space to install %s: %d bytes are required in %s, but only %d bytes are available",
+		e.PluginID, e.Required, e.Dir, e.Available)
+}
+
+// checkDiskSpace returns an ErrInsufficientDiskSpace if the plugins directory doesn't have enough free space
+// to extract the archive, so that the install fails before a partially extracted plugin is left behind.
+func (i *Installer) checkDiskSpace(archiveFile, pluginID, pluginsDir string) error {
+	required, err := requiredDiskSpace(archiveFile)
+	if err != nil {
+		return err
+	}
+
+	dir, err := existingDir(pluginsDir)
+	if err != nil {
+		return err
+	}
+	available, err := freeDiskSpace(dir)
+	if err != nil {
+		if errors.Is(err, errDiskSpaceUnknown) {
+			i.log.Debugf("Skipping disk space check for %s: %v", pluginID, err)
+			return nil
+		}
+		return fmt.Errorf("%v: %w", "failed to determine free disk space", err)
+	}
+
+	if available < required {
+		return ErrInsufficientDiskSpace{PluginID: pluginID, Dir: pluginsDir, Required: required, Available: available}
+	}
+
+	return nil
+}
+
+// requiredDiskSpace returns the size of the extracted files of the archive. If it can't be read from the archive,
+// it's estimated from the size of the archive.
+func requiredDiskSpace(archiveFile string) (uint64, error) {
+	fi, err := os.Stat(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+	estimate := uint64(fi.Size()) * unknownSizeFactor
+
+	r, err := zip.OpenReader(archiveFile)
+	if err != nil {
+		return estimate, nil
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	var size uint64
+	for _, zf := range r.File {
+		// an entry without an uncompressed size but with compressed data has an unknown size
+		if zf.UncompressedSize64 == 0 && zf.CompressedSize64 > 0 {
+			return estimate, nil
+		}
+		size += zf.UncompressedSize64
+	}
+
+	return size, nil
+}
+
+// existingDir returns the directory, or its closest parent that exists, since the plugins directory is only
+// created when the first plugin is extracted.
+func existingDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no parent of %s exists", dir)
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package installer
+
+// freeDiskSpace can't determine the free disk space on this platform.
+func freeDiskSpace(_ string) (uint64, error) {
+	return 0, errDiskSpaceUnknown
+}
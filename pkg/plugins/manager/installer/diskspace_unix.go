@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package installer
+
+import "syscall"
+
+// freeDiskSpace returns the number of bytes available to unprivileged users on the file system of the directory.
+func freeDiskSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+
+	// nolint:unconvert
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
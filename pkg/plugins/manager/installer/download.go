@@ -0,0 +1,152 @@
+package installer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxDownloadAttempts is the number of times the download of a plugin archive is attempted before giving up.
+const maxDownloadAttempts = 3
+
+// errDownloadInterrupted is returned when the download of a plugin archive broke off, and can be resumed.
+type errDownloadInterrupted struct {
+	err error
+}
+
+func (e errDownloadInterrupted) Error() string {
+	return fmt.Sprintf("download interrupted: %v", e.err)
+}
+
+func (e errDownloadInterrupted) Unwrap() error {
+	return e.err
+}
+
+// downloadResumable downloads the archive at the URL into tmpFile. If the download breaks off, it's resumed
+// from the last byte received with a range request, or restarted if the server doesn't support range requests.
+func (i *Installer) downloadResumable(tmpFile *os.File, url string) error {
+	var (
+		offset int64
+		size   int64 = -1
+		err    error
+	)
+	for attempt := 1; attempt <= maxDownloadAttempts; attempt++ {
+		offset, size, err = i.downloadFrom(tmpFile, url, offset, size)
+		if err == nil {
+			break
+		}
+
+		var interrupted errDownloadInterrupted
+		if !errors.As(err, &interrupted) {
+			return err
+		}
+		i.log.Debugf("Failed downloading %s after %d bytes, attempt %d of %d: %v", url, offset, attempt, maxDownloadAttempts, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if size >= 0 && offset != size {
+		return fmt.Errorf("downloaded %d bytes of the plugin archive, but expected %d", offset, size)
+	}
+
+	return nil
+}
+
+// downloadFrom downloads the archive at the URL into tmpFile from the offset. It returns the new offset, and the
+// size of the whole archive if it's known or -1 otherwise. Failures that the download can be resumed after are
+// returned as errDownloadInterrupted.
+func (i *Installer) downloadFrom(tmpFile *os.File, url string, offset, size int64) (int64, int64, error) {
+	req, err := i.createRequest(url)
+	if err != nil {
+		return offset, size, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	// Using no timeout here as some plugins can be bigger and smaller timeout would prevent to download a plugin on
+	// slow network. As this is CLI operation hanging is not a big of an issue as user can just abort.
+	res, err := i.httpClientNoTimeout.Do(req)
+	if err != nil {
+		return offset, size, errDownloadInterrupted{err: err}
+	}
+	if res.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		i.closeBody(res.Body)
+		return 0, -1, errDownloadInterrupted{err: fmt.Errorf("range from byte %d not satisfiable", offset)}
+	}
+	body, err := i.handleResponse(res)
+	if err != nil {
+		return offset, size, err
+	}
+	defer i.closeBody(body)
+
+	if res.StatusCode == http.StatusPartialContent {
+		start, total, ok := parseContentRange(res.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			return 0, -1, errDownloadInterrupted{err: fmt.Errorf("unexpected content range %q", res.Header.Get("Content-Range"))}
+		}
+		if total >= 0 {
+			size = total
+		}
+	} else {
+		if offset > 0 {
+			i.log.Debugf("Server doesn't support range requests, downloading %s from the start", url)
+		}
+		offset = 0
+		size = res.ContentLength
+	}
+
+	if err := tmpFile.Truncate(offset); err != nil {
+		return offset, size, err
+	}
+	if _, err := tmpFile.Seek(offset, io.SeekStart); err != nil {
+		return offset, size, err
+	}
+	n, err := io.Copy(tmpFile, body)
+	offset += n
+	if err != nil {
+		return offset, size, errDownloadInterrupted{err: err}
+	}
+
+	return offset, size, nil
+}
+
+func (i *Installer) closeBody(body io.Closer) {
+	if err := body.Close(); err != nil {
+		i.log.Warn("Failed to close body", "err", err)
+	}
+}
+
+// parseContentRange parses the first byte position and the complete length out of a Content-Range header
+// such as "bytes 100-199/1000". The complete length is -1 if it's unknown.
+func parseContentRange(contentRange string) (int64, int64, bool) {
+	if !strings.HasPrefix(contentRange, "bytes ") {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(contentRange, "bytes "), "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if parts[1] == "*" {
+		return start, -1, true
+	}
+	total, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return start, total, true
+}
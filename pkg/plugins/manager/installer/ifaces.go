@@ -14,6 +14,8 @@ type Service interface {
 	Uninstall(ctx context.Context, pluginDir string) error
 	// GetUpdateInfo provides update information for the requested plugin.
 	GetUpdateInfo(ctx context.Context, pluginID, version, pluginRepoURL string) (plugins.UpdateInfo, error)
+	// DependencyTree resolves the requested plugin and its transitive dependencies without installing them.
+	DependencyTree(ctx context.Context, pluginID, version, pluginsDir, pluginZipURL, pluginRepoURL string) (*DependencyNode, error)
 }
 
 type Logger interface {
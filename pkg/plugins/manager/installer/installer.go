@@ -2,7 +2,6 @@ package installer
 
 import (
 	"archive/zip"
-	"bufio"
 	"bytes"
 	"context"
 	"crypto/sha256"
@@ -20,19 +19,117 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver"
+
 	"github.com/grafana/grafana/pkg/plugins"
 )
 
 type Installer struct {
-	retryCount int
-
 	httpClient          http.Client
 	httpClientNoTimeout http.Client
 	grafanaVersion      string
 	log                 Logger
+	archives            archiveCache
+	lockfile            *Lockfile
+	report              *InstallReport
+	progress            *Progress
+	catalog             *Catalog
+	policy              *Policy
+	archiveSignature    *ArchiveSignature
+	checksums           *ChecksumManifest
+	strictChecksums     bool
+	batch               bool
+	versioned           bool
+	sandbox             bool
+	force               bool
+	forceDeps           bool
+	onlyCompatible      bool
+	currentPlatformOnly bool
+	bestEffort          bool
+	backupExisting      bool
+	// backupKeep is the number of backups kept per plugin, or 0 to keep them all
+	backupKeep int
+	// repoToken is only sent to repoURL's host
+	repoToken string
+	repoURL   *url.URL
+	// installed tracks the versions of the plugins installed so far in batch mode
+	installed map[string]string
+}
+
+// Option configures optional behaviour of the Installer.
+type Option func(*Installer)
+
+// WithLockfile makes the Installer install the plugin versions pinned in the lockfile,
+// and record the versions it resolves for plugins that are not pinned yet.
+func WithLockfile(lockfile *Lockfile) Option {
+	return func(i *Installer) {
+		i.lockfile = lockfile
+	}
+}
+
+// WithBatch makes the Installer keep downloaded archives and installed plugins across Install calls,
+// so that dependencies shared by several plugins of a batch are only installed once.
+func WithBatch() Option {
+	return func(i *Installer) {
+		i.batch = true
+		i.installed = map[string]string{}
+	}
+}
+
+// WithCatalog makes the Installer resolve plugins and their dependencies against the catalog
+// instead of the plugin repository, refusing to install plugins that are not in the catalog.
+func WithCatalog(catalog *Catalog) Option {
+	return func(i *Installer) {
+		i.catalog = catalog
+	}
+}
+
+// WithForce makes the Installer install plugin versions that don't support the running Grafana version or system.
+func WithForce() Option {
+	return func(i *Installer) {
+		i.force = true
+	}
+}
+
+// WithOnlyCompatible makes the Installer install the latest compatible version instead of a requested version
+// that doesn't support the running Grafana version or system.
+func WithOnlyCompatible() Option {
+	return func(i *Installer) {
+		i.onlyCompatible = true
+	}
+}
+
+// WithForceDeps makes the Installer download and extract dependencies even if the required version is already installed.
+func WithForceDeps() Option {
+	return func(i *Installer) {
+		i.forceDeps = true
+	}
+}
+
+// WithBestEffort makes the Installer keep the installed plugin when some of its dependencies fail to install.
+// The remaining dependencies are still installed, and the failed ones are reported by an ErrDependenciesFailed.
+func WithBestEffort() Option {
+	return func(i *Installer) {
+		i.bestEffort = true
+	}
+}
+
+// WithRepoToken makes the Installer authenticate to a private plugin repository with the token.
+// The token is only sent with requests to the host of the repository, and not to other hosts plugins are downloaded from.
+func WithRepoToken(repoURL, token string) Option {
+	return func(i *Installer) {
+		u, err := url.Parse(repoURL)
+		if err != nil || u.Host == "" {
+			i.log.Warnf("Ignoring the repository token since the repository URL %q can't be parsed", repoURL)
+			return
+		}
+		i.repoURL = u
+		i.repoToken = token
+	}
 }
 
 const (
@@ -69,6 +166,40 @@ func (e ErrVersionUnsupported) Error() string {
 	return fmt.Sprintf("%s v%s is not supported on your system (%s)", e.PluginID, e.RequestedVersion, e.SystemInfo)
 }
 
+type ErrNoCompatibleVersion struct {
+	PluginID         string
+	RequestedVersion string
+	SystemInfo       string
+	Available        []Version
+}
+
+func (e ErrNoCompatibleVersion) Error() string {
+	available := make([]string, 0, len(e.Available))
+	for _, v := range e.Available {
+		archs := make([]string, 0, len(v.Arch))
+		for arch := range v.Arch {
+			archs = append(archs, arch)
+		}
+		sort.Strings(archs)
+
+		var requirements []string
+		if v.GrafanaDependency != "" {
+			requirements = append(requirements, "Grafana "+v.GrafanaDependency)
+		}
+		requirements = append(requirements, archs...)
+		if len(requirements) == 0 {
+			requirements = append(requirements, "any")
+		}
+		available = append(available, fmt.Sprintf("%s (%s)", v.Version, strings.Join(requirements, ", ")))
+	}
+	if len(available) == 0 {
+		available = append(available, "none")
+	}
+
+	return fmt.Sprintf("no compatible version of %s found for your system (%s), available versions: %s",
+		e.PluginID, e.SystemInfo, strings.Join(available, "; "))
+}
+
 type ErrVersionNotFound struct {
 	PluginID         string
 	RequestedVersion string
@@ -79,100 +210,406 @@ func (e ErrVersionNotFound) Error() string {
 	return fmt.Sprintf("%s v%s either does not exist or is not supported on your system (%s)", e.PluginID, e.RequestedVersion, e.SystemInfo)
 }
 
-func New(skipTLSVerify bool, grafanaVersion string, logger Logger) Service {
-	return &Installer{
+type ErrPluginMismatch struct {
+	PluginID         string
+	RequestedVersion string
+	ActualID         string
+	ActualVersion    string
+}
+
+func (e ErrPluginMismatch) Error() string {
+	if e.PluginID != e.ActualID {
+		return fmt.Sprintf("archive for %s contains plugin %s", e.PluginID, e.ActualID)
+	}
+	return fmt.Sprintf("archive for %s v%s contains v%s", e.PluginID, e.RequestedVersion, e.ActualVersion)
+}
+
+// ErrDependenciesFailed is returned in best effort mode when a plugin was installed, but some of its dependencies were not.
+type ErrDependenciesFailed struct {
+	PluginID string
+	Failed   []FailedDependency
+}
+
+type FailedDependency struct {
+	ID      string
+	Version string
+	Err     error
+}
+
+func (e ErrDependenciesFailed) Error() string {
+	failed := make([]string, 0, len(e.Failed))
+	for _, dep := range e.Failed {
+		if dep.Version != "" {
+			failed = append(failed, fmt.Sprintf("%s v%s (%v)", dep.ID, dep.Version, dep.Err))
+		} else {
+			failed = append(failed, fmt.Sprintf("%s (%v)", dep.ID, dep.Err))
+		}
+	}
+	return fmt.Sprintf("%s was installed, but %d of its dependencies failed to install: %s", e.PluginID, len(e.Failed), strings.Join(failed, ", "))
+}
+
+func New(skipTLSVerify bool, grafanaVersion string, logger Logger, opts ...Option) Service {
+	i := &Installer{
 		httpClient:          makeHttpClient(skipTLSVerify, 10*time.Second),
 		httpClientNoTimeout: makeHttpClient(skipTLSVerify, 0),
 		log:                 logger,
 		grafanaVersion:      grafanaVersion,
 	}
+
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
 }
 
 // Install downloads the plugin code as a zip file from specified URL
 // and then extracts the zip into the provided plugins directory.
 func (i *Installer) Install(ctx context.Context, pluginID, version, pluginsDir, pluginZipURL, pluginRepoURL string) error {
-	var checksum string
-	if pluginZipURL == "" {
-		plugin, err := i.getPluginMetadataFromPluginRepo(pluginID, pluginRepoURL)
+	// archives are only cached for the duration of a single install, including its dependencies,
+	// unless a batch of plugins is installed
+	if !i.batch {
+		defer i.archives.clear()
+	}
+
+	err := i.install(ctx, pluginID, version, pluginsDir, pluginZipURL, pluginRepoURL)
+	// the plugin itself was installed if only its dependencies failed, which are reported on their own
+	var depErr ErrDependenciesFailed
+	if err != nil && !errors.As(err, &depErr) {
+		i.reportProgress(pluginID, ProgressFailed, err)
+	}
+
+	return err
+}
+
+func (i *Installer) install(ctx context.Context, pluginID, version, pluginsDir, pluginZipURL, pluginRepoURL string) error {
+	if i.policy != nil {
+		if err := i.policy.check(pluginID); err != nil {
+			return err
+		}
+	}
+
+	fromRepo := pluginZipURL == ""
+	version, pluginZipURL, checksum, err := i.resolve(pluginID, version, pluginZipURL, pluginRepoURL)
+	if err != nil {
+		return err
+	}
+
+	i.log.Debugf("Installing plugin\nfrom: %s\ninto: %s", pluginZipURL, pluginsDir)
+
+	i.reportProgress(pluginID, ProgressDownloading, nil)
+	archiveFile, err := i.downloadArchive(pluginID, version, pluginZipURL, checksum, fromRepo)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.Remove(archiveFile); err != nil {
+			i.log.Warn("Failed to remove temporary file", "file", archiveFile, "err", err)
+		}
+	}()
+
+	if i.archiveSignature != nil && i.archiveSignature.PluginID == pluginID {
+		if err := i.verifyArchiveSignature(archiveFile); err != nil {
+			return err
+		}
+	}
+
+	if err := i.verifyChecksum(archiveFile, pluginID, version); err != nil {
+		return err
+	}
+
+	if err := i.checkDiskSpace(archiveFile, pluginID, pluginsDir); err != nil {
+		return err
+	}
+
+	if i.currentPlatformOnly {
+		if err := checkPlatformExecutable(archiveFile, pluginID); err != nil {
+			return err
+		}
+	}
+
+	i.reportProgress(pluginID, ProgressExtracting, nil)
+	var res InstalledPlugin
+	pluginDir := filepath.Join(pluginsDir, pluginID)
+	if i.versioned {
+		res, err = i.installVersion(archiveFile, pluginsDir, pluginID, version)
+		if err != nil {
+			return err
+		}
+		pluginDir = filepath.Join(pluginDir, res.Info.Version)
+	} else if i.sandbox {
+		extractedDir, verified, cleanup, err := i.extractInSandbox(archiveFile, pluginsDir, pluginID, version)
 		if err != nil {
 			return err
 		}
+		err = i.commitSandbox(extractedDir, pluginsDir, pluginID)
+		cleanup()
+		if err != nil {
+			return err
+		}
+		res = verified
+	} else {
+		if i.backupExisting {
+			if err := i.backupPlugin(pluginsDir, pluginID); err != nil {
+				return err
+			}
+		}
+
+		err = i.extractFiles(archiveFile, pluginID, pluginsDir)
+		if err != nil {
+			return fmt.Errorf("%v: %w", "failed to extract plugin archive", err)
+		}
 
-		v, err := i.selectVersion(&plugin, version)
+		res, err = i.verifyExtractedPlugin(pluginDir, pluginID, version)
 		if err != nil {
 			return err
 		}
+	}
+
+	if checksum == "" && (i.report != nil || (fromRepo && i.lockfile != nil)) {
+		if checksum, err = fileSHA256(archiveFile); err != nil {
+			return fmt.Errorf("%v: %w", "failed to compute SHA256 checksum", err)
+		}
+	}
+	if fromRepo && i.lockfile != nil {
+		i.lockfile.lock(pluginID, version, checksum)
+	}
+	if i.report != nil {
+		i.report.add(ReportedPlugin{ID: res.ID, Version: res.Info.Version, Dir: pluginDir, SHA256: checksum})
+	}
+
+	i.log.Successf("Downloaded %s v%s zip successfully", res.ID, res.Info.Version)
+	i.reportProgress(pluginID, ProgressComplete, nil)
+
+	if i.batch {
+		i.installed[pluginID] = res.Info.Version
+	}
 
-		if version == "" {
-			version = v.Version
+	// download dependency plugins
+	var failed []FailedDependency
+	for _, dep := range res.Dependencies.Plugins {
+		depVersion := normalizeVersion(dep.Version)
+		if installed, exists := i.installed[dep.ID]; exists && (depVersion == "" || depVersion == normalizeVersion(installed)) {
+			i.log.Debugf("Skipping %s v%s since it has already been installed", dep.ID, installed)
+			continue
+		}
+		if !i.forceDeps && depVersion != "" && depVersion == normalizeVersion(installedVersion(pluginsDir, dep.ID)) {
+			i.log.Infof("Skipping %s v%s, a dependency of %s, since that version is already installed", dep.ID, depVersion, res.ID)
+			continue
 		}
-		pluginZipURL = fmt.Sprintf("%s/%s/versions/%s/download",
-			pluginRepoURL,
-			pluginID,
-			version,
-		)
 
-		// Plugins which are downloaded just as sourcecode zipball from github do not have checksum
-		if v.Arch != nil {
-			archMeta, exists := v.Arch[osAndArchString()]
-			if !exists {
-				archMeta = v.Arch["any"]
+		i.log.Infof("Fetching %s dependencies...", res.ID)
+		if err := i.install(ctx, dep.ID, depVersion, pluginsDir, "", pluginRepoURL); err != nil {
+			// the dependency itself was installed if only its own dependencies failed
+			var depErr ErrDependenciesFailed
+			isDepErr := errors.As(err, &depErr)
+			if !isDepErr {
+				i.reportProgress(dep.ID, ProgressFailed, err)
 			}
-			checksum = archMeta.SHA256
+			if !i.bestEffort {
+				return fmt.Errorf("failed to install plugin %s: %w", dep.ID, err)
+			}
+
+			if isDepErr {
+				failed = append(failed, depErr.Failed...)
+				continue
+			}
+			i.log.Warnf("Failed to install %s, a dependency of %s: %v", dep.ID, res.ID, err)
+			failed = append(failed, FailedDependency{ID: dep.ID, Version: depVersion, Err: err})
 		}
 	}
 
-	i.log.Debugf("Installing plugin\nfrom: %s\ninto: %s", pluginZipURL, pluginsDir)
+	if len(failed) > 0 {
+		return ErrDependenciesFailed{PluginID: res.ID, Failed: failed}
+	}
 
+	return err
+}
+
+// resolve returns the version, download URL and checksum of the plugin, taking the lockfile and catalog into account.
+// Plugins installed from a URL are not resolved.
+func (i *Installer) resolve(pluginID, version, pluginZipURL, pluginRepoURL string) (string, string, string, error) {
+	if pluginZipURL != "" {
+		if i.catalog != nil {
+			return "", "", "", fmt.Errorf("%s can't be installed from a URL since only cataloged plugins may be installed", pluginID)
+		}
+		return version, pluginZipURL, "", nil
+	}
+
+	locked, isLocked := i.lockfile.get(pluginID)
+	if isLocked {
+		if version != "" && version != locked.Version {
+			i.log.Warnf("Ignoring requested version %s of %s since the lockfile pins v%s", version, pluginID, locked.Version)
+		}
+		version = locked.Version
+	}
+
+	var (
+		checksum string
+		err      error
+	)
+	if i.catalog != nil {
+		version, pluginZipURL, checksum, err = i.catalog.resolve(pluginID, version)
+	} else {
+		version, pluginZipURL, checksum, err = i.resolveFromRepo(pluginID, version, pluginRepoURL)
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if isLocked && locked.SHA256 != "" {
+		if checksum != "" && checksum != locked.SHA256 {
+			return "", "", "", fmt.Errorf("checksum of %s v%s does not match the checksum pinned in the lockfile", pluginID, version)
+		}
+		checksum = locked.SHA256
+	}
+
+	return version, pluginZipURL, checksum, nil
+}
+
+// downloadArchive downloads the plugin archive into a temporary file, or copies it from the archive cache
+// if it was already downloaded. The caller is responsible for removing the returned file.
+func (i *Installer) downloadArchive(pluginID, version, pluginZipURL, checksum string, fromRepo bool) (string, error) {
 	// Create temp file for downloading zip file
 	tmpFile, err := ioutil.TempFile("", "*.zip")
 	if err != nil {
-		return fmt.Errorf("%v: %w", "failed to create temporary file", err)
+		return "", fmt.Errorf("%v: %w", "failed to create temporary file", err)
 	}
-	defer func() {
+
+	if archive, exists := i.archives.get(pluginID, version); fromRepo && exists {
+		i.log.Debugf("Using previously downloaded archive for %s v%s", pluginID, version)
+		_, err = tmpFile.Write(archive)
+	} else {
+		err = i.DownloadFile(pluginID, tmpFile, pluginZipURL, checksum)
+		if err == nil && fromRepo {
+			i.cacheArchive(pluginID, version, tmpFile.Name())
+		}
+	}
+	removeTmpFile := func() {
 		if err := os.Remove(tmpFile.Name()); err != nil {
 			i.log.Warn("Failed to remove temporary file", "file", tmpFile.Name(), "err", err)
 		}
-	}()
-
-	err = i.DownloadFile(pluginID, tmpFile, pluginZipURL, checksum)
+	}
 	if err != nil {
 		if err := tmpFile.Close(); err != nil {
 			i.log.Warn("Failed to close file", "err", err)
 		}
-		return fmt.Errorf("%v: %w", "failed to download plugin archive", err)
+		removeTmpFile()
+		return "", fmt.Errorf("%v: %w", "failed to download plugin archive", err)
 	}
-	err = tmpFile.Close()
+	if err := tmpFile.Close(); err != nil {
+		removeTmpFile()
+		return "", fmt.Errorf("%v: %w", "failed to close tmp file", err)
+	}
+
+	return tmpFile.Name(), nil
+}
+
+// resolveFromRepo returns the version, download URL and checksum of the requested plugin version in the plugin repository.
+func (i *Installer) resolveFromRepo(pluginID, version, pluginRepoURL string) (string, string, string, error) {
+	plugin, err := i.getPluginMetadataFromPluginRepo(pluginID, pluginRepoURL)
 	if err != nil {
-		return fmt.Errorf("%v: %w", "failed to close tmp file", err)
+		return "", "", "", err
 	}
 
-	err = i.extractFiles(tmpFile.Name(), pluginID, pluginsDir)
+	v, err := i.selectVersion(&plugin, version)
 	if err != nil {
-		return fmt.Errorf("%v: %w", "failed to extract plugin archive", err)
+		return "", "", "", err
 	}
 
-	res, _ := toPluginDTO(pluginsDir, pluginID)
+	if version == "" {
+		version = v.Version
+	}
+	pluginZipURL := fmt.Sprintf("%s/%s/versions/%s/download",
+		pluginRepoURL,
+		pluginID,
+		version,
+	)
 
-	i.log.Successf("Downloaded %s v%s zip successfully", res.ID, res.Info.Version)
+	// Plugins which are downloaded just as sourcecode zipball from github do not have checksum
+	var checksum string
+	if v.Arch != nil {
+		archMeta, exists := v.Arch[osAndArchString()]
+		if !exists {
+			archMeta = v.Arch["any"]
+		}
+		checksum = archMeta.SHA256
+	}
 
-	// download dependency plugins
-	for _, dep := range res.Dependencies.Plugins {
-		i.log.Infof("Fetching %s dependencies...", res.ID)
-		if err := i.Install(ctx, dep.ID, normalizeVersion(dep.Version), pluginsDir, "", pluginRepoURL); err != nil {
-			return fmt.Errorf("failed to install plugin %s: %w", dep.ID, err)
+	return version, pluginZipURL, checksum, nil
+}
+
+// verifyExtractedPlugin makes sure the extracted plugin.json matches the requested plugin ID and version,
+// so that a repackaged or wrong archive can't be installed under another plugin's ID.
+// The extracted plugin is removed if it doesn't match.
+func (i *Installer) verifyExtractedPlugin(extractedDir, pluginID, version string) (InstalledPlugin, error) {
+	res, err := toPluginDTO(filepath.Dir(extractedDir), filepath.Base(extractedDir))
+	if err == nil && (res.ID != pluginID || (version != "" && normalizeVersion(res.Info.Version) != normalizeVersion(version))) {
+		err = ErrPluginMismatch{
+			PluginID:         pluginID,
+			RequestedVersion: version,
+			ActualID:         res.ID,
+			ActualVersion:    res.Info.Version,
 		}
 	}
+	if err == nil {
+		err = validatePluginJSON(res)
+	}
+	if err != nil {
+		if removeErr := os.RemoveAll(extractedDir); removeErr != nil {
+			i.log.Warn("Failed to remove extracted plugin", "pluginID", pluginID, "err", removeErr)
+		}
+		return InstalledPlugin{}, fmt.Errorf("%v: %w", "failed to verify extracted plugin", err)
+	}
 
-	return err
+	return res, nil
+}
+
+// cacheArchive keeps a copy of the downloaded archive so that it can be reused if
+// the same plugin version is required again as a dependency during this install.
+func (i *Installer) cacheArchive(pluginID, version, archiveFile string) {
+	// It's safe to ignore gosec warning G304 since the file is the temporary file we just downloaded to
+	// nolint:gosec
+	data, err := ioutil.ReadFile(archiveFile)
+	if err != nil {
+		i.log.Warn("Failed to read downloaded archive for caching", "err", err)
+		return
+	}
+
+	if !i.archives.add(pluginID, version, data) {
+		i.log.Debugf("Not caching archive for %s v%s since the archive cache is full", pluginID, version)
+	}
+}
+
+func fileSHA256(path string) (string, error) {
+	// It's safe to ignore gosec warning G304 since the file is the temporary file we just downloaded to
+	// nolint:gosec
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
 }
 
 // Uninstall removes the specified plugin from the provided plugin directory.
 func (i *Installer) Uninstall(ctx context.Context, pluginDir string) error {
 	// verify it's a plugin directory
-	if _, err := os.Stat(filepath.Join(pluginDir, "plugin.json")); err != nil {
+	activeDir := pluginDir
+	if IsVersioned(pluginDir) {
+		activeDir = filepath.Join(pluginDir, currentVersionLink)
+	}
+	if _, err := os.Stat(filepath.Join(activeDir, "plugin.json")); err != nil {
 		if os.IsNotExist(err) {
-			if _, err := os.Stat(filepath.Join(pluginDir, "dist", "plugin.json")); err != nil {
+			if _, err := os.Stat(filepath.Join(activeDir, "dist", "plugin.json")); err != nil {
 				if os.IsNotExist(err) {
 					return fmt.Errorf("tried to remove %s, but it doesn't seem to be a plugin", pluginDir)
 				}
@@ -185,7 +622,7 @@ func (i *Installer) Uninstall(ctx context.Context, pluginDir string) error {
 	return os.RemoveAll(pluginDir)
 }
 
-func (i *Installer) DownloadFile(pluginID string, tmpFile *os.File, url string, checksum string) (err error) {
+func (i *Installer) DownloadFile(pluginID string, tmpFile *os.File, url string, checksum string) error {
 	// Try handling URL as a local file path first
 	if _, err := os.Stat(url); err == nil {
 		// We can ignore this gosec G304 warning since `url` stems from command line flag "pluginUrl". If the
@@ -207,54 +644,18 @@ func (i *Installer) DownloadFile(pluginID string, tmpFile *os.File, url string,
 		return nil
 	}
 
-	i.retryCount = 0
-
-	defer func() {
-		if r := recover(); r != nil {
-			i.retryCount++
-			if i.retryCount < 3 {
-				i.log.Debug("Failed downloading. Will retry once.")
-				err = tmpFile.Truncate(0)
-				if err != nil {
-					return
-				}
-				_, err = tmpFile.Seek(0, 0)
-				if err != nil {
-					return
-				}
-				err = i.DownloadFile(pluginID, tmpFile, url, checksum)
-			} else {
-				i.retryCount = 0
-				failure := fmt.Sprintf("%v", r)
-				if failure == "runtime error: makeslice: len out of range" {
-					err = fmt.Errorf("corrupt HTTP response from source, please try again")
-				} else {
-					panic(r)
-				}
-			}
-		}
-	}()
-
-	// Using no timeout here as some plugins can be bigger and smaller timeout would prevent to download a plugin on
-	// slow network. As this is CLI operation hanging is not a big of an issue as user can just abort.
-	bodyReader, err := i.sendRequestWithoutTimeout(url)
-	if err != nil {
+	if err := i.downloadResumable(tmpFile, url); err != nil {
 		return err
 	}
-	defer func() {
-		if err := bodyReader.Close(); err != nil {
-			i.log.Warn("Failed to close body", "err", err)
-		}
-	}()
 
-	w := bufio.NewWriter(tmpFile)
+	// the archive may have been downloaded in several parts, so the checksum is computed over the whole file
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
 	h := sha256.New()
-	if _, err = io.Copy(w, io.TeeReader(bodyReader, h)); err != nil {
+	if _, err := io.Copy(h, tmpFile); err != nil {
 		return fmt.Errorf("%v: %w", "failed to compute SHA256 checksum", err)
 	}
-	if err := w.Flush(); err != nil {
-		return fmt.Errorf("failed to write to %q: %w", tmpFile.Name(), err)
-	}
 	if len(checksum) > 0 && checksum != fmt.Sprintf("%x", h.Sum(nil)) {
 		return fmt.Errorf("expected SHA256 checksum does not match the downloaded archive - please contact security@grafana.com")
 	}
@@ -304,19 +705,6 @@ func (i *Installer) sendRequest(URL string, subPaths ...string) (io.ReadCloser,
 	return i.handleResponse(res)
 }
 
-func (i *Installer) sendRequestWithoutTimeout(URL string, subPaths ...string) (io.ReadCloser, error) {
-	req, err := i.createRequest(URL, subPaths...)
-	if err != nil {
-		return nil, err
-	}
-
-	res, err := i.httpClientNoTimeout.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	return i.handleResponse(res)
-}
-
 func (i *Installer) createRequest(URL string, subPaths ...string) (*http.Request, error) {
 	u, err := url.Parse(URL)
 	if err != nil {
@@ -336,6 +724,9 @@ func (i *Installer) createRequest(URL string, subPaths ...string) (*http.Request
 	req.Header.Set("grafana-os", runtime.GOOS)
 	req.Header.Set("grafana-arch", runtime.GOARCH)
 	req.Header.Set("User-Agent", "grafana "+i.grafanaVersion)
+	if i.repoToken != "" && u.Scheme == i.repoURL.Scheme && u.Host == i.repoURL.Host {
+		req.Header.Set("Authorization", "Bearer "+i.repoToken)
+	}
 
 	return req, err
 }
@@ -425,13 +816,18 @@ func (i *Installer) GetUpdateInfo(ctx context.Context, pluginID, version, plugin
 func (i *Installer) selectVersion(plugin *Plugin, version string) (*Version, error) {
 	var ver Version
 
-	latestForArch := latestSupportedVersion(plugin)
+	latestForArch := i.latestCompatibleVersion(plugin)
 	if latestForArch == nil {
-		return nil, ErrVersionUnsupported{
-			PluginID:         plugin.ID,
-			RequestedVersion: version,
-			SystemInfo:       i.fullSystemInfoString(),
+		if !i.force || len(plugin.Versions) == 0 {
+			return nil, ErrNoCompatibleVersion{
+				PluginID:         plugin.ID,
+				RequestedVersion: version,
+				SystemInfo:       i.fullSystemInfoString(),
+				Available:        plugin.Versions,
+			}
 		}
+		i.log.Warnf("Forcing install of %s since no version is compatible with your system (%s)", plugin.ID, i.fullSystemInfoString())
+		latestForArch = &plugin.Versions[0]
 	}
 
 	if version == "" {
@@ -454,7 +850,16 @@ func (i *Installer) selectVersion(plugin *Plugin, version string) (*Version, err
 		}
 	}
 
-	if !supportsCurrentArch(&ver) {
+	if !i.isCompatible(&ver) {
+		if i.onlyCompatible && i.isCompatible(latestForArch) {
+			i.log.Warnf("Installing %s v%s instead of v%s which is not supported on your system (%s)",
+				plugin.ID, latestForArch.Version, version, i.fullSystemInfoString())
+			return latestForArch, nil
+		}
+		if i.force {
+			i.log.Warnf("Forcing install of %s v%s which is not supported on your system (%s)", plugin.ID, version, i.fullSystemInfoString())
+			return &ver, nil
+		}
 		i.log.Debugf("Requested plugin version %s v%s not found but potential fallback version '%s' was found",
 			plugin.ID, version, latestForArch.Version)
 		return nil, ErrVersionUnsupported{
@@ -489,10 +894,40 @@ func supportsCurrentArch(version *Version) bool {
 	return false
 }
 
-func latestSupportedVersion(plugin *Plugin) *Version {
+// supportsGrafanaVersion reports whether the version's Grafana dependency is satisfied by the running Grafana version.
+// Versions without a dependency, or with a dependency that can't be parsed, are considered supported.
+func (i *Installer) supportsGrafanaVersion(version *Version) bool {
+	if version.GrafanaDependency == "" || i.grafanaVersion == "" {
+		return true
+	}
+
+	constraint, err := semver.NewConstraint(version.GrafanaDependency)
+	if err != nil {
+		i.log.Debugf("Failed to parse Grafana dependency %q of v%s: %v", version.GrafanaDependency, version.Version, err)
+		return true
+	}
+	grafanaVersion, err := semver.NewVersion(i.grafanaVersion)
+	if err != nil {
+		i.log.Debugf("Failed to parse Grafana version %q: %v", i.grafanaVersion, err)
+		return true
+	}
+	// pre-releases never satisfy constraints without a pre-release, so only the release is compared
+	release, err := semver.NewVersion(fmt.Sprintf("%d.%d.%d", grafanaVersion.Major(), grafanaVersion.Minor(), grafanaVersion.Patch()))
+	if err != nil {
+		return true
+	}
+
+	return constraint.Check(release)
+}
+
+func (i *Installer) isCompatible(version *Version) bool {
+	return supportsCurrentArch(version) && i.supportsGrafanaVersion(version)
+}
+
+func (i *Installer) latestCompatibleVersion(plugin *Plugin) *Version {
 	for _, v := range plugin.Versions {
 		ver := v
-		if supportsCurrentArch(&ver) {
+		if i.isCompatible(&ver) {
 			return &ver
 		}
 	}
@@ -541,6 +976,11 @@ func (i *Installer) extractFiles(archiveFile string, pluginID string, dest strin
 				zf.Name, dest)
 		}
 
+		if i.currentPlatformOnly && !zf.FileInfo().IsDir() && isOtherPlatformExecutable(zf.Name) {
+			i.log.Debugf("Skipping %s, which is built for another platform", zf.Name)
+			continue
+		}
+
 		dstPath := filepath.Clean(filepath.Join(dest, removeGitBuildFromName(zf.Name, pluginID)))
 
 		if zf.FileInfo().IsDir() {
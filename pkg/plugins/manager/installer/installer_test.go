@@ -1,15 +1,25 @@
 package installer
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
 )
 
 func TestInstall(t *testing.T) {
@@ -42,6 +52,65 @@ func TestInstall(t *testing.T) {
 	require.Equal(t, files[5].Name(), "text.txt")
 }
 
+func TestInstallVerifiesExtractedPlugin(t *testing.T) {
+	t.Run("Should fail and remove the plugin if the plugin ID does not match", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+
+		i := &Installer{log: &fakeLogger{}}
+		err := i.Install(context.Background(), "other-app", "", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		var mismatchErr ErrPluginMismatch
+		require.ErrorAs(t, err, &mismatchErr)
+		require.Equal(t, "test-app", mismatchErr.ActualID)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "other-app"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should fail and remove the plugin if the version does not match", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+
+		i := &Installer{log: &fakeLogger{}}
+		err := i.Install(context.Background(), "test-app", "1.0.0", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		var mismatchErr ErrPluginMismatch
+		require.ErrorAs(t, err, &mismatchErr)
+		require.Equal(t, "2.0.0", mismatchErr.ActualVersion)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-app"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should fail and remove the plugin if plugin.json is invalid", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+		archive := writePluginArchive(t, "invalid-app", `{
+			"id": "invalid-app",
+			"type": "application",
+			"info": {"version": "1.0.0"},
+			"dependencies": {"grafanaDependency": ">=9.0.0", "plugins": [{"type": "app"}]}
+		}`)
+
+		i := &Installer{log: &fakeLogger{}}
+		err := i.Install(context.Background(), "invalid-app", "", pluginsDir, archive, "")
+		var invalidErr ErrInvalidPluginJSON
+		require.ErrorAs(t, err, &invalidErr)
+		require.Equal(t, []string{
+			"name is missing",
+			`type "application" is not a valid plugin type`,
+			"plugin dependency 1 has no id",
+		}, invalidErr.Problems)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "invalid-app"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should succeed if the plugin ID and version match", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+
+		i := &Installer{log: &fakeLogger{}}
+		err := i.Install(context.Background(), "test-app", "2.0.0", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		require.NoError(t, err)
+	})
+}
+
 func TestUninstall(t *testing.T) {
 	i := &Installer{log: &fakeLogger{}}
 
@@ -221,6 +290,917 @@ func TestSelectVersion(t *testing.T) {
 		require.NoError(t, err)
 		require.Equal(t, "1.0.0", ver.Version)
 	})
+
+	t.Run("Should skip versions that require another Grafana version", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, grafanaVersion: "8.5.0-pre"}
+		ver, err := i.selectVersion(createPlugin(
+			versionArg{version: "2.0.0", grafanaDependency: ">=9.0.0"},
+			versionArg{version: "1.0.0", grafanaDependency: ">=8.0.0"},
+		), "")
+		require.NoError(t, err)
+		require.Equal(t, "1.0.0", ver.Version)
+
+		_, err = i.selectVersion(createPlugin(
+			versionArg{version: "2.0.0", grafanaDependency: ">=9.0.0"},
+			versionArg{version: "1.0.0", grafanaDependency: ">=8.0.0"},
+		), "2.0.0")
+		require.ErrorIs(t, err, ErrVersionUnsupported{RequestedVersion: "2.0.0", SystemInfo: i.fullSystemInfoString()})
+	})
+
+	t.Run("Should select the latest compatible version instead of an incompatible requested version if only compatible versions are installed", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, grafanaVersion: "8.5.0", onlyCompatible: true}
+		ver, err := i.selectVersion(createPlugin(
+			versionArg{version: "3.0.0", grafanaDependency: ">=9.0.0"},
+			versionArg{version: "2.0.0", grafanaDependency: ">=8.0.0"},
+			versionArg{version: "1.0.0", arch: []string{"non-existent"}},
+		), "1.0.0")
+		require.NoError(t, err)
+		require.Equal(t, "2.0.0", ver.Version)
+	})
+
+	t.Run("Should list the available versions when no version is compatible", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, grafanaVersion: "8.5.0"}
+		_, err := i.selectVersion(createPlugin(
+			versionArg{version: "2.0.0", grafanaDependency: ">=9.0.0"},
+			versionArg{version: "1.0.0", arch: []string{"non-existent"}},
+		), "")
+		var compatErr ErrNoCompatibleVersion
+		require.ErrorAs(t, err, &compatErr)
+		require.Contains(t, err.Error(), "2.0.0 (Grafana >=9.0.0)")
+		require.Contains(t, err.Error(), "1.0.0 (non-existent)")
+	})
+
+	t.Run("Should select the latest version when no version is compatible but install is forced", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, grafanaVersion: "8.5.0", force: true}
+		ver, err := i.selectVersion(createPlugin(
+			versionArg{version: "2.0.0", grafanaDependency: ">=9.0.0"},
+			versionArg{version: "1.0.0", grafanaDependency: ">=9.0.0"},
+		), "")
+		require.NoError(t, err)
+		require.Equal(t, "2.0.0", ver.Version)
+	})
+}
+
+func TestGrafanaVersion(t *testing.T) {
+	archives := map[string]string{}
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		archives[version] = writePluginArchive(t, "test-app", fmt.Sprintf(`{
+			"id": "test-app",
+			"type": "app",
+			"name": "test-app",
+			"info": {"version": %q}
+		}`, version))
+	}
+
+	var grafanaVersions []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		grafanaVersions = append(grafanaVersions, r.Header.Get("grafana-version"))
+		switch r.URL.Path {
+		case "/repo/test-app":
+			_, _ = w.Write([]byte(`{"id": "test-app", "versions": [
+				{"version": "2.0.0", "grafanaDependency": ">=9.1.0"},
+				{"version": "1.0.0", "grafanaDependency": ">=8.0.0"}
+			]}`))
+		case "/test-app/versions/1.0.0/download", "/test-app/versions/2.0.0/download":
+			http.ServeFile(w, r, archives[strings.Split(r.URL.Path, "/")[3]])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	requireInstalledVersion := func(t *testing.T, grafanaVersion, expected string) {
+		t.Helper()
+		grafanaVersions = nil
+		pluginsDir := t.TempDir()
+
+		i := New(false, grafanaVersion, &fakeLogger{})
+		err := i.Install(context.Background(), "test-app", "", pluginsDir, "", srv.URL)
+		require.NoError(t, err)
+
+		pluginJSON, err := ioutil.ReadFile(filepath.Join(pluginsDir, "test-app", "plugin.json"))
+		require.NoError(t, err)
+		require.Contains(t, string(pluginJSON), fmt.Sprintf(`"version": %q`, expected))
+		require.NotEmpty(t, grafanaVersions)
+		for _, v := range grafanaVersions {
+			require.Equal(t, grafanaVersion, v)
+		}
+	}
+
+	t.Run("Should install the latest version compatible with the Grafana version", func(t *testing.T) {
+		requireInstalledVersion(t, "9.0.0", "1.0.0")
+	})
+
+	t.Run("Should install the latest version once the Grafana version satisfies its dependency", func(t *testing.T) {
+		requireInstalledVersion(t, "9.1.0", "2.0.0")
+	})
+}
+
+func TestArchiveCache(t *testing.T) {
+	t.Run("Should return cached archive for the same plugin version only", func(t *testing.T) {
+		c := archiveCache{}
+		require.True(t, c.add("test-app", "1.0.0", []byte("archive")))
+
+		data, exists := c.get("test-app", "1.0.0")
+		require.True(t, exists)
+		require.Equal(t, []byte("archive"), data)
+
+		_, exists = c.get("test-app", "2.0.0")
+		require.False(t, exists)
+	})
+
+	t.Run("Should not exceed the maximum cache size", func(t *testing.T) {
+		c := archiveCache{}
+		require.True(t, c.add("test-app", "1.0.0", make([]byte, maxArchiveCacheSize)))
+		require.False(t, c.add("other-app", "1.0.0", []byte("archive")))
+
+		_, exists := c.get("other-app", "1.0.0")
+		require.False(t, exists)
+	})
+
+	t.Run("Should be empty after clear", func(t *testing.T) {
+		c := archiveCache{}
+		require.True(t, c.add("test-app", "1.0.0", []byte("archive")))
+		c.clear()
+
+		_, exists := c.get("test-app", "1.0.0")
+		require.False(t, exists)
+	})
+}
+
+func TestLockfile(t *testing.T) {
+	t.Run("Should return empty lockfile if the file does not exist", func(t *testing.T) {
+		lockfile, err := ReadLockfile(filepath.Join(t.TempDir(), "plugins.lock"))
+		require.NoError(t, err)
+		require.Empty(t, lockfile.Plugins)
+	})
+
+	t.Run("Should read back the pinned versions after writing", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "plugins.lock")
+		lockfile := &Lockfile{}
+		lockfile.lock("test-app", "1.0.0", "abc")
+		require.NoError(t, lockfile.Write(path))
+
+		lockfile, err := ReadLockfile(path)
+		require.NoError(t, err)
+		locked, exists := lockfile.get("test-app")
+		require.True(t, exists)
+		require.Equal(t, LockedPlugin{Version: "1.0.0", SHA256: "abc"}, locked)
+	})
+}
+
+func TestCatalog(t *testing.T) {
+	catalog := &Catalog{Plugins: map[string][]CatalogVersion{
+		"test-app": {
+			{Version: "2.0.0", URL: "./testdata/plugin-with-symlinks.zip"},
+		},
+	}}
+
+	t.Run("Should install the cataloged version if no version is requested", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		err := i.Install(context.Background(), "test-app", "", pluginsDir, "", "")
+		require.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-app", "plugin.json"))
+		require.NoError(t, err)
+	})
+
+	t.Run("Should fail if the plugin is not in the catalog", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		err := i.Install(context.Background(), "other-app", "", t.TempDir(), "", "")
+		require.ErrorIs(t, err, ErrNotInCatalog{PluginID: "other-app"})
+	})
+
+	t.Run("Should fail if the requested version is not in the catalog", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		err := i.Install(context.Background(), "test-app", "3.0.0", t.TempDir(), "", "")
+		require.ErrorIs(t, err, ErrNotInCatalog{PluginID: "test-app", RequestedVersion: "3.0.0"})
+	})
+
+	t.Run("Should fail if a plugin URL is provided", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		err := i.Install(context.Background(), "test-app", "", t.TempDir(), "./testdata/plugin-with-symlinks.zip", "")
+		require.Error(t, err)
+	})
+}
+
+func TestBestEffortInstall(t *testing.T) {
+	archive := writePluginArchive(t, "main-app", `{
+		"id": "main-app",
+		"type": "app",
+		"name": "main-app",
+		"info": {"version": "1.0.0"},
+		"dependencies": {"plugins": [{"id": "missing-app", "version": "1.0.0"}, {"id": "test-app"}]}
+	}`)
+
+	catalog := &Catalog{Plugins: map[string][]CatalogVersion{
+		"main-app": {{Version: "1.0.0", URL: archive}},
+		"test-app": {{Version: "2.0.0", URL: "./testdata/plugin-with-symlinks.zip"}},
+	}}
+
+	t.Run("Should fail on the first failed dependency", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		err := i.Install(context.Background(), "main-app", "", t.TempDir(), "", "")
+		require.Error(t, err)
+		var depErr ErrDependenciesFailed
+		require.False(t, errors.As(err, &depErr))
+	})
+
+	t.Run("Should install the remaining dependencies and report the failed ones in best effort mode", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		WithBestEffort()(i)
+		err := i.Install(context.Background(), "main-app", "", pluginsDir, "", "")
+		var depErr ErrDependenciesFailed
+		require.ErrorAs(t, err, &depErr)
+		require.Equal(t, "main-app", depErr.PluginID)
+		require.Len(t, depErr.Failed, 1)
+		require.Equal(t, "missing-app", depErr.Failed[0].ID)
+		require.ErrorIs(t, depErr.Failed[0].Err, ErrNotInCatalog{PluginID: "missing-app", RequestedVersion: "1.0.0"})
+
+		for _, pluginID := range []string{"main-app", "test-app"} {
+			_, err = os.Stat(filepath.Join(pluginsDir, pluginID, "plugin.json"))
+			require.NoError(t, err)
+		}
+	})
+}
+
+func TestSkipInstalledDependencies(t *testing.T) {
+	archive := writePluginArchive(t, "main-app", `{
+		"id": "main-app",
+		"type": "app",
+		"name": "main-app",
+		"info": {"version": "1.0.0"},
+		"dependencies": {"plugins": [{"id": "test-app", "version": "2.0.0"}]}
+	}`)
+
+	pluginsDir := t.TempDir()
+	i := &Installer{log: &fakeLogger{}, catalog: &Catalog{Plugins: map[string][]CatalogVersion{
+		"test-app": {{Version: "2.0.0", URL: "./testdata/plugin-with-symlinks.zip"}},
+	}}}
+	err := i.Install(context.Background(), "test-app", "", pluginsDir, "", "")
+	require.NoError(t, err)
+
+	// the archive of the dependency can't be downloaded anymore, so it can only be skipped
+	catalog := &Catalog{Plugins: map[string][]CatalogVersion{
+		"main-app": {{Version: "1.0.0", URL: archive}},
+		"test-app": {{Version: "2.0.0", URL: filepath.Join(t.TempDir(), "missing.zip")}},
+	}}
+
+	t.Run("Should skip a dependency whose required version is installed", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		err := i.Install(context.Background(), "main-app", "", pluginsDir, "", "")
+		require.NoError(t, err)
+	})
+
+	t.Run("Should install a dependency whose required version is installed when forced", func(t *testing.T) {
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		WithForceDeps()(i)
+		err := i.Install(context.Background(), "main-app", "", pluginsDir, "", "")
+		require.Error(t, err)
+	})
+}
+
+func TestPolicy(t *testing.T) {
+	catalog := &Catalog{Plugins: map[string][]CatalogVersion{
+		"main-app": {{Version: "1.0.0", URL: writePluginArchive(t, "main-app", `{
+			"id": "main-app",
+			"type": "app",
+			"name": "main-app",
+			"info": {"version": "1.0.0"},
+			"dependencies": {"plugins": [{"id": "test-app"}]}
+		}`)}},
+		"test-app": {{Version: "2.0.0", URL: "./testdata/plugin-with-symlinks.zip"}},
+	}}
+
+	tests := []struct {
+		description string
+		policy      *Policy
+		expectedErr error
+	}{
+		{
+			description: "Should install plugins that are not denied",
+			policy:      &Policy{Deny: []string{"other-app"}},
+		},
+		{
+			description: "Should refuse to install a denied dependency",
+			policy:      &Policy{Deny: []string{"test-app"}},
+			expectedErr: ErrPluginNotAllowed{PluginID: "test-app", Denied: true},
+		},
+		{
+			description: "Should refuse to install a dependency that is not allowed",
+			policy:      &Policy{Allow: []string{"main-app"}},
+			expectedErr: ErrPluginNotAllowed{PluginID: "test-app"},
+		},
+		{
+			description: "Should refuse to install a plugin that is both allowed and denied",
+			policy:      &Policy{Allow: []string{"main-app", "test-app"}, Deny: []string{"main-app"}},
+			expectedErr: ErrPluginNotAllowed{PluginID: "main-app", Denied: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.description, func(t *testing.T) {
+			i := &Installer{log: &fakeLogger{}, catalog: catalog}
+			WithPolicy(tc.policy)(i)
+			err := i.Install(context.Background(), "main-app", "", t.TempDir(), "", "")
+			if tc.expectedErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestDependencyTree(t *testing.T) {
+	catalog := &Catalog{Plugins: map[string][]CatalogVersion{
+		"a-app": {{Version: "1.0.0", URL: writePluginArchive(t, "a-app", `{
+			"id": "a-app",
+			"type": "app",
+			"name": "a-app",
+			"info": {"version": "1.0.0"},
+			"dependencies": {"plugins": [{"id": "test-app", "version": "2.0.0"}, {"id": "b-app"}]}
+		}`)}},
+		"b-app": {{Version: "1.1.0", URL: writePluginArchive(t, "b-app", `{
+			"id": "b-app",
+			"type": "app",
+			"name": "b-app",
+			"info": {"version": "1.1.0"},
+			"dependencies": {"plugins": [{"id": "a-app"}, {"id": "missing-app"}]}
+		}`)}},
+		"test-app": {{Version: "2.0.0", URL: "./testdata/plugin-with-symlinks.zip"}},
+	}}
+
+	pluginsDir := t.TempDir()
+	i := &Installer{log: &fakeLogger{}, catalog: catalog}
+	err := i.Install(context.Background(), "test-app", "", pluginsDir, "", "")
+	require.NoError(t, err)
+
+	tree, err := i.DependencyTree(context.Background(), "a-app", "", pluginsDir, "", "")
+	require.NoError(t, err)
+	require.Equal(t, "1.0.0", tree.Version)
+	require.Empty(t, tree.InstalledVersion)
+	require.Len(t, tree.Dependencies, 2)
+
+	testApp := tree.Dependencies[0]
+	require.Equal(t, "test-app", testApp.ID)
+	require.Equal(t, "2.0.0", testApp.InstalledVersion)
+	require.Empty(t, testApp.Dependencies)
+
+	bApp := tree.Dependencies[1]
+	require.Equal(t, "1.1.0", bApp.Version)
+	require.Len(t, bApp.Dependencies, 2)
+	require.Equal(t, "a-app", bApp.Dependencies[0].ID)
+	require.True(t, bApp.Dependencies[0].Cycle)
+	require.Equal(t, "missing-app", bApp.Dependencies[1].ID)
+	require.ErrorIs(t, bApp.Dependencies[1].Err, ErrNotInCatalog{PluginID: "missing-app"})
+
+	_, err = os.Stat(filepath.Join(pluginsDir, "a-app"))
+	require.True(t, os.IsNotExist(err))
+}
+
+// writePluginArchive writes an archive containing only the plugin.json of the plugin, and returns its path.
+func writePluginArchive(t *testing.T, pluginID, pluginJSON string) string {
+	t.Helper()
+
+	archive := filepath.Join(t.TempDir(), pluginID+".zip")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	entry, err := w.Create(pluginID + "/plugin.json")
+	require.NoError(t, err)
+	_, err = entry.Write([]byte(pluginJSON))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+
+	return archive
+}
+
+func TestVersionedInstall(t *testing.T) {
+	pluginsDir := t.TempDir()
+	pluginDir := filepath.Join(pluginsDir, "test-app")
+	err := os.MkdirAll(pluginDir, 0750)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(pluginDir, "plugin.json"), []byte(`{"id": "test-app", "info": {"version": "1.0.0"}}`), 0600)
+	require.NoError(t, err)
+
+	i := &Installer{log: &fakeLogger{}}
+	WithVersioned()(i)
+	err = i.Install(context.Background(), "test-app", "", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+	require.NoError(t, err)
+
+	requireLink := func(t *testing.T, name, expected string) {
+		t.Helper()
+		target, err := os.Readlink(filepath.Join(pluginDir, name))
+		require.NoError(t, err)
+		require.Equal(t, expected, target)
+	}
+
+	t.Run("Should install into a version directory and keep the previous version", func(t *testing.T) {
+		require.True(t, IsVersioned(pluginDir))
+		requireLink(t, currentVersionLink, "2.0.0")
+		requireLink(t, previousVersionLink, "1.0.0")
+
+		_, err := os.Stat(filepath.Join(pluginDir, currentVersionLink, "plugin.json"))
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(pluginDir, "1.0.0", "plugin.json"))
+		require.NoError(t, err)
+	})
+
+	t.Run("Should swap the current and previous versions on rollback", func(t *testing.T) {
+		version, err := Rollback(pluginsDir, "test-app")
+		require.NoError(t, err)
+		require.Equal(t, "1.0.0", version)
+		requireLink(t, currentVersionLink, "1.0.0")
+		requireLink(t, previousVersionLink, "2.0.0")
+	})
+
+	t.Run("Should fail to roll back a plugin that is not versioned", func(t *testing.T) {
+		_, err := Rollback(t.TempDir(), "test-app")
+		require.Error(t, err)
+	})
+}
+
+func TestRepoToken(t *testing.T) {
+	i := &Installer{log: &fakeLogger{}}
+	WithRepoToken("https://plugins.example.com/api/plugins", "secret")(i)
+
+	t.Run("Should send the token to the repository", func(t *testing.T) {
+		req, err := i.createRequest("https://plugins.example.com/api/plugins", "repo", "test-app")
+		require.NoError(t, err)
+		require.Equal(t, "Bearer secret", req.Header.Get("Authorization"))
+	})
+
+	t.Run("Should not send the token to other hosts", func(t *testing.T) {
+		for _, u := range []string{"https://cdn.example.com/test-app.zip", "http://plugins.example.com/api/plugins"} {
+			req, err := i.createRequest(u)
+			require.NoError(t, err)
+			require.Empty(t, req.Header.Get("Authorization"), u)
+		}
+	})
+}
+
+func TestResumableDownload(t *testing.T) {
+	archive := bytes.Repeat([]byte("grafana plugin archive "), 1000)
+	checksum := fmt.Sprintf("%x", sha256.Sum256(archive))
+
+	// newServer returns a server that breaks off the first download halfway through
+	newServer := func(t *testing.T, supportsRanges bool) (*httptest.Server, *[]string) {
+		var ranges []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			if len(ranges) == 1 {
+				w.Header().Set("Content-Length", strconv.Itoa(len(archive)))
+				_, _ = w.Write(archive[:len(archive)/2])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+
+			var start int
+			if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil || !supportsRanges {
+				_, _ = w.Write(archive)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(archive)-1, len(archive)))
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(archive[start:])
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &ranges
+	}
+
+	download := func(t *testing.T, url string) []byte {
+		tmpFile, err := ioutil.TempFile(t.TempDir(), "*.zip")
+		require.NoError(t, err)
+		defer func() {
+			require.NoError(t, tmpFile.Close())
+		}()
+
+		i := &Installer{log: &fakeLogger{}}
+		err = i.DownloadFile("test-app", tmpFile, url, checksum)
+		require.NoError(t, err)
+
+		data, err := ioutil.ReadFile(tmpFile.Name())
+		require.NoError(t, err)
+		return data
+	}
+
+	t.Run("Should resume the download from where it broke off", func(t *testing.T) {
+		srv, ranges := newServer(t, true)
+		require.Equal(t, archive, download(t, srv.URL))
+		require.Len(t, *ranges, 2)
+		require.Empty(t, (*ranges)[0])
+		require.NotEmpty(t, (*ranges)[1])
+	})
+
+	t.Run("Should download again from the start if the server doesn't support range requests", func(t *testing.T) {
+		srv, ranges := newServer(t, false)
+		require.Equal(t, archive, download(t, srv.URL))
+		require.Len(t, *ranges, 2)
+	})
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, ok := parseContentRange("bytes 100-199/1000")
+	require.True(t, ok)
+	require.Equal(t, int64(100), start)
+	require.Equal(t, int64(1000), total)
+
+	start, total, ok = parseContentRange("bytes 100-199/*")
+	require.True(t, ok)
+	require.Equal(t, int64(100), start)
+	require.Equal(t, int64(-1), total)
+
+	_, _, ok = parseContentRange("items 100-199/1000")
+	require.False(t, ok)
+}
+
+func TestDiskSpace(t *testing.T) {
+	t.Run("Required disk space is the extracted size of the archive", func(t *testing.T) {
+		archive := "testdata/grafana-simple-json-datasource-ec18fa4da8096a952608a7e4c7782b4260b41bcf.zip"
+		r, err := zip.OpenReader(archive)
+		require.NoError(t, err)
+		var size uint64
+		for _, zf := range r.File {
+			size += zf.UncompressedSize64
+		}
+		require.NoError(t, r.Close())
+
+		required, err := requiredDiskSpace(archive)
+		require.NoError(t, err)
+		require.Equal(t, size, required)
+	})
+
+	t.Run("Required disk space is estimated if the archive can't be read", func(t *testing.T) {
+		archive := filepath.Join(t.TempDir(), "archive.zip")
+		err := ioutil.WriteFile(archive, []byte("not a zip"), 0600)
+		require.NoError(t, err)
+
+		required, err := requiredDiskSpace(archive)
+		require.NoError(t, err)
+		require.Equal(t, uint64(len("not a zip")*unknownSizeFactor), required)
+	})
+
+	t.Run("Free disk space is checked on the closest existing parent of the plugins directory", func(t *testing.T) {
+		dir := t.TempDir()
+		existing, err := existingDir(filepath.Join(dir, "plugins", "nested"))
+		require.NoError(t, err)
+		require.Equal(t, dir, existing)
+
+		i := &Installer{log: &fakeLogger{}}
+		err = i.checkDiskSpace("testdata/plugin-with-symlink.zip", "test-app", filepath.Join(dir, "plugins"))
+		require.NoError(t, err)
+	})
+}
+
+func TestCurrentPlatformOnly(t *testing.T) {
+	otherPlatform := "gpx_test_linux_arm64"
+	if osAndArchString() == "linux-arm64" {
+		otherPlatform = "gpx_test_linux_amd64"
+	}
+	pluginJSON := `{"id": "test-datasource", "name": "Test", "type": "datasource", "backend": true, "executable": "gpx_test", "info": {"version": "1.0.0"}}`
+
+	writeArchive := func(t *testing.T, executables ...string) string {
+		t.Helper()
+
+		archive := filepath.Join(t.TempDir(), "test-datasource.zip")
+		f, err := os.Create(archive)
+		require.NoError(t, err)
+		w := zip.NewWriter(f)
+		for name, content := range map[string]string{"plugin.json": pluginJSON, "module.js": "", "README.md": ""} {
+			entry, err := w.Create("test-datasource/" + name)
+			require.NoError(t, err)
+			_, err = entry.Write([]byte(content))
+			require.NoError(t, err)
+		}
+		for _, name := range executables {
+			_, err := w.Create("test-datasource/" + name)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		require.NoError(t, f.Close())
+
+		return archive
+	}
+
+	t.Run("Should only extract the executable for the current platform", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+		archive := writeArchive(t, platformExecutable("gpx_test"), otherPlatform)
+
+		i := &Installer{log: &fakeLogger{}}
+		WithCurrentPlatformOnly()(i)
+		err := i.Install(context.Background(), "test-datasource", "", pluginsDir, archive, "")
+		require.NoError(t, err)
+
+		for _, name := range []string{"plugin.json", "module.js", "README.md", platformExecutable("gpx_test")} {
+			_, err = os.Stat(filepath.Join(pluginsDir, "test-datasource", name))
+			require.NoError(t, err)
+		}
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-datasource", otherPlatform))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should fail without extracting if there's no executable for the current platform", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+		archive := writeArchive(t, otherPlatform)
+
+		i := &Installer{log: &fakeLogger{}}
+		WithCurrentPlatformOnly()(i)
+		err := i.Install(context.Background(), "test-datasource", "", pluginsDir, archive, "")
+		var missingErr ErrExecutableMissing
+		require.ErrorAs(t, err, &missingErr)
+		require.Equal(t, platformExecutable("gpx_test"), missingErr.Executable)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-datasource"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should extract every executable by default", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+		archive := writeArchive(t, otherPlatform)
+
+		i := &Installer{log: &fakeLogger{}}
+		err := i.Install(context.Background(), "test-datasource", "", pluginsDir, archive, "")
+		require.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-datasource", otherPlatform))
+		require.NoError(t, err)
+	})
+}
+
+func TestBackupExisting(t *testing.T) {
+	pluginsDir := t.TempDir()
+	i := &Installer{log: &fakeLogger{}}
+	WithBackupExisting(2)(i)
+
+	backups := func(t *testing.T) []string {
+		t.Helper()
+		matches, err := filepath.Glob(filepath.Join(pluginsDir, "test-app"+backupMarker+"*"))
+		require.NoError(t, err)
+		return matches
+	}
+
+	t.Run("Should not back up a plugin that isn't installed", func(t *testing.T) {
+		err := i.Install(context.Background(), "test-app", "", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		require.NoError(t, err)
+		require.Empty(t, backups(t))
+	})
+
+	t.Run("Should move the installed plugin to a backup when it's replaced", func(t *testing.T) {
+		err := i.Install(context.Background(), "test-app", "", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		require.NoError(t, err)
+		require.Len(t, backups(t), 1)
+
+		_, err = os.Stat(filepath.Join(backups(t)[0], "plugin.json"))
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-app", "plugin.json"))
+		require.NoError(t, err)
+	})
+
+	t.Run("Should only keep the most recent backups", func(t *testing.T) {
+		oldest := backups(t)[0]
+		for n := 0; n < 2; n++ {
+			err := i.Install(context.Background(), "test-app", "", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+			require.NoError(t, err)
+		}
+		require.Len(t, backups(t), 2)
+		require.NotContains(t, backups(t), oldest)
+	})
+}
+
+func TestArchiveSignature(t *testing.T) {
+	archive := "./testdata/plugin-with-symlinks.zip"
+	entity, err := openpgp.NewEntity("Test Org", "", "security@test.org", nil)
+	require.NoError(t, err)
+
+	publicKeyPath := filepath.Join(t.TempDir(), "public.key")
+	var publicKey bytes.Buffer
+	w, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+	require.NoError(t, ioutil.WriteFile(publicKeyPath, publicKey.Bytes(), 0600))
+
+	writeSignature := func(t *testing.T, signed []byte) string {
+		t.Helper()
+
+		var signature bytes.Buffer
+		require.NoError(t, openpgp.ArmoredDetachSign(&signature, entity, bytes.NewReader(signed), nil))
+		path := filepath.Join(t.TempDir(), "plugin.zip.asc")
+		require.NoError(t, ioutil.WriteFile(path, signature.Bytes(), 0600))
+		return path
+	}
+
+	t.Run("Should install the plugin if the archive is signed with the key", func(t *testing.T) {
+		data, err := ioutil.ReadFile(archive)
+		require.NoError(t, err)
+		signature, err := NewArchiveSignature("test-app", publicKeyPath, "", writeSignature(t, data))
+		require.NoError(t, err)
+
+		pluginsDir := t.TempDir()
+		i := &Installer{log: &fakeLogger{}}
+		WithArchiveSignature(signature)(i)
+		err = i.Install(context.Background(), "test-app", "", pluginsDir, archive, "")
+		require.NoError(t, err)
+	})
+
+	t.Run("Should fail without extracting if the archive isn't signed with the key", func(t *testing.T) {
+		signature, err := NewArchiveSignature("test-app", publicKeyPath, "", writeSignature(t, []byte("another archive")))
+		require.NoError(t, err)
+
+		pluginsDir := t.TempDir()
+		i := &Installer{log: &fakeLogger{}}
+		WithArchiveSignature(signature)(i)
+		err = i.Install(context.Background(), "test-app", "", pluginsDir, archive, "")
+		var signatureErr ErrArchiveSignatureInvalid
+		require.ErrorAs(t, err, &signatureErr)
+		require.Equal(t, "test-app", signatureErr.PluginID)
+		require.Contains(t, signatureErr.Key, "Test Org <security@test.org>")
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-app"))
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestChecksumManifest(t *testing.T) {
+	catalog := &Catalog{Plugins: map[string][]CatalogVersion{
+		"test-app": {
+			{Version: "2.0.0", URL: "./testdata/plugin-with-symlinks.zip"},
+		},
+	}}
+	checksum, err := fileSHA256("./testdata/plugin-with-symlinks.zip")
+	require.NoError(t, err)
+
+	install := func(t *testing.T, manifest *ChecksumManifest, strict bool) (string, error) {
+		t.Helper()
+
+		pluginsDir := t.TempDir()
+		i := &Installer{log: &fakeLogger{}, catalog: catalog}
+		WithChecksumManifest(manifest, strict)(i)
+		return pluginsDir, i.Install(context.Background(), "test-app", "", pluginsDir, "", "")
+	}
+
+	t.Run("Should install the plugin if the archive matches the checksum manifest", func(t *testing.T) {
+		manifest := &ChecksumManifest{Plugins: map[string]map[string]string{"test-app": {"v2.0.0": checksum}}}
+		_, err := install(t, manifest, true)
+		require.NoError(t, err)
+	})
+
+	t.Run("Should fail without extracting if the archive doesn't match the checksum manifest", func(t *testing.T) {
+		manifest := &ChecksumManifest{Plugins: map[string]map[string]string{"test-app": {"2.0.0": "abc"}}}
+		pluginsDir, err := install(t, manifest, false)
+		require.ErrorIs(t, err, ErrChecksumMismatch{PluginID: "test-app", Version: "2.0.0", Expected: "abc", Actual: checksum})
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-app"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("Should only fail on archives missing from the checksum manifest if checksums are strict", func(t *testing.T) {
+		manifest := &ChecksumManifest{Plugins: map[string]map[string]string{"test-app": {"1.0.0": checksum}}}
+		_, err := install(t, manifest, false)
+		require.NoError(t, err)
+
+		_, err = install(t, manifest, true)
+		require.ErrorIs(t, err, ErrChecksumMissing{PluginID: "test-app", Version: "2.0.0"})
+	})
+}
+
+func TestSandbox(t *testing.T) {
+	setup := func(t *testing.T) (string, *Installer) {
+		t.Helper()
+
+		pluginsDir := filepath.Join(t.TempDir(), "plugins")
+		i := &Installer{log: &fakeLogger{}}
+		err := i.Install(context.Background(), "test-app", "", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		require.NoError(t, err)
+		WithSandbox()(i)
+		return pluginsDir, i
+	}
+	requireNoSandbox := func(t *testing.T, pluginsDir string) {
+		t.Helper()
+
+		entries, err := ioutil.ReadDir(filepath.Dir(pluginsDir))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, "plugins", entries[0].Name())
+	}
+
+	t.Run("Should replace the installed plugin once the plugin is verified", func(t *testing.T) {
+		pluginsDir, i := setup(t)
+		err := ioutil.WriteFile(filepath.Join(pluginsDir, "test-app", "stale.txt"), []byte("stale"), 0600)
+		require.NoError(t, err)
+
+		err = i.Install(context.Background(), "test-app", "2.0.0", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		require.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-app", "plugin.json"))
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-app", "stale.txt"))
+		require.True(t, os.IsNotExist(err))
+		requireNoSandbox(t, pluginsDir)
+	})
+
+	t.Run("Should keep the installed plugin if the plugin fails verification", func(t *testing.T) {
+		pluginsDir, i := setup(t)
+
+		err := i.Install(context.Background(), "test-app", "1.0.0", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		var mismatchErr ErrPluginMismatch
+		require.ErrorAs(t, err, &mismatchErr)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "test-app", "plugin.json"))
+		require.NoError(t, err)
+		requireNoSandbox(t, pluginsDir)
+	})
+
+	t.Run("Should never extract a plugin that fails verification into the plugins directory", func(t *testing.T) {
+		pluginsDir, i := setup(t)
+
+		err := i.Install(context.Background(), "other-app", "", pluginsDir, "./testdata/plugin-with-symlinks.zip", "")
+		require.Error(t, err)
+
+		_, err = os.Stat(filepath.Join(pluginsDir, "other-app"))
+		require.True(t, os.IsNotExist(err))
+		requireNoSandbox(t, pluginsDir)
+	})
+}
+
+func TestInstallReport(t *testing.T) {
+	archive := writePluginArchive(t, "main-app", `{
+		"id": "main-app",
+		"type": "app",
+		"name": "main-app",
+		"info": {"version": "1.0.0"},
+		"dependencies": {"plugins": [{"id": "test-app"}]}
+	}`)
+	checksum, err := fileSHA256(archive)
+	require.NoError(t, err)
+
+	pluginsDir := t.TempDir()
+	report := &InstallReport{}
+	i := &Installer{log: &fakeLogger{}, catalog: &Catalog{Plugins: map[string][]CatalogVersion{
+		"main-app": {{Version: "1.0.0", URL: archive}},
+		"test-app": {{Version: "2.0.0", URL: "./testdata/plugin-with-symlinks.zip"}},
+	}}}
+	WithInstallReport(report)(i)
+	err = i.Install(context.Background(), "main-app", "", pluginsDir, "", "")
+	require.NoError(t, err)
+
+	require.Len(t, report.Plugins, 2)
+	require.Equal(t, ReportedPlugin{
+		ID:      "main-app",
+		Version: "1.0.0",
+		Dir:     filepath.Join(pluginsDir, "main-app"),
+		SHA256:  checksum,
+	}, report.Plugins[0])
+	require.Equal(t, "test-app", report.Plugins[1].ID)
+	require.Equal(t, filepath.Join(pluginsDir, "test-app"), report.Plugins[1].Dir)
+	require.NotEmpty(t, report.Plugins[1].SHA256)
+}
+
+func TestProgress(t *testing.T) {
+	t.Run("Should write a line per state change when not attached to a terminal", func(t *testing.T) {
+		var out bytes.Buffer
+		progress := NewProgress(&out, false, "main-app", "missing-app")
+		i := &Installer{log: &fakeLogger{}, catalog: &Catalog{Plugins: map[string][]CatalogVersion{
+			"main-app": {{Version: "1.0.0", URL: "./testdata/plugin-with-symlinks.zip"}},
+		}}}
+		WithProgress(progress)(i)
+
+		err := i.Install(context.Background(), "main-app", "", t.TempDir(), "", "")
+		require.Error(t, err)
+		err = i.Install(context.Background(), "missing-app", "", t.TempDir(), "", "")
+		require.Error(t, err)
+		progress.Finish()
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Equal(t, []string{"main-app: downloading", "main-app: extracting"}, lines[:2])
+		require.True(t, strings.HasPrefix(lines[2], "main-app: failed: "))
+		require.True(t, strings.HasPrefix(lines[3], "missing-app: failed: "))
+		require.Equal(t, "Installed 0 of 2 plugins", lines[4])
+		require.Len(t, lines, 7)
+	})
+
+	t.Run("Should rewrite a consolidated status line when attached to a terminal", func(t *testing.T) {
+		var out bytes.Buffer
+		progress := NewProgress(&out, true, "a", "b", "c")
+		progress.Set("a", ProgressDownloading, nil)
+		require.True(t, strings.HasSuffix(out.String(), "\r\033[K0/3 complete, downloading a"))
+
+		progress.Set("a", ProgressComplete, nil)
+		progress.Set("dep", ProgressExtracting, nil)
+		require.True(t, strings.HasSuffix(out.String(), "\r\033[K1/4 complete, extracting dep"))
+
+		progress.Set("dep", ProgressComplete, nil)
+		progress.Set("b", ProgressDownloading, nil)
+		progress.Set("b", ProgressFailed, errors.New("not found"))
+		progress.Finish()
+		require.True(t, strings.HasSuffix(out.String(), "\r\033[K2/4 complete, 1 failed\nInstalled 2 of 4 plugins\n  b: not found\n"))
+	})
 }
 
 func TestRemoveGitBuildFromName(t *testing.T) {
@@ -343,8 +1323,9 @@ func skipWindows(t *testing.T) {
 }
 
 type versionArg struct {
-	version string
-	arch    []string
+	version           string
+	arch              []string
+	grafanaDependency string
 }
 
 func createPlugin(versions ...versionArg) *Plugin {
@@ -357,6 +1338,8 @@ func createPlugin(versions ...versionArg) *Plugin {
 			Version: version.version,
 			Commit:  fmt.Sprintf("commit_%s", version.version),
 			URL:     fmt.Sprintf("url_%s", version.version),
+
+			GrafanaDependency: version.grafanaDependency,
 		}
 		if version.arch != nil {
 			ver.Arch = map[string]ArchMeta{}
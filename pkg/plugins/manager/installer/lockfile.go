@@ -0,0 +1,79 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// Lockfile pins the exact versions and checksums of plugins and their transitive dependencies,
+// so that installing from the same lockfile always results in the same set of plugins.
+type Lockfile struct {
+	Plugins map[string]LockedPlugin `json:"plugins"`
+}
+
+type LockedPlugin struct {
+	Version string `json:"version"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+// ReadLockfile reads the lockfile at the provided path.
+// An empty lockfile is returned if the file does not exist yet.
+func ReadLockfile(path string) (*Lockfile, error) {
+	// We can ignore the gosec G304 warning since the path stems from the command line flag "lockfile"
+	// nolint:gosec
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Lockfile{Plugins: map[string]LockedPlugin{}}, nil
+		}
+		return nil, fmt.Errorf("%v: %w", "failed to read lockfile", err)
+	}
+
+	lockfile := &Lockfile{}
+	if err := json.Unmarshal(data, lockfile); err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to parse lockfile", err)
+	}
+	if lockfile.Plugins == nil {
+		lockfile.Plugins = map[string]LockedPlugin{}
+	}
+
+	return lockfile, nil
+}
+
+// Write writes the lockfile to the provided path.
+func (l *Lockfile) Write(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// We can ignore the gosec G306 warning since the lockfile is meant to be shared and contains no secrets
+	// nolint:gosec
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("%v: %w", "failed to write lockfile", err)
+	}
+
+	return nil
+}
+
+func (l *Lockfile) get(pluginID string) (LockedPlugin, bool) {
+	if l == nil {
+		return LockedPlugin{}, false
+	}
+
+	locked, exists := l.Plugins[pluginID]
+	return locked, exists
+}
+
+func (l *Lockfile) lock(pluginID, version, checksum string) {
+	if l == nil {
+		return
+	}
+
+	if l.Plugins == nil {
+		l.Plugins = map[string]LockedPlugin{}
+	}
+	l.Plugins[pluginID] = LockedPlugin{Version: version, SHA256: checksum}
+}
@@ -4,13 +4,16 @@ type InstalledPlugin struct {
 	ID           string       `json:"id"`
 	Name         string       `json:"name"`
 	Type         string       `json:"type"`
+	Backend      bool         `json:"backend"`
+	Executable   string       `json:"executable"`
 	Info         PluginInfo   `json:"info"`
 	Dependencies Dependencies `json:"dependencies"`
 }
 
 type Dependencies struct {
-	GrafanaVersion string             `json:"grafanaVersion"`
-	Plugins        []PluginDependency `json:"plugins"`
+	GrafanaVersion    string             `json:"grafanaVersion"`
+	GrafanaDependency string             `json:"grafanaDependency"`
+	Plugins           []PluginDependency `json:"plugins"`
 }
 
 type PluginDependency struct {
@@ -32,10 +35,11 @@ type Plugin struct {
 }
 
 type Version struct {
-	Commit  string              `json:"commit"`
-	URL     string              `json:"url"`
-	Version string              `json:"version"`
-	Arch    map[string]ArchMeta `json:"arch"`
+	Commit            string              `json:"commit"`
+	URL               string              `json:"url"`
+	Version           string              `json:"version"`
+	Arch              map[string]ArchMeta `json:"arch"`
+	GrafanaDependency string              `json:"grafanaDependency"`
 }
 
 type ArchMeta struct {
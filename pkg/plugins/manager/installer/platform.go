@@ -0,0 +1,82 @@
+package installer
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// platformExecutableRegexp matches the names of backend plugin executables, which are suffixed by the OS and
+// architecture they're built for, such as gpx_plugin_linux_amd64 or gpx_plugin_windows_amd64.exe.
+var platformExecutableRegexp = regexp.MustCompile(`_(linux|darwin|windows|freebsd|netbsd|openbsd)_(amd64|arm64|arm|386|ppc64le|s390x)(\.exe)?$`)
+
+type ErrExecutableMissing struct {
+	PluginID   string
+	Executable string
+	Platform   string
+}
+
+func (e ErrExecutableMissing) Error() string {
+	return fmt.Sprintf("%s has no backend executable %s for %s", e.PluginID, e.Executable, e.Platform)
+}
+
+// WithCurrentPlatformOnly makes the Installer skip the backend executables built for other platforms when extracting
+// plugins, and refuse to install backend plugins whose archive has no executable for the current platform.
+func WithCurrentPlatformOnly() Option {
+	return func(i *Installer) {
+		i.currentPlatformOnly = true
+	}
+}
+
+// isOtherPlatformExecutable reports whether the archive member is a backend executable built for another platform.
+func isOtherPlatformExecutable(name string) bool {
+	m := platformExecutableRegexp.FindStringSubmatch(path.Base(name))
+	if m == nil {
+		return false
+	}
+
+	return m[1]+"-"+m[2] != osAndArchString()
+}
+
+// platformExecutable returns the name of the executable of a backend plugin for the current platform,
+// the same way it's started by the backend plugin provider.
+func platformExecutable(executable string) string {
+	extension := ""
+	if runtime.GOOS == "windows" {
+		extension = ".exe"
+	}
+
+	return fmt.Sprintf("%s_%s_%s%s", executable, strings.ToLower(runtime.GOOS), strings.ToLower(runtime.GOARCH), extension)
+}
+
+// checkPlatformExecutable returns an ErrExecutableMissing if the archive holds a backend plugin without an
+// executable for the current platform, which would otherwise only be noticed when the plugin fails to start.
+func checkPlatformExecutable(archiveFile, pluginID string) error {
+	plugin, err := readArchivePluginJSON(archiveFile)
+	if err != nil {
+		return err
+	}
+	if !plugin.Backend || plugin.Executable == "" {
+		return nil
+	}
+
+	r, err := zip.OpenReader(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+
+	executable := platformExecutable(plugin.Executable)
+	for _, zf := range r.File {
+		if !zf.FileInfo().IsDir() && path.Base(path.Clean(zf.Name)) == executable {
+			return nil
+		}
+	}
+
+	return ErrExecutableMissing{PluginID: pluginID, Executable: executable, Platform: osAndArchString()}
+}
@@ -0,0 +1,67 @@
+package installer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+
+	"github.com/grafana/grafana/pkg/plugins"
+)
+
+// ErrInvalidPluginJSON is returned when the plugin.json of an extracted plugin would fail to load at startup.
+type ErrInvalidPluginJSON struct {
+	PluginID string
+	Problems []string
+}
+
+func (e ErrInvalidPluginJSON) Error() string {
+	return fmt.Sprintf("plugin.json of %s is invalid: %s", e.PluginID, strings.Join(e.Problems, ", "))
+}
+
+// validatePluginJSON checks the required fields, the type and the dependencies of the plugin.json.
+func validatePluginJSON(plugin InstalledPlugin) error {
+	var problems []string
+	if plugin.ID == "" {
+		problems = append(problems, "id is missing")
+	}
+	if plugin.Name == "" {
+		problems = append(problems, "name is missing")
+	}
+	if plugin.Type == "" {
+		problems = append(problems, "type is missing")
+	} else if !isValidPluginType(plugin.Type) {
+		problems = append(problems, fmt.Sprintf("type %q is not a valid plugin type", plugin.Type))
+	}
+
+	if plugin.Dependencies.GrafanaDependency != "" {
+		if _, err := semver.NewConstraint(plugin.Dependencies.GrafanaDependency); err != nil {
+			problems = append(problems, fmt.Sprintf("grafanaDependency %q is not a valid version constraint", plugin.Dependencies.GrafanaDependency))
+		}
+	}
+	for i, dep := range plugin.Dependencies.Plugins {
+		switch {
+		case dep.ID == "":
+			problems = append(problems, fmt.Sprintf("plugin dependency %d has no id", i+1))
+		case dep.ID == plugin.ID:
+			problems = append(problems, "plugin depends on itself")
+		case dep.Type != "" && !isValidPluginType(dep.Type):
+			problems = append(problems, fmt.Sprintf("type %q of plugin dependency %s is not a valid plugin type", dep.Type, dep.ID))
+		}
+	}
+
+	if len(problems) > 0 {
+		return ErrInvalidPluginJSON{PluginID: plugin.ID, Problems: problems}
+	}
+
+	return nil
+}
+
+func isValidPluginType(pluginType string) bool {
+	for _, t := range plugins.PluginTypes {
+		if string(t) == pluginType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package installer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// Policy restricts the plugins that can be installed, including the dependencies of installed plugins.
+// Denied plugins can never be installed, and when plugins are allowed, only those plugins can be installed.
+type Policy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+type ErrPluginNotAllowed struct {
+	PluginID string
+	// Denied is set if the plugin is denied, rather than missing from the allowed plugins.
+	Denied bool
+}
+
+func (e ErrPluginNotAllowed) Error() string {
+	if e.Denied {
+		return fmt.Sprintf("%s is denied by the plugin install policy", e.PluginID)
+	}
+	return fmt.Sprintf("%s is not allowed by the plugin install policy", e.PluginID)
+}
+
+// WithPolicy makes the Installer refuse to install plugins, or dependencies, that the policy doesn't allow.
+func WithPolicy(policy *Policy) Option {
+	return func(i *Installer) {
+		i.policy = policy
+	}
+}
+
+// ReadPolicy reads the policy at the provided path.
+func ReadPolicy(path string) (*Policy, error) {
+	// We can ignore the gosec G304 warning since the path stems from the command line flag "policy"
+	// nolint:gosec
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to read plugin install policy", err)
+	}
+
+	policy := &Policy{}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("%v: %w", "failed to parse plugin install policy", err)
+	}
+
+	return policy, nil
+}
+
+// check returns an ErrPluginNotAllowed if the policy doesn't allow the plugin to be installed.
+func (p *Policy) check(pluginID string) error {
+	for _, denied := range p.Deny {
+		if denied == pluginID {
+			return ErrPluginNotAllowed{PluginID: pluginID, Denied: true}
+		}
+	}
+
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for _, allowed := range p.Allow {
+		if allowed == pluginID {
+			return nil
+		}
+	}
+
+	return ErrPluginNotAllowed{PluginID: pluginID}
+}
@@ -0,0 +1,147 @@
+package installer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ProgressState is the install state of a plugin reported to a Progress.
+type ProgressState int
+
+const (
+	ProgressQueued ProgressState = iota
+	ProgressDownloading
+	ProgressExtracting
+	ProgressComplete
+	ProgressFailed
+)
+
+func (s ProgressState) String() string {
+	switch s {
+	case ProgressQueued:
+		return "queued"
+	case ProgressDownloading:
+		return "downloading"
+	case ProgressExtracting:
+		return "extracting"
+	case ProgressComplete:
+		return "complete"
+	case ProgressFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Progress aggregates the install state of the plugins of a batch, dependencies included, into a single status line
+// such as "3/10 complete, downloading grafana-piechart-panel". Without a terminal, a line is written per state change instead.
+// The plugins of a batch are installed one after the other, so at most one plugin is in progress at a time.
+type Progress struct {
+	out      io.Writer
+	terminal bool
+	// pluginIDs keeps the order the plugins were first reported in
+	pluginIDs []string
+	states    map[string]ProgressState
+	errs      map[string]error
+	// current is the plugin being downloaded or extracted, if any
+	current string
+}
+
+// NewProgress returns a Progress writing to out, with the plugins queued. The terminal flag tells whether out is a terminal,
+// in which case the status line is rewritten in place.
+func NewProgress(out io.Writer, terminal bool, pluginIDs ...string) *Progress {
+	p := &Progress{
+		out:      out,
+		terminal: terminal,
+		states:   map[string]ProgressState{},
+		errs:     map[string]error{},
+	}
+	for _, pluginID := range pluginIDs {
+		p.track(pluginID)
+		p.states[pluginID] = ProgressQueued
+	}
+
+	return p
+}
+
+// WithProgress makes the Installer report the install state of the plugins it installs to the progress.
+func WithProgress(progress *Progress) Option {
+	return func(i *Installer) {
+		i.progress = progress
+	}
+}
+
+func (i *Installer) reportProgress(pluginID string, state ProgressState, err error) {
+	if i.progress != nil {
+		i.progress.Set(pluginID, state, err)
+	}
+}
+
+// Set changes the install state of the plugin, which is tracked from then on if it wasn't already.
+func (p *Progress) Set(pluginID string, state ProgressState, err error) {
+	p.track(pluginID)
+	p.states[pluginID] = state
+	if state == ProgressFailed {
+		p.errs[pluginID] = err
+	} else {
+		delete(p.errs, pluginID)
+	}
+	if state == ProgressDownloading || state == ProgressExtracting {
+		p.current = pluginID
+	} else if p.current == pluginID {
+		p.current = ""
+	}
+
+	if p.terminal {
+		fmt.Fprintf(p.out, "\r\033[K%s", p.status())
+	} else if state == ProgressFailed {
+		fmt.Fprintf(p.out, "%s: %s: %v\n", pluginID, state, err)
+	} else {
+		fmt.Fprintf(p.out, "%s: %s\n", pluginID, state)
+	}
+}
+
+// Finish ends the status line and writes how many plugins were installed, along with the error of each failed plugin.
+func (p *Progress) Finish() {
+	if p.terminal {
+		fmt.Fprintln(p.out)
+	}
+
+	counts := p.counts()
+	fmt.Fprintf(p.out, "Installed %d of %d plugins\n", counts[ProgressComplete], len(p.pluginIDs))
+	for _, pluginID := range p.pluginIDs {
+		if p.states[pluginID] == ProgressFailed {
+			fmt.Fprintf(p.out, "  %s: %v\n", pluginID, p.errs[pluginID])
+		}
+	}
+}
+
+func (p *Progress) track(pluginID string) {
+	if _, exists := p.states[pluginID]; !exists {
+		p.pluginIDs = append(p.pluginIDs, pluginID)
+	}
+}
+
+func (p *Progress) counts() map[ProgressState]int {
+	counts := map[ProgressState]int{}
+	for _, state := range p.states {
+		counts[state]++
+	}
+
+	return counts
+}
+
+// status returns the aggregated status, along with the number of failed plugins and the plugin in progress if any.
+func (p *Progress) status() string {
+	counts := p.counts()
+	parts := []string{fmt.Sprintf("%d/%d complete", counts[ProgressComplete], len(p.pluginIDs))}
+	if counts[ProgressFailed] > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[ProgressFailed], ProgressFailed))
+	}
+	if p.current != "" {
+		parts = append(parts, fmt.Sprintf("%s %s", p.states[p.current], p.current))
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,27 @@
+package installer
+
+// InstallReport records the plugins installed by the Installer in the order they were installed,
+// so that the outcome of an install can be reported in a machine-readable way.
+// The requested plugin comes first, followed by the dependencies it installed.
+type InstallReport struct {
+	Plugins []ReportedPlugin `json:"plugins"`
+}
+
+type ReportedPlugin struct {
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	// Dir is the directory the plugin was extracted to
+	Dir    string `json:"dir"`
+	SHA256 string `json:"sha256"`
+}
+
+// WithInstallReport makes the Installer record the plugins it installs in the report.
+func WithInstallReport(report *InstallReport) Option {
+	return func(i *Installer) {
+		i.report = report
+	}
+}
+
+func (r *InstallReport) add(plugin ReportedPlugin) {
+	r.Plugins = append(r.Plugins, plugin)
+}
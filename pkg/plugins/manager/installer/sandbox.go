@@ -0,0 +1,93 @@
+package installer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// WithSandbox makes the Installer extract plugins into a sandbox directory next to the plugins directory,
+// and only move them into the plugins directory once they've been verified. A plugin that fails verification
+// never appears in the plugins directory, and the plugin it would have replaced is left in place.
+func WithSandbox() Option {
+	return func(i *Installer) {
+		i.sandbox = true
+	}
+}
+
+// extractInSandbox extracts the archive into a new sandbox directory and verifies the extracted plugin.
+// It returns the directory of the verified plugin, and a function removing the sandbox that the caller
+// must call once the plugin has been moved out of it.
+func (i *Installer) extractInSandbox(archiveFile, pluginsDir, pluginID, version string) (string, InstalledPlugin, func(), error) {
+	pluginsDir, err := filepath.Abs(pluginsDir)
+	if err != nil {
+		return "", InstalledPlugin{}, nil, err
+	}
+
+	// the sandbox is next to the plugins directory rather than in it, so that the plugins are never loaded
+	// from it, and on the same file system, so that the verified plugin can be moved atomically
+	parentDir := filepath.Dir(pluginsDir)
+	// We can ignore gosec G301 here since it makes sense to give all users read access
+	// nolint:gosec
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
+		return "", InstalledPlugin{}, nil, err
+	}
+	sandboxDir, err := ioutil.TempDir(parentDir, "."+filepath.Base(pluginsDir)+"-sandbox-")
+	if err != nil {
+		return "", InstalledPlugin{}, nil, fmt.Errorf("%v: %w", "failed to create sandbox directory", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(sandboxDir); err != nil {
+			i.log.Warn("Failed to remove sandbox directory", "dir", sandboxDir, "err", err)
+		}
+	}
+
+	if err := i.extractFiles(archiveFile, pluginID, sandboxDir); err != nil {
+		cleanup()
+		return "", InstalledPlugin{}, nil, fmt.Errorf("%v: %w", "failed to extract plugin archive", err)
+	}
+
+	extractedDir := filepath.Join(sandboxDir, pluginID)
+	res, err := i.verifyExtractedPlugin(extractedDir, pluginID, version)
+	if err != nil {
+		cleanup()
+		return "", InstalledPlugin{}, nil, err
+	}
+
+	return extractedDir, res, cleanup, nil
+}
+
+// commitSandbox moves the verified plugin out of the sandbox into the plugins directory, replacing the installed plugin.
+// The replaced plugin is moved into the sandbox, so that it's removed along with it, unless it's backed up.
+func (i *Installer) commitSandbox(extractedDir, pluginsDir, pluginID string) error {
+	// We can ignore gosec G301 here since it makes sense to give all users read access
+	// nolint:gosec
+	if err := os.MkdirAll(pluginsDir, 0755); err != nil {
+		return err
+	}
+
+	pluginDir := filepath.Join(pluginsDir, pluginID)
+	replacedDir := ""
+	if i.backupExisting {
+		if err := i.backupPlugin(pluginsDir, pluginID); err != nil {
+			return err
+		}
+	} else if _, err := os.Stat(pluginDir); !os.IsNotExist(err) {
+		replacedDir = filepath.Join(filepath.Dir(extractedDir), pluginID+".replaced")
+		if err := os.Rename(pluginDir, replacedDir); err != nil {
+			return fmt.Errorf("%v: %w", "failed to move installed plugin out of the plugins directory", err)
+		}
+	}
+
+	if err := os.Rename(extractedDir, pluginDir); err != nil {
+		if replacedDir != "" {
+			if restoreErr := os.Rename(replacedDir, pluginDir); restoreErr != nil {
+				i.log.Warn("Failed to restore replaced plugin", "pluginID", pluginID, "err", restoreErr)
+			}
+		}
+		return fmt.Errorf("%v: %w", "failed to move plugin out of the sandbox", err)
+	}
+
+	return nil
+}
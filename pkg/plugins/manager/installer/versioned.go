@@ -0,0 +1,176 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// currentVersionLink points to the active version of a plugin installed in versioned mode.
+	currentVersionLink = "current"
+	// previousVersionLink points to the version that was active before the last install or rollback.
+	previousVersionLink = "previous"
+	// incomingVersionDir holds a plugin version while it's extracted, since the version of plugins
+	// installed from a URL is only known once plugin.json has been read.
+	incomingVersionDir = ".incoming"
+)
+
+// WithVersioned makes the Installer extract plugins into a directory per version and point a
+// "current" symlink at the installed version. The previously active version is kept, so that
+// a bad upgrade can be undone with Rollback.
+func WithVersioned() Option {
+	return func(i *Installer) {
+		i.versioned = true
+	}
+}
+
+// IsVersioned reports whether the plugin directory holds versions installed in versioned mode.
+func IsVersioned(pluginDir string) bool {
+	fi, err := os.Lstat(filepath.Join(pluginDir, currentVersionLink))
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
+
+// installVersion extracts the archive into a version directory of the plugin, and then repoints
+// the current symlink to it.
+func (i *Installer) installVersion(archiveFile, pluginsDir, pluginID, version string) (InstalledPlugin, error) {
+	pluginDir := filepath.Join(pluginsDir, pluginID)
+	if err := i.migrateToVersioned(pluginsDir, pluginID); err != nil {
+		return InstalledPlugin{}, fmt.Errorf("%v: %w", "failed to move existing plugin into a version directory", err)
+	}
+
+	var (
+		extractedDir string
+		res          InstalledPlugin
+		err          error
+	)
+	if i.sandbox {
+		var cleanup func()
+		extractedDir, res, cleanup, err = i.extractInSandbox(archiveFile, pluginsDir, pluginID, version)
+		if err != nil {
+			return InstalledPlugin{}, err
+		}
+		defer cleanup()
+	} else {
+		if err := i.extractFiles(archiveFile, incomingVersionDir, pluginDir); err != nil {
+			return InstalledPlugin{}, fmt.Errorf("%v: %w", "failed to extract plugin archive", err)
+		}
+
+		extractedDir = filepath.Join(pluginDir, incomingVersionDir)
+		if res, err = i.verifyExtractedPlugin(extractedDir, pluginID, version); err != nil {
+			return InstalledPlugin{}, err
+		}
+	}
+
+	installedVersion := res.Info.Version
+	if filepath.Base(installedVersion) != installedVersion || installedVersion == ".." {
+		return InstalledPlugin{}, fmt.Errorf("%q is not a valid version for a version directory", installedVersion)
+	}
+
+	versionDir := filepath.Join(pluginDir, installedVersion)
+	if err := os.RemoveAll(versionDir); err != nil {
+		return InstalledPlugin{}, err
+	}
+	if err := os.Rename(extractedDir, versionDir); err != nil {
+		return InstalledPlugin{}, err
+	}
+
+	previous, err := os.Readlink(filepath.Join(pluginDir, currentVersionLink))
+	if err != nil && !os.IsNotExist(err) {
+		return InstalledPlugin{}, err
+	}
+	if err := switchVersionLink(pluginDir, currentVersionLink, installedVersion); err != nil {
+		return InstalledPlugin{}, fmt.Errorf("%v: %w", "failed to switch current version", err)
+	}
+	if previous != "" && previous != installedVersion {
+		if err := switchVersionLink(pluginDir, previousVersionLink, previous); err != nil {
+			i.log.Warnf("Failed to keep v%s of %s for rollback: %v", previous, pluginID, err)
+		}
+	}
+
+	return res, nil
+}
+
+// migrateToVersioned moves a plugin that was installed without versioned mode into a version directory,
+// so that it can be rolled back to once the new version is installed.
+func (i *Installer) migrateToVersioned(pluginsDir, pluginID string) error {
+	pluginDir := filepath.Join(pluginsDir, pluginID)
+	if _, err := os.Stat(pluginDir); os.IsNotExist(err) {
+		// We can ignore gosec G301 here since it makes sense to give all users read access
+		// nolint:gosec
+		return os.MkdirAll(pluginDir, 0755)
+	}
+	if IsVersioned(pluginDir) {
+		return nil
+	}
+
+	existing, err := toPluginDTO(pluginsDir, pluginID)
+	if err != nil || filepath.Base(existing.Info.Version) != existing.Info.Version {
+		i.log.Debugf("Removing existing installation of plugin %s", pluginDir)
+		if err := os.RemoveAll(pluginDir); err != nil {
+			return err
+		}
+		// nolint:gosec
+		return os.MkdirAll(pluginDir, 0755)
+	}
+
+	tmpDir := filepath.Join(pluginsDir, "."+pluginID+".migrating")
+	if err := os.Rename(pluginDir, tmpDir); err != nil {
+		return err
+	}
+	// nolint:gosec
+	if err := os.MkdirAll(pluginDir, 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, filepath.Join(pluginDir, existing.Info.Version)); err != nil {
+		return err
+	}
+
+	return switchVersionLink(pluginDir, currentVersionLink, existing.Info.Version)
+}
+
+// Rollback points the current symlink of a plugin installed in versioned mode back to the previous version,
+// and returns the version that is now active.
+func Rollback(pluginsDir, pluginID string) (string, error) {
+	pluginDir := filepath.Join(pluginsDir, pluginID)
+	if !IsVersioned(pluginDir) {
+		return "", fmt.Errorf("%s is not installed in versioned mode", pluginID)
+	}
+
+	current, err := os.Readlink(filepath.Join(pluginDir, currentVersionLink))
+	if err != nil {
+		return "", err
+	}
+	previous, err := os.Readlink(filepath.Join(pluginDir, previousVersionLink))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%s has no previous version to roll back to", pluginID)
+		}
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(pluginDir, previous)); err != nil {
+		return "", fmt.Errorf("%v: %w", fmt.Sprintf("previous version %s of %s can't be found", previous, pluginID), err)
+	}
+
+	if err := switchVersionLink(pluginDir, currentVersionLink, previous); err != nil {
+		return "", err
+	}
+	if err := switchVersionLink(pluginDir, previousVersionLink, current); err != nil {
+		return "", err
+	}
+
+	return previous, nil
+}
+
+// switchVersionLink atomically points the named symlink in the plugin directory to the version directory.
+func switchVersionLink(pluginDir, name, version string) error {
+	tmpLink := filepath.Join(pluginDir, "."+name+".tmp")
+	if err := os.Remove(tmpLink); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Symlink(version, tmpLink); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpLink, filepath.Join(pluginDir, name))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/grafana/grafana/pkg/infra/fs"
 	"github.com/grafana/grafana/pkg/infra/log"
@@ -13,6 +14,13 @@ import (
 
 var walk = util.Walk
 
+// currentVersionLink points to the active version of plugins installed in versioned mode by the plugin installer.
+const currentVersionLink = "current"
+
+// backupMarker is part of the name of the plugin-id.bak-<timestamp> directories the plugin installer backs up
+// replaced plugins to.
+const backupMarker = ".bak-"
+
 type Finder struct {
 	log log.Logger
 }
@@ -46,6 +54,8 @@ func (f *Finder) Find(pluginPaths []string) ([]string, error) {
 
 func (f *Finder) getAbsPluginJSONPaths(path string) ([]string, error) {
 	var pluginJSONPaths []string
+	// the active version of a versioned plugin is reached both directly and through its current symlink
+	walkedVersions := map[string]struct{}{}
 
 	var err error
 	path, err = filepath.Abs(path)
@@ -73,6 +83,15 @@ func (f *Finder) getAbsPluginJSONPaths(path string) ([]string, error) {
 			}
 
 			if fi.IsDir() {
+				if currentPath != path && strings.Contains(fi.Name(), backupMarker) {
+					return util.ErrWalkSkipDir
+				}
+				if activeVersion, versioned := activePluginVersion(filepath.Dir(currentPath)); versioned {
+					if _, walked := walkedVersions[currentPath]; walked || fi.Name() != activeVersion {
+						return util.ErrWalkSkipDir
+					}
+					walkedVersions[currentPath] = struct{}{}
+				}
 				return nil
 			}
 
@@ -88,3 +107,12 @@ func (f *Finder) getAbsPluginJSONPaths(path string) ([]string, error) {
 
 	return pluginJSONPaths, nil
 }
+
+// activePluginVersion returns the version directory the current symlink of a versioned plugin directory points to.
+func activePluginVersion(pluginDir string) (string, bool) {
+	version, err := os.Readlink(filepath.Join(pluginDir, currentVersionLink))
+	if err != nil {
+		return "", false
+	}
+	return version, true
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -124,4 +125,39 @@ func TestFinder_getAbsPluginJSONPaths(t *testing.T) {
 		require.Error(t, err)
 		require.Empty(t, paths)
 	})
+
+	t.Run("When scanning a versioned plugin should only return its current version", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+		pluginDir := filepath.Join(pluginsDir, "test-app")
+		for _, version := range []string{"1.0.0", "2.0.0"} {
+			err := os.MkdirAll(filepath.Join(pluginDir, version), 0750)
+			require.NoError(t, err)
+			err = os.WriteFile(filepath.Join(pluginDir, version, "plugin.json"), []byte(`{"id": "test-app"}`), 0600)
+			require.NoError(t, err)
+		}
+		require.NoError(t, os.Symlink("2.0.0", filepath.Join(pluginDir, "current")))
+		require.NoError(t, os.Symlink("1.0.0", filepath.Join(pluginDir, "previous")))
+
+		finder := New()
+		paths, err := finder.getAbsPluginJSONPaths(pluginsDir)
+		require.NoError(t, err)
+		require.Len(t, paths, 1)
+		require.Equal(t, "2.0.0", filepath.Base(filepath.Dir(paths[0])))
+	})
+
+	t.Run("When scanning plugins should skip the backups of replaced plugins", func(t *testing.T) {
+		pluginsDir := t.TempDir()
+		for _, dir := range []string{"test-app", "test-app.bak-20220101T000000.000000000"} {
+			err := os.MkdirAll(filepath.Join(pluginsDir, dir), 0750)
+			require.NoError(t, err)
+			err = os.WriteFile(filepath.Join(pluginsDir, dir, "plugin.json"), []byte(`{"id": "test-app"}`), 0600)
+			require.NoError(t, err)
+		}
+
+		finder := New()
+		paths, err := finder.getAbsPluginJSONPaths(pluginsDir)
+		require.NoError(t, err)
+		require.Len(t, paths, 1)
+		require.Equal(t, "test-app", filepath.Base(filepath.Dir(paths[0])))
+	})
 }
@@ -49,14 +49,14 @@ func (s *AccessControlStore) SetUserResourcePermission(
 	var err error
 	var permission *accesscontrol.ResourcePermission
 	err = s.sql.WithTransactionalDbSession(ctx, func(sess *sqlstore.DBSession) error {
-		permission, err = s.setUserResourcePermission(sess, orgID, usr, cmd, hook)
+		permission, err = s.setUserResourcePermission(ctx, sess, orgID, usr, cmd, hook)
 		return err
 	})
 
 	return permission, err
 }
 func (s *AccessControlStore) setUserResourcePermission(
-	sess *sqlstore.DBSession, orgID int64, user accesscontrol.User,
+	ctx context.Context, sess *sqlstore.DBSession, orgID int64, user accesscontrol.User,
 	cmd types.SetResourcePermissionCommand,
 	hook types.UserResourceHookFunc,
 ) (*accesscontrol.ResourcePermission, error) {
@@ -66,7 +66,7 @@ func (s *AccessControlStore) setUserResourcePermission(
 	}
 
 	if hook != nil {
-		if err := hook(sess, orgID, user, cmd.ResourceID, cmd.Permission); err != nil {
+		if err := hook(ctx, sess, orgID, user, cmd.ResourceID, cmd.Permission); err != nil {
 			return nil, err
 		}
 	}
@@ -168,7 +168,7 @@ func (s *AccessControlStore) SetResourcePermissions(
 		for _, cmd := range commands {
 			var p *accesscontrol.ResourcePermission
 			if cmd.User.ID != 0 {
-				p, err = s.setUserResourcePermission(sess, orgID, cmd.User, cmd.SetResourcePermissionCommand, hooks.User)
+				p, err = s.setUserResourcePermission(ctx, sess, orgID, cmd.User, cmd.SetResourcePermissionCommand, hooks.User)
 			} else if cmd.TeamID != 0 {
 				p, err = s.setTeamResourcePermission(sess, orgID, cmd.TeamID, cmd.SetResourcePermissionCommand, hooks.Team)
 			} else if models.RoleType(cmd.BuiltinRole).IsValid() || cmd.BuiltinRole == accesscontrol.RoleGrafanaAdmin {
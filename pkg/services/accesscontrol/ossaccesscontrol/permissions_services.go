@@ -10,6 +10,7 @@ import (
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/accesscontrol"
 	"github.com/grafana/grafana/pkg/services/accesscontrol/resourcepermissions"
+	"github.com/grafana/grafana/pkg/services/contexthandler"
 	"github.com/grafana/grafana/pkg/services/dashboards"
 	"github.com/grafana/grafana/pkg/services/serviceaccounts"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
@@ -70,7 +71,7 @@ func ProvideTeamPermissions(
 		ReaderRoleName: "Team permission reader",
 		WriterRoleName: "Team permission writer",
 		RoleGroup:      "Teams",
-		OnSetUser: func(session *sqlstore.DBSession, orgID int64, user accesscontrol.User, resourceID, permission string) error {
+		OnSetUser: func(ctx context.Context, session *sqlstore.DBSession, orgID int64, user accesscontrol.User, resourceID, permission string) error {
 			teamId, err := strconv.ParseInt(resourceID, 10, 64)
 			if err != nil {
 				return err
@@ -81,11 +82,16 @@ func ProvideTeamPermissions(
 			case "Admin":
 				return sqlstore.AddOrUpdateTeamMemberHook(session, user.ID, orgID, teamId, user.IsExternal, models.PERMISSION_ADMIN)
 			case "":
-				return sqlstore.RemoveTeamMemberHook(session, &models.RemoveTeamMemberCommand{
+				cmd := &models.RemoveTeamMemberCommand{
 					OrgId:  orgID,
 					UserId: user.ID,
 					TeamId: teamId,
-				})
+				}
+				// record who removed the member when the permission is set from a request
+				if reqCtx := contexthandler.FromContext(ctx); reqCtx != nil && reqCtx.SignedInUser != nil {
+					cmd.ActorId = reqCtx.UserId
+				}
+				return sqlstore.RemoveTeamMemberHook(session, cmd)
 			default:
 				return fmt.Errorf("invalid team permission type %s", permission)
 			}
@@ -0,0 +1,73 @@
+package ossaccesscontrol
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/api/routing"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
+	"github.com/grafana/grafana/pkg/services/accesscontrol/database"
+	acmock "github.com/grafana/grafana/pkg/services/accesscontrol/mock"
+	"github.com/grafana/grafana/pkg/services/contexthandler/ctxkey"
+	"github.com/grafana/grafana/pkg/services/licensing"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/user"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+func TestIntegrationTeamPermissions_RemoveMember(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	setup := func(t *testing.T) (*sqlstore.SQLStore, *TeamPermissionsService, models.Team, *user.User, *user.User) {
+		db := sqlstore.InitTestDB(t)
+		cfg := setting.NewCfg()
+		cfg.RBACEnabled = true
+		teamPermissions, err := ProvideTeamPermissions(cfg, routing.NewRouteRegister(), db, acmock.New(), database.ProvideService(db), &licensing.OSSLicensingService{})
+		require.NoError(t, err)
+
+		team, err := db.CreateTeam("team", "", 1)
+		require.NoError(t, err)
+		actor, err := db.CreateUser(context.Background(), user.CreateUserCommand{Login: "actor", Email: "actor@test.com"})
+		require.NoError(t, err)
+		member, err := db.CreateUser(context.Background(), user.CreateUserCommand{Login: "member", Email: "member@test.com"})
+		require.NoError(t, err)
+
+		_, err = teamPermissions.SetUserPermission(context.Background(), 1, accesscontrol.User{ID: member.ID}, strconv.FormatInt(team.Id, 10), "Member")
+		require.NoError(t, err)
+		return db, teamPermissions, team, actor, member
+	}
+
+	t.Run("should record the signed in user as the actor", func(t *testing.T) {
+		db, teamPermissions, team, actor, member := setup(t)
+
+		ctx := ctxkey.Set(context.Background(), &models.ReqContext{SignedInUser: &models.SignedInUser{UserId: actor.ID, OrgId: 1}})
+		_, err := teamPermissions.SetUserPermission(ctx, 1, accesscontrol.User{ID: member.ID}, strconv.FormatInt(team.Id, 10), "")
+		require.NoError(t, err)
+
+		removals, err := db.GetTeamsUserRemovedFrom(context.Background(), 1, member.ID, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		require.Len(t, removals, 1)
+		require.Equal(t, team.Id, removals[0].TeamId)
+		require.Equal(t, actor.ID, removals[0].ActorId)
+		require.Equal(t, "actor", removals[0].ActorLogin)
+	})
+
+	t.Run("should record an unknown actor without a signed in user", func(t *testing.T) {
+		db, teamPermissions, team, _, member := setup(t)
+
+		_, err := teamPermissions.SetUserPermission(context.Background(), 1, accesscontrol.User{ID: member.ID}, strconv.FormatInt(team.Id, 10), "")
+		require.NoError(t, err)
+
+		removals, err := db.GetTeamsUserRemovedFrom(context.Background(), 1, member.ID, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		require.Len(t, removals, 1)
+		require.Equal(t, int64(0), removals[0].ActorId)
+	})
+}
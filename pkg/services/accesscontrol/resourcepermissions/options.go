@@ -31,8 +31,8 @@ type Options struct {
 	WriterRoleName string
 	// RoleGroup is the group name for the generated fixed roles
 	RoleGroup string
-	// OnSetUser if configured will be called each time a permission is set for a user
-	OnSetUser func(session *sqlstore.DBSession, orgID int64, user accesscontrol.User, resourceID, permission string) error
+	// OnSetUser if configured will be called each time a permission is set for a user, with the context the permission was set with
+	OnSetUser func(ctx context.Context, session *sqlstore.DBSession, orgID int64, user accesscontrol.User, resourceID, permission string) error
 	// OnSetTeam if configured will be called each time a permission is set for a team
 	OnSetTeam func(session *sqlstore.DBSession, orgID, teamID int64, resourceID, permission string) error
 	// OnSetBuiltInRole if configured will be called each time a permission is set for a built-in role
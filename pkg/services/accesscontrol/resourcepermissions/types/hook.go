@@ -1,6 +1,8 @@
 package types
 
 import (
+	"context"
+
 	"github.com/grafana/grafana/pkg/services/accesscontrol"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
 )
@@ -11,7 +13,7 @@ type ResourceHooks struct {
 	BuiltInRole BuiltinResourceHookFunc
 }
 
-type UserResourceHookFunc func(session *sqlstore.DBSession, orgID int64, user accesscontrol.User, resourceID, permission string) error
+type UserResourceHookFunc func(ctx context.Context, session *sqlstore.DBSession, orgID int64, user accesscontrol.User, resourceID, permission string) error
 type TeamResourceHookFunc func(session *sqlstore.DBSession, orgID, teamID int64, resourceID, permission string) error
 type BuiltinResourceHookFunc func(session *sqlstore.DBSession, orgID int64, builtInRole, resourceID, permission string) error
 
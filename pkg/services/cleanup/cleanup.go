@@ -6,8 +6,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"time"
 
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
 	"github.com/grafana/grafana/pkg/services/dashboardsnapshots"
 	dashver "github.com/grafana/grafana/pkg/services/dashboardversion"
 	"github.com/grafana/grafana/pkg/services/queryhistory"
@@ -23,7 +25,8 @@ import (
 
 func ProvideService(cfg *setting.Cfg, serverLockService *serverlock.ServerLockService,
 	shortURLService shorturls.Service, store sqlstore.Store, queryHistoryService queryhistory.Service,
-	dashboardVersionService dashver.Service, dashSnapSvc dashboardsnapshots.Service) *CleanUpService {
+	dashboardVersionService dashver.Service, dashSnapSvc dashboardsnapshots.Service,
+	teamPermissionsService accesscontrol.TeamPermissionsService) *CleanUpService {
 	s := &CleanUpService{
 		Cfg:                      cfg,
 		ServerLockService:        serverLockService,
@@ -33,6 +36,7 @@ func ProvideService(cfg *setting.Cfg, serverLockService *serverlock.ServerLockSe
 		log:                      log.New("cleanup"),
 		dashboardVersionService:  dashboardVersionService,
 		dashboardSnapshotService: dashSnapSvc,
+		teamPermissionsService:   teamPermissionsService,
 	}
 	return s
 }
@@ -46,6 +50,7 @@ type CleanUpService struct {
 	QueryHistoryService      queryhistory.Service
 	dashboardVersionService  dashver.Service
 	dashboardSnapshotService dashboardsnapshots.Service
+	teamPermissionsService   accesscontrol.TeamPermissionsService
 }
 
 func (srv *CleanUpService) Run(ctx context.Context) error {
@@ -63,6 +68,7 @@ func (srv *CleanUpService) Run(ctx context.Context) error {
 			srv.deleteExpiredDashboardVersions(ctx)
 			srv.cleanUpOldAnnotations(ctxWithTimeout)
 			srv.expireOldUserInvites(ctx)
+			srv.expireTeamMemberships(ctx)
 			srv.deleteStaleShortURLs(ctx)
 			srv.deleteStaleQueryHistory(ctx)
 			err := srv.ServerLockService.LockAndExecute(ctx, "delete old login attempts",
@@ -184,6 +190,32 @@ func (srv *CleanUpService) expireOldUserInvites(ctx context.Context) {
 	}
 }
 
+// expireTeamMemberships removes the expired team memberships the same way members are removed from a team,
+// which revokes the team permissions of the member and records the removal. An expired admin is kept if
+// removing it would leave its team without an admin.
+func (srv *CleanUpService) expireTeamMemberships(ctx context.Context) {
+	expired, err := srv.store.GetExpiredTeamMembers(ctx)
+	if err != nil {
+		srv.log.Error("Problem expiring team memberships", "error", err.Error())
+		return
+	}
+
+	var removed int64
+	for _, member := range expired {
+		teamID := strconv.FormatInt(member.TeamId, 10)
+		if _, err := srv.teamPermissionsService.SetUserPermission(ctx, member.OrgId, accesscontrol.User{ID: member.UserId}, teamID, ""); err != nil {
+			if errors.Is(err, models.ErrLastTeamAdmin) {
+				srv.log.Warn("Keeping expired team membership of the last team admin", "orgId", member.OrgId, "teamId", member.TeamId, "userId", member.UserId)
+				continue
+			}
+			srv.log.Error("Problem expiring team membership", "orgId", member.OrgId, "teamId", member.TeamId, "userId", member.UserId, "error", err.Error())
+			continue
+		}
+		removed++
+	}
+	srv.log.Debug("Expired team memberships", "rows affected", removed)
+}
+
 func (srv *CleanUpService) deleteStaleShortURLs(ctx context.Context) {
 	cmd := models.DeleteShortUrlCommand{
 		OlderThan: time.Now().Add(-time.Hour * 24 * 7),
@@ -1,9 +1,21 @@
 package cleanup
 
 import (
+	"context"
+	"fmt"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/grafana/grafana/pkg/api/routing"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
+	"github.com/grafana/grafana/pkg/services/accesscontrol/database"
+	acmock "github.com/grafana/grafana/pkg/services/accesscontrol/mock"
+	"github.com/grafana/grafana/pkg/services/accesscontrol/ossaccesscontrol"
+	"github.com/grafana/grafana/pkg/services/licensing"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/user"
 	"github.com/grafana/grafana/pkg/setting"
 	"github.com/stretchr/testify/require"
 )
@@ -35,3 +47,68 @@ func TestCleanUpTmpFiles(t *testing.T) {
 		require.False(t, service.shouldCleanupTempFile(weekAgo, now))
 	})
 }
+
+func TestIntegrationExpireTeamMemberships(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	ctx := context.Background()
+	db := sqlstore.InitTestDB(t)
+	cfg := setting.NewCfg()
+	cfg.RBACEnabled = true
+	teamPermissions, err := ossaccesscontrol.ProvideTeamPermissions(cfg, routing.NewRouteRegister(), db, acmock.New(), database.ProvideService(db), &licensing.OSSLicensingService{})
+	require.NoError(t, err)
+	service := CleanUpService{
+		log:                    log.New("cleanup"),
+		store:                  db,
+		teamPermissionsService: teamPermissions,
+	}
+
+	team, err := db.CreateTeam("team", "", 1)
+	require.NoError(t, err)
+	teamID := strconv.FormatInt(team.Id, 10)
+	userIDs := make([]int64, 3)
+	expired := time.Now().Add(-time.Hour)
+	for i, permission := range []string{"Admin", "Admin", "Member"} {
+		usr, err := db.CreateUser(ctx, user.CreateUserCommand{Login: fmt.Sprintf("user%d", i), Email: fmt.Sprintf("user%d@test.com", i)})
+		require.NoError(t, err)
+		userIDs[i] = usr.ID
+		_, err = teamPermissions.SetUserPermission(ctx, 1, accesscontrol.User{ID: usr.ID}, teamID, permission)
+		require.NoError(t, err)
+		require.NoError(t, db.SetTeamMemberExpiry(ctx, 1, team.Id, usr.ID, &expired))
+	}
+
+	service.expireTeamMemberships(ctx)
+
+	teamPermissionCount := func(userID int64) int64 {
+		var count int64
+		err := db.WithDbSession(ctx, func(sess *sqlstore.DBSession) error {
+			_, err := sess.SQL(`SELECT COUNT(*) FROM permission
+				INNER JOIN user_role ON user_role.role_id = permission.role_id
+				WHERE user_role.user_id = ? AND permission.scope = ?`, userID, "teams:id:"+teamID).Get(&count)
+			return err
+		})
+		require.NoError(t, err)
+		return count
+	}
+
+	// the second admin is kept, since removing it would leave the team without an admin
+	for i, expectedMember := range []bool{false, true, false} {
+		isMember, err := db.IsTeamMember(1, team.Id, userIDs[i])
+		require.NoError(t, err)
+		require.Equal(t, expectedMember, isMember)
+
+		if expectedMember {
+			require.NotZero(t, teamPermissionCount(userIDs[i]))
+			continue
+		}
+		require.Zero(t, teamPermissionCount(userIDs[i]))
+
+		removals, err := db.GetTeamsUserRemovedFrom(ctx, 1, userIDs[i], time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		require.Len(t, removals, 1)
+		require.Equal(t, team.Id, removals[0].TeamId)
+		require.Zero(t, removals[0].ActorId)
+	}
+}
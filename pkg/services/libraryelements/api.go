@@ -1,24 +1,43 @@
 package libraryelements
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/grafana/grafana/pkg/api/dtos"
 	"github.com/grafana/grafana/pkg/api/response"
 	"github.com/grafana/grafana/pkg/api/routing"
 	"github.com/grafana/grafana/pkg/middleware"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/dashboards"
+	dashver "github.com/grafana/grafana/pkg/services/dashboardversion"
 	"github.com/grafana/grafana/pkg/web"
 )
 
 func (l *LibraryElementService) registerAPIEndpoints() {
 	l.RouteRegister.Group("/api/library-elements", func(entities routing.RouteRegister) {
 		entities.Post("/", middleware.ReqSignedIn, routing.Wrap(l.createHandler))
+		entities.Post("/bulk-permissions", middleware.ReqSignedIn, routing.Wrap(l.bulkPermissionsHandler))
+		entities.Post("/bulk-move", middleware.ReqSignedIn, routing.Wrap(l.bulkMoveHandler))
+		entities.Post("/bulk-tag", middleware.ReqSignedIn, routing.Wrap(l.bulkTagHandler))
+		entities.Post("/validate", middleware.ReqSignedIn, routing.Wrap(l.validateHandler))
+		entities.Post("/import", middleware.ReqSignedIn, routing.Wrap(l.importHandler))
+		entities.Post("/from-panel", middleware.ReqSignedIn, routing.Wrap(l.createFromPanelHandler))
 		entities.Delete("/:uid", middleware.ReqSignedIn, routing.Wrap(l.deleteHandler))
 		entities.Get("/", middleware.ReqSignedIn, routing.Wrap(l.getAllHandler))
+		entities.Get("/broken-connections", middleware.ReqOrgAdmin, routing.Wrap(l.getBrokenConnectionsHandler))
+		entities.Get("/batch", middleware.ReqSignedIn, routing.Wrap(l.getBatchHandler))
+		entities.Get("/dashboards/:dashboardUid/versions/:version", middleware.ReqSignedIn, routing.Wrap(l.getDashboardVersionElementsHandler))
 		entities.Get("/:uid", middleware.ReqSignedIn, routing.Wrap(l.getHandler))
 		entities.Get("/:uid/connections/", middleware.ReqSignedIn, routing.Wrap(l.getConnectionsHandler))
+		entities.Get("/:uid/diff", middleware.ReqSignedIn, routing.Wrap(l.getVersionDiffHandler))
+		entities.Get("/:uid/model", middleware.ReqSignedIn, routing.Wrap(l.getModelHandler))
+		entities.Get("/:uid/permissions", middleware.ReqSignedIn, routing.Wrap(l.getPermissionsHandler))
 		entities.Get("/name/:name", middleware.ReqSignedIn, routing.Wrap(l.getByNameHandler))
 		entities.Patch("/:uid", middleware.ReqSignedIn, routing.Wrap(l.patchHandler))
 	})
@@ -42,6 +61,9 @@ func (l *LibraryElementService) createHandler(c *models.ReqContext) response.Res
 	if err := web.Bind(c.Req, &cmd); err != nil {
 		return response.Error(http.StatusBadRequest, "bad request data", err)
 	}
+	if cmd.Origin == "" {
+		cmd.Origin = c.Req.Header.Get(originHeader)
+	}
 
 	if cmd.FolderUID != nil {
 		if *cmd.FolderUID == "" {
@@ -73,12 +95,205 @@ func (l *LibraryElementService) createHandler(c *models.ReqContext) response.Res
 	return response.JSON(http.StatusOK, LibraryElementResponse{Result: element})
 }
 
+// swagger:route POST /library-elements/from-panel library_elements createLibraryElementFromPanel
+//
+// Create library panel from a dashboard panel.
+//
+// Creates a library panel from the model of a panel already on a dashboard.
+// The panel can also be replaced with a reference to the new library panel, which saves a new version of the dashboard.
+// Provisioned dashboards can't be changed, and the request fails if the dashboard is changed by someone else in the meantime.
+// The user needs to be able to edit the dashboard.
+//
+// Responses:
+// 200: getLibraryElementResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 403: forbiddenError
+// 404: notFoundError
+// 412: preconditionFailedError
+// 500: internalServerError
+func (l *LibraryElementService) createFromPanelHandler(c *models.ReqContext) response.Response {
+	cmd := CreateLibraryElementFromPanelCommand{}
+	if err := web.Bind(c.Req, &cmd); err != nil {
+		return response.Error(http.StatusBadRequest, "bad request data", err)
+	}
+
+	if cmd.FolderUID != nil {
+		if *cmd.FolderUID == "" {
+			cmd.FolderID = 0
+		} else {
+			folder, err := l.folderService.GetFolderByUID(c.Req.Context(), c.SignedInUser, c.OrgId, *cmd.FolderUID)
+			if err != nil || folder == nil {
+				return response.Error(http.StatusBadRequest, "failed to get folder", err)
+			}
+			cmd.FolderID = folder.Id
+		}
+	}
+
+	element, err := l.createLibraryElementFromPanel(c.Req.Context(), c.SignedInUser, cmd)
+	if err != nil {
+		return toLibraryElementError(err, "Failed to create library element from panel")
+	}
+
+	if element.FolderID != 0 {
+		folder, err := l.folderService.GetFolderByID(c.Req.Context(), c.SignedInUser, element.FolderID, c.OrgId)
+		if err != nil {
+			return response.Error(http.StatusInternalServerError, "failed to get folder", err)
+		}
+		element.FolderUID = folder.Uid
+		element.Meta.FolderUID = folder.Uid
+		element.Meta.FolderName = folder.Title
+	}
+	if cmd.ReplacePanel {
+		element.Meta.ConnectedDashboards = 1
+	}
+
+	return response.JSON(http.StatusOK, LibraryElementResponse{Result: element})
+}
+
+// swagger:route POST /library-elements/validate library_elements validateLibraryElements
+//
+// Validate library elements.
+//
+// Runs the checks of creating a library element for each element in the list, without creating anything.
+// Each element has its own result listing all the problems found, so that they can be fixed before creating the elements.
+//
+// Responses:
+// 200: validateLibraryElementsResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 500: internalServerError
+func (l *LibraryElementService) validateHandler(c *models.ReqContext) response.Response {
+	cmd := ValidateLibraryElementsCommand{}
+	if err := web.Bind(c.Req, &cmd); err != nil {
+		return response.Error(http.StatusBadRequest, "bad request data", err)
+	}
+
+	folderErrs := make([]error, len(cmd.Elements))
+	for i, element := range cmd.Elements {
+		if element.FolderUID == nil {
+			continue
+		}
+		if *element.FolderUID == "" {
+			cmd.Elements[i].FolderID = 0
+			continue
+		}
+		folder, err := l.folderService.GetFolderByUID(c.Req.Context(), c.SignedInUser, c.OrgId, *element.FolderUID)
+		if err != nil || folder == nil {
+			folderErrs[i] = dashboards.ErrFolderNotFound
+			continue
+		}
+		cmd.Elements[i].FolderID = folder.Id
+	}
+
+	validationErrs, err := l.validateLibraryElements(c.Req.Context(), c.SignedInUser, cmd.Elements)
+	if err != nil {
+		return toLibraryElementError(err, "Failed to validate library elements")
+	}
+
+	results := make([]LibraryElementValidationResult, 0, len(cmd.Elements))
+	for i, element := range cmd.Elements {
+		result := LibraryElementValidationResult{Index: i, UID: element.UID, Name: element.Name, Errors: []string{}}
+		errs := validationErrs[i]
+		if folderErrs[i] != nil {
+			errs = append([]error{folderErrs[i]}, errs...)
+		}
+		for _, err := range errs {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		result.Valid = len(result.Errors) == 0
+		results = append(results, result)
+	}
+
+	return response.JSON(http.StatusOK, LibraryElementValidationResponse{Result: results})
+}
+
+// swagger:route POST /library-elements/import library_elements importLibraryElements
+//
+// Import library elements.
+//
+// Creates each library element in the list, each element has its own result so that one failing element doesn't fail the others.
+// If autoCreateFolders is set, the referenced folders that don't exist are created by UID and title before creating the elements stored in them,
+// and are listed in the response.
+//
+// Responses:
+// 200: importLibraryElementsResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 500: internalServerError
+func (l *LibraryElementService) importHandler(c *models.ReqContext) response.Response {
+	cmd := ImportLibraryElementsCommand{}
+	if err := web.Bind(c.Req, &cmd); err != nil {
+		return response.Error(http.StatusBadRequest, "bad request data", err)
+	}
+
+	folderIDs := map[string]int64{}
+	createdFolders := []ImportedFolder{}
+	results := make([]ImportLibraryElementsResult, 0, len(cmd.Elements))
+	for i, element := range cmd.Elements {
+		result := ImportLibraryElementsResult{Index: i, UID: element.UID, Name: element.Name, Status: http.StatusOK}
+		create := element.CreateLibraryElementCommand
+		if create.Origin == "" {
+			create.Origin = c.Req.Header.Get(originHeader)
+		}
+
+		err := func() error {
+			if create.FolderUID == nil {
+				return nil
+			}
+			folderUID := *create.FolderUID
+			if folderUID == "" {
+				create.FolderID = 0
+				return nil
+			}
+			if folderID, ok := folderIDs[folderUID]; ok {
+				create.FolderID = folderID
+				return nil
+			}
+			folder, err := l.folderService.GetFolderByUID(c.Req.Context(), c.SignedInUser, c.OrgId, folderUID)
+			if err == nil && folder == nil {
+				err = dashboards.ErrFolderNotFound
+			}
+			if errors.Is(err, dashboards.ErrFolderNotFound) && cmd.AutoCreateFolders {
+				title := element.FolderTitle
+				if title == "" {
+					title = folderUID
+				}
+				folder, err = l.folderService.CreateFolder(c.Req.Context(), c.SignedInUser, c.OrgId, title, folderUID)
+				if err == nil {
+					createdFolders = append(createdFolders, ImportedFolder{UID: folder.Uid, Title: folder.Title})
+				}
+			}
+			if err != nil {
+				return err
+			}
+			folderIDs[folderUID] = folder.Id
+			create.FolderID = folder.Id
+			return nil
+		}()
+		if err == nil {
+			var created LibraryElementDTO
+			if created, err = l.createLibraryElement(c.Req.Context(), c.SignedInUser, create); err == nil {
+				result.UID = created.UID
+			}
+		}
+		if err != nil {
+			result.Status = toLibraryElementError(err, "Failed to import library element").Status()
+			result.Message = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return response.JSON(http.StatusOK, ImportLibraryElementsResponse{Result: results, CreatedFolders: createdFolders})
+}
+
 // swagger:route DELETE /library-elements/{library_element_uid} library_elements deleteLibraryElementByUID
 //
 // Delete library element.
 //
 // Deletes an existing library element as specified by the UID. This operation cannot be reverted.
-// You cannot delete a library element that is connected. This operation cannot be reverted.
+// You cannot delete a library element that is connected, unless you're an org admin and force the deletion.
+// The connections of a forcefully deleted library element are removed, and the affected dashboards are returned.
 //
 // Responses:
 // 200: okResponse
@@ -88,14 +303,15 @@ func (l *LibraryElementService) createHandler(c *models.ReqContext) response.Res
 // 404: notFoundError
 // 500: internalServerError
 func (l *LibraryElementService) deleteHandler(c *models.ReqContext) response.Response {
-	id, err := l.deleteLibraryElement(c.Req.Context(), c.SignedInUser, web.Params(c.Req)[":uid"])
+	id, affectedDashboards, err := l.deleteLibraryElement(c.Req.Context(), c.SignedInUser, web.Params(c.Req)[":uid"], c.QueryBool("force"))
 	if err != nil {
 		return toLibraryElementError(err, "Failed to delete library element")
 	}
 
 	return response.JSON(http.StatusOK, DeleteLibraryElementResponse{
-		Message: "Library element deleted",
-		ID:      id,
+		Message:            "Library element deleted",
+		ID:                 id,
+		AffectedDashboards: affectedDashboards,
 	})
 }
 
@@ -104,9 +320,11 @@ func (l *LibraryElementService) deleteHandler(c *models.ReqContext) response.Res
 // Get library element by UID.
 //
 // Returns a library element with the given UID.
+// The response has an ETag header, send it back in the If-None-Match header to get a 304 response if the library element hasn't changed.
 //
 // Responses:
 // 200: getLibraryElementResponse
+// 304: notModifiedResponse
 // 401: unauthorisedError
 // 404: notFoundError
 // 500: internalServerError
@@ -116,7 +334,46 @@ func (l *LibraryElementService) getHandler(c *models.ReqContext) response.Respon
 		return toLibraryElementError(err, "Failed to get library element")
 	}
 
-	return response.JSON(http.StatusOK, LibraryElementResponse{Result: element})
+	return withETag(c, response.JSON(http.StatusOK, LibraryElementResponse{Result: element}))
+}
+
+// swagger:route GET /library-elements/{library_element_uid}/model library_elements getLibraryElementModelByUID
+//
+// Get the model of a library element by UID.
+//
+// Returns only the model of the library element with the given UID, without the library element's meta data.
+// The response has an ETag header, send it back in the If-None-Match header to get a 304 response if the model hasn't changed.
+//
+// Responses:
+// 200: getLibraryElementModelResponse
+// 304: notModifiedResponse
+// 401: unauthorisedError
+// 404: notFoundError
+// 500: internalServerError
+func (l *LibraryElementService) getModelHandler(c *models.ReqContext) response.Response {
+	element, err := l.getLibraryElementByUid(c.Req.Context(), c.SignedInUser, web.Params(c.Req)[":uid"])
+	if err != nil {
+		return toLibraryElementError(err, "Failed to get library element")
+	}
+
+	return withETag(c, response.JSON(http.StatusOK, []byte(element.Model)))
+}
+
+// withETag sets the ETag header of a successful response, or replaces the response with a 304 response
+// if the ETag matches the If-None-Match header of the request.
+func withETag(c *models.ReqContext, resp *response.NormalResponse) response.Response {
+	if resp.Status() != http.StatusOK {
+		return resp
+	}
+
+	etag := libraryElementETag(resp.Body())
+	if etagMatches(c.Req.Header.Get("If-None-Match"), etag) {
+		header := make(http.Header)
+		header.Set("ETag", etag)
+		return response.CreateNormalResponse(header, nil, http.StatusNotModified)
+	}
+
+	return resp.SetHeader("ETag", etag)
 }
 
 // swagger:route GET /library-elements library_elements getLibraryElements
@@ -130,17 +387,36 @@ func (l *LibraryElementService) getHandler(c *models.ReqContext) response.Respon
 // Responses:
 // 200: getLibraryElementsResponse
 // 401: unauthorisedError
+// 403: forbiddenError
 // 500: internalServerError
 func (l *LibraryElementService) getAllHandler(c *models.ReqContext) response.Response {
 	query := searchLibraryElementsQuery{
-		perPage:       c.QueryInt("perPage"),
-		page:          c.QueryInt("page"),
-		searchString:  c.Query("searchString"),
-		sortDirection: c.Query("sortDirection"),
-		kind:          c.QueryInt("kind"),
-		typeFilter:    c.Query("typeFilter"),
-		excludeUID:    c.Query("excludeUid"),
-		folderFilter:  c.Query("folderFilter"),
+		perPage:                 c.QueryInt("perPage"),
+		page:                    c.QueryInt("page"),
+		searchString:            c.Query("searchString"),
+		sortDirection:           c.Query("sortDirection"),
+		kind:                    c.QueryInt("kind"),
+		typeFilter:              c.Query("typeFilter"),
+		excludeUID:              c.Query("excludeUid"),
+		folderFilter:            c.Query("folderFilter"),
+		generalOnly:             c.QueryBool("generalOnly"),
+		connectedDashboardQuery: c.Query("connectedDashboardQuery"),
+		unmanagedOnly:           c.QueryBool("unmanagedOnly"),
+		origin:                  c.Query("origin"),
+		humanEditedOnly:         c.QueryBool("humanEditedOnly"),
+		editableOnly:            c.QueryBool("editableOnly"),
+		dedupeByName:            c.QueryBool("dedupeByName"),
+		panelType:               c.Query("panelType"),
+		minConnections:          c.QueryInt("minConnections"),
+		tag:                     c.Query("tag"),
+	}
+	if excludeFolderUID := c.Query("excludeFolderUid"); excludeFolderUID != "" {
+		folder, err := l.folderService.GetFolderByUID(c.Req.Context(), c.SignedInUser, c.OrgId, excludeFolderUID)
+		if err != nil {
+			return toLibraryElementError(err, "Failed to get folder")
+		}
+		// folders can't be nested, so the folder is the whole subtree to exclude
+		query.excludeFolderIDs = []int64{folder.Id}
 	}
 	elementsResult, err := l.getAllLibraryElements(c.Req.Context(), c.SignedInUser, query)
 	if err != nil {
@@ -169,6 +445,9 @@ func (l *LibraryElementService) patchHandler(c *models.ReqContext) response.Resp
 	if err := web.Bind(c.Req, &cmd); err != nil {
 		return response.Error(http.StatusBadRequest, "bad request data", err)
 	}
+	if cmd.Origin == "" {
+		cmd.Origin = c.Req.Header.Get(originHeader)
+	}
 
 	if cmd.FolderUID != nil {
 		if *cmd.FolderUID == "" {
@@ -200,11 +479,42 @@ func (l *LibraryElementService) patchHandler(c *models.ReqContext) response.Resp
 	return response.JSON(http.StatusOK, LibraryElementResponse{Result: element})
 }
 
+// swagger:route GET /library-elements/{library_element_uid}/diff library_elements getLibraryElementVersionDiff
+//
+// Get the difference between two versions of a library element.
+//
+// Returns both versions of the library element and the values of the model that changed between them.
+//
+// Responses:
+// 200: getLibraryElementVersionDiffResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 404: notFoundError
+// 500: internalServerError
+func (l *LibraryElementService) getVersionDiffHandler(c *models.ReqContext) response.Response {
+	from, err := strconv.ParseInt(c.Query("from"), 10, 64)
+	if err != nil || from < 1 {
+		return response.Error(http.StatusBadRequest, "from must be a version number", err)
+	}
+	to, err := strconv.ParseInt(c.Query("to"), 10, 64)
+	if err != nil || to < 1 {
+		return response.Error(http.StatusBadRequest, "to must be a version number", err)
+	}
+
+	diff, err := l.getLibraryElementVersionDiff(c.Req.Context(), c.SignedInUser, web.Params(c.Req)[":uid"], from, to)
+	if err != nil {
+		return toLibraryElementError(err, "Failed to get library element versions")
+	}
+
+	return response.JSON(http.StatusOK, LibraryElementVersionDiffResponse{Result: diff})
+}
+
 // swagger:route GET /library-elements/{library_element_uid}/connections/ library_elements getLibraryElementConnections
 //
 // Get library element connections.
 //
-// Returns a list of connections for a library element based on the UID specified.
+// Returns a list of connections for a library element based on the UID specified, ordered by dashboard UID.
+// Use the `perPage` and `page` query parameters to page through the connections; all the connections are returned when neither is set.
 //
 // Responses:
 // 200: getLibraryElementConnectionsResponse
@@ -212,14 +522,269 @@ func (l *LibraryElementService) patchHandler(c *models.ReqContext) response.Resp
 // 404: notFoundError
 // 500: internalServerError
 func (l *LibraryElementService) getConnectionsHandler(c *models.ReqContext) response.Response {
-	connections, err := l.getConnections(c.Req.Context(), c.SignedInUser, web.Params(c.Req)[":uid"])
+	perPage := c.QueryInt("perPage")
+	page := c.QueryInt("page")
+	// connections are only paginated when asked for, for backward compatibility
+	if perPage > 0 || page > 0 {
+		if perPage <= 0 {
+			perPage = 100
+		}
+		if page <= 0 {
+			page = 1
+		}
+	}
+
+	connections, totalCount, err := l.getConnections(c.Req.Context(), c.SignedInUser, web.Params(c.Req)[":uid"], perPage, page)
 	if err != nil {
 		return toLibraryElementError(err, "Failed to get connections")
 	}
 
-	return response.JSON(http.StatusOK, LibraryElementConnectionsResponse{Result: connections})
+	return response.JSON(http.StatusOK, LibraryElementConnectionsResponse{
+		Result:     connections,
+		TotalCount: totalCount,
+		Page:       page,
+		PerPage:    perPage,
+	})
+}
+
+// swagger:route GET /library-elements/{library_element_uid}/permissions library_elements getLibraryElementPermissions
+//
+// Get library element permissions.
+//
+// Returns the users, teams and roles that can view or edit a library element.
+// Library elements inherit the permissions of the folder they are stored in.
+//
+// Responses:
+// 200: getLibraryElementPermissionsResponse
+// 401: unauthorisedError
+// 403: forbiddenError
+// 404: notFoundError
+// 500: internalServerError
+func (l *LibraryElementService) getPermissionsHandler(c *models.ReqContext) response.Response {
+	acl, err := l.getLibraryElementPermissions(c.Req.Context(), c.SignedInUser, web.Params(c.Req)[":uid"])
+	if err != nil {
+		return toLibraryElementError(err, "Failed to get library element permissions")
+	}
+
+	filteredACLs := make([]*models.DashboardACLInfoDTO, 0, len(acl))
+	for _, perm := range acl {
+		if perm.UserId > 0 && dtos.IsHiddenUser(perm.UserLogin, c.SignedInUser, l.Cfg) {
+			continue
+		}
+
+		perm.UserAvatarUrl = dtos.GetGravatarUrl(perm.UserEmail)
+
+		if perm.TeamId > 0 {
+			perm.TeamAvatarUrl = dtos.GetGravatarUrlWithDefault(perm.TeamEmail, perm.Team)
+		}
+
+		filteredACLs = append(filteredACLs, perm)
+	}
+
+	return response.JSON(http.StatusOK, LibraryElementPermissionsResponse{Result: filteredACLs})
+}
+
+// swagger:route GET /library-elements/broken-connections library_elements getLibraryElementBrokenConnections
+//
+// Get broken library element connections.
+//
+// Returns the connections whose library element or dashboard no longer exists.
+// When the library element is missing, the panels referencing it are returned when they can be found in the dashboard.
+//
+// Responses:
+// 200: getLibraryElementBrokenConnectionsResponse
+// 401: unauthorisedError
+// 403: forbiddenError
+// 500: internalServerError
+func (l *LibraryElementService) getBrokenConnectionsHandler(c *models.ReqContext) response.Response {
+	connections, err := l.getBrokenConnections(c.Req.Context(), c.SignedInUser)
+	if err != nil {
+		return toLibraryElementError(err, "Failed to get broken connections")
+	}
+
+	return response.JSON(http.StatusOK, LibraryElementBrokenConnectionsResponse{Result: connections})
+}
+
+// swagger:route POST /library-elements/bulk-permissions library_elements setLibraryElementsPermissions
+//
+// Set the folder permissions of several library elements.
+//
+// Library elements have no permissions of their own, they inherit the permissions of their folder.
+// This is a folder-wide change: it changes the permissions of the folder of each library element in the list,
+// which applies to every dashboard and library element in that folder, not only to the listed library elements.
+// Each folder is changed once, and all folders are changed in a single transaction.
+// Library elements in the General folder are rejected.
+// Each library element has its own result with the UID of its folder, elements whose folder the user
+// can't administer are reported as forbidden. The response also lists the folders whose permissions were changed.
+//
+// Responses:
+// 200: bulkLibraryElementPermissionsResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 500: internalServerError
+func (l *LibraryElementService) bulkPermissionsHandler(c *models.ReqContext) response.Response {
+	cmd := BulkLibraryElementPermissionsCommand{}
+	if err := web.Bind(c.Req, &cmd); err != nil {
+		return response.Error(http.StatusBadRequest, "bad request data", err)
+	}
+	if err := validatePermissionItems(cmd); err != nil {
+		return response.Error(http.StatusBadRequest, err.Error(), err)
+	}
+
+	folderUIDs, errs, folders := l.setLibraryElementPermissions(c.Req.Context(), c.SignedInUser, cmd)
+	results := make([]BulkLibraryElementPermissionsResult, 0, len(cmd.UIDs))
+	for i, uid := range cmd.UIDs {
+		result := BulkLibraryElementPermissionsResult{UID: uid, FolderUID: folderUIDs[i], Status: http.StatusOK}
+		if errs[i] != nil {
+			result.Status = toLibraryElementError(errs[i], "Failed to set library element permissions").Status()
+			result.Message = errs[i].Error()
+		}
+		results = append(results, result)
+	}
+
+	return response.JSON(http.StatusOK, BulkLibraryElementPermissionsResponse{Result: results, Folders: folders})
+}
+
+// swagger:route POST /library-elements/bulk-move library_elements moveLibraryElements
+//
+// Move several library elements to a folder.
+//
+// Moves each library element in the list to the folder, in a single transaction.
+// Each library element has its own result, elements the user can't edit are skipped and reported as forbidden.
+//
+// Responses:
+// 200: bulkMoveLibraryElementsResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 403: forbiddenError
+// 500: internalServerError
+func (l *LibraryElementService) bulkMoveHandler(c *models.ReqContext) response.Response {
+	cmd := BulkMoveLibraryElementsCommand{}
+	if err := web.Bind(c.Req, &cmd); err != nil {
+		return response.Error(http.StatusBadRequest, "bad request data", err)
+	}
+
+	var folderID int64
+	if cmd.FolderUID != "" {
+		folder, err := l.folderService.GetFolderByUID(c.Req.Context(), c.SignedInUser, c.OrgId, cmd.FolderUID)
+		if err != nil || folder == nil {
+			return response.Error(http.StatusBadRequest, "failed to get folder", err)
+		}
+		folderID = folder.Id
+	}
+
+	errs, err := l.moveLibraryElements(c.Req.Context(), c.SignedInUser, cmd.UIDs, folderID)
+	if err != nil {
+		return toLibraryElementError(err, "Failed to move library elements")
+	}
+	results := make([]BulkMoveLibraryElementsResult, 0, len(cmd.UIDs))
+	for i, uid := range cmd.UIDs {
+		result := BulkMoveLibraryElementsResult{UID: uid, Status: http.StatusOK}
+		if errs[i] != nil {
+			result.Status = toLibraryElementError(errs[i], "Failed to move library element").Status()
+			result.Message = errs[i].Error()
+		}
+		results = append(results, result)
+	}
+
+	return response.JSON(http.StatusOK, BulkMoveLibraryElementsResponse{Result: results})
 }
 
+// swagger:route POST /library-elements/bulk-tag library_elements tagLibraryElements
+//
+// Add and remove tags on several library elements.
+//
+// Adds and removes the tags on each library element in the list, in a single transaction.
+// Each library element has its own result, elements the user can't edit are skipped and reported as forbidden.
+//
+// Responses:
+// 200: bulkTagLibraryElementsResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 403: forbiddenError
+// 500: internalServerError
+func (l *LibraryElementService) bulkTagHandler(c *models.ReqContext) response.Response {
+	cmd := BulkTagLibraryElementsCommand{}
+	if err := web.Bind(c.Req, &cmd); err != nil {
+		return response.Error(http.StatusBadRequest, "bad request data", err)
+	}
+
+	errs, err := l.tagLibraryElements(c.Req.Context(), c.SignedInUser, cmd)
+	if err != nil {
+		return toLibraryElementError(err, "Failed to tag library elements")
+	}
+	results := make([]BulkTagLibraryElementsResult, 0, len(cmd.UIDs))
+	for i, uid := range cmd.UIDs {
+		result := BulkTagLibraryElementsResult{UID: uid, Status: http.StatusOK}
+		if errs[i] != nil {
+			result.Status = toLibraryElementError(errs[i], "Failed to tag library element").Status()
+			result.Message = errs[i].Error()
+		}
+		results = append(results, result)
+	}
+
+	return response.JSON(http.StatusOK, BulkTagLibraryElementsResponse{Result: results})
+}
+
+// swagger:route GET /library-elements/batch library_elements getLibraryElementsByUIDs
+//
+// Get library elements by UIDs.
+//
+// Returns the library elements with the given UIDs, in the order of the UIDs in the request.
+// UIDs of library elements that don't exist or that the user can't view are omitted rather than returned as placeholders,
+// so the result can have fewer library elements than UIDs requested.
+//
+// Responses:
+// 200: getLibraryElementArrayResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 500: internalServerError
+func (l *LibraryElementService) getBatchHandler(c *models.ReqContext) response.Response {
+	uids := c.QueryStrings("uid")
+	if len(uids) > maxBatchUIDs {
+		return response.Error(http.StatusBadRequest, fmt.Sprintf("at most %d uids can be requested at once", maxBatchUIDs), nil)
+	}
+
+	elements, err := l.getLibraryElementsByUIDs(c.Req.Context(), c.SignedInUser, uids)
+	if err != nil {
+		return toLibraryElementError(err, "Failed to get library elements")
+	}
+
+	return response.JSON(http.StatusOK, LibraryElementArrayResponse{Result: elements})
+}
+
+// swagger:route GET /library-elements/dashboards/{dashboard_uid}/versions/{dashboard_version} library_elements getLibraryElementsForDashboardVersion
+//
+// Get the library elements of a dashboard version.
+//
+// Returns the library elements referenced by the panels of the given version of the dashboard, in the order of the panels.
+// Library elements are returned as they are now, since they don't keep their own history.
+// Library elements that have been deleted since or that the user can't view are omitted.
+//
+// Responses:
+// 200: getLibraryElementArrayResponse
+// 400: badRequestError
+// 401: unauthorisedError
+// 403: forbiddenError
+// 404: notFoundError
+// 500: internalServerError
+func (l *LibraryElementService) getDashboardVersionElementsHandler(c *models.ReqContext) response.Response {
+	version, err := strconv.Atoi(web.Params(c.Req)[":version"])
+	if err != nil {
+		return response.Error(http.StatusBadRequest, "version is invalid", err)
+	}
+
+	elements, err := l.getElementsForDashboardVersion(c.Req.Context(), c.SignedInUser, web.Params(c.Req)[":dashboardUid"], version)
+	if err != nil {
+		return toLibraryElementError(err, "Failed to get library elements of dashboard version")
+	}
+
+	return response.JSON(http.StatusOK, LibraryElementArrayResponse{Result: elements})
+}
+
+// maxBatchUIDs is the maximum number of library elements that can be requested at once by UID.
+const maxBatchUIDs = 200
+
 // swagger:route GET /library-elements/name/{library_element_name} library_elements getLibraryElementByName
 //
 // Get library element by name.
@@ -240,6 +805,23 @@ func (l *LibraryElementService) getByNameHandler(c *models.ReqContext) response.
 	return response.JSON(http.StatusOK, LibraryElementArrayResponse{Result: elements})
 }
 
+// libraryElementETag hashes the whole response rather than using the element's version,
+// since the meta data (e.g. folder name, connected dashboards) changes without the version being bumped.
+func libraryElementETag(body []byte) string {
+	return fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+}
+
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
 func toLibraryElementError(err error, message string) response.Response {
 	if errors.Is(err, errLibraryElementAlreadyExists) {
 		return response.Error(400, errLibraryElementAlreadyExists.Error(), err)
@@ -247,9 +829,24 @@ func toLibraryElementError(err error, message string) response.Response {
 	if errors.Is(err, ErrLibraryElementNotFound) {
 		return response.Error(404, ErrLibraryElementNotFound.Error(), err)
 	}
+	if errors.Is(err, errLibraryElementVersionNotFound) {
+		return response.Error(404, errLibraryElementVersionNotFound.Error(), err)
+	}
 	if errors.Is(err, errLibraryElementDashboardNotFound) {
 		return response.Error(404, errLibraryElementDashboardNotFound.Error(), err)
 	}
+	if errors.Is(err, errLibraryElementMoveBreaksConnections) {
+		return response.Error(400, errLibraryElementMoveBreaksConnections.Error(), err)
+	}
+	if errors.Is(err, errLibraryElementInvalidTag) {
+		return response.Error(400, errLibraryElementInvalidTag.Error(), err)
+	}
+	if errors.Is(err, errLibraryElementInvalidOrigin) {
+		return response.Error(400, errLibraryElementInvalidOrigin.Error(), err)
+	}
+	if errors.Is(err, errLibraryElementUnmanagedOnlyAccessDenied) {
+		return response.Error(403, errLibraryElementUnmanagedOnlyAccessDenied.Error(), err)
+	}
 	if errors.Is(err, errLibraryElementVersionMismatch) {
 		return response.Error(412, errLibraryElementVersionMismatch.Error(), err)
 	}
@@ -262,16 +859,45 @@ func toLibraryElementError(err error, message string) response.Response {
 	if errors.Is(err, errLibraryElementHasConnections) {
 		return response.Error(403, errLibraryElementHasConnections.Error(), err)
 	}
+	if errors.Is(err, errLibraryElementForceDeleteAccessDenied) {
+		return response.Error(403, errLibraryElementForceDeleteAccessDenied.Error(), err)
+	}
 	if errors.Is(err, errLibraryElementInvalidUID) {
 		return response.Error(400, errLibraryElementInvalidUID.Error(), err)
 	}
 	if errors.Is(err, errLibraryElementUIDTooLong) {
 		return response.Error(400, errLibraryElementUIDTooLong.Error(), err)
 	}
+	if errors.Is(err, errLibraryElementDashboardAccessDenied) {
+		return response.Error(403, errLibraryElementDashboardAccessDenied.Error(), err)
+	}
+	if errors.Is(err, dashver.ErrDashboardVersionNotFound) {
+		return response.Error(404, dashver.ErrDashboardVersionNotFound.Error(), err)
+	}
+	if errors.Is(err, dashboards.ErrDashboardNotFound) {
+		return response.Error(404, dashboards.ErrDashboardNotFound.Error(), err)
+	}
+	if errors.Is(err, dashboards.ErrDashboardUpdateAccessDenied) {
+		return response.Error(403, dashboards.ErrDashboardUpdateAccessDenied.Error(), err)
+	}
+	if errors.Is(err, errLibraryElementPanelNotFound) {
+		return response.Error(404, errLibraryElementPanelNotFound.Error(), err)
+	}
+	if errors.Is(err, errLibraryElementPanelIsLibraryPanel) {
+		return response.Error(400, errLibraryElementPanelIsLibraryPanel.Error(), err)
+	}
+	if errors.Is(err, errLibraryElementGeneralFolderPermissions) {
+		return response.Error(400, errLibraryElementGeneralFolderPermissions.Error(), err)
+	}
+	// errors from saving a dashboard, e.g. when the dashboard is provisioned or was changed by someone else
+	var dashboardErr dashboards.DashboardErr
+	if errors.As(err, &dashboardErr) {
+		return response.Error(dashboardErr.StatusCode, dashboardErr.Error(), err)
+	}
 	return response.Error(500, message, err)
 }
 
-// swagger:parameters getLibraryElementByUID getLibraryElementConnections
+// swagger:parameters getLibraryElementByUID getLibraryElementModelByUID getLibraryElementConnections getLibraryElementPermissions getLibraryElementVersionDiff
 type LibraryElementByUID struct {
 	// in:path
 	// required:true
@@ -285,11 +911,28 @@ type GetLibraryElementByUIDParams struct {
 	UID string `json:"library_element_uid"`
 }
 
-// swagger:parameters GetLibraryElementConnectionsParams
+// swagger:parameters getLibraryElementConnections
 type GetLibraryElementConnectionsParams struct {
-	// in:path
+	// The number of connections per page.
+	// in:query
+	// required:false
+	PerPage int `json:"perPage"`
+	// The page of connections, given that only perPage connections are returned at a time. Numbering starts at 1.
+	// in:query
+	// required:false
+	Page int `json:"page"`
+}
+
+// swagger:parameters getLibraryElementVersionDiff
+type GetLibraryElementVersionDiffParams struct {
+	// The version to compare from.
+	// in:query
 	// required:true
-	UID string `json:"library_element_uid"`
+	From int64 `json:"from"`
+	// The version to compare to.
+	// in:query
+	// required:true
+	To int64 `json:"to"`
 }
 
 // swagger:parameters deleteLibraryElementByUID
@@ -297,6 +940,18 @@ type DeleteLibraryElementByUIDParams struct {
 	// in:path
 	// required:true
 	UID string `json:"library_element_uid"`
+	// Delete the library element even if it's connected to dashboards. Only org admins can force the deletion.
+	// in:query
+	// required:false
+	Force bool `json:"force"`
+}
+
+// swagger:parameters getLibraryElementsByUIDs
+type GetLibraryElementsByUIDsParams struct {
+	// UIDs of the library elements, the library elements are returned in the same order.
+	// in:query
+	// required:true
+	UIDs []string `json:"uid"`
 }
 
 // swagger:parameters getLibraryElementByName
@@ -306,6 +961,16 @@ type LibraryElementByNameParams struct {
 	Name string `json:"library_element_name"`
 }
 
+// swagger:parameters getLibraryElementsForDashboardVersion
+type GetLibraryElementsForDashboardVersionParams struct {
+	// in:path
+	// required:true
+	DashboardUID string `json:"dashboard_uid"`
+	// in:path
+	// required:true
+	Version int `json:"dashboard_version"`
+}
+
 // swagger:parameters getLibraryElements
 type GetLibraryElementsParams struct {
 	// Part of the name or description searched for.
@@ -332,14 +997,64 @@ type GetLibraryElementsParams struct {
 	// in:query
 	// required:false
 	TypeFilter string `json:"typeFilter"`
+	// Only return library panels of the visualization type, such as graph.
+	// in:query
+	// required:false
+	PanelType string `json:"panelType"`
 	// Element UID to exclude from search results.
 	// in:query
 	// required:false
 	ExcludeUID string `json:"excludeUid"`
 	// A comma separated list of folder ID(s) to filter the elements by.
+	// The General folder has ID 0, including it returns the elements in the General folder along with those in the other listed folders.
 	// in:query
 	// required:false
 	FolderFilter string `json:"folderFilter"`
+	// Only return elements in the General folder, i.e. elements that don't belong to any folder.
+	// Takes precedence over folderFilter.
+	// in:query
+	// required:false
+	GeneralOnly bool `json:"generalOnly"`
+	// UID of a folder to exclude the elements of from search results.
+	// Can be combined with folderFilter, in which case the folder is left out of the folders it lists.
+	// in:query
+	// required:false
+	ExcludeFolderUID string `json:"excludeFolderUid"`
+	// Only return elements outside the folders the user is an admin of, either directly or through a team.
+	// Permissions that come from the org role are not taken into account. Only org admins can use this filter.
+	// in:query
+	// required:false
+	UnmanagedOnly bool `json:"unmanagedOnly"`
+	// Only return elements last created or changed with the origin, either api or provisioning.
+	// in:query
+	// required:false
+	Origin string `json:"origin"`
+	// Only return elements that were created or changed at least once through the api rather than by provisioning.
+	// in:query
+	// required:false
+	HumanEditedOnly bool `json:"humanEditedOnly"`
+	// Part of the title of a dashboard the elements are connected to.
+	// Only dashboards the user can view are searched.
+	// in:query
+	// required:false
+	ConnectedDashboardQuery string `json:"connectedDashboardQuery"`
+	// Only return elements the user can edit, rather than all the elements the user can view.
+	// in:query
+	// required:false
+	EditableOnly bool `json:"editableOnly"`
+	// Only return the most recently updated library element of each name.
+	// in:query
+	// required:false
+	DedupeByName bool `json:"dedupeByName"`
+	// Only return elements connected to more than this number of dashboards.
+	// Unless sortDirection is set, the elements connected to the most dashboards are returned first.
+	// in:query
+	// required:false
+	MinConnections int `json:"minConnections"`
+	// Only return elements with this tag.
+	// in:query
+	// required:false
+	Tag string `json:"tag"`
 	// The number of results per page.
 	// in:query
 	// required:false
@@ -359,6 +1074,48 @@ type CreateLibraryElementParams struct {
 	Body CreateLibraryElementCommand `json:"body"`
 }
 
+// swagger:parameters createLibraryElementFromPanel
+type CreateLibraryElementFromPanelParams struct {
+	// in:body
+	// required:true
+	Body CreateLibraryElementFromPanelCommand `json:"body"`
+}
+
+// swagger:parameters validateLibraryElements
+type ValidateLibraryElementsParams struct {
+	// in:body
+	// required:true
+	Body ValidateLibraryElementsCommand `json:"body"`
+}
+
+// swagger:parameters importLibraryElements
+type ImportLibraryElementsParams struct {
+	// in:body
+	// required:true
+	Body ImportLibraryElementsCommand `json:"body"`
+}
+
+// swagger:parameters setLibraryElementsPermissions
+type SetLibraryElementsPermissionsParams struct {
+	// in:body
+	// required:true
+	Body BulkLibraryElementPermissionsCommand `json:"body"`
+}
+
+// swagger:parameters moveLibraryElements
+type MoveLibraryElementsParams struct {
+	// in:body
+	// required:true
+	Body BulkMoveLibraryElementsCommand `json:"body"`
+}
+
+// swagger:parameters tagLibraryElements
+type TagLibraryElementsParams struct {
+	// in:body
+	// required:true
+	Body BulkTagLibraryElementsCommand `json:"body"`
+}
+
 // swagger:parameters updateLibraryElement
 type UpdateLibraryElementParam struct {
 	// in:body
@@ -381,8 +1138,62 @@ type GetLibraryElementResponse struct {
 	Body LibraryElementResponse `json:"body"`
 }
 
+// swagger:response getLibraryElementModelResponse
+type GetLibraryElementModelResponse struct {
+	// in: body
+	Body json.RawMessage `json:"body"`
+}
+
+// swagger:response getLibraryElementVersionDiffResponse
+type GetLibraryElementVersionDiffResponse struct {
+	// in: body
+	Body LibraryElementVersionDiffResponse `json:"body"`
+}
+
 // swagger:response getLibraryElementConnectionsResponse
 type GetLibraryElementConnectionsResponse struct {
 	// in: body
 	Body LibraryElementConnectionsResponse `json:"body"`
 }
+
+// swagger:response getLibraryElementBrokenConnectionsResponse
+type GetLibraryElementBrokenConnectionsResponse struct {
+	// in: body
+	Body LibraryElementBrokenConnectionsResponse `json:"body"`
+}
+
+// swagger:response validateLibraryElementsResponse
+type ValidateLibraryElementsResponse struct {
+	// in: body
+	Body LibraryElementValidationResponse `json:"body"`
+}
+
+// swagger:response importLibraryElementsResponse
+type ImportLibraryElementsResponseBody struct {
+	// in: body
+	Body ImportLibraryElementsResponse `json:"body"`
+}
+
+// swagger:response bulkLibraryElementPermissionsResponse
+type BulkLibraryElementPermissionsResponseBody struct {
+	// in: body
+	Body BulkLibraryElementPermissionsResponse `json:"body"`
+}
+
+// swagger:response bulkMoveLibraryElementsResponse
+type BulkMoveLibraryElementsResponseBody struct {
+	// in: body
+	Body BulkMoveLibraryElementsResponse `json:"body"`
+}
+
+// swagger:response bulkTagLibraryElementsResponse
+type BulkTagLibraryElementsResponseBody struct {
+	// in: body
+	Body BulkTagLibraryElementsResponse `json:"body"`
+}
+
+// swagger:response getLibraryElementPermissionsResponse
+type GetLibraryElementPermissionsResponse struct {
+	// in: body
+	Body LibraryElementPermissionsResponse `json:"body"`
+}
@@ -5,12 +5,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/grafana/grafana/pkg/api/dtos"
+	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
 	"github.com/grafana/grafana/pkg/services/dashboards"
+	dashver "github.com/grafana/grafana/pkg/services/dashboardversion"
+	"github.com/grafana/grafana/pkg/services/guardian"
 	"github.com/grafana/grafana/pkg/services/search"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
 	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
@@ -20,7 +26,7 @@ import (
 const (
 	selectLibraryElementDTOWithMeta = `
 SELECT DISTINCT
-	le.name, le.id, le.org_id, le.folder_id, le.uid, le.kind, le.type, le.description, le.model, le.created, le.created_by, le.updated, le.updated_by, le.version
+	le.name, le.id, le.org_id, le.folder_id, le.uid, le.kind, le.type, le.description, le.model, le.created, le.created_by, le.updated, le.updated_by, le.version, le.origin, le.human_edited
 	, u1.login AS created_by_name
 	, u1.email AS created_by_email
 	, u2.login AS updated_by_name
@@ -94,18 +100,24 @@ func getLibraryElement(dialect migrator.Dialect, session *sqlstore.DBSession, ui
 
 // createLibraryElement adds a library element.
 func (l *LibraryElementService) createLibraryElement(c context.Context, signedInUser *models.SignedInUser, cmd CreateLibraryElementCommand) (LibraryElementDTO, error) {
+	defer l.lockNames()()
+	return l.insertLibraryElement(c, signedInUser, cmd)
+}
+
+// insertLibraryElement adds a library element, the caller holds the lock on the names.
+func (l *LibraryElementService) insertLibraryElement(c context.Context, signedInUser *models.SignedInUser, cmd CreateLibraryElementCommand) (LibraryElementDTO, error) {
 	if err := l.requireSupportedElementKind(cmd.Kind); err != nil {
 		return LibraryElementDTO{}, err
 	}
 	createUID := cmd.UID
 	if len(createUID) == 0 {
 		createUID = util.GenerateShortUID()
-	} else {
-		if !util.IsValidShortUID(createUID) {
-			return LibraryElementDTO{}, errLibraryElementInvalidUID
-		} else if util.IsShortUIDTooLong(createUID) {
-			return LibraryElementDTO{}, errLibraryElementUIDTooLong
-		}
+	} else if err := validateLibraryElementUID(createUID); err != nil {
+		return LibraryElementDTO{}, err
+	}
+	origin, err := validateOrigin(cmd.Origin)
+	if err != nil {
+		return LibraryElementDTO{}, err
 	}
 	element := LibraryElement{
 		OrgID:    signedInUser.OrgId,
@@ -115,6 +127,9 @@ func (l *LibraryElementService) createLibraryElement(c context.Context, signedIn
 		Model:    cmd.Model,
 		Version:  1,
 		Kind:     cmd.Kind,
+		Origin:   origin,
+		// provisioning is the only origin that isn't a human edit
+		HumanEdited: origin != OriginProvisioning,
 
 		Created: time.Now(),
 		Updated: time.Now(),
@@ -127,17 +142,22 @@ func (l *LibraryElementService) createLibraryElement(c context.Context, signedIn
 		return LibraryElementDTO{}, err
 	}
 
-	err := l.SQLStore.WithTransactionalDbSession(c, func(session *sqlstore.DBSession) error {
+	err = l.SQLStore.WithTransactionalDbSession(c, func(session *sqlstore.DBSession) error {
 		if err := l.requireEditPermissionsOnFolder(c, signedInUser, cmd.FolderID); err != nil {
 			return err
 		}
+		if exists, err := l.libraryElementNameExists(session, element.OrgID, element.FolderID, element.Kind, element.Name, 0); err != nil {
+			return err
+		} else if exists {
+			return errLibraryElementAlreadyExists
+		}
 		if _, err := session.Insert(&element); err != nil {
 			if l.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
 				return errLibraryElementAlreadyExists
 			}
 			return err
 		}
-		return nil
+		return insertLibraryElementVersion(session, element)
 	})
 
 	dto := LibraryElementDTO{
@@ -151,6 +171,8 @@ func (l *LibraryElementService) createLibraryElement(c context.Context, signedIn
 		Description: element.Description,
 		Model:       element.Model,
 		Version:     element.Version,
+		Origin:      element.Origin,
+		Tags:        []string{},
 		Meta: LibraryElementDTOMeta{
 			ConnectedDashboards: 0,
 			Created:             element.Created,
@@ -171,9 +193,360 @@ func (l *LibraryElementService) createLibraryElement(c context.Context, signedIn
 	return dto, err
 }
 
+// validateOrigin returns the origin, or the api origin if no origin is set.
+func validateOrigin(origin string) (string, error) {
+	switch origin {
+	case "":
+		return OriginAPI, nil
+	case OriginAPI, OriginProvisioning:
+		return origin, nil
+	default:
+		return "", errLibraryElementInvalidOrigin
+	}
+}
+
+func validateLibraryElementUID(uid string) error {
+	if !util.IsValidShortUID(uid) {
+		return errLibraryElementInvalidUID
+	} else if util.IsShortUIDTooLong(uid) {
+		return errLibraryElementUIDTooLong
+	}
+
+	return nil
+}
+
+// validateLibraryElementModel makes sure the model can be synced with the element's fields.
+func validateLibraryElementModel(model json.RawMessage) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal(model, &m); err != nil || m == nil {
+		return errLibraryElementInvalidModel
+	}
+	for _, field := range []string{"type", "description"} {
+		if value, exists := m[field]; exists && value != nil {
+			if _, ok := value.(string); !ok {
+				return errLibraryElementInvalidModel
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateLibraryElements runs the checks of createLibraryElement for each element without creating anything.
+// Elements are also checked against the elements listed before them, as if they were created in order.
+func (l *LibraryElementService) validateLibraryElements(c context.Context, signedInUser *models.SignedInUser, cmds []CreateLibraryElementCommand) ([][]error, error) {
+	results := make([][]error, len(cmds))
+	seenUIDs := map[string]bool{}
+	seenNames := map[string]bool{}
+	err := l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
+		for i, cmd := range cmds {
+			var errs []error
+			if err := l.requireSupportedElementKind(cmd.Kind); err != nil {
+				errs = append(errs, err)
+			}
+			if err := validateLibraryElementModel(cmd.Model); err != nil {
+				errs = append(errs, err)
+			}
+			if err := l.requireEditPermissionsOnFolder(c, signedInUser, cmd.FolderID); err != nil {
+				errs = append(errs, err)
+			}
+
+			if cmd.UID != "" {
+				if err := validateLibraryElementUID(cmd.UID); err != nil {
+					errs = append(errs, err)
+				} else {
+					exists, err := session.Table("library_element").Where("org_id=? AND uid=?", signedInUser.OrgId, cmd.UID).Exist()
+					if err != nil {
+						return err
+					}
+					if exists || seenUIDs[cmd.UID] {
+						errs = append(errs, errLibraryElementAlreadyExists)
+					}
+					seenUIDs[cmd.UID] = true
+				}
+			}
+
+			nameKey := fmt.Sprintf("%d/%d/%s", cmd.FolderID, cmd.Kind, cmd.Name)
+			if l.Cfg.LibraryElementNameUniqueness == nameUniquenessOrg {
+				nameKey = fmt.Sprintf("%d/%s", cmd.Kind, cmd.Name)
+			}
+			exists, err := l.libraryElementNameExists(session, signedInUser.OrgId, cmd.FolderID, cmd.Kind, cmd.Name, 0)
+			if err != nil {
+				return err
+			}
+			if exists || seenNames[nameKey] {
+				errs = append(errs, errLibraryElementAlreadyExists)
+			}
+			seenNames[nameKey] = true
+
+			results[i] = errs
+		}
+
+		return nil
+	})
+
+	return results, err
+}
+
+// maxLibraryElementNameAttempts is the number of names tried when the name of a library element is already taken.
+const maxLibraryElementNameAttempts = 100
+
+// createLibraryElementFromPanel creates a library panel from the model of a dashboard panel,
+// and optionally replaces the dashboard panel with a reference to the new library panel.
+func (l *LibraryElementService) createLibraryElementFromPanel(c context.Context, signedInUser *models.SignedInUser, cmd CreateLibraryElementFromPanelCommand) (LibraryElementDTO, error) {
+	var element LibraryElementDTO
+	var dashboard models.Dashboard
+	var panel map[string]interface{}
+	defer l.lockNames()()
+	err := l.SQLStore.InTransaction(c, func(ctx context.Context) error {
+		return l.SQLStore.WithTransactionalDbSession(ctx, func(session *sqlstore.DBSession) error {
+			exists, err := session.Where("uid=? AND org_id=? AND is_folder=?", cmd.DashboardUID, signedInUser.OrgId, l.SQLStore.Dialect.BooleanStr(false)).Get(&dashboard)
+			if err != nil {
+				return err
+			}
+			if !exists || dashboard.Data == nil {
+				return dashboards.ErrDashboardNotFound
+			}
+			if err := l.requireEditPermissionsOnDashboard(ctx, signedInUser, dashboard.Id); err != nil {
+				return err
+			}
+
+			panel = findDashboardPanel(dashboard.Data.Get("panels").MustArray(), cmd.PanelID)
+			if panel == nil {
+				return errLibraryElementPanelNotFound
+			}
+			if _, ok := panel["libraryPanel"]; ok {
+				return errLibraryElementPanelIsLibraryPanel
+			}
+
+			model := make(map[string]interface{}, len(panel))
+			for key, value := range panel {
+				// the position belongs to the dashboard, not to the library panel
+				if key != "gridPos" {
+					model[key] = value
+				}
+			}
+			modelJSON, err := json.Marshal(model)
+			if err != nil {
+				return err
+			}
+
+			name := cmd.Name
+			if name == "" {
+				name = simplejson.NewFromAny(panel).Get("title").MustString()
+			}
+			if name == "" {
+				name = fmt.Sprintf("Panel %d", cmd.PanelID)
+			}
+			name, err = l.uniqueLibraryElementName(session, signedInUser.OrgId, cmd.FolderID, models.PanelElement, name)
+			if err != nil {
+				return err
+			}
+
+			element, err = l.insertLibraryElement(ctx, signedInUser, CreateLibraryElementCommand{
+				FolderID: cmd.FolderID,
+				Name:     name,
+				Model:    modelJSON,
+				Kind:     int64(models.PanelElement),
+				UID:      cmd.UID,
+			})
+			return err
+		})
+	})
+	if err != nil || !cmd.ReplacePanel {
+		return element, err
+	}
+
+	// the dashboard is saved outside of the transaction, through the dashboard service
+	if err := l.replaceDashboardPanel(c, signedInUser, &dashboard, panel, element); err != nil {
+		// the library panel is removed again, so that a failed request doesn't leave it behind
+		if _, _, deleteErr := l.deleteLibraryElement(c, signedInUser, element.UID, false); deleteErr != nil {
+			l.log.Error("Could not remove library panel after failing to replace the dashboard panel", "uid", element.UID, "error", deleteErr)
+		}
+		return LibraryElementDTO{}, err
+	}
+
+	return element, nil
+}
+
+// findDashboardPanel returns the panel with the ID, including the panels of collapsed rows.
+func findDashboardPanel(panels []interface{}, panelID int64) map[string]interface{} {
+	for _, p := range panels {
+		panel, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		panelAsJSON := simplejson.NewFromAny(panel)
+		if panelAsJSON.Get("type").MustString() == "row" {
+			if nested := findDashboardPanel(panelAsJSON.Get("panels").MustArray(), panelID); nested != nil {
+				return nested
+			}
+			continue
+		}
+		if panelAsJSON.Get("id").MustInt64() == panelID {
+			return panel
+		}
+	}
+
+	return nil
+}
+
+// findLibraryPanelUIDs adds the UIDs of the library panels of the dashboard panels, including the panels of rows,
+// in the order of the panels. Library panels used several times are only added once.
+func findLibraryPanelUIDs(panels []interface{}, uids []string, seen map[string]bool) []string {
+	for _, p := range panels {
+		panelAsJSON := simplejson.NewFromAny(p)
+		if panelAsJSON.Get("type").MustString() == "row" {
+			uids = findLibraryPanelUIDs(panelAsJSON.Get("panels").MustArray(), uids, seen)
+			continue
+		}
+		if uid := panelAsJSON.Get("libraryPanel").Get("uid").MustString(); uid != "" && !seen[uid] {
+			seen[uid] = true
+			uids = append(uids, uid)
+		}
+	}
+
+	return uids
+}
+
+// getElementsForDashboardVersion gets the library elements referenced by a version of a dashboard.
+// Library elements don't keep their own history, so the current elements are returned,
+// leaving out the ones that have been deleted since or that the user can't view.
+func (l *LibraryElementService) getElementsForDashboardVersion(c context.Context, signedInUser *models.SignedInUser, dashboardUID string, version int) ([]LibraryElementDTO, error) {
+	var uids []string
+	err := l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
+		dashboard := models.Dashboard{}
+		exists, err := session.Where("uid=? AND org_id=? AND is_folder=?", dashboardUID, signedInUser.OrgId, l.SQLStore.Dialect.BooleanStr(false)).Get(&dashboard)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return dashboards.ErrDashboardNotFound
+		}
+		if err := l.requireViewPermissionsOnDashboard(c, signedInUser, dashboard.Id); err != nil {
+			return err
+		}
+
+		dashVersion := dashver.DashboardVersion{}
+		exists, err = session.Where("dashboard_id=? AND version=?", dashboard.Id, version).Get(&dashVersion)
+		if err != nil {
+			return err
+		}
+		if !exists || dashVersion.Data == nil {
+			return dashver.ErrDashboardVersionNotFound
+		}
+
+		uids = findLibraryPanelUIDs(dashVersion.Data.Get("panels").MustArray(), []string{}, map[string]bool{})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return l.getLibraryElementsByUIDs(c, signedInUser, uids)
+}
+
+// uniqueLibraryElementName returns the name, or the name followed by the first free number if it's already taken.
+func (l *LibraryElementService) uniqueLibraryElementName(session *sqlstore.DBSession, orgID, folderID int64, kind models.LibraryElementKind, name string) (string, error) {
+	candidate := name
+	for i := 2; i <= maxLibraryElementNameAttempts; i++ {
+		exists, err := l.libraryElementNameExists(session, orgID, folderID, int64(kind), candidate, 0)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s (%d)", name, i)
+	}
+
+	return "", errLibraryElementAlreadyExists
+}
+
+// lockNames serializes the changes that check whether a name is taken and then write it, when names are unique
+// in the org. No database constraint covers a name across folders, so two concurrent changes could otherwise both
+// find the name free. Names unique per folder are covered by the unique index on the folder and name.
+// The lock only covers this Grafana instance. It returns the function releasing the lock.
+func (l *LibraryElementService) lockNames() func() {
+	if l.Cfg.LibraryElementNameUniqueness != nameUniquenessOrg {
+		return func() {}
+	}
+	l.nameMu.Lock()
+	return l.nameMu.Unlock
+}
+
+// libraryElementNameExists reports whether another element of the kind has the name, either in the folder or,
+// when names are unique per org, in any folder of the org. The element with excludeID is ignored.
+func (l *LibraryElementService) libraryElementNameExists(session *sqlstore.DBSession, orgID, folderID, kind int64, name string, excludeID int64) (bool, error) {
+	sess := session.Table("library_element").Where("org_id=? AND name=? AND kind=? AND id<>?", orgID, name, kind, excludeID)
+	if l.Cfg.LibraryElementNameUniqueness != nameUniquenessOrg {
+		sess = sess.And("folder_id=?", folderID)
+	}
+
+	return sess.Exist()
+}
+
+// replaceDashboardPanel replaces the dashboard panel with a reference to the library panel,
+// saves the dashboard through the dashboard service and connects the library panel to the dashboard.
+// Saving through the dashboard service creates a new dashboard version, rejects provisioned dashboards,
+// and fails if the dashboard was changed since it was read.
+func (l *LibraryElementService) replaceDashboardPanel(c context.Context, signedInUser *models.SignedInUser, dashboard *models.Dashboard, panel map[string]interface{}, element LibraryElementDTO) error {
+	reference := map[string]interface{}{
+		"id":      panel["id"],
+		"gridPos": panel["gridPos"],
+		"title":   element.Name,
+		"libraryPanel": map[string]interface{}{
+			"uid":  element.UID,
+			"name": element.Name,
+		},
+	}
+	// the panel is part of the dashboard data, so it's replaced in place
+	for key := range panel {
+		delete(panel, key)
+	}
+	for key, value := range reference {
+		if value != nil {
+			panel[key] = value
+		}
+	}
+	// the stored version is the one the panel was read from, so a concurrent change is detected when saving
+	dashboard.SetId(dashboard.Id)
+	dashboard.SetUid(dashboard.Uid)
+	dashboard.SetVersion(dashboard.Version)
+
+	saved, err := l.dashboardService.SaveDashboard(c, &dashboards.SaveDashboardDTO{
+		OrgId:     signedInUser.OrgId,
+		User:      signedInUser,
+		Message:   fmt.Sprintf("Replaced panel %v with library panel %s", reference["id"], element.Name),
+		Overwrite: false,
+		Dashboard: dashboard,
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	return l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
+		connection := libraryElementConnection{
+			ElementID:    element.ID,
+			Kind:         1,
+			ConnectionID: saved.Id,
+			Created:      time.Now(),
+			CreatedBy:    signedInUser.UserId,
+		}
+		_, err := session.Insert(&connection)
+		return err
+	})
+}
+
 // deleteLibraryElement deletes a library element.
-func (l *LibraryElementService) deleteLibraryElement(c context.Context, signedInUser *models.SignedInUser, uid string) (int64, error) {
+func (l *LibraryElementService) deleteLibraryElement(c context.Context, signedInUser *models.SignedInUser, uid string, force bool) (int64, []LibraryElementAffectedDashboard, error) {
+	if force && signedInUser.OrgRole != models.ROLE_ADMIN {
+		return 0, nil, errLibraryElementForceDeleteAccessDenied
+	}
+
 	var elementID int64
+	var affectedDashboards []LibraryElementAffectedDashboard
 	err := l.SQLStore.WithTransactionalDbSession(c, func(session *sqlstore.DBSession) error {
 		element, err := getLibraryElement(l.SQLStore.Dialect, session, uid, signedInUser.OrgId)
 		if err != nil {
@@ -195,7 +568,26 @@ func (l *LibraryElementService) deleteLibraryElement(c context.Context, signedIn
 		if err := session.SQL(sql, element.ID).Find(&connectionIDs); err != nil {
 			return err
 		} else if len(connectionIDs) > 0 {
-			return errLibraryElementHasConnections
+			if !force {
+				return errLibraryElementHasConnections
+			}
+
+			sql := "SELECT dashboard.id, dashboard.uid, dashboard.title FROM library_element_connection AS lec"
+			sql += " INNER JOIN dashboard ON dashboard.id = lec.connection_id"
+			sql += " WHERE lec.element_id=? AND lec.kind=? ORDER BY dashboard.title ASC, dashboard.id ASC"
+			if err := session.SQL(sql, element.ID, Dashboard).Find(&affectedDashboards); err != nil {
+				return err
+			}
+			if _, err := session.Exec("DELETE FROM library_element_connection WHERE element_id=?", element.ID); err != nil {
+				return err
+			}
+		}
+
+		if _, err := session.Exec("DELETE FROM "+models.LibraryElementTagTableName+" WHERE library_element_id=?", element.ID); err != nil {
+			return err
+		}
+		if _, err := session.Exec("DELETE FROM "+models.LibraryElementVersionTableName+" WHERE element_id=?", element.ID); err != nil {
+			return err
 		}
 
 		result, err := session.Exec("DELETE FROM library_element WHERE id=?", element.ID)
@@ -211,12 +603,13 @@ func (l *LibraryElementService) deleteLibraryElement(c context.Context, signedIn
 		elementID = element.ID
 		return nil
 	})
-	return elementID, err
+	return elementID, affectedDashboards, err
 }
 
 // getLibraryElements gets a Library Element where param == value
 func getLibraryElements(c context.Context, store *sqlstore.SQLStore, signedInUser *models.SignedInUser, params []Pair) ([]LibraryElementDTO, error) {
 	libraryElements := make([]LibraryElementWithMeta, 0)
+	var tags map[int64][]string
 	err := store.WithDbSession(c, func(session *sqlstore.DBSession) error {
 		builder := sqlstore.SQLBuilder{}
 		builder.Write(selectLibraryElementDTOWithMeta)
@@ -242,7 +635,13 @@ func getLibraryElements(c context.Context, store *sqlstore.SQLStore, signedInUse
 			return ErrLibraryElementNotFound
 		}
 
-		return nil
+		elementIDs := make([]int64, 0, len(libraryElements))
+		for _, libraryElement := range libraryElements {
+			elementIDs = append(elementIDs, libraryElement.ID)
+		}
+		var err error
+		tags, err = getLibraryElementTags(session, elementIDs)
+		return err
 	})
 	if err != nil {
 		return []LibraryElementDTO{}, err
@@ -262,6 +661,8 @@ func getLibraryElements(c context.Context, store *sqlstore.SQLStore, signedInUse
 			Description: libraryElement.Description,
 			Model:       libraryElement.Model,
 			Version:     libraryElement.Version,
+			Origin:      libraryElement.Origin,
+			Tags:        tags[libraryElement.ID],
 			Meta: LibraryElementDTOMeta{
 				FolderName:          libraryElement.FolderName,
 				FolderUID:           libraryElement.FolderUID,
@@ -303,6 +704,45 @@ func (l *LibraryElementService) getLibraryElementsByName(c context.Context, sign
 	return getLibraryElements(c, l.SQLStore, signedInUser, []Pair{{"org_id", signedInUser.OrgId}, {"name", name}})
 }
 
+// getLibraryElementsByUIDs gets the Library Elements with the uids, in the order of the uids.
+// Elements that don't exist or that the user can't view are omitted, so fewer elements than uids may be returned.
+func (l *LibraryElementService) getLibraryElementsByUIDs(c context.Context, signedInUser *models.SignedInUser, uids []string) ([]LibraryElementDTO, error) {
+	if len(uids) == 0 {
+		return []LibraryElementDTO{}, nil
+	}
+
+	unique := make([]string, 0, len(uids))
+	seen := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		if !seen[uid] {
+			seen[uid] = true
+			unique = append(unique, uid)
+		}
+	}
+
+	libraryElements, err := getLibraryElements(c, l.SQLStore, signedInUser, []Pair{{"org_id", signedInUser.OrgId}, {"uid", unique}})
+	if errors.Is(err, ErrLibraryElementNotFound) {
+		return []LibraryElementDTO{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the database returns the elements in its own order, so they are put back in the requested order
+	byUID := make(map[string]LibraryElementDTO, len(libraryElements))
+	for _, element := range libraryElements {
+		byUID[element.UID] = element
+	}
+	ordered := make([]LibraryElementDTO, 0, len(uids))
+	for _, uid := range uids {
+		if element, ok := byUID[uid]; ok {
+			ordered = append(ordered, element)
+		}
+	}
+
+	return ordered, nil
+}
+
 // getAllLibraryElements gets all Library Elements.
 func (l *LibraryElementService) getAllLibraryElements(c context.Context, signedInUser *models.SignedInUser, query searchLibraryElementsQuery) (LibraryElementSearchResult, error) {
 	elements := make([]LibraryElementWithMeta, 0)
@@ -321,43 +761,103 @@ func (l *LibraryElementService) getAllLibraryElements(c context.Context, signedI
 	if folderFilter.parseError != nil {
 		return LibraryElementSearchResult{}, folderFilter.parseError
 	}
+	var managedFolderIDs []int64
+	if query.unmanagedOnly {
+		if signedInUser.OrgRole != models.ROLE_ADMIN {
+			return LibraryElementSearchResult{}, errLibraryElementUnmanagedOnlyAccessDenied
+		}
+		var err error
+		if managedFolderIDs, err = l.getManagedFolderIDs(c, signedInUser); err != nil {
+			return LibraryElementSearchResult{}, err
+		}
+	}
+	permission := models.PERMISSION_VIEW
+	includeGeneralFolder := folderFilter.includeGeneralFolder
+	if query.editableOnly {
+		permission = models.PERMISSION_EDIT
+		// only editors can edit the elements in the General folder
+		includeGeneralFolder = includeGeneralFolder && signedInUser.HasRole(models.ROLE_EDITOR)
+	}
+	if !includeGeneralFolder && folderFilter.generalOnly {
+		return LibraryElementSearchResult{Elements: []LibraryElementDTO{}, Page: query.page, PerPage: query.perPage}, nil
+	}
 	err := l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
 		builder := sqlstore.SQLBuilder{}
-		if folderFilter.includeGeneralFolder {
+		if includeGeneralFolder {
 			builder.Write(selectLibraryElementDTOWithMeta)
 			builder.Write(", 'General' as folder_name ")
 			builder.Write(", '' as folder_uid ")
+			writeSearchRelevanceSQL(query, l.SQLStore, &builder)
 			builder.Write(getFromLibraryElementDTOWithMeta(l.SQLStore.Dialect))
 			builder.Write(` WHERE le.org_id=?  AND le.folder_id=0`, signedInUser.OrgId)
 			writeKindSQL(query, &builder)
 			writeSearchStringSQL(query, l.SQLStore, &builder)
 			writeExcludeSQL(query, &builder)
+			writeOriginSQL(query, &builder)
+			writeHumanEditedOnlySQL(query, l.SQLStore, &builder)
 			writeTypeFilterSQL(typeFilter, &builder)
-			builder.Write(" UNION ")
+			writePanelTypeSQL(query, &builder)
+			writeMinConnectionsSQL(query, &builder)
+			writeTagSQL(query, &builder)
+			writeConnectedDashboardSQL(query, l.SQLStore, signedInUser, &builder)
 		}
-		builder.Write(selectLibraryElementDTOWithMeta)
-		builder.Write(", dashboard.title as folder_name ")
-		builder.Write(", dashboard.uid as folder_uid ")
-		builder.Write(getFromLibraryElementDTOWithMeta(l.SQLStore.Dialect))
-		builder.Write(" INNER JOIN dashboard AS dashboard on le.folder_id = dashboard.id AND le.folder_id<>0")
-		builder.Write(` WHERE le.org_id=?`, signedInUser.OrgId)
-		writeKindSQL(query, &builder)
-		writeSearchStringSQL(query, l.SQLStore, &builder)
-		writeExcludeSQL(query, &builder)
-		writeTypeFilterSQL(typeFilter, &builder)
-		if err := folderFilter.writeFolderFilterSQL(false, &builder); err != nil {
-			return err
+		if !folderFilter.generalOnly {
+			if includeGeneralFolder {
+				builder.Write(" UNION ")
+			}
+			builder.Write(selectLibraryElementDTOWithMeta)
+			builder.Write(", dashboard.title as folder_name ")
+			builder.Write(", dashboard.uid as folder_uid ")
+			writeSearchRelevanceSQL(query, l.SQLStore, &builder)
+			builder.Write(getFromLibraryElementDTOWithMeta(l.SQLStore.Dialect))
+			builder.Write(" INNER JOIN dashboard AS dashboard on le.folder_id = dashboard.id AND le.folder_id<>0")
+			builder.Write(` WHERE le.org_id=?`, signedInUser.OrgId)
+			writeKindSQL(query, &builder)
+			writeSearchStringSQL(query, l.SQLStore, &builder)
+			writeExcludeSQL(query, &builder)
+			writeOriginSQL(query, &builder)
+			writeHumanEditedOnlySQL(query, l.SQLStore, &builder)
+			writeTypeFilterSQL(typeFilter, &builder)
+			writePanelTypeSQL(query, &builder)
+			writeMinConnectionsSQL(query, &builder)
+			writeTagSQL(query, &builder)
+			writeConnectedDashboardSQL(query, l.SQLStore, signedInUser, &builder)
+			writeExcludeFolderIDsSQL(managedFolderIDs, &builder)
+			writeExcludeFolderIDsSQL(query.excludeFolderIDs, &builder)
+			if err := folderFilter.writeFolderFilterSQL(false, &builder); err != nil {
+				return err
+			}
+			if signedInUser.OrgRole != models.ROLE_ADMIN {
+				builder.WriteDashboardPermissionFilter(signedInUser, permission)
+			}
 		}
-		if signedInUser.OrgRole != models.ROLE_ADMIN {
-			builder.WriteDashboardPermissionFilter(signedInUser, models.PERMISSION_VIEW)
+		searchBuilder := sqlstore.SQLBuilder{}
+		writeDedupeByNameSQL(query, &builder, &searchBuilder)
+		// editable elements are counted with the same filters as they're searched with, so that the edit permission is taken into account
+		editableCountSQL := "SELECT COUNT(*) FROM (" + searchBuilder.GetSQLString() + ") AS elements"
+		editableCountParams := append([]interface{}{}, searchBuilder.GetParams()...)
+		searchBuilder.Write(" ORDER BY ")
+		if query.minConnections > 0 && query.sortDirection == "" {
+			searchBuilder.Write("connected_dashboards DESC, ")
+		}
+		if len(strings.TrimSpace(query.searchString)) > 0 {
+			searchBuilder.Write("relevance ASC, ")
 		}
 		if query.sortDirection == search.SortAlphaDesc.Name {
-			builder.Write(" ORDER BY 1 DESC")
+			searchBuilder.Write("1 DESC")
 		} else {
-			builder.Write(" ORDER BY 1 ASC")
+			searchBuilder.Write("1 ASC")
 		}
-		writePerPageSQL(query, l.SQLStore, &builder)
-		if err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&elements); err != nil {
+		writePerPageSQL(query, l.SQLStore, &searchBuilder)
+		if err := session.SQL(searchBuilder.GetSQLString(), searchBuilder.GetParams()...).Find(&elements); err != nil {
+			return err
+		}
+		elementIDs := make([]int64, 0, len(elements))
+		for _, element := range elements {
+			elementIDs = append(elementIDs, element.ID)
+		}
+		tags, err := getLibraryElementTags(session, elementIDs)
+		if err != nil {
 			return err
 		}
 
@@ -375,6 +875,8 @@ func (l *LibraryElementService) getAllLibraryElements(c context.Context, signedI
 				Description: element.Description,
 				Model:       element.Model,
 				Version:     element.Version,
+				Origin:      element.Origin,
+				Tags:        tags[element.ID],
 				Meta: LibraryElementDTOMeta{
 					FolderName:          element.FolderName,
 					FolderUID:           element.FolderUID,
@@ -395,23 +897,41 @@ func (l *LibraryElementService) getAllLibraryElements(c context.Context, signedI
 			})
 		}
 
-		var libraryElements []LibraryElement
-		countBuilder := sqlstore.SQLBuilder{}
-		countBuilder.Write("SELECT * FROM library_element AS le")
-		countBuilder.Write(` WHERE le.org_id=?`, signedInUser.OrgId)
-		writeKindSQL(query, &countBuilder)
-		writeSearchStringSQL(query, l.SQLStore, &countBuilder)
-		writeExcludeSQL(query, &countBuilder)
-		writeTypeFilterSQL(typeFilter, &countBuilder)
-		if err := folderFilter.writeFolderFilterSQL(true, &countBuilder); err != nil {
-			return err
-		}
-		if err := session.SQL(countBuilder.GetSQLString(), countBuilder.GetParams()...).Find(&libraryElements); err != nil {
-			return err
+		var totalCount int64
+		if query.editableOnly {
+			if _, err := session.SQL(editableCountSQL, editableCountParams...).Get(&totalCount); err != nil {
+				return err
+			}
+		} else {
+			var libraryElements []LibraryElement
+			countBuilder := sqlstore.SQLBuilder{}
+			countBuilder.Write("SELECT * FROM library_element AS le")
+			countBuilder.Write(` WHERE le.org_id=?`, signedInUser.OrgId)
+			writeKindSQL(query, &countBuilder)
+			writeSearchStringSQL(query, l.SQLStore, &countBuilder)
+			writeExcludeSQL(query, &countBuilder)
+			writeOriginSQL(query, &countBuilder)
+			writeHumanEditedOnlySQL(query, l.SQLStore, &countBuilder)
+			writeTypeFilterSQL(typeFilter, &countBuilder)
+			writePanelTypeSQL(query, &countBuilder)
+			writeMinConnectionsSQL(query, &countBuilder)
+			writeTagSQL(query, &countBuilder)
+			writeConnectedDashboardSQL(query, l.SQLStore, signedInUser, &countBuilder)
+			writeExcludeFolderIDsSQL(managedFolderIDs, &countBuilder)
+			writeExcludeFolderIDsSQL(query.excludeFolderIDs, &countBuilder)
+			if err := folderFilter.writeFolderFilterSQL(true, &countBuilder); err != nil {
+				return err
+			}
+			countSearchBuilder := sqlstore.SQLBuilder{}
+			writeDedupeByNameSQL(query, &countBuilder, &countSearchBuilder)
+			if err := session.SQL(countSearchBuilder.GetSQLString(), countSearchBuilder.GetParams()...).Find(&libraryElements); err != nil {
+				return err
+			}
+			totalCount = int64(len(libraryElements))
 		}
 
 		result = LibraryElementSearchResult{
-			TotalCount: int64(len(libraryElements)),
+			TotalCount: totalCount,
 			Elements:   retDTOs,
 			Page:       query.page,
 			PerPage:    query.perPage,
@@ -446,13 +966,175 @@ func (l *LibraryElementService) handleFolderIDPatches(ctx context.Context, eleme
 	return nil
 }
 
+// requireFolderVisibleFromConnectedDashboards returns an error if the folder can't be viewed from any of the dashboards
+// the element is connected to.
+func (l *LibraryElementService) requireFolderVisibleFromConnectedDashboards(c context.Context, session *sqlstore.DBSession, signedInUser *models.SignedInUser, elementID, folderID int64) error {
+	var connections []struct {
+		ConnectionID int64 `xorm:"connection_id"`
+	}
+	sql := "SELECT connection_id FROM library_element_connection WHERE element_id=? AND kind=?"
+	if err := session.SQL(sql, elementID, Dashboard).Find(&connections); err != nil {
+		return err
+	}
+	for _, connection := range connections {
+		if err := l.requireFolderVisibleFromDashboard(c, signedInUser, folderID, connection.ConnectionID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveLibraryElements moves the elements to the folder in a single transaction. Elements that can't be moved, for
+// instance because the user can't edit them, are skipped and their error is returned at the same index as their UID.
+func (l *LibraryElementService) moveLibraryElements(c context.Context, signedInUser *models.SignedInUser, uids []string, folderID int64) ([]error, error) {
+	if err := l.requireEditPermissionsOnFolder(c, signedInUser, folderID); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(uids))
+	defer l.lockNames()()
+	err := l.SQLStore.WithTransactionalDbSession(c, func(session *sqlstore.DBSession) error {
+		for i, uid := range uids {
+			element, err := getLibraryElement(l.SQLStore.Dialect, session, uid, signedInUser.OrgId)
+			if err != nil {
+				if !errors.Is(err, ErrLibraryElementNotFound) {
+					return err
+				}
+				errs[i] = err
+				continue
+			}
+			if element.FolderID == folderID {
+				continue
+			}
+			if err := l.requireEditPermissionsOnFolder(c, signedInUser, element.FolderID); err != nil {
+				errs[i] = err
+				continue
+			}
+			if err := l.requireFolderVisibleFromConnectedDashboards(c, session, signedInUser, element.ID, folderID); err != nil {
+				errs[i] = err
+				continue
+			}
+			if exists, err := l.libraryElementNameExists(session, element.OrgID, folderID, element.Kind, element.Name, element.ID); err != nil {
+				return err
+			} else if exists {
+				errs[i] = errLibraryElementAlreadyExists
+				continue
+			}
+
+			updated := time.Now()
+			sql := "UPDATE library_element SET folder_id=?, version=version+1, updated=?, updated_by=? WHERE id=?"
+			if _, err := session.Exec(sql, folderID, updated, signedInUser.UserId, element.ID); err != nil {
+				return err
+			}
+			if err := insertLibraryElementVersion(session, LibraryElement{
+				ID:        element.ID,
+				Name:      element.Name,
+				Model:     element.Model,
+				Version:   element.Version + 1,
+				Updated:   updated,
+				UpdatedBy: signedInUser.UserId,
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// getLibraryElementTags gets the tags of the elements by element id, in alphabetical order.
+// Every element has an entry, elements without tags have an empty list.
+func getLibraryElementTags(session *sqlstore.DBSession, elementIDs []int64) (map[int64][]string, error) {
+	tags := make(map[int64][]string, len(elementIDs))
+	for _, elementID := range elementIDs {
+		tags[elementID] = []string{}
+	}
+	if len(elementIDs) == 0 {
+		return tags, nil
+	}
+
+	var rows []libraryElementTag
+	if err := session.Table(models.LibraryElementTagTableName).In("library_element_id", elementIDs).Asc("term").Find(&rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		tags[row.LibraryElementID] = append(tags[row.LibraryElementID], row.Term)
+	}
+
+	return tags, nil
+}
+
+// tagLibraryElements adds and removes the tags of the elements in a single transaction. Elements that can't be tagged,
+// for instance because the user can't edit them, are skipped and their error is returned at the same index as their UID.
+func (l *LibraryElementService) tagLibraryElements(c context.Context, signedInUser *models.SignedInUser, cmd BulkTagLibraryElementsCommand) ([]error, error) {
+	for _, tag := range append(append([]string{}, cmd.Add...), cmd.Remove...) {
+		if len(tag) == 0 || len(tag) > 50 {
+			return nil, errLibraryElementInvalidTag
+		}
+	}
+
+	errs := make([]error, len(cmd.UIDs))
+	err := l.SQLStore.WithTransactionalDbSession(c, func(session *sqlstore.DBSession) error {
+		for i, uid := range cmd.UIDs {
+			element, err := getLibraryElement(l.SQLStore.Dialect, session, uid, signedInUser.OrgId)
+			if err != nil {
+				if !errors.Is(err, ErrLibraryElementNotFound) {
+					return err
+				}
+				errs[i] = err
+				continue
+			}
+			if err := l.requireEditPermissionsOnFolder(c, signedInUser, element.FolderID); err != nil {
+				errs[i] = err
+				continue
+			}
+
+			for _, tag := range cmd.Remove {
+				if _, err := session.Exec("DELETE FROM "+models.LibraryElementTagTableName+" WHERE library_element_id=? AND term=?", element.ID, tag); err != nil {
+					return err
+				}
+			}
+			for _, tag := range cmd.Add {
+				exists, err := session.Table(models.LibraryElementTagTableName).Where("library_element_id=? AND term=?", element.ID, tag).Exist()
+				if err != nil {
+					return err
+				}
+				if exists {
+					continue
+				}
+				if _, err := session.Exec("INSERT INTO "+models.LibraryElementTagTableName+" (library_element_id, term) VALUES (?, ?)", element.ID, tag); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return errs, nil
+}
+
 // patchLibraryElement updates a Library Element.
 func (l *LibraryElementService) patchLibraryElement(c context.Context, signedInUser *models.SignedInUser, cmd PatchLibraryElementCommand, uid string) (LibraryElementDTO, error) {
 	var dto LibraryElementDTO
 	if err := l.requireSupportedElementKind(cmd.Kind); err != nil {
 		return LibraryElementDTO{}, err
 	}
-	err := l.SQLStore.WithTransactionalDbSession(c, func(session *sqlstore.DBSession) error {
+	origin, err := validateOrigin(cmd.Origin)
+	if err != nil {
+		return LibraryElementDTO{}, err
+	}
+	defer l.lockNames()()
+	err = l.SQLStore.WithTransactionalDbSession(c, func(session *sqlstore.DBSession) error {
 		elementInDB, err := getLibraryElement(l.SQLStore.Dialect, session, uid, signedInUser.OrgId)
 		if err != nil {
 			return err
@@ -487,6 +1169,8 @@ func (l *LibraryElementService) patchLibraryElement(c context.Context, signedInU
 			Description: elementInDB.Description,
 			Model:       cmd.Model,
 			Version:     elementInDB.Version + 1,
+			Origin:      origin,
+			HumanEdited: elementInDB.HumanEdited || origin != OriginProvisioning,
 			Created:     elementInDB.Created,
 			CreatedBy:   elementInDB.CreatedBy,
 			Updated:     time.Now(),
@@ -502,9 +1186,19 @@ func (l *LibraryElementService) patchLibraryElement(c context.Context, signedInU
 		if err := l.handleFolderIDPatches(c, &libraryElement, elementInDB.FolderID, cmd.FolderID, signedInUser); err != nil {
 			return err
 		}
+		if libraryElement.FolderID != elementInDB.FolderID && !cmd.Force {
+			if err := l.requireFolderVisibleFromConnectedDashboards(c, session, signedInUser, elementInDB.ID, libraryElement.FolderID); err != nil {
+				return err
+			}
+		}
 		if err := syncFieldsWithModel(&libraryElement); err != nil {
 			return err
 		}
+		if exists, err := l.libraryElementNameExists(session, libraryElement.OrgID, libraryElement.FolderID, libraryElement.Kind, libraryElement.Name, libraryElement.ID); err != nil {
+			return err
+		} else if exists {
+			return errLibraryElementAlreadyExists
+		}
 		if rowsAffected, err := session.ID(elementInDB.ID).Update(&libraryElement); err != nil {
 			if l.SQLStore.Dialect.IsUniqueConstraintViolation(err) {
 				return errLibraryElementAlreadyExists
@@ -513,6 +1207,13 @@ func (l *LibraryElementService) patchLibraryElement(c context.Context, signedInU
 		} else if rowsAffected != 1 {
 			return ErrLibraryElementNotFound
 		}
+		if err := insertLibraryElementVersion(session, libraryElement); err != nil {
+			return err
+		}
+		tags, err := getLibraryElementTags(session, []int64{libraryElement.ID})
+		if err != nil {
+			return err
+		}
 
 		dto = LibraryElementDTO{
 			ID:          libraryElement.ID,
@@ -525,6 +1226,8 @@ func (l *LibraryElementService) patchLibraryElement(c context.Context, signedInU
 			Description: libraryElement.Description,
 			Model:       libraryElement.Model,
 			Version:     libraryElement.Version,
+			Origin:      libraryElement.Origin,
+			Tags:        tags[libraryElement.ID],
 			Meta: LibraryElementDTOMeta{
 				ConnectedDashboards: elementInDB.ConnectedDashboards,
 				Created:             libraryElement.Created,
@@ -547,28 +1250,167 @@ func (l *LibraryElementService) patchLibraryElement(c context.Context, signedInU
 	return dto, err
 }
 
+// insertLibraryElementVersion stores the name and model of the element's current version.
+func insertLibraryElementVersion(session *sqlstore.DBSession, element LibraryElement) error {
+	_, err := session.Insert(&libraryElementVersion{
+		ElementID: element.ID,
+		Version:   element.Version,
+		Name:      element.Name,
+		Model:     element.Model,
+		Created:   element.Updated,
+		CreatedBy: element.UpdatedBy,
+	})
+	return err
+}
+
+// getLibraryElementVersionDiff returns two stored versions of a library element and the changes of the model between them.
+func (l *LibraryElementService) getLibraryElementVersionDiff(c context.Context, signedInUser *models.SignedInUser, uid string, from, to int64) (LibraryElementVersionDiff, error) {
+	// getting the element checks that the user can view it
+	element, err := l.getLibraryElementByUid(c, signedInUser, uid)
+	if err != nil {
+		return LibraryElementVersionDiff{}, err
+	}
+
+	versions := make([]libraryElementVersionWithMeta, 0, 2)
+	err = l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
+		user := l.SQLStore.Dialect.Quote("user")
+		sql := "SELECT lev.*, u.login AS created_by_name, u.email AS created_by_email"
+		sql += " FROM " + models.LibraryElementVersionTableName + " AS lev"
+		sql += " LEFT JOIN " + user + " AS u ON lev.created_by = u.id"
+		sql += " WHERE lev.element_id=? AND lev.version IN (?, ?)"
+		return session.SQL(sql, element.ID, from, to).Find(&versions)
+	})
+	if err != nil {
+		return LibraryElementVersionDiff{}, err
+	}
+
+	byVersion := make(map[int64]LibraryElementVersionDTO, len(versions))
+	for _, v := range versions {
+		byVersion[v.Version] = LibraryElementVersionDTO{
+			Version: v.Version,
+			Name:    v.Name,
+			Model:   v.Model,
+			Created: v.Created,
+			CreatedBy: LibraryElementDTOMetaUser{
+				ID:        v.CreatedBy,
+				Name:      v.CreatedByName,
+				AvatarURL: dtos.GetGravatarUrl(v.CreatedByEmail),
+			},
+		}
+	}
+	fromVersion, fromExists := byVersion[from]
+	toVersion, toExists := byVersion[to]
+	if !fromExists || !toExists {
+		return LibraryElementVersionDiff{}, errLibraryElementVersionNotFound
+	}
+
+	var fromModel, toModel interface{}
+	if err := json.Unmarshal(fromVersion.Model, &fromModel); err != nil {
+		return LibraryElementVersionDiff{}, err
+	}
+	if err := json.Unmarshal(toVersion.Model, &toModel); err != nil {
+		return LibraryElementVersionDiff{}, err
+	}
+
+	return LibraryElementVersionDiff{
+		From:    fromVersion,
+		To:      toVersion,
+		Changes: diffModels("", fromModel, toModel, make([]LibraryElementModelChange, 0)),
+	}, nil
+}
+
+// diffModels appends the values that differ between the decoded JSON values to the changes.
+// Objects and arrays are compared item by item, so that only the changed values are reported.
+func diffModels(path string, from, to interface{}, changes []LibraryElementModelChange) []LibraryElementModelChange {
+	switch fromValue := from.(type) {
+	case map[string]interface{}:
+		if toValue, ok := to.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(fromValue)+len(toValue))
+			for key := range fromValue {
+				keys = append(keys, key)
+			}
+			for key := range toValue {
+				if _, exists := fromValue[key]; !exists {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				keyPath := key
+				if path != "" {
+					keyPath = path + "." + key
+				}
+				changes = diffModels(keyPath, fromValue[key], toValue[key], changes)
+			}
+			return changes
+		}
+	case []interface{}:
+		if toValue, ok := to.([]interface{}); ok {
+			for i := 0; i < len(fromValue) || i < len(toValue); i++ {
+				var fromItem, toItem interface{}
+				if i < len(fromValue) {
+					fromItem = fromValue[i]
+				}
+				if i < len(toValue) {
+					toItem = toValue[i]
+				}
+				changes = diffModels(fmt.Sprintf("%s[%d]", path, i), fromItem, toItem, changes)
+			}
+			return changes
+		}
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		changes = append(changes, LibraryElementModelChange{Path: path, From: from, To: to})
+	}
+	return changes
+}
+
 // getConnections gets all connections for a Library Element.
-func (l *LibraryElementService) getConnections(c context.Context, signedInUser *models.SignedInUser, uid string) ([]LibraryElementConnectionDTO, error) {
+// The connections are ordered by dashboard UID. If perPage is 0 all the connections are returned, otherwise only the
+// connections of the page are, and the total count is the number of connections across all pages.
+func (l *LibraryElementService) getConnections(c context.Context, signedInUser *models.SignedInUser, uid string, perPage, page int) ([]LibraryElementConnectionDTO, int64, error) {
 	connections := make([]LibraryElementConnectionDTO, 0)
+	var totalCount int64
 	err := l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
 		element, err := getLibraryElement(l.SQLStore.Dialect, session, uid, signedInUser.OrgId)
 		if err != nil {
 			return err
 		}
+		writeConnectionsFilterSQL := func(builder *sqlstore.SQLBuilder) {
+			builder.Write(" INNER JOIN dashboard AS dashboard on lec.connection_id = dashboard.id")
+			builder.Write(` WHERE lec.element_id=?`, element.ID)
+			if signedInUser.OrgRole != models.ROLE_ADMIN {
+				builder.WriteDashboardPermissionFilter(signedInUser, models.PERMISSION_VIEW)
+			}
+		}
+
 		var libraryElementConnections []libraryElementConnectionWithMeta
 		builder := sqlstore.SQLBuilder{}
 		builder.Write("SELECT lec.*, u1.login AS created_by_name, u1.email AS created_by_email, dashboard.uid AS connection_uid")
 		builder.Write(" FROM " + models.LibraryElementConnectionTableName + " AS lec")
 		builder.Write(" LEFT JOIN " + l.SQLStore.Dialect.Quote("user") + " AS u1 ON lec.created_by = u1.id")
-		builder.Write(" INNER JOIN dashboard AS dashboard on lec.connection_id = dashboard.id")
-		builder.Write(` WHERE lec.element_id=?`, element.ID)
-		if signedInUser.OrgRole != models.ROLE_ADMIN {
-			builder.WriteDashboardPermissionFilter(signedInUser, models.PERMISSION_VIEW)
+		writeConnectionsFilterSQL(&builder)
+		builder.Write(" ORDER BY dashboard.uid ASC")
+		if perPage > 0 {
+			builder.Write(l.SQLStore.Dialect.LimitOffset(int64(perPage), int64(perPage*(page-1))))
 		}
 		if err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&libraryElementConnections); err != nil {
 			return err
 		}
 
+		if perPage > 0 {
+			countBuilder := sqlstore.SQLBuilder{}
+			countBuilder.Write("SELECT COUNT(*) FROM " + models.LibraryElementConnectionTableName + " AS lec")
+			writeConnectionsFilterSQL(&countBuilder)
+			if _, err := session.SQL(countBuilder.GetSQLString(), countBuilder.GetParams()...).Get(&totalCount); err != nil {
+				return err
+			}
+		} else {
+			totalCount = int64(len(libraryElementConnections))
+		}
+
 		for _, connection := range libraryElementConnections {
 			connections = append(connections, LibraryElementConnectionDTO{
 				ID:            connection.ID,
@@ -588,7 +1430,297 @@ func (l *LibraryElementService) getConnections(c context.Context, signedInUser *
 		return nil
 	})
 
-	return connections, err
+	return connections, totalCount, err
+}
+
+// getBrokenConnections gets all connections whose Library Element or dashboard no longer exists.
+func (l *LibraryElementService) getBrokenConnections(c context.Context, signedInUser *models.SignedInUser) ([]LibraryElementBrokenConnectionDTO, error) {
+	brokenConnections := make([]LibraryElementBrokenConnectionDTO, 0)
+	err := l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
+		var connections []libraryElementBrokenConnection
+		builder := sqlstore.SQLBuilder{}
+		builder.Write("SELECT lec.id, lec.element_id, lec.connection_id")
+		builder.Write(", coalesce(le.uid, '') AS element_uid")
+		builder.Write(", coalesce(dashboard.uid, '') AS dashboard_uid")
+		builder.Write(", coalesce(dashboard.title, '') AS dashboard_title")
+		builder.Write(" FROM " + models.LibraryElementConnectionTableName + " AS lec")
+		builder.Write(" LEFT JOIN library_element AS le ON le.id = lec.element_id")
+		builder.Write(" LEFT JOIN dashboard AS dashboard ON dashboard.id = lec.connection_id")
+		builder.Write(" WHERE lec.kind=1 AND (le.id IS NULL OR dashboard.id IS NULL)")
+		builder.Write(" AND (le.org_id=? OR dashboard.org_id=?)", signedInUser.OrgId, signedInUser.OrgId)
+		builder.Write(" ORDER BY lec.connection_id, lec.element_id")
+		if err := session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&connections); err != nil {
+			return err
+		}
+
+		// dashboards are only inspected once, even if they have several broken connections
+		inspectedDashboards := make(map[int64]bool)
+		for _, connection := range connections {
+			dto := LibraryElementBrokenConnectionDTO{
+				ID:               connection.ID,
+				ElementID:        connection.ElementID,
+				ElementUID:       connection.ElementUID,
+				ElementMissing:   connection.ElementUID == "",
+				ConnectionID:     connection.ConnectionID,
+				DashboardUID:     connection.DashboardUID,
+				DashboardTitle:   connection.DashboardTitle,
+				DashboardMissing: connection.DashboardUID == "",
+			}
+			if !dto.ElementMissing || dto.DashboardMissing {
+				brokenConnections = append(brokenConnections, dto)
+				continue
+			}
+			if inspectedDashboards[connection.ConnectionID] {
+				continue
+			}
+			inspectedDashboards[connection.ConnectionID] = true
+
+			// the element is gone, so look for the panels in the dashboard that reference it
+			panels, err := getUnresolvedLibraryPanels(session, connection.ConnectionID, signedInUser.OrgId)
+			if err != nil {
+				return err
+			}
+			if len(panels) == 0 {
+				brokenConnections = append(brokenConnections, dto)
+				continue
+			}
+			for _, panel := range panels {
+				panelDTO := dto
+				panelDTO.ElementUID = panel.uid
+				panelDTO.PanelID = panel.id
+				brokenConnections = append(brokenConnections, panelDTO)
+			}
+		}
+
+		return nil
+	})
+
+	return brokenConnections, err
+}
+
+type libraryPanelReference struct {
+	id  int64
+	uid string
+}
+
+// getUnresolvedLibraryPanels returns the panels of a dashboard that reference Library Elements that don't exist.
+func getUnresolvedLibraryPanels(session *sqlstore.DBSession, dashboardID int64, orgID int64) ([]libraryPanelReference, error) {
+	dashboard := models.Dashboard{}
+	exists, err := session.Where("id=? AND org_id=?", dashboardID, orgID).Get(&dashboard)
+	if err != nil || !exists || dashboard.Data == nil {
+		return nil, err
+	}
+
+	references := getLibraryPanelReferences(dashboard.Data.Get("panels").MustArray())
+	unresolved := make([]libraryPanelReference, 0)
+	for _, reference := range references {
+		count, err := session.Table("library_element").Where("uid=? AND org_id=?", reference.uid, orgID).Count()
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			unresolved = append(unresolved, reference)
+		}
+	}
+
+	return unresolved, nil
+}
+
+func getLibraryPanelReferences(panels []interface{}) []libraryPanelReference {
+	references := make([]libraryPanelReference, 0)
+	for _, panel := range panels {
+		panelAsJSON := simplejson.NewFromAny(panel)
+		if panelAsJSON.Get("type").MustString() == "row" {
+			references = append(references, getLibraryPanelReferences(panelAsJSON.Get("panels").MustArray())...)
+			continue
+		}
+
+		uid := panelAsJSON.GetPath("libraryPanel", "uid").MustString()
+		if len(uid) == 0 {
+			continue
+		}
+		references = append(references, libraryPanelReference{id: panelAsJSON.Get("id").MustInt64(), uid: uid})
+	}
+
+	return references
+}
+
+// getLibraryElementPermissions gets the permissions that apply to a Library Element.
+// Library Elements inherit the permissions of the folder they are stored in.
+func (l *LibraryElementService) getLibraryElementPermissions(c context.Context, signedInUser *models.SignedInUser, uid string) ([]*models.DashboardACLInfoDTO, error) {
+	var element LibraryElementWithMeta
+	err := l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
+		var err error
+		element, err = getLibraryElement(l.SQLStore.Dialect, session, uid, signedInUser.OrgId)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.requireAdminPermissionsOnFolder(c, signedInUser, element.FolderID); err != nil {
+		return nil, err
+	}
+
+	// the General folder has no ACL, access is granted based on the org role
+	if isGeneralFolder(element.FolderID) {
+		editorRole := models.ROLE_EDITOR
+		viewerRole := models.ROLE_VIEWER
+		return []*models.DashboardACLInfoDTO{
+			{OrgId: signedInUser.OrgId, Role: &editorRole, Permission: models.PERMISSION_EDIT, PermissionName: models.PERMISSION_EDIT.String(), Inherited: true},
+			{OrgId: signedInUser.OrgId, Role: &viewerRole, Permission: models.PERMISSION_VIEW, PermissionName: models.PERMISSION_VIEW.String(), Inherited: true},
+		}, nil
+	}
+
+	g := guardian.New(c, element.FolderID, signedInUser.OrgId, signedInUser)
+	return g.GetACLWithoutDuplicates()
+}
+
+func validatePermissionItems(cmd BulkLibraryElementPermissionsCommand) error {
+	for _, item := range append(cmd.Add, cmd.Remove...) {
+		if (item.UserID == 0) == (item.TeamID == 0) {
+			return errLibraryElementInvalidPermissionItem
+		}
+	}
+	for _, item := range cmd.Add {
+		if item.Permission != models.PERMISSION_VIEW && item.Permission != models.PERMISSION_EDIT && item.Permission != models.PERMISSION_ADMIN {
+			return errLibraryElementInvalidPermissionItem
+		}
+	}
+
+	return nil
+}
+
+// setLibraryElementPermissions changes the permissions of the folders of the Library Elements.
+// Library Elements have no permissions of their own, so the change applies to every dashboard and Library Element in each folder.
+// The Library Elements are grouped by folder, and each folder is checked and changed once. Elements that are not found,
+// or whose folder can't be changed, get their own error. The remaining folders are all changed within a single transaction,
+// so that either all of them are changed or none is. It returns the folders that were changed.
+func (l *LibraryElementService) setLibraryElementPermissions(c context.Context, signedInUser *models.SignedInUser, cmd BulkLibraryElementPermissionsCommand) ([]string, []error, []LibraryElementPermissionsFolder) {
+	folderUIDs := make([]string, len(cmd.UIDs))
+	errs := make([]error, len(cmd.UIDs))
+	folders := make([]LibraryElementPermissionsFolder, 0)
+	elementsByFolder := make(map[int64][]int)
+	for i, uid := range cmd.UIDs {
+		var element LibraryElementWithMeta
+		err := l.SQLStore.WithDbSession(c, func(session *sqlstore.DBSession) error {
+			var err error
+			element, err = getLibraryElement(l.SQLStore.Dialect, session, uid, signedInUser.OrgId)
+			return err
+		})
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		folderUIDs[i] = element.FolderUID
+		if _, ok := elementsByFolder[element.FolderID]; !ok {
+			folders = append(folders, LibraryElementPermissionsFolder{ID: element.FolderID, UID: element.FolderUID, Title: element.FolderName})
+		}
+		elementsByFolder[element.FolderID] = append(elementsByFolder[element.FolderID], i)
+	}
+
+	changed := make([]LibraryElementPermissionsFolder, 0, len(folders))
+	for _, folder := range folders {
+		err := l.requireAdminPermissionsOnFolder(c, signedInUser, folder.ID)
+		if err == nil && isGeneralFolder(folder.ID) {
+			err = errLibraryElementGeneralFolderPermissions
+		}
+		if err != nil {
+			for _, i := range elementsByFolder[folder.ID] {
+				errs[i] = err
+			}
+			continue
+		}
+		changed = append(changed, folder)
+	}
+
+	err := l.SQLStore.InTransaction(c, func(ctx context.Context) error {
+		for _, folder := range changed {
+			var err error
+			if !accesscontrol.IsDisabled(l.Cfg) {
+				err = l.setFolderPermissions(ctx, signedInUser.OrgId, folder.UID, cmd)
+			} else {
+				err = l.updateFolderACL(ctx, signedInUser, folder.ID, cmd)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, folder := range changed {
+			for _, i := range elementsByFolder[folder.ID] {
+				errs[i] = err
+			}
+		}
+		return folderUIDs, errs, []LibraryElementPermissionsFolder{}
+	}
+
+	return folderUIDs, errs, changed
+}
+
+func (l *LibraryElementService) setFolderPermissions(c context.Context, orgID int64, folderUID string, cmd BulkLibraryElementPermissionsCommand) error {
+	commands := make([]accesscontrol.SetResourcePermissionCommand, 0, len(cmd.Remove)+len(cmd.Add))
+	for _, item := range cmd.Remove {
+		commands = append(commands, accesscontrol.SetResourcePermissionCommand{UserID: item.UserID, TeamID: item.TeamID})
+	}
+	for _, item := range cmd.Add {
+		commands = append(commands, accesscontrol.SetResourcePermissionCommand{UserID: item.UserID, TeamID: item.TeamID, Permission: item.Permission.String()})
+	}
+
+	_, err := l.folderPermissionsService.SetPermissions(c, orgID, folderUID, commands...)
+	return err
+}
+
+// updateFolderACL keeps the folder's current permissions, including the default role permissions
+// which otherwise stop applying once the folder has its own permissions.
+func (l *LibraryElementService) updateFolderACL(c context.Context, signedInUser *models.SignedInUser, folderID int64, cmd BulkLibraryElementPermissionsCommand) error {
+	g := guardian.New(c, folderID, signedInUser.OrgId, signedInUser)
+	acl, err := g.GetACL()
+	if err != nil {
+		return err
+	}
+
+	changedItems := append(append([]LibraryElementPermissionItem{}, cmd.Remove...), cmd.Add...)
+	changed := func(userID, teamID int64) bool {
+		for _, item := range changedItems {
+			if (item.UserID != 0 && item.UserID == userID) || (item.TeamID != 0 && item.TeamID == teamID) {
+				return true
+			}
+		}
+		return false
+	}
+
+	items := make([]*models.DashboardACL, 0, len(acl)+len(cmd.Add))
+	for _, item := range acl {
+		if item.Inherited || changed(item.UserId, item.TeamId) {
+			continue
+		}
+		items = append(items, &models.DashboardACL{
+			OrgID:       signedInUser.OrgId,
+			DashboardID: folderID,
+			UserID:      item.UserId,
+			TeamID:      item.TeamId,
+			Role:        item.Role,
+			Permission:  item.Permission,
+			Created:     time.Now(),
+			Updated:     time.Now(),
+		})
+	}
+	for _, item := range cmd.Add {
+		items = append(items, &models.DashboardACL{
+			OrgID:       signedInUser.OrgId,
+			DashboardID: folderID,
+			UserID:      item.UserID,
+			TeamID:      item.TeamID,
+			Permission:  item.Permission,
+			Created:     time.Now(),
+			Updated:     time.Now(),
+		})
+	}
+
+	return l.dashboardService.UpdateDashboardACL(c, folderID, items)
 }
 
 //getElementsForDashboardID gets all elements for a specific dashboard
@@ -620,6 +1752,7 @@ func (l *LibraryElementService) getElementsForDashboardID(c context.Context, das
 				Description: element.Description,
 				Model:       element.Model,
 				Version:     element.Version,
+				Origin:      element.Origin,
 				Meta: LibraryElementDTOMeta{
 					FolderName:          element.FolderName,
 					FolderUID:           element.FolderUID,
@@ -747,6 +1880,14 @@ func (l *LibraryElementService) deleteLibraryElementsInFolderUID(c context.Conte
 			if err != nil {
 				return err
 			}
+			_, err = session.Exec("DELETE FROM "+models.LibraryElementTagTableName+" WHERE library_element_id=?", elementID.ID)
+			if err != nil {
+				return err
+			}
+			_, err = session.Exec("DELETE FROM "+models.LibraryElementVersionTableName+" WHERE element_id=?", elementID.ID)
+			if err != nil {
+				return err
+			}
 		}
 		if _, err := session.Exec("DELETE FROM library_element WHERE folder_id=? AND org_id=?", folderID, signedInUser.OrgId); err != nil {
 			return err
@@ -2,10 +2,13 @@ package libraryelements
 
 import (
 	"context"
+	"strings"
 
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
 	"github.com/grafana/grafana/pkg/services/dashboards"
 	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
 )
 
 func isGeneralFolder(folderID int64) bool {
@@ -73,6 +76,144 @@ func (l *LibraryElementService) requireViewPermissionsOnFolder(ctx context.Conte
 	return nil
 }
 
+func (l *LibraryElementService) requireAdminPermissionsOnFolder(ctx context.Context, user *models.SignedInUser, folderID int64) error {
+	if user.HasRole(models.ROLE_ADMIN) {
+		return nil
+	}
+
+	if isGeneralFolder(folderID) {
+		return dashboards.ErrFolderAccessDenied
+	}
+
+	folder, err := l.folderService.GetFolderByID(ctx, user, folderID, user.OrgId)
+	if err != nil {
+		return err
+	}
+
+	g := guardian.New(ctx, folder.Id, user.OrgId, user)
+
+	canAdmin, err := g.CanAdmin()
+	if err != nil {
+		return err
+	}
+	if !canAdmin {
+		return dashboards.ErrFolderAccessDenied
+	}
+
+	return nil
+}
+
+// requireFolderVisibleFromDashboard checks that everyone who can view the dashboard can also view the folder,
+// so that a library element in the folder can be shown on the dashboard.
+func (l *LibraryElementService) requireFolderVisibleFromDashboard(ctx context.Context, user *models.SignedInUser, folderID int64, dashboardID int64) error {
+	// the General folder can be viewed by everyone in the org
+	if isGeneralFolder(folderID) {
+		return nil
+	}
+
+	folderACL, err := guardian.New(ctx, folderID, user.OrgId, user).GetACLWithoutDuplicates()
+	if err != nil {
+		return err
+	}
+	dashboardACL, err := guardian.New(ctx, dashboardID, user.OrgId, user).GetACLWithoutDuplicates()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range dashboardACL {
+		if !aclGrantsViewTo(folderACL, item) {
+			return errLibraryElementMoveBreaksConnections
+		}
+	}
+
+	return nil
+}
+
+// aclGrantsViewTo reports whether the ACL grants view access to everyone the item grants access to.
+func aclGrantsViewTo(acl []*models.DashboardACLInfoDTO, item *models.DashboardACLInfoDTO) bool {
+	// admins can view every folder
+	if item.Role != nil && *item.Role == models.ROLE_ADMIN {
+		return true
+	}
+
+	for _, granted := range acl {
+		if granted.Role != nil {
+			// every user of the org is at least a viewer
+			if *granted.Role == models.ROLE_VIEWER {
+				return true
+			}
+			if item.Role != nil && item.Role.Includes(*granted.Role) {
+				return true
+			}
+		}
+		if granted.UserId != 0 && granted.UserId == item.UserId {
+			return true
+		}
+		if granted.TeamId != 0 && granted.TeamId == item.TeamId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getManagedFolderIDs returns the IDs of the folders whose permissions make the user an admin, either directly or
+// through one of their teams. Permissions that come from the org role are ignored, since org admins can admin every folder.
+func (l *LibraryElementService) getManagedFolderIDs(ctx context.Context, user *models.SignedInUser) ([]int64, error) {
+	managed := make([]int64, 0)
+	err := l.SQLStore.WithDbSession(ctx, func(session *sqlstore.DBSession) error {
+		builder := sqlstore.SQLBuilder{}
+		builder.Write("SELECT dashboard.id FROM dashboard WHERE dashboard.org_id = ? AND dashboard.is_folder = ?", user.OrgId, l.SQLStore.Dialect.BooleanStr(true))
+
+		if accesscontrol.IsDisabled(l.Cfg) {
+			// the user is checked as a viewer, so that only the permissions of the user and their teams are left
+			viewer := *user
+			viewer.OrgRole = models.ROLE_VIEWER
+			builder.WriteDashboardPermissionFilter(&viewer, models.PERMISSION_ADMIN)
+			return session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&managed)
+		}
+
+		// with access control, the folder admins are the ones that can change the permissions of the folder,
+		// only the managed permissions of the user and their teams are used
+		scopes := make([]string, 0)
+		err := session.SQL(`SELECT DISTINCT permission.scope FROM permission
+			INNER JOIN role ON role.id = permission.role_id
+			WHERE role.org_id = ? AND role.name LIKE ? AND permission.action = ? AND permission.scope LIKE ? AND (
+				role.id IN (SELECT role_id FROM user_role WHERE org_id = ? AND user_id = ?) OR
+				role.id IN (SELECT role_id FROM team_role WHERE org_id = ? AND team_id IN (SELECT team_id FROM team_member WHERE org_id = ? AND user_id = ?))
+			)`,
+			user.OrgId, accesscontrol.ManagedRolePrefix+"%", dashboards.ActionFoldersPermissionsWrite, dashboards.ScopeFoldersPrefix+"%",
+			user.OrgId, user.UserId, user.OrgId, user.OrgId, user.UserId,
+		).Find(&scopes)
+		if err != nil || len(scopes) == 0 {
+			return err
+		}
+
+		params := make([]interface{}, 0, len(scopes))
+		for _, scope := range scopes {
+			params = append(params, strings.TrimPrefix(scope, dashboards.ScopeFoldersPrefix))
+		}
+		builder.Write(" AND dashboard.uid IN (?"+strings.Repeat(",?", len(params)-1)+")", params...)
+		return session.SQL(builder.GetSQLString(), builder.GetParams()...).Find(&managed)
+	})
+
+	return managed, err
+}
+
+func (l *LibraryElementService) requireViewPermissionsOnDashboard(ctx context.Context, user *models.SignedInUser, dashboardID int64) error {
+	g := guardian.New(ctx, dashboardID, user.OrgId, user)
+
+	canView, err := g.CanView()
+	if err != nil {
+		return err
+	}
+	if !canView {
+		return errLibraryElementDashboardAccessDenied
+	}
+
+	return nil
+}
+
 func (l *LibraryElementService) requireEditPermissionsOnDashboard(ctx context.Context, user *models.SignedInUser, dashboardID int64) error {
 	g := guardian.New(ctx, dashboardID, user.OrgId, user)
 
@@ -2,22 +2,27 @@ package libraryelements
 
 import (
 	"context"
+	"sync"
 
 	"github.com/grafana/grafana/pkg/api/routing"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
 	"github.com/grafana/grafana/pkg/services/dashboards"
 	"github.com/grafana/grafana/pkg/services/sqlstore"
 	"github.com/grafana/grafana/pkg/setting"
 )
 
-func ProvideService(cfg *setting.Cfg, sqlStore *sqlstore.SQLStore, routeRegister routing.RouteRegister, folderService dashboards.FolderService) *LibraryElementService {
+func ProvideService(cfg *setting.Cfg, sqlStore *sqlstore.SQLStore, routeRegister routing.RouteRegister, folderService dashboards.FolderService,
+	dashboardService dashboards.DashboardService, folderPermissionsService accesscontrol.FolderPermissionsService) *LibraryElementService {
 	l := &LibraryElementService{
-		Cfg:           cfg,
-		SQLStore:      sqlStore,
-		RouteRegister: routeRegister,
-		folderService: folderService,
-		log:           log.New("library-elements"),
+		Cfg:                      cfg,
+		SQLStore:                 sqlStore,
+		RouteRegister:            routeRegister,
+		folderService:            folderService,
+		dashboardService:         dashboardService,
+		folderPermissionsService: folderPermissionsService,
+		log:                      log.New("library-elements"),
 	}
 	l.registerAPIEndpoints()
 	return l
@@ -35,11 +40,15 @@ type Service interface {
 
 // LibraryElementService is the service for the Library Element feature.
 type LibraryElementService struct {
-	Cfg           *setting.Cfg
-	SQLStore      *sqlstore.SQLStore
-	RouteRegister routing.RouteRegister
-	folderService dashboards.FolderService
-	log           log.Logger
+	Cfg                      *setting.Cfg
+	SQLStore                 *sqlstore.SQLStore
+	RouteRegister            routing.RouteRegister
+	folderService            dashboards.FolderService
+	dashboardService         dashboards.DashboardService
+	folderPermissionsService accesscontrol.FolderPermissionsService
+	log                      log.Logger
+	// nameMu serializes the changes that check and write library element names when names are unique in the org
+	nameMu sync.Mutex
 }
 
 // CreateElement creates a Library Element.
@@ -1,13 +1,21 @@
 package libraryelements
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
 	"github.com/grafana/grafana/pkg/util"
+	"github.com/grafana/grafana/pkg/web"
 )
 
 func TestCreateLibraryElement(t *testing.T) {
@@ -19,6 +27,51 @@ func TestCreateLibraryElement(t *testing.T) {
 			require.Equal(t, 400, resp.Status())
 		})
 
+	scenarioWithPanel(t, "When an admin tries to create a library panel with the name of a library panel in another folder, it should depend on the name uniqueness scope",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(0, "Text - Library Panel")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			sc.service.Cfg.LibraryElementNameUniqueness = nameUniquenessOrg
+			newFolder := createFolderWithACL(t, sc.sqlStore, "NewFolder", sc.user, []folderACLItem{})
+			command = getCreatePanelCommand(newFolder.Id, "Text - Library Panel")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp = sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 400, resp.Status())
+		})
+
+	scenarioWithPanel(t, "When an admin creates library panels with the same name in several folders at once and names are unique in the org, only one should be created",
+		func(t *testing.T, sc scenarioContext) {
+			sc.service.Cfg.LibraryElementNameUniqueness = nameUniquenessOrg
+			folders := make([]*models.Folder, 5)
+			for i := range folders {
+				folders[i] = createFolderWithACL(t, sc.sqlStore, fmt.Sprintf("Folder %d", i), sc.user, []folderACLItem{})
+			}
+
+			var wg sync.WaitGroup
+			errs := make([]error, len(folders))
+			for i, folder := range folders {
+				wg.Add(1)
+				go func(i int, folderID int64) {
+					defer wg.Done()
+					_, errs[i] = sc.service.createLibraryElement(context.Background(), sc.reqContext.SignedInUser, getCreatePanelCommand(folderID, "Concurrent - Library Panel"))
+				}(i, folder.Id)
+			}
+			wg.Wait()
+
+			created := 0
+			for _, err := range errs {
+				if err == nil {
+					created++
+					continue
+				}
+				require.ErrorIs(t, err, errLibraryElementAlreadyExists)
+			}
+			require.Equal(t, 1, created)
+		})
+
 	scenarioWithPanel(t, "When an admin tries to create a library panel that does not exists, it should succeed",
 		func(t *testing.T, sc scenarioContext) {
 			var expected = libraryElementResult{
@@ -139,6 +192,86 @@ func TestCreateLibraryElement(t *testing.T) {
 			require.Equal(t, 400, resp.Status())
 		})
 
+	scenarioWithPanel(t, "When an admin validates library panels, it should return the problems of each panel without creating them",
+		func(t *testing.T, sc scenarioContext) {
+			valid := getCreatePanelCommand(sc.folder.Id, "Valid Panel")
+			existingName := getCreatePanelCommand(sc.folder.Id, "Text - Library Panel")
+			invalidUID := getCreatePanelCommand(sc.folder.Id, "Invalid UID")
+			invalidUID.UID = "Testing an invalid UID"
+			duplicate := getCreatePanelCommand(sc.folder.Id, "Valid Panel")
+			invalidModel := getCreatePanelCommand(sc.folder.Id, "Invalid Model")
+			invalidModel.Model = []byte(`{"type": 1}`)
+			command := ValidateLibraryElementsCommand{
+				Elements: []CreateLibraryElementCommand{valid, existingName, invalidUID, duplicate, invalidModel},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.validateHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result LibraryElementValidationResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 5)
+			require.True(t, result.Result[0].Valid)
+			require.Empty(t, result.Result[0].Errors)
+			require.Equal(t, []string{errLibraryElementAlreadyExists.Error()}, result.Result[1].Errors)
+			require.Equal(t, []string{errLibraryElementInvalidUID.Error()}, result.Result[2].Errors)
+			require.Equal(t, []string{errLibraryElementAlreadyExists.Error()}, result.Result[3].Errors)
+			require.Equal(t, []string{errLibraryElementInvalidModel.Error()}, result.Result[4].Errors)
+			for _, r := range result.Result[1:] {
+				require.False(t, r.Valid)
+			}
+
+			sc.reqContext.Req.Body = mockRequestBody(getCreatePanelCommand(sc.folder.Id, "Valid Panel"))
+			resp = sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+		})
+
+	scenarioWithPanel(t, "When an admin imports library panels into missing folders, it should only create the folders if asked to",
+		func(t *testing.T, sc scenarioContext) {
+			existingFolderUID := sc.folder.Uid
+			missingFolderUID := "missing-folder"
+			inExisting := ImportLibraryElement{CreateLibraryElementCommand: getCreatePanelCommand(0, "In Existing Folder")}
+			inExisting.FolderUID = &existingFolderUID
+			inMissing := ImportLibraryElement{CreateLibraryElementCommand: getCreatePanelCommand(0, "In Missing Folder"), FolderTitle: "Imported Folder"}
+			inMissing.FolderUID = &missingFolderUID
+			alsoInMissing := ImportLibraryElement{CreateLibraryElementCommand: getCreatePanelCommand(0, "Also In Missing Folder")}
+			alsoInMissing.FolderUID = &missingFolderUID
+
+			command := ImportLibraryElementsCommand{Elements: []ImportLibraryElement{inExisting, inMissing}}
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.importHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result ImportLibraryElementsResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 2)
+			require.Equal(t, 200, result.Result[0].Status)
+			require.NotEmpty(t, result.Result[0].UID)
+			require.Equal(t, 404, result.Result[1].Status)
+			require.Empty(t, result.CreatedFolders)
+
+			command = ImportLibraryElementsCommand{Elements: []ImportLibraryElement{inMissing, alsoInMissing}, AutoCreateFolders: true}
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp = sc.service.importHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			result = ImportLibraryElementsResponse{}
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 2)
+			for _, r := range result.Result {
+				require.Equal(t, 200, r.Status, r.Message)
+			}
+			require.Equal(t, []ImportedFolder{{UID: missingFolderUID, Title: "Imported Folder"}}, result.CreatedFolders)
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": result.Result[1].UID})
+			resp = sc.service.getHandler(sc.reqContext)
+			element := validateAndUnMarshalResponse(t, resp)
+			require.Equal(t, missingFolderUID, element.Result.Meta.FolderUID)
+		})
+
 	testScenario(t, "When an admin tries to create a library panel where name and panel title differ, it should not update panel title",
 		func(t *testing.T, sc scenarioContext) {
 			command := getCreatePanelCommand(1, "Library Panel Name")
@@ -186,4 +319,120 @@ func TestCreateLibraryElement(t *testing.T) {
 				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
 			}
 		})
+
+	scenarioWithPanel(t, "When an admin creates a library panel from a dashboard panel, it should replace the panel and handle name collisions",
+		func(t *testing.T, sc scenarioContext) {
+			dashJSON := map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{
+						"id":    int64(1),
+						"title": "Text - Library Panel",
+						"type":  "text",
+						"gridPos": map[string]interface{}{
+							"h": 6,
+							"w": 6,
+							"x": 0,
+							"y": 0,
+						},
+					},
+				},
+			}
+			dash := models.Dashboard{
+				Title: "Testing createFromPanelHandler",
+				Data:  simplejson.NewFromAny(dashJSON),
+			}
+			dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+
+			command := CreateLibraryElementFromPanelCommand{
+				DashboardUID: dashInDB.Uid,
+				PanelID:      1,
+				FolderID:     sc.folder.Id,
+				ReplacePanel: true,
+			}
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createFromPanelHandler(sc.reqContext)
+			result := validateAndUnMarshalResponse(t, resp)
+			require.Equal(t, "Text - Library Panel (2)", result.Result.Name)
+			require.Equal(t, int64(1), result.Result.Meta.ConnectedDashboards)
+			require.NotContains(t, result.Result.Model, "gridPos")
+
+			connections, _, err := sc.service.getConnections(sc.reqContext.Req.Context(), sc.reqContext.SignedInUser, result.Result.UID, 0, 0)
+			require.NoError(t, err)
+			require.Len(t, connections, 1)
+			require.Equal(t, dashInDB.Id, connections[0].ConnectionID)
+
+			query := models.GetDashboardQuery{Uid: dashInDB.Uid, OrgId: sc.user.OrgId}
+			err = sc.service.dashboardService.GetDashboard(sc.reqContext.Req.Context(), &query)
+			require.NoError(t, err)
+			require.Equal(t, dashInDB.Version+1, query.Result.Version)
+			panel := query.Result.Data.Get("panels").GetIndex(0)
+			require.Equal(t, result.Result.UID, panel.GetPath("libraryPanel", "uid").MustString())
+			require.Equal(t, 6, panel.GetPath("gridPos", "w").MustInt())
+
+			err = sc.sqlStore.WithDbSession(sc.reqContext.Req.Context(), func(session *sqlstore.DBSession) error {
+				versions, err := session.Table("dashboard_version").Where("dashboard_id = ? AND version = ?", dashInDB.Id, query.Result.Version).Count()
+				require.Equal(t, int64(1), versions)
+				return err
+			})
+			require.NoError(t, err)
+
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp = sc.service.createFromPanelHandler(sc.reqContext)
+			require.Equal(t, 400, resp.Status())
+
+			command.PanelID = 2
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp = sc.service.createFromPanelHandler(sc.reqContext)
+			require.Equal(t, 404, resp.Status())
+		})
+
+	scenarioWithPanel(t, "When an admin replaces a panel of a provisioned dashboard with a library panel, it should fail and not create the library panel",
+		func(t *testing.T, sc scenarioContext) {
+			dashJSON := map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{
+						"id":    int64(1),
+						"title": "Provisioned Panel",
+						"type":  "text",
+					},
+				},
+			}
+			dash := models.Dashboard{
+				Title: "Testing createFromPanelHandler with a provisioned dashboard",
+				Data:  simplejson.NewFromAny(dashJSON),
+			}
+			dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+			err := sc.sqlStore.WithDbSession(sc.reqContext.Req.Context(), func(session *sqlstore.DBSession) error {
+				_, err := session.Insert(&models.DashboardProvisioning{
+					DashboardId: dashInDB.Id,
+					Name:        "default",
+					ExternalId:  "/var/lib/grafana/dashboards/provisioned.json",
+					Updated:     time.Now().Unix(),
+				})
+				return err
+			})
+			require.NoError(t, err)
+
+			command := CreateLibraryElementFromPanelCommand{
+				DashboardUID: dashInDB.Uid,
+				PanelID:      1,
+				FolderID:     sc.folder.Id,
+				ReplacePanel: true,
+			}
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createFromPanelHandler(sc.reqContext)
+			require.Equal(t, 400, resp.Status())
+
+			err = sc.sqlStore.WithDbSession(sc.reqContext.Req.Context(), func(session *sqlstore.DBSession) error {
+				elements, err := session.Table("library_element").Where("name = ?", "Provisioned Panel").Count()
+				require.Equal(t, int64(0), elements)
+				return err
+			})
+			require.NoError(t, err)
+
+			query := models.GetDashboardQuery{Uid: dashInDB.Uid, OrgId: sc.user.OrgId}
+			err = sc.service.dashboardService.GetDashboard(sc.reqContext.Req.Context(), &query)
+			require.NoError(t, err)
+			require.Equal(t, dashInDB.Version, query.Result.Version)
+		})
 }
@@ -1,6 +1,7 @@
 package libraryelements
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
 )
 
 func TestDeleteLibraryElement(t *testing.T) {
@@ -80,4 +82,39 @@ func TestDeleteLibraryElement(t *testing.T) {
 			resp := sc.service.deleteHandler(sc.reqContext)
 			require.Equal(t, 403, resp.Status())
 		})
+
+	scenarioWithPanel(t, "When an admin forces the deletion of a library panel that is connected, it should succeed and return the affected dashboards",
+		func(t *testing.T, sc scenarioContext) {
+			dash := models.Dashboard{
+				Title: "Testing forced deleteHandler",
+				Data:  simplejson.NewFromAny(map[string]interface{}{}),
+			}
+			dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+			err := sc.service.ConnectElementsToDashboard(sc.reqContext.Req.Context(), sc.reqContext.SignedInUser, []string{sc.initialResult.Result.UID}, dashInDB.Id)
+			require.NoError(t, err)
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			err = sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("force", "true")
+			sc.reqContext.SignedInUser.OrgRole = models.ROLE_EDITOR
+			resp := sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 403, resp.Status())
+
+			sc.reqContext.SignedInUser.OrgRole = models.ROLE_ADMIN
+			resp = sc.service.deleteHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result DeleteLibraryElementResponse
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, sc.initialResult.Result.ID, result.ID)
+			require.Equal(t, []LibraryElementAffectedDashboard{{ID: dashInDB.Id, UID: dashInDB.Uid, Title: dashInDB.Title}}, result.AffectedDashboards)
+
+			err = sc.sqlStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				exists, err := session.Table(models.LibraryElementConnectionTableName).Where("element_id=?", sc.initialResult.Result.ID).Exist()
+				require.False(t, exists)
+				return err
+			})
+			require.NoError(t, err)
+		})
 }
@@ -0,0 +1,77 @@
+package libraryelements
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/api/response"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLibraryElementVersionDiff(t *testing.T) {
+	scenarioWithPanel(t, "When an admin tries to diff two versions of a library panel that exist, it should return the changes",
+		func(t *testing.T, sc scenarioContext) {
+			cmd := PatchLibraryElementCommand{
+				FolderID: sc.folder.Id,
+				Model: []byte(`
+								{
+								  "datasource": "${DS_GDEV-TESTDATA}",
+								  "description": "An updated description",
+								  "id": 1,
+								  "title": "Text - Library Panel",
+								  "type": "text"
+								}
+							`),
+				Kind:    int64(models.PanelElement),
+				Version: 1,
+			}
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			resp := sc.service.patchHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			resp = getVersionDiff(sc, "from=1&to=2")
+			require.Equal(t, 200, resp.Status())
+			var result LibraryElementVersionDiffResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.From.Version)
+			require.Equal(t, int64(2), result.Result.To.Version)
+			require.Equal(t, []LibraryElementModelChange{
+				{Path: "description", From: "A description", To: "An updated description"},
+			}, result.Result.Changes)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to diff a version of a library panel that does not exist, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			resp := getVersionDiff(sc, "from=1&to=2")
+			require.Equal(t, 404, resp.Status())
+		})
+
+	scenarioWithPanel(t, "When an admin tries to diff versions of a library panel that does not exist, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": "unknown"})
+			resp := getVersionDiff(sc, "from=1&to=1")
+			require.Equal(t, 404, resp.Status())
+		})
+
+	scenarioWithPanel(t, "When an admin tries to diff library panel versions without valid versions, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			resp := getVersionDiff(sc, "from=1")
+			require.Equal(t, 400, resp.Status())
+
+			resp = getVersionDiff(sc, "from=0&to=1")
+			require.Equal(t, 400, resp.Status())
+		})
+}
+
+func getVersionDiff(sc scenarioContext, rawQuery string) response.Response {
+	sc.reqContext.Req.URL = &url.URL{RawQuery: rawQuery}
+	sc.reqContext.Req.Form = nil
+	return sc.service.getVersionDiffHandler(sc.reqContext)
+}
@@ -1,15 +1,20 @@
 package libraryelements
 
 import (
+	"context"
 	"encoding/json"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/dashboards/database"
 	"github.com/grafana/grafana/pkg/services/search"
+	"github.com/grafana/grafana/pkg/web"
 )
 
 func TestGetAllLibraryElements(t *testing.T) {
@@ -587,6 +592,89 @@ func TestGetAllLibraryElements(t *testing.T) {
 			}
 		})
 
+	scenarioWithPanel(t, "When an admin tries to get all library panels and panelType is set, it should only return the library panels of the type",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreateCommandWithModel(sc.folder.Id, "Graph - Library Panel", models.PanelElement, []byte(`
+			{
+			  "datasource": "${DS_GDEV-TESTDATA}",
+			  "title": "Graph - Library Panel",
+			  "type": "graph",
+			  "description": "A description"
+			}
+		`))
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			graph := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			command = getCreateCommandWithModel(sc.folder.Id, "query0", models.VariableElement, []byte(`
+			{
+			  "datasource": "${DS_GDEV-TESTDATA}",
+			  "name": "query0",
+			  "type": "text",
+			  "description": "A description"
+			}
+		`))
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("panelType", "graph")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, graph.Result.UID, result.Result.Elements[0].UID)
+			require.Equal(t, "graph", result.Result.Elements[0].Type)
+
+			sc.reqContext.Req.Form.Set("panelType", "text")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			result = libraryElementsSearch{}
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[0].UID)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels and excludeFolderUid is set, it should not return the library panels in the folder",
+		func(t *testing.T, sc scenarioContext) {
+			newFolder := createFolderWithACL(t, sc.sqlStore, "NewFolder", sc.user, []folderACLItem{})
+			command := getCreatePanelCommand(newFolder.Id, "Text - Library Panel2")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("excludeFolderUid", newFolder.Uid)
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[0].UID)
+
+			sc.reqContext.Req.Form.Add("folderFilter", strconv.FormatInt(sc.folder.Id, 10)+","+strconv.FormatInt(newFolder.Id, 10))
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			result = libraryElementsSearch{}
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[0].UID)
+
+			sc.reqContext.Req.Form.Set("excludeFolderUid", "nonexistent")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 404, resp.Status())
+		})
+
 	scenarioWithPanel(t, "When an admin tries to get all library panels and two exist and folderFilter is set to a nonexistent folders, it should succeed and the result should be correct",
 		func(t *testing.T, sc scenarioContext) {
 			newFolder := createFolderWithACL(t, sc.sqlStore, "NewFolder", sc.user, []folderACLItem{})
@@ -618,6 +706,334 @@ func TestGetAllLibraryElements(t *testing.T) {
 			}
 		})
 
+	scenarioWithPanel(t, "When an admin tries to get all library panels and two exist and connectedDashboardQuery is set, it should only return library panels connected to matching dashboards",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(sc.folder.Id, "Text - Library Panel2")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			dash := models.Dashboard{
+				Title: "Connected Dashboard",
+				Data:  simplejson.NewFromAny(map[string]interface{}{"title": "Connected Dashboard"}),
+			}
+			dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+			err := sc.service.ConnectElementsToDashboard(sc.reqContext.Req.Context(), sc.reqContext.SignedInUser, []string{sc.initialResult.Result.UID}, dashInDB.Id)
+			require.NoError(t, err)
+
+			err = sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("connectedDashboardQuery", "connected")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[0].UID)
+
+			sc.reqContext.Req.Form.Set("connectedDashboardQuery", "unknown")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(0), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 0)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels and three exist and minConnections is set, it should only return library panels connected to more dashboards, most connected first",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(sc.folder.Id, "Text - Library Panel2")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			panel2 := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			command = getCreatePanelCommand(sc.folder.Id, "Text - Library Panel3")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			panel3 := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+
+			connections := map[string]int{sc.initialResult.Result.UID: 2, panel2.Result.UID: 1, panel3.Result.UID: 3}
+			for uid, count := range connections {
+				for i := 0; i < count; i++ {
+					title := "Dashboard " + uid + " " + strconv.Itoa(i)
+					dash := models.Dashboard{
+						Title: title,
+						Data:  simplejson.NewFromAny(map[string]interface{}{"title": title}),
+					}
+					dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+					err := sc.service.ConnectElementsToDashboard(sc.reqContext.Req.Context(), sc.reqContext.SignedInUser, []string{uid}, dashInDB.Id)
+					require.NoError(t, err)
+				}
+			}
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("minConnections", "1")
+			resp := sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 2)
+			require.Equal(t, panel3.Result.UID, result.Result.Elements[0].UID)
+			require.Equal(t, int64(3), result.Result.Elements[0].Meta.ConnectedDashboards)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[1].UID)
+
+			sc.reqContext.Req.Form.Add("sortDirection", "alpha-asc")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result.Elements, 2)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[0].UID)
+			require.Equal(t, panel3.Result.UID, result.Result.Elements[1].UID)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels and two exist and generalOnly is set, it should only return library panels in the General folder",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(0, "Text - Library Panel in General")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("generalOnly", "true")
+			sc.reqContext.Req.Form.Add("folderFilter", strconv.FormatInt(sc.folder.Id, 10))
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, "Text - Library Panel in General", result.Result.Elements[0].Name)
+			require.Equal(t, int64(0), result.Result.Elements[0].FolderID)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels with an origin, it should only return library panels last changed with that origin",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(sc.folder.Id, "Text - Provisioned Library Panel")
+			sc.reqContext.Req.Header.Set(originHeader, OriginProvisioning)
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			provisioned := validateAndUnMarshalResponse(t, resp)
+			sc.reqContext.Req.Header.Del(originHeader)
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Set("origin", OriginProvisioning)
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Equal(t, provisioned.Result.UID, result.Result.Elements[0].UID)
+
+			// editing the provisioned library panel by hand changes its origin
+			cmd := PatchLibraryElementCommand{Kind: int64(models.PanelElement), Version: 1, FolderID: -1}
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": provisioned.Result.UID})
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			resp = sc.service.patchHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(0), result.Result.TotalCount)
+
+			sc.reqContext.Req.Form.Set("origin", OriginAPI)
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), result.Result.TotalCount)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all human edited library panels, it should only return library panels changed at least once outside of provisioning",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(sc.folder.Id, "Text - Provisioned Library Panel")
+			sc.reqContext.Req.Header.Set(originHeader, OriginProvisioning)
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			provisioned := validateAndUnMarshalResponse(t, resp)
+
+			getHumanEdited := func() libraryElementsSearch {
+				t.Helper()
+				err := sc.reqContext.Req.ParseForm()
+				require.NoError(t, err)
+				sc.reqContext.Req.Form.Set("humanEditedOnly", "true")
+				resp := sc.service.getAllHandler(sc.reqContext)
+				require.Equal(t, 200, resp.Status())
+				var result libraryElementsSearch
+				err = json.Unmarshal(resp.Body(), &result)
+				require.NoError(t, err)
+				return result
+			}
+			patch := func(version int64) {
+				t.Helper()
+				cmd := PatchLibraryElementCommand{Kind: int64(models.PanelElement), Version: version, FolderID: -1}
+				sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": provisioned.Result.UID})
+				sc.reqContext.Req.Body = mockRequestBody(cmd)
+				resp := sc.service.patchHandler(sc.reqContext)
+				require.Equal(t, 200, resp.Status())
+			}
+
+			result := getHumanEdited()
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[0].UID)
+
+			patch(1)
+			result = getHumanEdited()
+			require.Equal(t, int64(1), result.Result.TotalCount)
+
+			// editing the provisioned library panel by hand marks it as human edited for good
+			sc.reqContext.Req.Header.Del(originHeader)
+			patch(2)
+			sc.reqContext.Req.Header.Set(originHeader, OriginProvisioning)
+			patch(3)
+			sc.reqContext.Req.Header.Del(originHeader)
+			result = getHumanEdited()
+			require.Equal(t, int64(2), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 2)
+		})
+
+	scenarioWithPanel(t, "When an editor tries to get all library panels in folders they don't manage, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.reqContext.SignedInUser.OrgRole = models.ROLE_EDITOR
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("unmanagedOnly", "true")
+			resp := sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 403, resp.Status())
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels in folders they don't manage, it should leave out the folders they admin through their user or teams",
+		func(t *testing.T, sc scenarioContext) {
+			dashboardStore := database.ProvideDashboardStore(sc.sqlStore)
+			team, err := sc.sqlStore.CreateTeam("Folder admins", "", sc.user.OrgId)
+			require.NoError(t, err)
+			err = sc.sqlStore.AddTeamMember(sc.user.UserId, sc.user.OrgId, team.Id, false, 0)
+			require.NoError(t, err)
+
+			createPanelInFolder := func(title string, acl models.DashboardACL) string {
+				folder := createFolderWithACL(t, sc.sqlStore, title, sc.user, []folderACLItem{})
+				acl.OrgID = sc.user.OrgId
+				acl.DashboardID = folder.Id
+				acl.Permission = models.PERMISSION_ADMIN
+				acl.Created = time.Now()
+				acl.Updated = time.Now()
+				err := dashboardStore.UpdateDashboardACL(context.Background(), folder.Id, []*models.DashboardACL{&acl})
+				require.NoError(t, err)
+
+				sc.reqContext.Req.Body = mockRequestBody(getCreatePanelCommand(folder.Id, title+" - Library Panel"))
+				return validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext)).Result.UID
+			}
+			createPanelInFolder("UserAdminFolder", models.DashboardACL{UserID: sc.user.UserId})
+			createPanelInFolder("TeamAdminFolder", models.DashboardACL{TeamID: team.Id})
+			adminRole := models.ROLE_ADMIN
+			roleAdminUID := createPanelInFolder("RoleAdminFolder", models.DashboardACL{Role: &adminRole})
+
+			err = sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("unmanagedOnly", "true")
+			resp := sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			// the admin role grants admin to every org admin, so it doesn't make the folder managed by the user
+			require.Equal(t, int64(2), result.Result.TotalCount)
+			uids := []string{result.Result.Elements[0].UID, result.Result.Elements[1].UID}
+			require.ElementsMatch(t, []string{sc.initialResult.Result.UID, roleAdminUID}, uids)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels deduped by name, it should only return the newest library panel of each name",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(0, "Text - Library Panel")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			newest := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			command = getCreatePanelCommand(sc.folder.Id, "Text - Library Panel2")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("dedupeByName", "true")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(2), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 2)
+			uids := []string{result.Result.Elements[0].UID, result.Result.Elements[1].UID}
+			require.Contains(t, uids, newest.Result.UID)
+			require.NotContains(t, uids, sc.initialResult.Result.UID)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels in a folder deduped by name, newer library panels in other folders should not hide them",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(0, "Text - Library Panel")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("dedupeByName", "true")
+			sc.reqContext.Req.Form.Add("folderFilter", strconv.FormatInt(sc.folder.Id, 10))
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[0].UID)
+		})
+
+	scenarioWithPanel(t, "When a viewer tries to get all library panels they can edit, it should only return the library panels in folders they can edit",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(0, "General - Library Panel")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			editableFolder := createFolderWithACL(t, sc.sqlStore, "EditableFolder", sc.user, []folderACLItem{{models.ROLE_VIEWER, models.PERMISSION_EDIT}})
+			command = getCreatePanelCommand(editableFolder.Id, "Editable - Library Panel")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp = sc.service.createHandler(sc.reqContext)
+			editable := validateAndUnMarshalResponse(t, resp)
+			sc.reqContext.SignedInUser.OrgRole = models.ROLE_VIEWER
+
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result libraryElementsSearch
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(3), result.Result.TotalCount)
+
+			err = sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("editableOnly", "true")
+			sc.reqContext.Req.Form.Add("perPage", "1")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			result = libraryElementsSearch{}
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, editable.Result.UID, result.Result.Elements[0].UID)
+		})
+
 	scenarioWithPanel(t, "When an admin tries to get all library panels and two exist and folderFilter is set to General folder, it should succeed and the result should be correct",
 		func(t *testing.T, sc scenarioContext) {
 			command := getCreatePanelCommand(sc.folder.Id, "Text - Library Panel2")
@@ -1259,4 +1675,75 @@ func TestGetAllLibraryElements(t *testing.T) {
 				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
 			}
 		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels and searchString is set, exact name matches should come first, then name prefix matches",
+		func(t *testing.T, sc scenarioContext) {
+			for _, name := range []string{"A Library Panel", "Library Panel 2", "Library Panel"} {
+				command := getCreatePanelCommand(sc.folder.Id, name)
+				sc.reqContext.Req.Body = mockRequestBody(command)
+				resp := sc.service.createHandler(sc.reqContext)
+				require.Equal(t, 200, resp.Status())
+			}
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("searchString", "library panel")
+			resp := sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result libraryElementsSearch
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(4), result.Result.TotalCount)
+			names := make([]string, 0, len(result.Result.Elements))
+			for _, element := range result.Result.Elements {
+				names = append(names, element.Name)
+			}
+			require.Equal(t, []string{"Library Panel", "Library Panel 2", "A Library Panel", "Text - Library Panel"}, names)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get all library panels with a tag, it should only return the tagged library panels with their tags",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(sc.folder.Id, "Untagged - Library Panel")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			sc.reqContext.Req.Body = mockRequestBody(BulkTagLibraryElementsCommand{
+				UIDs: []string{sc.initialResult.Result.UID},
+				Add:  []string{"prod", "cpu"},
+			})
+			resp = sc.service.bulkTagHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			err := sc.reqContext.Req.ParseForm()
+			require.NoError(t, err)
+			sc.reqContext.Req.Form.Add("tag", "cpu")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result LibraryElementSearchResponse
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), result.Result.TotalCount)
+			require.Len(t, result.Result.Elements, 1)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result.Elements[0].UID)
+			require.Equal(t, []string{"cpu", "prod"}, result.Result.Elements[0].Tags)
+
+			sc.reqContext.Req.Form.Set("tag", "memory")
+			resp = sc.service.getAllHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			result = LibraryElementSearchResponse{}
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, int64(0), result.Result.TotalCount)
+			require.Empty(t, result.Result.Elements)
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			resp = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var element LibraryElementResponse
+			err = json.Unmarshal(resp.Body(), &element)
+			require.NoError(t, err)
+			require.Equal(t, []string{"cpu", "prod"}, element.Result.Tags)
+		})
 }
@@ -1,9 +1,11 @@
 package libraryelements
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/grafana/grafana/pkg/api/response"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/web"
 	"github.com/stretchr/testify/require"
@@ -180,6 +182,132 @@ func TestGetLibraryElement(t *testing.T) {
 			}
 		})
 
+	scenarioWithPanel(t, "When an admin tries to get a library panel with a matching ETag, it should return not modified",
+		func(t *testing.T, sc scenarioContext) {
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			resp := sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			etag := resp.(*response.NormalResponse).Header().Get("ETag")
+			require.NotEmpty(t, etag)
+
+			sc.reqContext.Req.Header.Set("If-None-Match", etag)
+			resp = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 304, resp.Status())
+			require.Empty(t, resp.Body())
+
+			sc.reqContext.Req.Header.Set("If-None-Match", `"outdated", W/`+etag)
+			resp = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 304, resp.Status())
+
+			sc.reqContext.Req.Header.Set("If-None-Match", `"outdated"`)
+			resp = sc.service.getHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get the model of a library panel, it should return only the model",
+		func(t *testing.T, sc scenarioContext) {
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			resp := sc.service.getModelHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			require.Equal(t, "application/json", resp.(*response.NormalResponse).Header().Get("Content-Type"))
+			model, err := json.Marshal(sc.initialResult.Result.Model)
+			require.NoError(t, err)
+			require.JSONEq(t, string(model), string(resp.Body()))
+			etag := resp.(*response.NormalResponse).Header().Get("ETag")
+			require.NotEmpty(t, etag)
+
+			sc.reqContext.Req.Header.Set("If-None-Match", etag)
+			resp = sc.service.getModelHandler(sc.reqContext)
+			require.Equal(t, 304, resp.Status())
+			require.Empty(t, resp.Body())
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get the model of a library panel that does not exist, it should fail",
+		func(t *testing.T, sc scenarioContext) {
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": "unknown"})
+			resp := sc.service.getModelHandler(sc.reqContext)
+			require.Equal(t, 404, resp.Status())
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get library panels by uids, it should return them in the requested order without the missing ones",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(sc.folder.Id, "Text - Library Panel2")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			second := validateAndUnMarshalResponse(t, resp)
+
+			sc.reqContext.Req.Form.Add("uid", second.Result.UID)
+			sc.reqContext.Req.Form.Add("uid", "unknown")
+			sc.reqContext.Req.Form.Add("uid", sc.initialResult.Result.UID)
+			sc.reqContext.Req.Form.Add("uid", second.Result.UID)
+			resp = sc.service.getBatchHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result LibraryElementArrayResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			uids := make([]string, 0, len(result.Result))
+			for _, element := range result.Result {
+				uids = append(uids, element.UID)
+			}
+			require.Equal(t, []string{second.Result.UID, sc.initialResult.Result.UID, second.Result.UID}, uids)
+		})
+
+	scenarioWithPanel(t, "When an admin tries to get the library panels of a dashboard version, it should return the library panels of that version",
+		func(t *testing.T, sc scenarioContext) {
+			command := getCreatePanelCommand(sc.folder.Id, "Text - Library Panel2")
+			sc.reqContext.Req.Body = mockRequestBody(command)
+			resp := sc.service.createHandler(sc.reqContext)
+			second := validateAndUnMarshalResponse(t, resp)
+
+			libraryPanel := func(id int64, uid string) map[string]interface{} {
+				return map[string]interface{}{
+					"id":           id,
+					"libraryPanel": map[string]interface{}{"uid": uid},
+				}
+			}
+			dashJSON := map[string]interface{}{
+				"panels": []interface{}{
+					libraryPanel(1, second.Result.UID),
+					map[string]interface{}{
+						"id":     int64(2),
+						"type":   "row",
+						"panels": []interface{}{libraryPanel(3, sc.initialResult.Result.UID), libraryPanel(4, second.Result.UID)},
+					},
+					libraryPanel(5, "deleted"),
+				},
+			}
+			dash := models.Dashboard{
+				Title: "Testing getDashboardVersionElementsHandler",
+				Data:  simplejson.NewFromAny(dashJSON),
+			}
+			dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":dashboardUid": dashInDB.Uid, ":version": "1"})
+			resp = sc.service.getDashboardVersionElementsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result LibraryElementArrayResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			uids := make([]string, 0, len(result.Result))
+			for _, element := range result.Result {
+				uids = append(uids, element.UID)
+			}
+			require.Equal(t, []string{second.Result.UID, sc.initialResult.Result.UID}, uids)
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":dashboardUid": dashInDB.Uid, ":version": "2"})
+			resp = sc.service.getDashboardVersionElementsHandler(sc.reqContext)
+			require.Equal(t, 404, resp.Status())
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":dashboardUid": "unknown", ":version": "1"})
+			resp = sc.service.getDashboardVersionElementsHandler(sc.reqContext)
+			require.Equal(t, 404, resp.Status())
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":dashboardUid": dashInDB.Uid, ":version": "latest"})
+			resp = sc.service.getDashboardVersionElementsHandler(sc.reqContext)
+			require.Equal(t, 400, resp.Status())
+		})
+
 	scenarioWithPanel(t, "When an admin tries to get a library panel that exists in an other org, it should fail",
 		func(t *testing.T, sc scenarioContext) {
 			sc.reqContext.SignedInUser.OrgId = 2
@@ -3,6 +3,7 @@ package libraryelements
 import (
 	"testing"
 
+	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/util"
 
 	"github.com/google/go-cmp/cmp"
@@ -400,4 +401,41 @@ func TestPatchLibraryElement(t *testing.T) {
 				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
 			}
 		})
+
+	scenarioWithPanel(t, "When an admin tries to move a connected library panel to a folder viewers of the dashboard can't view, it should fail unless forced",
+		func(t *testing.T, sc scenarioContext) {
+			dash := models.Dashboard{
+				Title: "Testing move with connections",
+				Data:  simplejson.NewFromAny(map[string]interface{}{"panels": []interface{}{}}),
+			}
+			dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+			err := sc.service.ConnectElementsToDashboard(sc.reqContext.Req.Context(), sc.reqContext.SignedInUser, []string{sc.initialResult.Result.UID}, dashInDB.Id)
+			require.NoError(t, err)
+
+			editorsFolder := createFolderWithACL(t, sc.sqlStore, "EditorsFolder", sc.user, []folderACLItem{{models.ROLE_EDITOR, models.PERMISSION_EDIT}})
+			cmd := PatchLibraryElementCommand{
+				FolderID: editorsFolder.Id,
+				Kind:     int64(models.PanelElement),
+				Version:  1,
+			}
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			resp := sc.service.patchHandler(sc.reqContext)
+			require.Equal(t, 400, resp.Status())
+
+			viewersFolder := createFolderWithACL(t, sc.sqlStore, "ViewersFolder", sc.user, []folderACLItem{{models.ROLE_VIEWER, models.PERMISSION_VIEW}})
+			cmd.FolderID = viewersFolder.Id
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			resp = sc.service.patchHandler(sc.reqContext)
+			result := validateAndUnMarshalResponse(t, resp)
+			require.Equal(t, viewersFolder.Id, result.Result.FolderID)
+
+			cmd.FolderID = editorsFolder.Id
+			cmd.Version = result.Result.Version
+			cmd.Force = true
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			resp = sc.service.patchHandler(sc.reqContext)
+			result = validateAndUnMarshalResponse(t, resp)
+			require.Equal(t, editorsFolder.Id, result.Result.FolderID)
+		})
 }
@@ -1,12 +1,15 @@
 package libraryelements
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/guardian"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
 	"github.com/grafana/grafana/pkg/web"
 	"github.com/stretchr/testify/require"
 )
@@ -381,4 +384,272 @@ func TestLibraryElementPermissions(t *testing.T) {
 				}
 			})
 	}
+
+	var getPermissionsCases = []struct {
+		role   models.RoleType
+		status int
+	}{
+		{models.ROLE_ADMIN, 200},
+		{models.ROLE_EDITOR, 403},
+		{models.ROLE_VIEWER, 403},
+	}
+
+	for _, testCase := range getPermissionsCases {
+		testScenario(t, fmt.Sprintf("When %s tries to get the permissions of a library panel in the General folder, it should return correct status", testCase.role),
+			func(t *testing.T, sc scenarioContext) {
+				cmd := getCreatePanelCommand(0, "Library Panel in General Folder")
+				sc.reqContext.Req.Body = mockRequestBody(cmd)
+				resp := sc.service.createHandler(sc.reqContext)
+				result := validateAndUnMarshalResponse(t, resp)
+				sc.reqContext.SignedInUser.OrgRole = testCase.role
+
+				sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": result.Result.UID})
+				resp = sc.service.getPermissionsHandler(sc.reqContext)
+				require.Equal(t, testCase.status, resp.Status())
+			})
+	}
+
+	testScenario(t, "When an admin sets permissions on library panels in several folders, it should return a result per library panel",
+		func(t *testing.T, sc scenarioContext) {
+			folder := createFolderWithACL(t, sc.sqlStore, "Folder", sc.user, everyonePermissions)
+			cmd := getCreatePanelCommand(folder.Id, "Library Panel in Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			inFolder := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			cmd = getCreatePanelCommand(0, "Library Panel in General Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			inGeneral := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+
+			bulkCmd := BulkLibraryElementPermissionsCommand{
+				UIDs: []string{inFolder.Result.UID, inGeneral.Result.UID, "unknown"},
+				Add:  []LibraryElementPermissionItem{{UserID: sc.user.UserId, Permission: models.PERMISSION_ADMIN}},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp := sc.service.bulkPermissionsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result BulkLibraryElementPermissionsResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 3)
+			require.Equal(t, 200, result.Result[0].Status)
+			require.Equal(t, folder.Uid, result.Result[0].FolderUID)
+			require.Equal(t, 400, result.Result[1].Status)
+			require.Equal(t, 404, result.Result[2].Status)
+			require.Equal(t, []LibraryElementPermissionsFolder{{ID: folder.Id, UID: folder.Uid, Title: "Folder"}}, result.Folders)
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": inFolder.Result.UID})
+			resp = sc.service.getPermissionsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var permissions LibraryElementPermissionsResponse
+			err = json.Unmarshal(resp.Body(), &permissions)
+			require.NoError(t, err)
+			found := false
+			for _, permission := range permissions.Result {
+				if permission.UserId == sc.user.UserId && permission.Permission == models.PERMISSION_ADMIN {
+					found = true
+				}
+			}
+			require.True(t, found)
+		})
+
+	testScenario(t, "When an admin sets permissions on several library panels in the same folder, it should change the folder once",
+		func(t *testing.T, sc scenarioContext) {
+			folder := createFolderWithACL(t, sc.sqlStore, "Folder", sc.user, everyonePermissions)
+			cmd := getCreatePanelCommand(folder.Id, "Library Panel in Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			first := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			cmd = getCreatePanelCommand(folder.Id, "Another Library Panel in Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			second := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+
+			bulkCmd := BulkLibraryElementPermissionsCommand{
+				UIDs: []string{first.Result.UID, second.Result.UID},
+				Add:  []LibraryElementPermissionItem{{UserID: sc.user.UserId, Permission: models.PERMISSION_ADMIN}},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp := sc.service.bulkPermissionsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result BulkLibraryElementPermissionsResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 2)
+			for _, elementResult := range result.Result {
+				require.Equal(t, 200, elementResult.Status)
+				require.Equal(t, folder.Uid, elementResult.FolderUID)
+			}
+			require.Equal(t, []LibraryElementPermissionsFolder{{ID: folder.Id, UID: folder.Uid, Title: "Folder"}}, result.Folders)
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": first.Result.UID})
+			resp = sc.service.getPermissionsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var permissions LibraryElementPermissionsResponse
+			err = json.Unmarshal(resp.Body(), &permissions)
+			require.NoError(t, err)
+			count := 0
+			for _, permission := range permissions.Result {
+				if permission.UserId == sc.user.UserId && permission.Permission == models.PERMISSION_ADMIN {
+					count++
+				}
+			}
+			require.Equal(t, 1, count)
+		})
+
+	testScenario(t, "When an admin sets permissions on a library panel in a folder with the default permissions, viewers and editors should keep their access to the folder",
+		func(t *testing.T, sc scenarioContext) {
+			folder := createFolderWithACL(t, sc.sqlStore, "Folder", sc.user, []folderACLItem{})
+			cmd := getCreatePanelCommand(folder.Id, "Library Panel in Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			inFolder := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+
+			bulkCmd := BulkLibraryElementPermissionsCommand{
+				UIDs: []string{inFolder.Result.UID},
+				Add:  []LibraryElementPermissionItem{{TeamID: 1, Permission: models.PERMISSION_EDIT}},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp := sc.service.bulkPermissionsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result BulkLibraryElementPermissionsResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Equal(t, 200, result.Result[0].Status)
+
+			viewer := &models.SignedInUser{UserId: 2, OrgId: sc.user.OrgId, OrgRole: models.ROLE_VIEWER}
+			canView, err := guardian.New(context.Background(), folder.Id, sc.user.OrgId, viewer).CanView()
+			require.NoError(t, err)
+			require.True(t, canView)
+			editor := &models.SignedInUser{UserId: 3, OrgId: sc.user.OrgId, OrgRole: models.ROLE_EDITOR}
+			canEdit, err := guardian.New(context.Background(), folder.Id, sc.user.OrgId, editor).CanEdit()
+			require.NoError(t, err)
+			require.True(t, canEdit)
+		})
+
+	testScenario(t, "When an editor sets permissions on a library panel in a folder they can't administer, it should return forbidden for that library panel",
+		func(t *testing.T, sc scenarioContext) {
+			folder := createFolderWithACL(t, sc.sqlStore, "Folder", sc.user, everyonePermissions)
+			cmd := getCreatePanelCommand(folder.Id, "Library Panel in Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			inFolder := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			sc.reqContext.SignedInUser.OrgRole = models.ROLE_EDITOR
+
+			bulkCmd := BulkLibraryElementPermissionsCommand{
+				UIDs:   []string{inFolder.Result.UID},
+				Remove: []LibraryElementPermissionItem{{TeamID: 1}},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp := sc.service.bulkPermissionsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result BulkLibraryElementPermissionsResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 1)
+			require.Equal(t, 403, result.Result[0].Status)
+			require.Empty(t, result.Folders)
+		})
+
+	testScenario(t, "When a permission item targets both a user and a team, it should return bad request",
+		func(t *testing.T, sc scenarioContext) {
+			bulkCmd := BulkLibraryElementPermissionsCommand{
+				UIDs: []string{"uid"},
+				Add:  []LibraryElementPermissionItem{{UserID: 1, TeamID: 1, Permission: models.PERMISSION_VIEW}},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp := sc.service.bulkPermissionsHandler(sc.reqContext)
+			require.Equal(t, 400, resp.Status())
+		})
+
+	testScenario(t, "When an editor moves library panels to a folder, it should skip the library panels they can't edit",
+		func(t *testing.T, sc scenarioContext) {
+			adminOnlyFolder := createFolderWithACL(t, sc.sqlStore, "Admin Only Folder", sc.user, adminOnlyPermissions)
+			cmd := getCreatePanelCommand(adminOnlyFolder.Id, "Library Panel in Admin Only Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			inAdminOnlyFolder := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			cmd = getCreatePanelCommand(0, "Library Panel in General Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			inGeneral := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			toFolder := createFolderWithACL(t, sc.sqlStore, "Folder", sc.user, defaultPermissions)
+			sc.reqContext.SignedInUser.OrgRole = models.ROLE_EDITOR
+
+			bulkCmd := BulkMoveLibraryElementsCommand{
+				UIDs:      []string{inAdminOnlyFolder.Result.UID, inGeneral.Result.UID, "unknown"},
+				FolderUID: toFolder.Uid,
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp := sc.service.bulkMoveHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result BulkMoveLibraryElementsResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 3)
+			require.Equal(t, 403, result.Result[0].Status)
+			require.Equal(t, 200, result.Result[1].Status)
+			require.Equal(t, 404, result.Result[2].Status)
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": inGeneral.Result.UID})
+			moved := validateAndUnMarshalResponse(t, sc.service.getHandler(sc.reqContext))
+			require.Equal(t, toFolder.Id, moved.Result.FolderID)
+			require.Equal(t, int64(2), moved.Result.Version)
+		})
+
+	testScenario(t, "When an editor tags library panels, it should skip the library panels they can't edit",
+		func(t *testing.T, sc scenarioContext) {
+			adminOnlyFolder := createFolderWithACL(t, sc.sqlStore, "Admin Only Folder", sc.user, adminOnlyPermissions)
+			cmd := getCreatePanelCommand(adminOnlyFolder.Id, "Library Panel in Admin Only Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			inAdminOnlyFolder := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+			cmd = getCreatePanelCommand(0, "Library Panel in General Folder")
+			sc.reqContext.Req.Body = mockRequestBody(cmd)
+			inGeneral := validateAndUnMarshalResponse(t, sc.service.createHandler(sc.reqContext))
+
+			getTags := func(elementID int64) []string {
+				tags := make([]string, 0)
+				err := sc.sqlStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+					return session.Table(models.LibraryElementTagTableName).Where("library_element_id=?", elementID).Asc("term").Cols("term").Find(&tags)
+				})
+				require.NoError(t, err)
+				return tags
+			}
+
+			bulkCmd := BulkTagLibraryElementsCommand{
+				UIDs: []string{inAdminOnlyFolder.Result.UID, inGeneral.Result.UID},
+				Add:  []string{"prod", "cpu"},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp := sc.service.bulkTagHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			require.Equal(t, []string{"cpu", "prod"}, getTags(inAdminOnlyFolder.Result.ID))
+
+			sc.reqContext.SignedInUser.OrgRole = models.ROLE_EDITOR
+			bulkCmd = BulkTagLibraryElementsCommand{
+				UIDs:   []string{inAdminOnlyFolder.Result.UID, inGeneral.Result.UID, "unknown"},
+				Add:    []string{"cpu", "memory"},
+				Remove: []string{"prod"},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp = sc.service.bulkTagHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+
+			var result BulkTagLibraryElementsResponse
+			err := json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 3)
+			require.Equal(t, 403, result.Result[0].Status)
+			require.Equal(t, 200, result.Result[1].Status)
+			require.Equal(t, 404, result.Result[2].Status)
+			require.Equal(t, []string{"cpu", "prod"}, getTags(inAdminOnlyFolder.Result.ID))
+			require.Equal(t, []string{"cpu", "memory"}, getTags(inGeneral.Result.ID))
+		})
+
+	testScenario(t, "When tagging library panels with an empty tag, it should return bad request",
+		func(t *testing.T, sc scenarioContext) {
+			bulkCmd := BulkTagLibraryElementsCommand{
+				UIDs: []string{"uid"},
+				Add:  []string{""},
+			}
+			sc.reqContext.Req.Body = mockRequestBody(bulkCmd)
+			resp := sc.service.bulkTagHandler(sc.reqContext)
+			require.Equal(t, 400, resp.Status())
+		})
 }
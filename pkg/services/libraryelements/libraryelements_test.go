@@ -15,6 +15,7 @@ import (
 	"github.com/grafana/grafana/pkg/api/response"
 	busmock "github.com/grafana/grafana/pkg/bus/mock"
 	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/models"
 	acmock "github.com/grafana/grafana/pkg/services/accesscontrol/mock"
 	"github.com/grafana/grafana/pkg/services/alerting"
@@ -160,6 +161,7 @@ func TestGetLibraryPanelConnections(t *testing.T) {
 							},
 						},
 					},
+					TotalCount: 1,
 				}
 			}
 
@@ -171,6 +173,85 @@ func TestGetLibraryPanelConnections(t *testing.T) {
 				t.Fatalf("Result mismatch (-want +got):\n%s", diff)
 			}
 		})
+
+	scenarioWithPanel(t, "When an admin tries to get a page of library panel connections, it should return the page ordered by dashboard UID and the total count",
+		func(t *testing.T, sc scenarioContext) {
+			for _, uid := range []string{"conn-c", "conn-a", "conn-b"} {
+				dash := models.Dashboard{
+					Uid:   uid,
+					Title: "Testing GetLibraryPanelConnections " + uid,
+					Data:  simplejson.NewFromAny(map[string]interface{}{"uid": uid}),
+				}
+				dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+				err := sc.service.ConnectElementsToDashboard(sc.reqContext.Req.Context(), sc.reqContext.SignedInUser, []string{sc.initialResult.Result.UID}, dashInDB.Id)
+				require.NoError(t, err)
+			}
+
+			sc.ctx.Req = web.SetURLParams(sc.ctx.Req, map[string]string{":uid": sc.initialResult.Result.UID})
+			sc.reqContext.Req.Form.Add("perPage", "2")
+			sc.reqContext.Req.Form.Add("page", "2")
+			resp := sc.service.getConnectionsHandler(sc.reqContext)
+			var result = validateAndUnMarshalConnectionResponse(t, resp)
+			require.Equal(t, int64(3), result.TotalCount)
+			require.Equal(t, 2, result.Page)
+			require.Equal(t, 2, result.PerPage)
+			require.Len(t, result.Result, 1)
+			require.Equal(t, "conn-c", result.Result[0].ConnectionUID)
+		})
+}
+
+func TestGetLibraryElementBrokenConnections(t *testing.T) {
+	scenarioWithPanel(t, "When an admin tries to get broken connections after a connected library panel was removed, it should return the referencing panel",
+		func(t *testing.T, sc scenarioContext) {
+			dashJSON := map[string]interface{}{
+				"panels": []interface{}{
+					map[string]interface{}{
+						"id": int64(2),
+						"gridPos": map[string]interface{}{
+							"h": 6,
+							"w": 6,
+							"x": 6,
+							"y": 0,
+						},
+						"libraryPanel": map[string]interface{}{
+							"uid":  sc.initialResult.Result.UID,
+							"name": sc.initialResult.Result.Name,
+						},
+					},
+				},
+			}
+			dash := models.Dashboard{
+				Title: "Testing GetLibraryElementBrokenConnections",
+				Data:  simplejson.NewFromAny(dashJSON),
+			}
+			dashInDB := createDashboard(t, sc.sqlStore, sc.user, &dash, sc.folder.Id)
+			err := sc.service.ConnectElementsToDashboard(sc.reqContext.Req.Context(), sc.reqContext.SignedInUser, []string{sc.initialResult.Result.UID}, dashInDB.Id)
+			require.NoError(t, err)
+
+			resp := sc.service.getBrokenConnectionsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			var result LibraryElementBrokenConnectionsResponse
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 0)
+
+			err = sc.sqlStore.WithDbSession(context.Background(), func(session *sqlstore.DBSession) error {
+				_, err := session.Exec("DELETE FROM library_element WHERE uid=?", sc.initialResult.Result.UID)
+				return err
+			})
+			require.NoError(t, err)
+
+			resp = sc.service.getBrokenConnectionsHandler(sc.reqContext)
+			require.Equal(t, 200, resp.Status())
+			err = json.Unmarshal(resp.Body(), &result)
+			require.NoError(t, err)
+			require.Len(t, result.Result, 1)
+			require.True(t, result.Result[0].ElementMissing)
+			require.Equal(t, sc.initialResult.Result.UID, result.Result[0].ElementUID)
+			require.Equal(t, dashInDB.Uid, result.Result[0].DashboardUID)
+			require.Equal(t, dashInDB.Title, result.Result[0].DashboardTitle)
+			require.Equal(t, int64(2), result.Result[0].PanelID)
+		})
 }
 
 type libraryElement struct {
@@ -420,6 +501,9 @@ func testScenario(t *testing.T, desc string, fn func(t *testing.T, sc scenarioCo
 				cfg, dashboardService, dashboardStore, nil,
 				features, folderPermissions, ac, busmock.New(),
 			),
+			dashboardService:         dashboardService,
+			folderPermissionsService: folderPermissions,
+			log:                      log.New("library-elements-test"),
 		}
 
 		usr := models.SignedInUser{
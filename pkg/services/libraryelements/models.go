@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"time"
+
+	"github.com/grafana/grafana/pkg/models"
 )
 
 type LibraryConnectionKind int
@@ -12,6 +14,18 @@ const (
 	Dashboard LibraryConnectionKind = iota + 1
 )
 
+// Origins record whether a library element was last created or changed through the API or by provisioning.
+const (
+	OriginAPI          = "api"
+	OriginProvisioning = "provisioning"
+)
+
+// originHeader sets the origin of a created or patched library element when the command doesn't.
+const originHeader = "X-Grafana-Origin"
+
+// nameUniquenessOrg makes library element names unique across the folders of an org, rather than per folder.
+const nameUniquenessOrg = "org"
+
 // LibraryElement is the model for library element definitions.
 type LibraryElement struct {
 	ID          int64  `xorm:"pk autoincr 'id'"`
@@ -24,6 +38,9 @@ type LibraryElement struct {
 	Description string
 	Model       json.RawMessage
 	Version     int64
+	Origin      string
+	// HumanEdited is set once the element is created or changed with an origin other than provisioning, and never unset
+	HumanEdited bool
 
 	Created time.Time
 	Updated time.Time
@@ -44,6 +61,8 @@ type LibraryElementWithMeta struct {
 	Description string
 	Model       json.RawMessage
 	Version     int64
+	Origin      string
+	HumanEdited bool
 
 	Created time.Time
 	Updated time.Time
@@ -72,6 +91,8 @@ type LibraryElementDTO struct {
 	Description string                `json:"description"`
 	Model       json.RawMessage       `json:"model"`
 	Version     int64                 `json:"version"`
+	Origin      string                `json:"origin"`
+	Tags        []string              `json:"tags"`
 	Meta        LibraryElementDTOMeta `json:"meta"`
 }
 
@@ -113,6 +134,62 @@ type libraryElementConnection struct {
 	CreatedBy    int64
 }
 
+// libraryElementTag is the model for library element tags.
+type libraryElementTag struct {
+	ID               int64  `xorm:"pk autoincr 'id'"`
+	LibraryElementID int64  `xorm:"library_element_id"`
+	Term             string `xorm:"term"`
+}
+
+// libraryElementVersion is the model for a stored version of a library element.
+type libraryElementVersion struct {
+	ID        int64 `xorm:"pk autoincr 'id'"`
+	ElementID int64 `xorm:"element_id"`
+	Version   int64
+	Name      string
+	Model     json.RawMessage
+	Created   time.Time
+	CreatedBy int64
+}
+
+// libraryElementVersionWithMeta is the model for stored versions of a library element with meta.
+type libraryElementVersionWithMeta struct {
+	ID             int64 `xorm:"pk autoincr 'id'"`
+	ElementID      int64 `xorm:"element_id"`
+	Version        int64
+	Name           string
+	Model          json.RawMessage
+	Created        time.Time
+	CreatedBy      int64
+	CreatedByName  string
+	CreatedByEmail string
+}
+
+// LibraryElementVersionDTO is the frontend DTO for a stored version of a library element.
+type LibraryElementVersionDTO struct {
+	Version   int64                     `json:"version"`
+	Name      string                    `json:"name"`
+	Model     json.RawMessage           `json:"model"`
+	Created   time.Time                 `json:"created"`
+	CreatedBy LibraryElementDTOMetaUser `json:"createdBy"`
+}
+
+// LibraryElementModelChange is a value of the model that differs between two versions of a library element.
+// The path is the dot separated path to the value, with the index of array items in brackets, e.g. targets[0].expr.
+// From is unset if the value was added, and To is unset if it was removed.
+type LibraryElementModelChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// LibraryElementVersionDiff is the difference between two versions of a library element.
+type LibraryElementVersionDiff struct {
+	From    LibraryElementVersionDTO    `json:"from"`
+	To      LibraryElementVersionDTO    `json:"to"`
+	Changes []LibraryElementModelChange `json:"changes"`
+}
+
 // libraryElementConnectionWithMeta is the model for library element connections with meta.
 type libraryElementConnectionWithMeta struct {
 	ID             int64  `xorm:"pk autoincr 'id'"`
@@ -126,6 +203,30 @@ type libraryElementConnectionWithMeta struct {
 	CreatedByEmail string
 }
 
+// libraryElementBrokenConnection is the model for connections whose element or dashboard is missing.
+type libraryElementBrokenConnection struct {
+	ID             int64  `xorm:"id"`
+	ElementID      int64  `xorm:"element_id"`
+	ElementUID     string `xorm:"element_uid"`
+	ConnectionID   int64  `xorm:"connection_id"`
+	DashboardUID   string `xorm:"dashboard_uid"`
+	DashboardTitle string `xorm:"dashboard_title"`
+}
+
+// LibraryElementBrokenConnectionDTO is the frontend DTO for connections that no longer resolve.
+type LibraryElementBrokenConnectionDTO struct {
+	ID             int64  `json:"id"`
+	ElementID      int64  `json:"elementId"`
+	ElementUID     string `json:"elementUid"`
+	ElementMissing bool   `json:"elementMissing"`
+	ConnectionID   int64  `json:"connectionId"`
+	DashboardUID   string `json:"dashboardUid"`
+	DashboardTitle string `json:"dashboardTitle"`
+	// PanelID is the ID of the dashboard panel referencing a missing element, 0 if unknown.
+	PanelID          int64 `json:"panelId"`
+	DashboardMissing bool  `json:"dashboardMissing"`
+}
+
 // LibraryElementConnectionDTO is the frontend DTO for element connections.
 type LibraryElementConnectionDTO struct {
 	ID            int64                     `json:"id"`
@@ -146,6 +247,8 @@ var (
 	errLibraryElementDashboardNotFound = errors.New("library element connection could not be found")
 	// errLibraryElementHasConnections is an error for when an user deletes a library element that is connected.
 	errLibraryElementHasConnections = errors.New("the library element has connections")
+	// errLibraryElementForceDeleteAccessDenied is an error for when a user who isn't an org admin forces the deletion of a library element.
+	errLibraryElementForceDeleteAccessDenied = errors.New("only org admins can force the deletion of a connected library element")
 	// errLibraryElementVersionMismatch is an error for when a library element has been changed by someone else.
 	errLibraryElementVersionMismatch = errors.New("the library element has been changed by someone else")
 	// errLibraryElementUnSupportedElementKind is an error for when the kind is unsupported.
@@ -156,6 +259,28 @@ var (
 	errLibraryElementInvalidUID = errors.New("uid contains illegal characters")
 	// errLibraryElementUIDTooLong is an error for when the uid of a library element is invalid
 	errLibraryElementUIDTooLong = errors.New("uid too long, max 40 characters")
+	// errLibraryElementInvalidModel is an error for when the model of a library element is invalid
+	errLibraryElementInvalidModel = errors.New("model must be a JSON object with string type and description")
+	// errLibraryElementGeneralFolderPermissions is an error for when a user tries to change the permissions of an element in the General folder.
+	errLibraryElementGeneralFolderPermissions = errors.New("permissions of library elements in the General folder can't be changed")
+	// errLibraryElementInvalidPermissionItem is an error for when a permission item doesn't target exactly one user or team.
+	errLibraryElementInvalidPermissionItem = errors.New("permission items must target either a user or a team with a valid permission")
+	// errLibraryElementPanelNotFound is an error for when a panel can't be found in a dashboard.
+	errLibraryElementPanelNotFound = errors.New("panel could not be found in the dashboard")
+	// errLibraryElementPanelIsLibraryPanel is an error for when a user tries to create a library panel from a library panel.
+	errLibraryElementPanelIsLibraryPanel = errors.New("panel is already a library panel")
+	// errLibraryElementMoveBreaksConnections is an error for when a library element is moved to a folder that some viewers of its connected dashboards can't view.
+	errLibraryElementMoveBreaksConnections = errors.New("moving the library element would hide it from viewers of dashboards using it, set force to move it anyway")
+	// errLibraryElementInvalidOrigin is an error for when the origin of a library element is neither api nor provisioning.
+	errLibraryElementInvalidOrigin = errors.New("origin must be either api or provisioning")
+	// errLibraryElementUnmanagedOnlyAccessDenied is an error for when a user who isn't an org admin searches for elements in folders they don't manage.
+	errLibraryElementUnmanagedOnlyAccessDenied = errors.New("only org admins can search for library elements in folders they don't manage")
+	// errLibraryElementDashboardAccessDenied is an error for when a user can't view the dashboard the library elements are requested for.
+	errLibraryElementDashboardAccessDenied = errors.New("access denied to dashboard")
+	// errLibraryElementInvalidTag is an error for when a tag is empty or longer than 50 characters.
+	errLibraryElementInvalidTag = errors.New("tags must be between 1 and 50 characters")
+	// errLibraryElementVersionNotFound is an error for when a version of a library element isn't stored.
+	errLibraryElementVersionNotFound = errors.New("library element version could not be found")
 )
 
 // Commands
@@ -180,6 +305,51 @@ type CreateLibraryElementCommand struct {
 	Kind int64 `json:"kind" binding:"Required"`
 	// required: false
 	UID string `json:"uid"`
+	// Origin of the library element, either api or provisioning. Defaults to the X-Grafana-Origin header, and then to api.
+	// required: false
+	Origin string `json:"origin"`
+}
+
+// CreateLibraryElementFromPanelCommand is the command for adding a library panel from a panel of a dashboard
+type CreateLibraryElementFromPanelCommand struct {
+	// UID of the dashboard the panel is on.
+	DashboardUID string `json:"dashboardUid" binding:"Required"`
+	// ID of the panel in the dashboard.
+	PanelID int64 `json:"panelId" binding:"Required"`
+	// ID of the folder where the library panel is stored.
+	FolderID int64 `json:"folderId"`
+	// UID of the folder where the library panel is stored.
+	FolderUID *string `json:"folderUid"`
+	// Name of the library panel, defaults to the title of the panel.
+	// A number is appended to the name if it's already taken in the folder.
+	Name string `json:"name"`
+	// required: false
+	UID string `json:"uid"`
+	// Replace the dashboard panel with a reference to the new library panel.
+	ReplacePanel bool `json:"replacePanel"`
+}
+
+// ValidateLibraryElementsCommand is the command for validating LibraryElements before creating them.
+type ValidateLibraryElementsCommand struct {
+	// The library elements to validate, as they would be sent to create them.
+	Elements []CreateLibraryElementCommand `json:"elements" binding:"Required"`
+}
+
+// ImportLibraryElementsCommand is the command for importing a bundle of LibraryElements.
+type ImportLibraryElementsCommand struct {
+	// The library elements to import.
+	Elements []ImportLibraryElement `json:"elements" binding:"Required"`
+	// Create the referenced folders that don't exist, instead of failing the elements stored in them.
+	AutoCreateFolders bool `json:"autoCreateFolders"`
+}
+
+// ImportLibraryElement is a single LibraryElement in an ImportLibraryElementsCommand.
+type ImportLibraryElement struct {
+	CreateLibraryElementCommand
+	// Title of the folder where the library element is stored, used when the folder has to be created.
+	// Defaults to the folder UID.
+	// required: false
+	FolderTitle string `json:"folderTitle"`
 }
 
 // PatchLibraryElementCommand is the command for patching a LibraryElement
@@ -202,6 +372,49 @@ type PatchLibraryElementCommand struct {
 	Version int64 `json:"version" binding:"Required"`
 	// required: false
 	UID string `json:"uid"`
+	// Force moves the library element to another folder even if viewers of its connected dashboards can't view that folder.
+	// required: false
+	Force bool `json:"force"`
+	// Origin of the change, either api or provisioning. Defaults to the X-Grafana-Origin header, and then to api.
+	// required: false
+	Origin string `json:"origin"`
+}
+
+// LibraryElementPermissionItem is a permission granted to, or revoked from, a user or a team.
+type LibraryElementPermissionItem struct {
+	UserID     int64                 `json:"userId"`
+	TeamID     int64                 `json:"teamId"`
+	Permission models.PermissionType `json:"permission"`
+}
+
+// BulkLibraryElementPermissionsCommand is the command for changing the folder permissions of several LibraryElements.
+// Library elements have no permissions of their own, so the permissions are applied to the folder of each element,
+// and apply to everything in that folder. Each folder is changed once, however many of the elements are in it.
+type BulkLibraryElementPermissionsCommand struct {
+	// UIDs of the library elements to change the permissions of.
+	UIDs []string `json:"uids" binding:"Required"`
+	// Permissions to add, existing permissions for the same user or team are replaced.
+	Add []LibraryElementPermissionItem `json:"add"`
+	// Permissions to remove, only the user or team is used to find the permission to remove.
+	Remove []LibraryElementPermissionItem `json:"remove"`
+}
+
+// BulkMoveLibraryElementsCommand is the command for moving several LibraryElements to a folder.
+type BulkMoveLibraryElementsCommand struct {
+	// UIDs of the library elements to move.
+	UIDs []string `json:"uids" binding:"Required"`
+	// UID of the folder to move the library elements to, the General folder if empty.
+	FolderUID string `json:"folderUid"`
+}
+
+// BulkTagLibraryElementsCommand is the command for adding and removing tags on several LibraryElements.
+type BulkTagLibraryElementsCommand struct {
+	// UIDs of the library elements to tag.
+	UIDs []string `json:"uids" binding:"Required"`
+	// Tags to add, tags the library element already has are ignored.
+	Add []string `json:"add"`
+	// Tags to remove.
+	Remove []string `json:"remove"`
 }
 
 // searchLibraryElementsQuery is the query used for searching for Elements
@@ -214,6 +427,26 @@ type searchLibraryElementsQuery struct {
 	typeFilter    string
 	excludeUID    string
 	folderFilter  string
+	generalOnly   bool
+	// connectedDashboardQuery matches the titles of the dashboards the elements are connected to
+	connectedDashboardQuery string
+	// unmanagedOnly restricts the search to elements outside the folders the user is an admin of
+	unmanagedOnly bool
+	origin        string
+	// humanEditedOnly restricts the search to elements created or changed at least once with an origin other than provisioning
+	humanEditedOnly bool
+	// editableOnly restricts the search to elements the user can edit
+	editableOnly bool
+	// dedupeByName only returns the most recently updated element of each name
+	dedupeByName bool
+	// excludeFolderIDs are the folders whose elements are left out of the search
+	excludeFolderIDs []int64
+	// panelType restricts the search to the panels of the visualization type
+	panelType string
+	// minConnections restricts the search to elements connected to more than this number of dashboards
+	minConnections int
+	// tag restricts the search to elements with the tag
+	tag string
 }
 
 // LibraryElementResponse is a response struct for LibraryElementDTO.
@@ -221,6 +454,11 @@ type LibraryElementResponse struct {
 	Result LibraryElementDTO `json:"result"`
 }
 
+// LibraryElementVersionDiffResponse is a response struct for LibraryElementVersionDiff.
+type LibraryElementVersionDiffResponse struct {
+	Result LibraryElementVersionDiff `json:"result"`
+}
+
 // LibraryElementSearchResponse is a response struct for LibraryElementSearchResult.
 type LibraryElementSearchResponse struct {
 	Result LibraryElementSearchResult `json:"result"`
@@ -233,11 +471,119 @@ type LibraryElementArrayResponse struct {
 
 // LibraryElementConnectionsResponse is a response struct for an array of LibraryElementConnectionDTO.
 type LibraryElementConnectionsResponse struct {
-	Result []LibraryElementConnectionDTO `json:"result"`
+	Result     []LibraryElementConnectionDTO `json:"result"`
+	TotalCount int64                         `json:"totalCount"`
+	// Page and PerPage are only set when the connections are paginated.
+	Page    int `json:"page,omitempty"`
+	PerPage int `json:"perPage,omitempty"`
+}
+
+// LibraryElementBrokenConnectionsResponse is a response struct for an array of LibraryElementBrokenConnectionDTO.
+type LibraryElementBrokenConnectionsResponse struct {
+	Result []LibraryElementBrokenConnectionDTO `json:"result"`
+}
+
+// LibraryElementPermissionsResponse is a response struct for the permissions of a library element.
+type LibraryElementPermissionsResponse struct {
+	Result []*models.DashboardACLInfoDTO `json:"result"`
+}
+
+// LibraryElementValidationResult is the result of validating a single library element.
+type LibraryElementValidationResult struct {
+	// Index of the element in the validated list.
+	Index  int      `json:"index"`
+	UID    string   `json:"uid,omitempty"`
+	Name   string   `json:"name"`
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// LibraryElementValidationResponse is a response struct for an array of LibraryElementValidationResult.
+type LibraryElementValidationResponse struct {
+	Result []LibraryElementValidationResult `json:"result"`
+}
+
+// ImportLibraryElementsResult is the result of importing a single library element.
+type ImportLibraryElementsResult struct {
+	// Index of the element in the imported list.
+	Index   int    `json:"index"`
+	UID     string `json:"uid,omitempty"`
+	Name    string `json:"name"`
+	Status  int    `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// ImportedFolder is a folder created while importing library elements.
+type ImportedFolder struct {
+	UID   string `json:"uid"`
+	Title string `json:"title"`
+}
+
+// ImportLibraryElementsResponse is a response struct for importing library elements.
+type ImportLibraryElementsResponse struct {
+	Result         []ImportLibraryElementsResult `json:"result"`
+	CreatedFolders []ImportedFolder              `json:"createdFolders"`
+}
+
+// BulkLibraryElementPermissionsResult is the result of changing the folder permissions of a single library element.
+type BulkLibraryElementPermissionsResult struct {
+	UID string `json:"uid"`
+	// FolderUID is the UID of the folder whose permissions are changed, empty for the General folder.
+	FolderUID string `json:"folderUid"`
+	Status    int    `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
+
+// LibraryElementPermissionsFolder is a folder whose permissions are changed by a bulk permissions change.
+type LibraryElementPermissionsFolder struct {
+	ID    int64  `json:"id"`
+	UID   string `json:"uid"`
+	Title string `json:"title"`
+}
+
+// BulkLibraryElementPermissionsResponse is a response struct for an array of BulkLibraryElementPermissionsResult.
+type BulkLibraryElementPermissionsResponse struct {
+	Result []BulkLibraryElementPermissionsResult `json:"result"`
+	// Folders are the folders whose permissions were changed. The change applies to every dashboard
+	// and library element in these folders, not only to the library elements in the request.
+	Folders []LibraryElementPermissionsFolder `json:"folders"`
+}
+
+// BulkMoveLibraryElementsResult is the result of moving a single library element.
+type BulkMoveLibraryElementsResult struct {
+	UID     string `json:"uid"`
+	Status  int    `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// BulkMoveLibraryElementsResponse is a response struct for an array of BulkMoveLibraryElementsResult.
+type BulkMoveLibraryElementsResponse struct {
+	Result []BulkMoveLibraryElementsResult `json:"result"`
+}
+
+// BulkTagLibraryElementsResult is the result of tagging a single library element.
+type BulkTagLibraryElementsResult struct {
+	UID     string `json:"uid"`
+	Status  int    `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// BulkTagLibraryElementsResponse is a response struct for an array of BulkTagLibraryElementsResult.
+type BulkTagLibraryElementsResponse struct {
+	Result []BulkTagLibraryElementsResult `json:"result"`
 }
 
 // DeleteLibraryElementResponse is the response struct for deleting a library element.
 type DeleteLibraryElementResponse struct {
 	ID      int64  `json:"id"`
 	Message string `json:"message"`
+	// AffectedDashboards lists the dashboards that were connected to a forcefully deleted library element.
+	AffectedDashboards []LibraryElementAffectedDashboard `json:"affectedDashboards,omitempty"`
+}
+
+// LibraryElementAffectedDashboard is a dashboard that was connected to a deleted library element.
+type LibraryElementAffectedDashboard struct {
+	ID    int64  `json:"id" xorm:"id"`
+	UID   string `json:"uid" xorm:"uid"`
+	Title string `json:"title" xorm:"title"`
 }
@@ -18,6 +18,14 @@ func selectLibraryElementByParam(params []Pair) (string, []interface{}) {
 	conditions := make([]string, 0, len(params))
 	values := make([]interface{}, 0, len(params))
 	for _, p := range params {
+		// a list of values matches any of the values
+		if list, ok := p.value.([]string); ok {
+			conditions = append(conditions, "le."+p.key+" IN (?"+strings.Repeat(",?", len(list)-1)+")")
+			for _, v := range list {
+				values = append(values, v)
+			}
+			continue
+		}
 		conditions = append(conditions, "le."+p.key+"=?")
 		values = append(values, p.value)
 	}
@@ -63,19 +71,112 @@ func writeSearchStringSQL(query searchLibraryElementsQuery, sqlStore *sqlstore.S
 	}
 }
 
+// writeSearchRelevanceSQL selects the relevance of the element to the search string, so that exact name matches
+// can be ordered first, followed by name prefix matches and then the remaining matches.
+func writeSearchRelevanceSQL(query searchLibraryElementsQuery, sqlStore *sqlstore.SQLStore, builder *sqlstore.SQLBuilder) {
+	if len(strings.TrimSpace(query.searchString)) > 0 {
+		builder.Write(", CASE WHEN LOWER(le.name) = LOWER(?) THEN 0", query.searchString)
+		builder.Write(" WHEN le.name "+sqlStore.Dialect.LikeStr()+" ? THEN 1 ELSE 2 END AS relevance ", query.searchString+"%")
+	}
+}
+
+// writeConnectedDashboardSQL restricts the elements to those connected to a dashboard with a matching title.
+// Only dashboards the user can view are considered, so that the search doesn't leak dashboard titles.
+func writeConnectedDashboardSQL(query searchLibraryElementsQuery, sqlStore *sqlstore.SQLStore, user *models.SignedInUser, builder *sqlstore.SQLBuilder) {
+	if len(strings.TrimSpace(query.connectedDashboardQuery)) > 0 {
+		builder.Write(" AND le.id IN (SELECT lec.element_id FROM "+models.LibraryElementConnectionTableName+" AS lec"+
+			" INNER JOIN dashboard AS dashboard ON lec.connection_id = dashboard.id"+
+			" WHERE lec.kind = ? AND dashboard.title "+sqlStore.Dialect.LikeStr()+" ?", Dashboard, "%"+query.connectedDashboardQuery+"%")
+		builder.WriteDashboardPermissionFilter(user, models.PERMISSION_VIEW)
+		builder.Write(")")
+	}
+}
+
 func writeExcludeSQL(query searchLibraryElementsQuery, builder *sqlstore.SQLBuilder) {
 	if len(strings.TrimSpace(query.excludeUID)) > 0 {
 		builder.Write(" AND le.uid <> ?", query.excludeUID)
 	}
 }
 
+func writeOriginSQL(query searchLibraryElementsQuery, builder *sqlstore.SQLBuilder) {
+	if len(strings.TrimSpace(query.origin)) > 0 {
+		builder.Write(" AND le.origin = ?", strings.TrimSpace(query.origin))
+	}
+}
+
+// writeHumanEditedOnlySQL only keeps the elements created or changed at least once with an origin other than provisioning.
+func writeHumanEditedOnlySQL(query searchLibraryElementsQuery, sqlStore *sqlstore.SQLStore, builder *sqlstore.SQLBuilder) {
+	if query.humanEditedOnly {
+		builder.Write(" AND le.human_edited = ?", sqlStore.Dialect.BooleanStr(true))
+	}
+}
+
+// writePanelTypeSQL only keeps the panels of the visualization type, which is synced from the type of the model.
+func writePanelTypeSQL(query searchLibraryElementsQuery, builder *sqlstore.SQLBuilder) {
+	if len(strings.TrimSpace(query.panelType)) > 0 {
+		builder.Write(" AND le.kind = ? AND le.type = ?", int64(models.PanelElement), strings.TrimSpace(query.panelType))
+	}
+}
+
+// writeMinConnectionsSQL only keeps the elements connected to more than the minimum number of dashboards.
+func writeMinConnectionsSQL(query searchLibraryElementsQuery, builder *sqlstore.SQLBuilder) {
+	if query.minConnections > 0 {
+		builder.Write(" AND (SELECT COUNT(connection_id) FROM "+models.LibraryElementConnectionTableName+" WHERE element_id = le.id AND kind=1) > ?", query.minConnections)
+	}
+}
+
+// writeTagSQL only keeps the elements with the tag.
+func writeTagSQL(query searchLibraryElementsQuery, builder *sqlstore.SQLBuilder) {
+	if len(strings.TrimSpace(query.tag)) > 0 {
+		builder.Write(" AND le.id IN (SELECT library_element_id FROM "+models.LibraryElementTagTableName+" WHERE term = ?)", strings.TrimSpace(query.tag))
+	}
+}
+
+// writeDedupeByNameSQL writes the filtered query, only keeping the most recently updated element of each name and kind.
+// The newer elements are looked for in the filtered query too, so that an element that is filtered out,
+// or that the user can't view, doesn't hide an older element that matches the search.
+func writeDedupeByNameSQL(query searchLibraryElementsQuery, filtered *sqlstore.SQLBuilder, builder *sqlstore.SQLBuilder) {
+	if !query.dedupeByName {
+		builder.Write(filtered.GetSQLString(), filtered.GetParams()...)
+		return
+	}
+
+	builder.Write("SELECT * FROM ("+filtered.GetSQLString()+") AS le", filtered.GetParams()...)
+	builder.Write(" WHERE NOT EXISTS (SELECT 1 FROM ("+filtered.GetSQLString()+") AS newer", filtered.GetParams()...)
+	builder.Write(" WHERE newer.name = le.name AND newer.kind = le.kind" +
+		" AND (newer.updated > le.updated OR (newer.updated = le.updated AND newer.id > le.id)))")
+}
+
+func writeExcludeFolderIDsSQL(folderIDs []int64, builder *sqlstore.SQLBuilder) {
+	if len(folderIDs) == 0 {
+		return
+	}
+
+	params := make([]interface{}, 0, len(folderIDs))
+	for _, folderID := range folderIDs {
+		params = append(params, folderID)
+	}
+	builder.Write(" AND le.folder_id NOT IN (?"+strings.Repeat(",?", len(params)-1)+")", params...)
+}
+
 type FolderFilter struct {
 	includeGeneralFolder bool
-	folderIDs            []string
-	parseError           error
+	// generalOnly restricts the search to the General folder (folder_id 0), ignoring any other folder
+	generalOnly bool
+	folderIDs   []string
+	parseError  error
 }
 
 func parseFolderFilter(query searchLibraryElementsQuery) FolderFilter {
+	if query.generalOnly {
+		return FolderFilter{
+			includeGeneralFolder: true,
+			generalOnly:          true,
+			folderIDs:            []string{"0"},
+			parseError:           nil,
+		}
+	}
+
 	folderIDs := make([]string, 0)
 	if len(strings.TrimSpace(query.folderFilter)) == 0 {
 		return FolderFilter{
@@ -58,4 +58,55 @@ func addLibraryElementsMigrations(mg *migrator.Migrator) {
 	mg.AddMigration("increase max description length to 2048", migrator.NewTableCharsetMigration("library_element", []*migrator.Column{
 		{Name: "description", Type: migrator.DB_NVarchar, Length: 2048, Nullable: false},
 	}))
+
+	mg.AddMigration("add origin column to library_element", migrator.NewAddColumnMigration(libraryElementsV1, &migrator.Column{
+		Name: "origin", Type: migrator.DB_NVarchar, Length: 40, Nullable: false, Default: "'api'",
+	}))
+
+	mg.AddMigration("add human_edited column to library_element", migrator.NewAddColumnMigration(libraryElementsV1, &migrator.Column{
+		Name: "human_edited", Type: migrator.DB_Bool, Nullable: false, Default: "0",
+	}))
+
+	mg.AddMigration("set human_edited for library elements not last changed by provisioning", migrator.NewRawSQLMigration("").
+		Default("UPDATE library_element SET human_edited = 1 WHERE origin <> 'provisioning'").
+		Postgres("UPDATE library_element SET human_edited = true WHERE origin <> 'provisioning'"))
+
+	libraryElementTagV1 := migrator.Table{
+		Name: models.LibraryElementTagTableName,
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "library_element_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "term", Type: migrator.DB_NVarchar, Length: 50, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"library_element_id", "term"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create "+models.LibraryElementTagTableName+" table v1", migrator.NewAddTableMigration(libraryElementTagV1))
+	mg.AddMigration("add index "+models.LibraryElementTagTableName+" library_element_id-term", migrator.NewAddIndexMigration(libraryElementTagV1, libraryElementTagV1.Indices[0]))
+
+	libraryElementVersionV1 := migrator.Table{
+		Name: models.LibraryElementVersionTableName,
+		Columns: []*migrator.Column{
+			{Name: "id", Type: migrator.DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "element_id", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "version", Type: migrator.DB_BigInt, Nullable: false},
+			{Name: "name", Type: migrator.DB_NVarchar, Length: 150, Nullable: false},
+			{Name: "model", Type: migrator.DB_Text, Nullable: false},
+			{Name: "created", Type: migrator.DB_DateTime, Nullable: false},
+			{Name: "created_by", Type: migrator.DB_BigInt, Nullable: false},
+		},
+		Indices: []*migrator.Index{
+			{Cols: []string{"element_id", "version"}, Type: migrator.UniqueIndex},
+		},
+	}
+
+	mg.AddMigration("create "+models.LibraryElementVersionTableName+" table v1", migrator.NewAddTableMigration(libraryElementVersionV1))
+	mg.AddMigration("add index "+models.LibraryElementVersionTableName+" element_id-version", migrator.NewAddIndexMigration(libraryElementVersionV1, libraryElementVersionV1.Indices[0]))
+
+	// the current version of the existing library elements is the first version with a history
+	mg.AddMigration("copy current library elements to "+models.LibraryElementVersionTableName, migrator.NewRawSQLMigration(
+		"INSERT INTO "+models.LibraryElementVersionTableName+" (element_id, version, name, model, created, created_by) "+
+			"SELECT id, version, name, model, updated, updated_by FROM library_element"))
 }
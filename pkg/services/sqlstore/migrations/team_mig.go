@@ -60,4 +60,83 @@ func addTeamMigrations(mg *Migrator) {
 	mg.AddMigration("Add column permission to team_member table", NewAddColumnMigration(teamMemberV1, &Column{
 		Name: "permission", Type: DB_SmallInt, Nullable: true,
 	}))
+
+	mg.AddMigration("Add column created_by to team_member table", NewAddColumnMigration(teamMemberV1, &Column{
+		Name: "created_by", Type: DB_BigInt, Nullable: true,
+	}))
+
+	mg.AddMigration("Add column expires_at to team_member table", NewAddColumnMigration(teamMemberV1, &Column{
+		Name: "expires_at", Type: DB_DateTime, Nullable: true,
+	}))
+
+	mg.AddMigration("Add column settings to team table", NewAddColumnMigration(teamV1, &Column{
+		Name: "settings", Type: DB_Text, Nullable: true,
+	}))
+
+	mg.AddMigration("Add column open_join to team table", NewAddColumnMigration(teamV1, &Column{
+		Name: "open_join", Type: DB_Bool, Nullable: false, Default: "0",
+	}))
+
+	teamLabelV1 := Table{
+		Name: "team_label",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt},
+			{Name: "team_id", Type: DB_BigInt},
+			{Name: "key", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "value", Type: DB_NVarchar, Length: 190, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "team_id", "key"}, Type: UniqueIndex},
+			{Cols: []string{"org_id", "key", "value"}},
+		},
+	}
+
+	mg.AddMigration("create team label table", NewAddTableMigration(teamLabelV1))
+	mg.AddMigration("add unique index team_label.org_id_team_id_key", NewAddIndexMigration(teamLabelV1, teamLabelV1.Indices[0]))
+	mg.AddMigration("add index team_label.org_id_key_value", NewAddIndexMigration(teamLabelV1, teamLabelV1.Indices[1]))
+
+	teamTombstoneV1 := Table{
+		Name: "team_tombstone",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt},
+			{Name: "team_id", Type: DB_BigInt},
+			{Name: "name", Type: DB_NVarchar, Length: 190, Nullable: false},
+			{Name: "deleted_at", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "deleted_at"}},
+		},
+	}
+
+	mg.AddMigration("create team tombstone table", NewAddTableMigration(teamTombstoneV1))
+	mg.AddMigration("add index team_tombstone.org_id_deleted_at", NewAddIndexMigration(teamTombstoneV1, teamTombstoneV1.Indices[0]))
+
+	teamMemberHistoryV1 := Table{
+		Name: "team_member_history",
+		Columns: []*Column{
+			{Name: "id", Type: DB_BigInt, IsPrimaryKey: true, IsAutoIncrement: true},
+			{Name: "org_id", Type: DB_BigInt},
+			{Name: "team_id", Type: DB_BigInt},
+			{Name: "user_id", Type: DB_BigInt},
+			{Name: "action", Type: DB_NVarchar, Length: 20, Nullable: false},
+			{Name: "actor_id", Type: DB_BigInt, Nullable: false},
+			{Name: "created", Type: DB_DateTime, Nullable: false},
+		},
+		Indices: []*Index{
+			{Cols: []string{"org_id", "user_id", "created"}},
+		},
+	}
+
+	mg.AddMigration("create team member history table", NewAddTableMigration(teamMemberHistoryV1))
+	mg.AddMigration("add index team_member_history.org_id_user_id_created", NewAddIndexMigration(teamMemberHistoryV1, teamMemberHistoryV1.Indices[0]))
+
+	mg.AddMigration("Add column external_synced to team_member table", NewAddColumnMigration(teamMemberV1, &Column{
+		Name: "external_synced", Type: DB_DateTime, Nullable: true,
+	}))
+
+	mg.AddMigration("set external_synced for external team members", NewRawSQLMigration("").
+		Default("UPDATE team_member SET external_synced = updated WHERE external = 1").
+		Postgres("UPDATE team_member SET external_synced = updated WHERE external = true"))
 }
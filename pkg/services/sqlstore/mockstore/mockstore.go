@@ -2,6 +2,7 @@ package mockstore
 
 import (
 	"context"
+	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/datasources"
@@ -254,6 +255,18 @@ func (m *SQLStoreMock) IsTeamMember(orgId int64, teamId int64, userId int64) (bo
 	return false, nil
 }
 
+func (m *SQLStoreMock) SetTeamMemberCreatedBy(ctx context.Context, orgID, teamID, userID, actorID int64) error {
+	return m.ExpectedError
+}
+
+func (m *SQLStoreMock) SetTeamMemberExpiry(ctx context.Context, orgID, teamID, userID int64, expiresAt *time.Time) error {
+	return m.ExpectedError
+}
+
+func (m *SQLStoreMock) GetExpiredTeamMembers(ctx context.Context) ([]*models.TeamMember, error) {
+	return nil, m.ExpectedError
+}
+
 func (m *SQLStoreMock) RemoveTeamMember(ctx context.Context, cmd *models.RemoveTeamMemberCommand) error {
 	return m.ExpectedError
 }
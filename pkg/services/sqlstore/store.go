@@ -2,6 +2,7 @@ package sqlstore
 
 import (
 	"context"
+	"time"
 
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/services/datasources"
@@ -54,6 +55,9 @@ type Store interface {
 	AddTeamMember(userID, orgID, teamID int64, isExternal bool, permission models.PermissionType) error
 	UpdateTeamMember(ctx context.Context, cmd *models.UpdateTeamMemberCommand) error
 	IsTeamMember(orgId int64, teamId int64, userId int64) (bool, error)
+	SetTeamMemberCreatedBy(ctx context.Context, orgID, teamID, userID, actorID int64) error
+	SetTeamMemberExpiry(ctx context.Context, orgID, teamID, userID int64, expiresAt *time.Time) error
+	GetExpiredTeamMembers(ctx context.Context) ([]*models.TeamMember, error)
 	RemoveTeamMember(ctx context.Context, cmd *models.RemoveTeamMemberCommand) error
 	GetUserTeamMemberships(ctx context.Context, orgID, userID int64, external bool) ([]*models.TeamMemberDTO, error)
 	GetTeamMembers(ctx context.Context, query *models.GetTeamMembersQuery) error
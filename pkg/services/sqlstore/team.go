@@ -3,10 +3,14 @@ package sqlstore
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
 	ac "github.com/grafana/grafana/pkg/services/accesscontrol"
 )
@@ -19,7 +23,51 @@ type TeamStore interface {
 	UpdateTeamMember(ctx context.Context, cmd *models.UpdateTeamMemberCommand) error
 	RemoveTeamMember(ctx context.Context, cmd *models.RemoveTeamMemberCommand) error
 	GetTeamMembers(ctx context.Context, cmd *models.GetTeamMembersQuery) error
+	GetTeamMembersGrouped(ctx context.Context, query *models.GetTeamMembersQuery) ([]*models.TeamMemberDTO, []*models.TeamMemberDTO, error)
 	GetUserTeamMemberships(ctx context.Context, orgID, userID int64, external bool) ([]*models.TeamMemberDTO, error)
+	GetUserOrgTeamMemberships(ctx context.Context, userID int64) (map[int64][]*models.TeamDTO, error)
+	GetRecentMembers(ctx context.Context, signedInUser *models.SignedInUser, orgID, teamID int64, since time.Time, limit int) ([]*models.TeamMemberDTO, error)
+	GetMembersJoinedBetween(ctx context.Context, signedInUser *models.SignedInUser, orgID, teamID int64, from, to time.Time) ([]*models.TeamMemberDTO, error)
+	GetTombstonesSince(ctx context.Context, orgID int64, since time.Time) ([]*models.TeamTombstone, error)
+	GetTeamsUserRemovedFrom(ctx context.Context, orgID, userID int64, since time.Time) ([]*models.TeamMemberRemoval, error)
+	GetMembershipOverlap(ctx context.Context, orgID, teamA, teamB int64) (int64, int64, int64, error)
+	MergeTeams(ctx context.Context, orgID, sourceTeamID, targetTeamID int64) (*models.MergeTeamsResult, error)
+	GetTeamDashboardAclCounts(ctx context.Context, orgID int64) (map[int64]int64, error)
+	GetMembersCreatedBy(ctx context.Context, orgID, actorUserID int64) ([]*models.TeamMemberDTO, error)
+	FindOrphanedMembers(ctx context.Context, orgID int64) ([]models.TeamMember, error)
+	CleanupOrphanedMembers(ctx context.Context, orgID int64) (int64, error)
+	GetOrgTeamStats(ctx context.Context, orgID int64) (*models.TeamStats, error)
+	GetMembersOfTeams(ctx context.Context, orgID int64, teamIDs []int64, distinct bool) ([]*models.TeamMemberDTO, error)
+	GetTeamsForUsersUnion(ctx context.Context, signedInUser *models.SignedInUser, orgID int64, userIDs []int64) ([]*models.TeamDTO, error)
+	GetTeamSettings(ctx context.Context, orgID, teamID int64) (*simplejson.Json, error)
+	SetTeamSettings(ctx context.Context, orgID, teamID int64, settings *simplejson.Json) error
+	CheckMemberships(ctx context.Context, orgID int64, pairs []models.TeamUserPair) (map[models.TeamUserPair]bool, error)
+	GetTeamWithAdmins(ctx context.Context, orgID, teamID int64) (*models.TeamDTO, []*models.TeamMemberDTO, error)
+	GetMembersByPermission(ctx context.Context, orgID int64, permission models.PermissionType) ([]*models.TeamMemberDTO, error)
+	GetMembersChangedSince(ctx context.Context, orgID int64, since time.Time) ([]*models.TeamMemberDTO, error)
+	SwapMemberPermissions(ctx context.Context, orgID, teamID, userA, userB int64) error
+	IsTeamNameAvailable(ctx context.Context, orgID int64, name string, excludeID int64) (bool, error)
+	GetPrimaryAdminTeam(ctx context.Context, orgID, userID int64) (*models.TeamDTO, error)
+	ListTeamsAfter(ctx context.Context, orgID, afterTeamID int64, limit int) ([]*models.TeamDTO, error)
+	ListTeamsByNamePattern(ctx context.Context, signedInUser *models.SignedInUser, orgID int64, pattern string) ([]*models.TeamDTO, error)
+	ReplaceTeamAdmin(ctx context.Context, orgID, teamID, oldAdminID, newAdminID int64) error
+	CheckConsistency(ctx context.Context, orgID int64) (*models.TeamConsistencyReport, error)
+	GetEffectiveTeamPermission(ctx context.Context, orgID, teamID, userID int64) (models.PermissionType, bool, error)
+	GetTeamMembersAfter(ctx context.Context, query *models.GetTeamMembersQuery, afterUserID int64) error
+	GetOrCreateTeamByName(ctx context.Context, orgID int64, name, email string) (*models.TeamDTO, bool, error)
+	SetTeamOpenJoin(ctx context.Context, orgID, teamID int64, openJoin bool) error
+	ListJoinableTeams(ctx context.Context, orgID, userID int64) ([]*models.TeamDTO, error)
+	JoinTeam(ctx context.Context, orgID, teamID, userID int64) error
+	CountMembershipsByAuthModule(ctx context.Context, orgID int64) (map[string]int64, error)
+	PromoteToAdmin(ctx context.Context, orgID, teamID int64, userIDs []int64, maxAdmins int) error
+	GetTeamFolderAccess(ctx context.Context, orgID, teamID int64) ([]models.FolderPermission, error)
+	GetAdminsOfUsersTeams(ctx context.Context, signedInUser *models.SignedInUser, orgID, userID int64, excludeSelf bool) (map[int64][]*models.TeamMemberDTO, error)
+	SetTeamLabels(ctx context.Context, orgID, teamID int64, labels map[string]string) error
+	ListTeamsByLabelSelector(ctx context.Context, signedInUser *models.SignedInUser, orgID int64, selector map[string]string) ([]*models.TeamDTO, error)
+	SnapshotTeam(ctx context.Context, orgID, teamID int64) (*models.TeamSnapshot, error)
+	ExportOrgMemberships(ctx context.Context, signedInUser *models.SignedInUser, orgID int64) ([]*models.TeamMembershipExport, error)
+	FindTeamsByEmail(ctx context.Context, orgID int64, email string) ([]*models.TeamDTO, error)
+	FindMembersWithUnexpectedPermission(ctx context.Context, orgID, teamID int64, expected map[int64]models.PermissionType) ([]*models.TeamMemberDTO, error)
 }
 
 func getFilteredUsers(signedInUser *models.SignedInUser, hiddenUsers map[string]struct{}) []string {
@@ -50,6 +98,11 @@ func getTeamMemberCount(filteredUsers []string) string {
 	return "(SELECT COUNT(*) FROM team_member WHERE team_member.team_id = team.id) AS member_count "
 }
 
+// getTeamAclCount selects the number of dashboard and folder permissions granted to the teams of a subquery
+func getTeamAclCount(teams string) string {
+	return "(SELECT COUNT(*) FROM dashboard_acl WHERE dashboard_acl.team_id = " + teams + ".id) AS acl_count "
+}
+
 func getTeamSelectSQLBase(filteredUsers []string) string {
 	return `SELECT
 		team.id as id,
@@ -60,6 +113,17 @@ func getTeamSelectSQLBase(filteredUsers []string) string {
 		` FROM team as team `
 }
 
+func getTeamSelectWithSettingsSQLBase(filteredUsers []string) string {
+	return `SELECT
+		team.id as id,
+		team.org_id,
+		team.name as name,
+		team.email as email,
+		team.settings as settings, ` +
+		getTeamMemberCount(filteredUsers) +
+		` FROM team as team `
+}
+
 func getTeamSelectWithPermissionsSQLBase(filteredUsers []string) string {
 	return `SELECT
 		team.id AS id,
@@ -81,6 +145,13 @@ func (ss *SQLStore) CreateTeam(name, email string, orgID int64) (models.Team, er
 		Updated: time.Now(),
 	}
 	err := ss.WithTransactionalDbSession(context.Background(), func(sess *DBSession) error {
+		if err := ss.lockOrgTeams(sess, orgID); err != nil {
+			return err
+		}
+		if err := ss.checkOrgTeamLimit(sess, orgID); err != nil {
+			return err
+		}
+
 		if isNameTaken, err := isTeamNameTaken(orgID, name, 0, sess); err != nil {
 			return err
 		} else if isNameTaken {
@@ -93,6 +164,146 @@ func (ss *SQLStore) CreateTeam(name, email string, orgID int64) (models.Team, er
 	return team, err
 }
 
+// GetOrCreateTeamByName returns the team with the name, which is compared case-insensitively, creating the team if there's none
+// The returned bool reports whether the team was created. If a concurrent call creates the team first, that team is returned
+func (ss *SQLStore) GetOrCreateTeamByName(ctx context.Context, orgID int64, name, email string) (*models.TeamDTO, bool, error) {
+	var created bool
+	err := ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		if err := ss.lockOrgTeams(sess, orgID); err != nil {
+			return err
+		}
+
+		exists, err := sess.Table("team").Where("org_id=? AND LOWER(name)=LOWER(?)", orgID, name).Exist()
+		if err != nil || exists {
+			return err
+		}
+		if err := ss.checkOrgTeamLimit(sess, orgID); err != nil {
+			return err
+		}
+
+		team := models.Team{
+			Name:    name,
+			Email:   email,
+			OrgId:   orgID,
+			Created: time.Now(),
+			Updated: time.Now(),
+		}
+		if _, err := sess.Insert(&team); err != nil {
+			return err
+		}
+		created = true
+
+		return nil
+	})
+	// a created team is read back by its exact name, so that an older team whose name only differs in case isn't returned
+	exactName := created
+	if err != nil {
+		if !ss.Dialect.IsUniqueConstraintViolation(err) {
+			return nil, false, err
+		}
+		// the team was created since it was looked up, so the insert was rolled back and the team is read in a new session.
+		// It's read by its exact name, which is how the unique index on the name compares names: case-sensitively
+		// on Postgres and SQLite, and following the column's collation on MySQL
+		created = false
+		exactName = true
+	}
+
+	team, err := ss.getTeamByName(ctx, orgID, name, exactName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return team, created, nil
+}
+
+// lockOrgTeams locks the org when its number of teams is limited, so that concurrent team inserts into the org
+// wait for each other instead of all counting the teams before any of them is inserted.
+// It must run before anything else is read in the transaction, so that the count isn't read from an older snapshot
+func (ss *SQLStore) lockOrgTeams(sess *DBSession, orgID int64) error {
+	if ss.Cfg == nil || ss.Cfg.MaxTeamsPerOrg <= 0 {
+		return nil
+	}
+
+	_, err := sess.Exec("UPDATE org SET updated = updated WHERE id = ?", orgID)
+	return err
+}
+
+// checkOrgTeamLimit returns ErrOrgTeamLimitReached if the org already has the maximum number of teams
+func (ss *SQLStore) checkOrgTeamLimit(sess *DBSession, orgID int64) error {
+	if ss.Cfg == nil || ss.Cfg.MaxTeamsPerOrg <= 0 {
+		return nil
+	}
+
+	count, err := sess.Table("team").Where("org_id=?", orgID).Count()
+	if err != nil {
+		return err
+	}
+	if count >= ss.Cfg.MaxTeamsPerOrg {
+		return models.ErrOrgTeamLimitReached
+	}
+
+	return nil
+}
+
+// getTeamByName returns the oldest team with the name, which is compared case-insensitively unless exact is set
+func (ss *SQLStore) getTeamByName(ctx context.Context, orgID int64, name string, exact bool) (*models.TeamDTO, error) {
+	var team models.TeamDTO
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var sql bytes.Buffer
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		if exact {
+			sql.WriteString(` WHERE team.org_id = ? AND team.name = ?`)
+		} else {
+			sql.WriteString(` WHERE team.org_id = ? AND LOWER(team.name) = LOWER(?)`)
+		}
+		sql.WriteString(` ORDER BY team.id ASC`)
+		sql.WriteString(ss.Dialect.Limit(1))
+
+		exists, err := sess.SQL(sql.String(), orgID, name).Get(&team)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrTeamNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// GetTeamFolderAccess returns the folders the team is granted a permission on, sorted by title
+// These are the permissions deleting the team revokes from its members
+func (ss *SQLStore) GetTeamFolderAccess(ctx context.Context, orgID, teamID int64) ([]models.FolderPermission, error) {
+	result := make([]models.FolderPermission, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		if _, err := teamExists(orgID, teamID, sess); err != nil {
+			return err
+		}
+
+		sql := `SELECT
+				dashboard.id AS folder_id,
+				dashboard.uid AS folder_uid,
+				dashboard.title AS folder_title,
+				dashboard_acl.permission
+			FROM dashboard_acl
+			INNER JOIN dashboard ON dashboard.id = dashboard_acl.dashboard_id
+			WHERE dashboard_acl.org_id = ? AND dashboard_acl.team_id = ? AND dashboard.is_folder = ?
+			ORDER BY dashboard.title ASC, dashboard.id ASC`
+
+		return sess.SQL(sql, orgID, teamID, ss.Dialect.BooleanStr(true)).Find(&result)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func (ss *SQLStore) UpdateTeam(ctx context.Context, cmd *models.UpdateTeamCommand) error {
 	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
 		if isNameTaken, err := isTeamNameTaken(cmd.OrgId, cmd.Name, cmd.Id, sess); err != nil {
@@ -108,6 +319,8 @@ func (ss *SQLStore) UpdateTeam(ctx context.Context, cmd *models.UpdateTeamComman
 		}
 
 		sess.MustCols("email")
+		// settings are only written by SetTeamSettings
+		sess.Omit("settings")
 
 		affectedRows, err := sess.ID(cmd.Id).Update(&team)
 
@@ -126,28 +339,192 @@ func (ss *SQLStore) UpdateTeam(ctx context.Context, cmd *models.UpdateTeamComman
 // DeleteTeam will delete a team, its member and any permissions connected to the team
 func (ss *SQLStore) DeleteTeam(ctx context.Context, cmd *models.DeleteTeamCommand) error {
 	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
-		if _, err := teamExists(cmd.OrgId, cmd.Id, sess); err != nil {
+		return deleteTeam(sess, cmd.OrgId, cmd.Id)
+	})
+}
+
+func deleteTeam(sess *DBSession, orgID, teamID int64) error {
+	var team models.Team
+	exists, err := sess.Where("org_id=? and id=?", orgID, teamID).Get(&team)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return models.ErrTeamNotFound
+	}
+
+	tombstone := models.TeamTombstone{
+		OrgId:     team.OrgId,
+		TeamId:    team.Id,
+		Name:      team.Name,
+		DeletedAt: time.Now(),
+	}
+	if _, err := sess.Insert(&tombstone); err != nil {
+		return err
+	}
+
+	deletes := []string{
+		"DELETE FROM team_member WHERE org_id=? and team_id = ?",
+		"DELETE FROM team WHERE org_id=? and id = ?",
+		"DELETE FROM dashboard_acl WHERE org_id=? and team_id = ?",
+		"DELETE FROM team_role WHERE org_id=? and team_id = ?",
+		"DELETE FROM team_label WHERE org_id=? and team_id = ?",
+	}
+
+	for _, sql := range deletes {
+		_, err := sess.Exec(sql, orgID, teamID)
+		if err != nil {
 			return err
 		}
+	}
+
+	_, err = sess.Exec("DELETE FROM permission WHERE scope=?", ac.Scope("teams", "id", fmt.Sprint(teamID)))
+
+	return err
+}
+
+// MergeTeams moves the members and dashboard permissions of the source team to the target team and deletes the source team
+// Members and permissions present in both teams are collapsed, keeping the higher permission
+func (ss *SQLStore) MergeTeams(ctx context.Context, orgID, sourceTeamID, targetTeamID int64) (*models.MergeTeamsResult, error) {
+	if sourceTeamID == targetTeamID {
+		return nil, models.ErrTeamMergeIntoItself
+	}
 
-		deletes := []string{
-			"DELETE FROM team_member WHERE org_id=? and team_id = ?",
-			"DELETE FROM team WHERE org_id=? and id = ?",
-			"DELETE FROM dashboard_acl WHERE org_id=? and team_id = ?",
-			"DELETE FROM team_role WHERE org_id=? and team_id = ?",
+	result := &models.MergeTeamsResult{}
+	err := ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		for _, teamID := range []int64{sourceTeamID, targetTeamID} {
+			if _, err := teamExists(orgID, teamID, sess); err != nil {
+				return err
+			}
 		}
 
-		for _, sql := range deletes {
-			_, err := sess.Exec(sql, cmd.OrgId, cmd.Id)
-			if err != nil {
+		hadAdmin, err := sess.Table("team_member").Where("org_id=? AND team_id IN (?, ?) AND permission=?",
+			orgID, sourceTeamID, targetTeamID, models.PERMISSION_ADMIN).Exist()
+		if err != nil {
+			return err
+		}
+
+		if err := mergeTeamMembers(sess, orgID, sourceTeamID, targetTeamID, result); err != nil {
+			return err
+		}
+		if err := mergeTeamDashboardACL(sess, orgID, sourceTeamID, targetTeamID); err != nil {
+			return err
+		}
+
+		// protect the target team from ending up without an admin
+		hasAdmin, err := sess.Table("team_member").Where("org_id=? AND team_id=? AND permission=?",
+			orgID, targetTeamID, models.PERMISSION_ADMIN).Exist()
+		if err != nil {
+			return err
+		}
+		if hadAdmin && !hasAdmin {
+			return models.ErrLastTeamAdmin
+		}
+
+		return deleteTeam(sess, orgID, sourceTeamID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func mergeTeamMembers(sess *DBSession, orgID, sourceTeamID, targetTeamID int64, result *models.MergeTeamsResult) error {
+	var members []models.TeamMember
+	if err := sess.Where("org_id=? AND team_id=?", orgID, sourceTeamID).Find(&members); err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		existing, err := getTeamMember(sess, orgID, targetTeamID, member.UserId)
+		if errors.Is(err, models.ErrTeamMemberNotFound) {
+			if _, err := sess.Exec("UPDATE team_member SET team_id=?, updated=? WHERE id=?", targetTeamID, time.Now(), member.Id); err != nil {
+				return err
+			}
+			result.MembersMoved++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if member.Permission > existing.Permission {
+			if _, err := sess.Exec("UPDATE team_member SET permission=?, updated=? WHERE id=?", member.Permission, time.Now(), existing.Id); err != nil {
 				return err
 			}
 		}
+		result.MembersAlreadyPresent++
+	}
 
-		_, err := sess.Exec("DELETE FROM permission WHERE scope=?", ac.Scope("teams", "id", fmt.Sprint(cmd.Id)))
+	return nil
+}
 
+func mergeTeamDashboardACL(sess *DBSession, orgID, sourceTeamID, targetTeamID int64) error {
+	var items []models.DashboardACL
+	if err := sess.Table("dashboard_acl").Where("org_id=? AND team_id=?", orgID, sourceTeamID).Find(&items); err != nil {
 		return err
+	}
+
+	for _, item := range items {
+		var existing models.DashboardACL
+		exists, err := sess.Table("dashboard_acl").Where("org_id=? AND dashboard_id=? AND team_id=?", orgID, item.DashboardID, targetTeamID).Get(&existing)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			if _, err := sess.Exec("UPDATE dashboard_acl SET team_id=?, updated=? WHERE id=?", targetTeamID, time.Now(), item.Id); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if item.Permission > existing.Permission {
+			if _, err := sess.Exec("UPDATE dashboard_acl SET permission=?, updated=? WHERE id=?", item.Permission, time.Now(), existing.Id); err != nil {
+				return err
+			}
+		}
+		if _, err := sess.Exec("DELETE FROM dashboard_acl WHERE id=?", item.Id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTombstonesSince returns the teams deleted in the org after since, oldest first
+func (ss *SQLStore) GetTombstonesSince(ctx context.Context, orgID int64, since time.Time) ([]*models.TeamTombstone, error) {
+	tombstones := make([]*models.TeamTombstone, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		return sess.Where("org_id=? AND deleted_at>?", orgID, since).Asc("deleted_at").Find(&tombstones)
+	})
+
+	return tombstones, err
+}
+
+// GetTeamsUserRemovedFrom returns the teams the user was removed from in the org after since, most recent first
+// Each removal includes who removed the user, if it was recorded
+func (ss *SQLStore) GetTeamsUserRemovedFrom(ctx context.Context, orgID, userID int64, since time.Time) ([]*models.TeamMemberRemoval, error) {
+	removals := make([]*models.TeamMemberRemoval, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		user := ss.Dialect.Quote("user")
+		rawSQL := `SELECT
+			team_member_history.team_id,
+			team.name AS team_name,
+			team_member_history.actor_id,
+			actor.login AS actor_login,
+			team_member_history.created AS removed_at
+			FROM team_member_history
+			LEFT JOIN team ON team.id = team_member_history.team_id
+			LEFT JOIN ` + user + ` AS actor ON actor.id = team_member_history.actor_id
+			WHERE team_member_history.org_id=? AND team_member_history.user_id=? AND team_member_history.action=? AND team_member_history.created>?
+			ORDER BY team_member_history.created DESC, team_member_history.id DESC`
+
+		return sess.SQL(rawSQL, orgID, userID, models.TeamMemberRemoved, since).Find(&removals)
 	})
+
+	return removals, err
 }
 
 func teamExists(orgID int64, teamID int64, sess *DBSession) (bool, error) {
@@ -174,12 +551,39 @@ func isTeamNameTaken(orgId int64, name string, existingId int64, sess *DBSession
 	return false, nil
 }
 
+// IsTeamNameAvailable reports whether a team can be given the name, which is compared case-insensitively
+// The team with excludeID is ignored, so that a team being renamed doesn't conflict with itself
+func (ss *SQLStore) IsTeamNameAvailable(ctx context.Context, orgID int64, name string, excludeID int64) (bool, error) {
+	var count int64
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var err error
+		count, err = sess.Table("team").Where("org_id=? AND LOWER(name)=LOWER(?) AND id<>?", orgID, name, excludeID).Count()
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return count == 0, nil
+}
+
+// staleExternalTeamsSQL selects the teams whose external members were all last synced before a bound,
+// which hints that the sync of the team with its external group has stopped
+const staleExternalTeamsSQL = `SELECT team_id FROM team_member WHERE external = ? GROUP BY team_id HAVING MAX(external_synced) < ?`
+
 func (ss *SQLStore) SearchTeams(ctx context.Context, query *models.SearchTeamsQuery) error {
 	return ss.WithDbSession(ctx, func(sess *DBSession) error {
 		query.Result = models.SearchTeamQueryResult{
 			Teams: make([]*models.TeamDTO, 0),
 		}
 		queryWithWildcards := "%" + query.Query + "%"
+		if query.PrefixQuery {
+			queryWithWildcards = query.Query + "%"
+			if query.Limit == 0 {
+				query.Limit = models.DefaultTeamPrefixSearchLimit
+				query.Page = 1
+			}
+		}
 
 		var sql bytes.Buffer
 		params := make([]interface{}, 0)
@@ -209,6 +613,16 @@ func (ss *SQLStore) SearchTeams(ctx context.Context, query *models.SearchTeamsQu
 			params = append(params, query.Name)
 		}
 
+		if query.ExcludeUserIdMemberships != 0 {
+			sql.WriteString(` and team.id NOT IN (SELECT team_id FROM team_member WHERE user_id = ?)`)
+			params = append(params, query.ExcludeUserIdMemberships)
+		}
+
+		if query.StaleExternalBefore != nil {
+			sql.WriteString(` and team.id IN (` + staleExternalTeamsSQL + `)`)
+			params = append(params, ss.Dialect.BooleanStr(true), *query.StaleExternalBefore)
+		}
+
 		var (
 			acFilter ac.SQLFilter
 			err      error
@@ -222,7 +636,20 @@ func (ss *SQLStore) SearchTeams(ctx context.Context, query *models.SearchTeamsQu
 			params = append(params, acFilter.Args...)
 		}
 
-		sql.WriteString(` order by team.name asc`)
+		switch {
+		case query.SortBy == models.TeamSortAclCountDesc:
+			filtered := sql.String()
+			sql.Reset()
+			sql.WriteString(`SELECT teams.*, ` + getTeamAclCount("teams") + ` FROM (` + filtered + `) AS teams`)
+			sql.WriteString(` order by acl_count desc, teams.name asc`)
+		case query.SortBy != "":
+			return models.ErrInvalidTeamSort
+		case query.PrefixQuery && query.Query != "":
+			sql.WriteString(` order by CASE WHEN LOWER(team.name) = LOWER(?) THEN 0 ELSE 1 END, team.name asc`)
+			params = append(params, query.Query)
+		default:
+			sql.WriteString(` order by team.name asc`)
+		}
 
 		if query.Limit != 0 {
 			offset := query.Limit * (query.Page - 1)
@@ -245,6 +672,14 @@ func (ss *SQLStore) SearchTeams(ctx context.Context, query *models.SearchTeamsQu
 			countSess.Where("name=?", query.Name)
 		}
 
+		if query.ExcludeUserIdMemberships != 0 {
+			countSess.Where("team.id NOT IN (SELECT team_id FROM team_member WHERE user_id = ?)", query.ExcludeUserIdMemberships)
+		}
+
+		if query.StaleExternalBefore != nil {
+			countSess.Where("team.id IN ("+staleExternalTeamsSQL+")", ss.Dialect.BooleanStr(true), *query.StaleExternalBefore)
+		}
+
 		// If we're not retrieving all results, then only search for teams that this user has access to
 		if query.UserIdFilter != models.FilterIgnoreUser {
 			countSess.
@@ -269,13 +704,95 @@ func (ss *SQLStore) SearchTeams(ctx context.Context, query *models.SearchTeamsQu
 	})
 }
 
+// ListTeamsAfter returns up to limit teams whose ID is greater than afterTeamID, ordered by ID
+// Passing the ID of the last team returned as afterTeamID gets the next page, which stays efficient however deep the scan goes
+func (ss *SQLStore) ListTeamsAfter(ctx context.Context, orgID, afterTeamID int64, limit int) ([]*models.TeamDTO, error) {
+	teams := make([]*models.TeamDTO, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var sql bytes.Buffer
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		sql.WriteString(` WHERE team.org_id = ? AND team.id > ?`)
+		sql.WriteString(` ORDER BY team.id ASC`)
+		if limit > 0 {
+			sql.WriteString(ss.Dialect.Limit(int64(limit)))
+		}
+
+		return sess.SQL(sql.String(), orgID, afterTeamID).Find(&teams)
+	})
+
+	return teams, err
+}
+
+// maxTeamNamePatternLength limits the size of the regular expressions teams can be listed by
+// Go regular expressions run in linear time, so the size of the pattern is all that needs to be bounded
+const maxTeamNamePatternLength = 256
+
+// ListTeamsByNamePattern returns the teams whose name matches the regular expression, ordered by name
+// Only the teams the signed in user can read are returned
+func (ss *SQLStore) ListTeamsByNamePattern(ctx context.Context, signedInUser *models.SignedInUser, orgID int64, pattern string) ([]*models.TeamDTO, error) {
+	if len(pattern) > maxTeamNamePatternLength {
+		return nil, fmt.Errorf("%w: pattern is longer than %d characters", models.ErrInvalidTeamNamePattern, maxTeamNamePatternLength)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", models.ErrInvalidTeamNamePattern, err)
+	}
+
+	candidates := make([]*models.TeamDTO, 0)
+	err = ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var sql bytes.Buffer
+		params := []interface{}{orgID}
+
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		sql.WriteString(` WHERE team.org_id = ?`)
+		// every match contains the literal prefix of the pattern, so teams without it don't need to be fetched
+		// LIKE treats a backslash as an escape character, so such prefixes aren't used
+		if prefix, _ := re.LiteralPrefix(); prefix != "" && !strings.Contains(prefix, `\`) {
+			sql.WriteString(` and team.name ` + ss.Dialect.LikeStr() + ` ?`)
+			if strings.HasPrefix(pattern, "^") {
+				params = append(params, prefix+"%")
+			} else {
+				params = append(params, "%"+prefix+"%")
+			}
+		}
+
+		if !ac.IsDisabled(ss.Cfg) {
+			acFilter, err := ac.Filter(signedInUser, "team.id", "teams:id:", ac.ActionTeamsRead)
+			if err != nil {
+				return err
+			}
+			sql.WriteString(` and` + acFilter.Where)
+			params = append(params, acFilter.Args...)
+		}
+		sql.WriteString(` order by team.name asc`)
+
+		return sess.SQL(sql.String(), params...).Find(&candidates)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	teams := make([]*models.TeamDTO, 0)
+	for _, team := range candidates {
+		if re.MatchString(team.Name) {
+			teams = append(teams, team)
+		}
+	}
+
+	return teams, nil
+}
+
 func (ss *SQLStore) GetTeamById(ctx context.Context, query *models.GetTeamByIdQuery) error {
 	return ss.WithDbSession(ctx, func(sess *DBSession) error {
 		var sql bytes.Buffer
 		params := make([]interface{}, 0)
 
 		filteredUsers := getFilteredUsers(query.SignedInUser, query.HiddenUsers)
-		sql.WriteString(getTeamSelectSQLBase(filteredUsers))
+		if query.WithSettings {
+			sql.WriteString(getTeamSelectWithSettingsSQLBase(filteredUsers))
+		} else {
+			sql.WriteString(getTeamSelectSQLBase(filteredUsers))
+		}
 		for _, user := range filteredUsers {
 			params = append(params, user)
 		}
@@ -304,20 +821,373 @@ func (ss *SQLStore) GetTeamById(ctx context.Context, query *models.GetTeamByIdQu
 	})
 }
 
-// GetTeamsByUser is used by the Guardian when checking a users' permissions
-func (ss *SQLStore) GetTeamsByUser(ctx context.Context, query *models.GetTeamsByUserQuery) error {
-	return ss.WithDbSession(ctx, func(sess *DBSession) error {
-		query.Result = make([]*models.TeamDTO, 0)
+// GetTeamWithAdmins returns the team along with its admin members, without the other members
+func (ss *SQLStore) GetTeamWithAdmins(ctx context.Context, orgID, teamID int64) (*models.TeamDTO, []*models.TeamMemberDTO, error) {
+	var team models.TeamDTO
+	admins := make([]*models.TeamMemberDTO, 0)
+	err := ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		exists, err := dbSess.SQL(getTeamSelectSQLBase([]string{})+` WHERE team.org_id = ? and team.id = ?`, orgID, teamID).Get(&team)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrTeamNotFound
+		}
 
-		var sql bytes.Buffer
-		var params []interface{}
-		params = append(params, query.OrgId, query.UserId)
+		sess := ss.teamMembersSession(dbSess, nil)
+		sess.Where("team_member.org_id=? AND team_member.team_id=? AND team_member.permission=?", orgID, teamID, models.PERMISSION_ADMIN)
+		sess.Asc("user.login", "user.email")
+		return sess.Find(&admins)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
-		sql.WriteString(getTeamSelectSQLBase([]string{}))
-		sql.WriteString(` INNER JOIN team_member on team.id = team_member.team_id`)
-		sql.WriteString(` WHERE team.org_id = ? and team_member.user_id = ?`)
+	return &team, admins, nil
+}
 
-		if !ac.IsDisabled(ss.Cfg) {
+// FindTeamsByEmail returns the teams with the email, ignoring case, sorted by name
+// Team emails aren't unique, so this finds the teams that share a notification address
+// No team is returned for an empty email, since teams without an email don't share an address
+func (ss *SQLStore) FindTeamsByEmail(ctx context.Context, orgID int64, email string) ([]*models.TeamDTO, error) {
+	teams := make([]*models.TeamDTO, 0)
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return teams, nil
+	}
+
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		sql := getTeamSelectSQLBase([]string{}) + ` WHERE team.org_id = ? AND LOWER(team.email) = LOWER(?) ORDER BY team.name ASC, team.id ASC`
+		return sess.SQL(sql, orgID, email).Find(&teams)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// GetPrimaryAdminTeam returns the team the user is an admin of
+// If the user is an admin of several teams, the team with the most members is returned, and then the oldest team
+func (ss *SQLStore) GetPrimaryAdminTeam(ctx context.Context, orgID, userID int64) (*models.TeamDTO, error) {
+	var team models.TeamDTO
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var sql bytes.Buffer
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		sql.WriteString(` INNER JOIN team_member ON team_member.team_id = team.id`)
+		sql.WriteString(` WHERE team.org_id = ? AND team_member.user_id = ? AND team_member.permission = ?`)
+		sql.WriteString(` ORDER BY member_count DESC, team.created ASC, team.id ASC`)
+		sql.WriteString(ss.Dialect.Limit(1))
+
+		exists, err := sess.SQL(sql.String(), orgID, userID, models.PERMISSION_ADMIN).Get(&team)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrTeamNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+// GetEffectiveTeamPermission returns the permission the user has on the team, and whether the user has any
+// Org admins are team admins whether or not they're members of the team, other users have the permission of their membership
+func (ss *SQLStore) GetEffectiveTeamPermission(ctx context.Context, orgID, teamID, userID int64) (models.PermissionType, bool, error) {
+	var (
+		permission models.PermissionType
+		found      bool
+	)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		exists, err := sess.Table("team").Where("org_id=? AND id=?", orgID, teamID).Exist()
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrTeamNotFound
+		}
+
+		var orgUser models.OrgUser
+		isOrgUser, err := sess.Where("org_id=? AND user_id=?", orgID, userID).Get(&orgUser)
+		if err != nil {
+			return err
+		}
+		if isOrgUser && orgUser.Role == models.ROLE_ADMIN {
+			permission, found = models.PERMISSION_ADMIN, true
+			return nil
+		}
+
+		var member models.TeamMember
+		isMember, err := sess.Where("org_id=? AND team_id=? AND user_id=?", orgID, teamID, userID).Get(&member)
+		if err != nil {
+			return err
+		}
+		if isMember {
+			permission, found = member.Permission, true
+		}
+
+		return nil
+	})
+
+	return permission, found, err
+}
+
+// GetTeamSettings returns the settings of the team, or empty settings if none have been set
+func (ss *SQLStore) GetTeamSettings(ctx context.Context, orgID, teamID int64) (*simplejson.Json, error) {
+	team := models.Team{}
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		exists, err := sess.Cols("settings").Where("org_id=? AND id=?", orgID, teamID).Get(&team)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrTeamNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if team.Settings == nil {
+		return simplejson.New(), nil
+	}
+	return team.Settings, nil
+}
+
+// SetTeamSettings replaces the settings of the team
+func (ss *SQLStore) SetTeamSettings(ctx context.Context, orgID, teamID int64, settings *simplejson.Json) error {
+	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		if settings == nil {
+			settings = simplejson.New()
+		}
+		team := models.Team{
+			Settings: settings,
+			Updated:  time.Now(),
+		}
+
+		affectedRows, err := sess.Where("org_id=? AND id=?", orgID, teamID).Cols("settings", "updated").Update(&team)
+		if err != nil {
+			return err
+		}
+		if affectedRows == 0 {
+			return models.ErrTeamNotFound
+		}
+
+		return nil
+	})
+}
+
+// SetTeamLabels replaces the labels of the team
+func (ss *SQLStore) SetTeamLabels(ctx context.Context, orgID, teamID int64, labels map[string]string) error {
+	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		if exists, err := teamExists(orgID, teamID, sess); err != nil {
+			return err
+		} else if !exists {
+			return models.ErrTeamNotFound
+		}
+
+		if _, err := sess.Exec("DELETE FROM team_label WHERE org_id=? AND team_id=?", orgID, teamID); err != nil {
+			return err
+		}
+
+		for _, key := range sortedLabelKeys(labels) {
+			if key == "" {
+				return fmt.Errorf("%w: empty key", models.ErrInvalidTeamLabel)
+			}
+			label := models.TeamLabel{OrgId: orgID, TeamId: teamID, Key: key, Value: labels[key]}
+			if _, err := sess.Insert(&label); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ListTeamsByLabelSelector returns the teams having all the labels of the selector, sorted by name
+// The teams are filtered based on the signed in user's permissions
+func (ss *SQLStore) ListTeamsByLabelSelector(ctx context.Context, signedInUser *models.SignedInUser, orgID int64, selector map[string]string) ([]*models.TeamDTO, error) {
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("%w: empty selector", models.ErrInvalidTeamLabel)
+	}
+
+	teams := make([]*models.TeamDTO, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var sql bytes.Buffer
+		params := []interface{}{orgID}
+
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		sql.WriteString(` WHERE team.org_id = ?`)
+		for _, key := range sortedLabelKeys(selector) {
+			if key == "" {
+				return fmt.Errorf("%w: empty key", models.ErrInvalidTeamLabel)
+			}
+			sql.WriteString(` and EXISTS (SELECT 1 FROM team_label WHERE team_label.org_id = team.org_id AND team_label.team_id = team.id AND team_label.key = ? AND team_label.value = ?)`)
+			params = append(params, key, selector[key])
+		}
+
+		if !ac.IsDisabled(ss.Cfg) {
+			acFilter, err := ac.Filter(signedInUser, "team.id", "teams:id:", ac.ActionTeamsRead)
+			if err != nil {
+				return err
+			}
+			sql.WriteString(` and` + acFilter.Where)
+			params = append(params, acFilter.Args...)
+		}
+		sql.WriteString(` order by team.name asc`)
+
+		return sess.SQL(sql.String(), params...).Find(&teams)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// SnapshotTeam returns the team along with its members, labels, settings and permissions, all read in the same transaction
+// so that they are consistent with each other
+func (ss *SQLStore) SnapshotTeam(ctx context.Context, orgID, teamID int64) (*models.TeamSnapshot, error) {
+	snapshot := models.TeamSnapshot{
+		Members:     make([]*models.TeamSnapshotMember, 0),
+		Labels:      make(map[string]string),
+		Permissions: make([]*models.TeamSnapshotPermission, 0),
+	}
+	err := ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		exists, err := sess.Where("org_id=? AND id=?", orgID, teamID).Get(&snapshot.Team)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrTeamNotFound
+		}
+		snapshot.TakenAt = time.Now()
+
+		user := ss.Dialect.Quote("user")
+		err = sess.SQL(`SELECT team_member.user_id, `+user+`.login, `+user+`.email, team_member.external, team_member.permission, team_member.expires_at
+			FROM team_member
+			INNER JOIN `+user+` ON `+user+`.id = team_member.user_id
+			WHERE team_member.org_id = ? AND team_member.team_id = ?
+			ORDER BY `+user+`.login ASC`, orgID, teamID).Find(&snapshot.Members)
+		if err != nil {
+			return err
+		}
+
+		var labels []models.TeamLabel
+		if err := sess.Where("org_id=? AND team_id=?", orgID, teamID).Find(&labels); err != nil {
+			return err
+		}
+		for _, label := range labels {
+			snapshot.Labels[label.Key] = label.Value
+		}
+
+		return sess.SQL(`SELECT dashboard_acl.dashboard_id, dashboard.uid AS dashboard_uid, dashboard.is_folder, dashboard_acl.permission
+			FROM dashboard_acl
+			INNER JOIN dashboard ON dashboard.id = dashboard_acl.dashboard_id
+			WHERE dashboard_acl.org_id = ? AND dashboard_acl.team_id = ?
+			ORDER BY dashboard_acl.dashboard_id ASC`, orgID, teamID).Find(&snapshot.Permissions)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// sortedLabelKeys returns the keys of the labels sorted, so that the generated SQL is the same for the same labels
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// SetTeamOpenJoin sets whether users can join the team by themselves
+func (ss *SQLStore) SetTeamOpenJoin(ctx context.Context, orgID, teamID int64, openJoin bool) error {
+	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		team := models.Team{
+			OpenJoin: openJoin,
+			Updated:  time.Now(),
+		}
+
+		affectedRows, err := sess.Where("org_id=? AND id=?", orgID, teamID).Cols("open_join", "updated").Update(&team)
+		if err != nil {
+			return err
+		}
+		if affectedRows == 0 {
+			return models.ErrTeamNotFound
+		}
+
+		return nil
+	})
+}
+
+// ListJoinableTeams returns the teams of the org that allow users to join by themselves and the user isn't a member of
+func (ss *SQLStore) ListJoinableTeams(ctx context.Context, orgID, userID int64) ([]*models.TeamDTO, error) {
+	teams := make([]*models.TeamDTO, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var sql bytes.Buffer
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		sql.WriteString(` WHERE team.org_id = ? AND team.open_join = ?`)
+		sql.WriteString(` AND NOT EXISTS (SELECT 1 FROM team_member WHERE team_member.team_id = team.id AND team_member.user_id = ?)`)
+		sql.WriteString(` ORDER BY team.name ASC`)
+
+		return sess.SQL(sql.String(), orgID, ss.Dialect.BooleanStr(true), userID).Find(&teams)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return teams, nil
+}
+
+// JoinTeam adds the user as a member of the team, as long as the team allows users to join by themselves
+func (ss *SQLStore) JoinTeam(ctx context.Context, orgID, teamID, userID int64) error {
+	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		var team models.Team
+		exists, err := sess.Where("org_id=? AND id=?", orgID, teamID).Get(&team)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return models.ErrTeamNotFound
+		}
+		if !team.OpenJoin {
+			return models.ErrTeamNotOpenJoin
+		}
+
+		if isMember, err := isTeamMember(sess, orgID, teamID, userID); err != nil {
+			return err
+		} else if isMember {
+			return models.ErrTeamMemberAlreadyAdded
+		}
+
+		return addTeamMember(sess, orgID, teamID, userID, false, 0)
+	})
+}
+
+// GetTeamsByUser is used by the Guardian when checking a users' permissions
+func (ss *SQLStore) GetTeamsByUser(ctx context.Context, query *models.GetTeamsByUserQuery) error {
+	return ss.WithDbSession(ctx, func(sess *DBSession) error {
+		query.Result = make([]*models.TeamDTO, 0)
+
+		var sql bytes.Buffer
+		var params []interface{}
+		params = append(params, query.OrgId, query.UserId)
+
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		sql.WriteString(` INNER JOIN team_member on team.id = team_member.team_id`)
+		sql.WriteString(` WHERE team.org_id = ? and team_member.user_id = ?`)
+
+		if !ac.IsDisabled(ss.Cfg) {
 			acFilter, err := ac.Filter(query.SignedInUser, "team.id", "teams:id:", ac.ActionTeamsRead)
 			if err != nil {
 				return err
@@ -331,6 +1201,66 @@ func (ss *SQLStore) GetTeamsByUser(ctx context.Context, query *models.GetTeamsBy
 	})
 }
 
+// GetUserOrgTeamMemberships returns the teams the user is a member of in every org, grouped by org ID
+// This function spans orgs and doesn't perform any accesscontrol filtering, so it should only be used on behalf of server admins.
+func (ss *SQLStore) GetUserOrgTeamMemberships(ctx context.Context, userID int64) (map[int64][]*models.TeamDTO, error) {
+	result := make(map[int64][]*models.TeamDTO)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var sql bytes.Buffer
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		sql.WriteString(` INNER JOIN team_member on team.id = team_member.team_id`)
+		sql.WriteString(` WHERE team_member.user_id = ?`)
+		sql.WriteString(` ORDER BY team.org_id ASC, team.name ASC`)
+
+		teams := make([]*models.TeamDTO, 0)
+		if err := sess.SQL(sql.String(), userID).Find(&teams); err != nil {
+			return err
+		}
+		for _, team := range teams {
+			result[team.OrgId] = append(result[team.OrgId], team)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// GetTeamsForUsersUnion returns the teams any of the users is a member of, each team only once
+// Only the teams the signed in user can read are returned
+func (ss *SQLStore) GetTeamsForUsersUnion(ctx context.Context, signedInUser *models.SignedInUser, orgID int64, userIDs []int64) ([]*models.TeamDTO, error) {
+	result := make([]*models.TeamDTO, 0)
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		var sql bytes.Buffer
+		params := []interface{}{orgID}
+
+		sql.WriteString(getTeamSelectSQLBase([]string{}))
+		sql.WriteString(` WHERE team.org_id = ? and team.id IN (SELECT team_id FROM team_member WHERE user_id IN (?` +
+			strings.Repeat(",?", len(userIDs)-1) + `))`)
+		for _, userID := range userIDs {
+			params = append(params, userID)
+		}
+
+		if !ac.IsDisabled(ss.Cfg) {
+			acFilter, err := ac.Filter(signedInUser, "team.id", "teams:id:", ac.ActionTeamsRead)
+			if err != nil {
+				return err
+			}
+			sql.WriteString(` and` + acFilter.Where)
+			params = append(params, acFilter.Args...)
+		}
+		sql.WriteString(` order by team.name asc`)
+
+		return sess.SQL(sql.String(), params...).Find(&result)
+	})
+
+	return result, err
+}
+
 // AddTeamMember adds a user to a team
 func (ss *SQLStore) AddTeamMember(userID, orgID, teamID int64, isExternal bool, permission models.PermissionType) error {
 	return ss.WithTransactionalDbSession(context.Background(), func(sess *DBSession) error {
@@ -344,6 +1274,94 @@ func (ss *SQLStore) AddTeamMember(userID, orgID, teamID int64, isExternal bool,
 	})
 }
 
+// SetTeamMemberCreatedBy records the user that added the member to the team
+// Memberships are added through the team permission service which doesn't know about the actor,
+// so the actor is recorded separately once the member has been added. An already recorded actor is kept.
+func (ss *SQLStore) SetTeamMemberCreatedBy(ctx context.Context, orgID, teamID, userID, actorID int64) error {
+	return ss.WithDbSession(ctx, func(sess *DBSession) error {
+		_, err := sess.Exec("UPDATE team_member SET created_by=? WHERE org_id=? AND team_id=? AND user_id=? AND created_by IS NULL",
+			actorID, orgID, teamID, userID)
+		return err
+	})
+}
+
+// SetTeamMemberExpiry sets when the membership expires, a nil expiry makes it permanent
+// Like the actor, the expiry is recorded separately once the member has been added through the team permission service.
+func (ss *SQLStore) SetTeamMemberExpiry(ctx context.Context, orgID, teamID, userID int64, expiresAt *time.Time) error {
+	return ss.WithDbSession(ctx, func(sess *DBSession) error {
+		res, err := sess.Exec("UPDATE team_member SET expires_at=? WHERE org_id=? AND team_id=? AND user_id=?",
+			expiresAt, orgID, teamID, userID)
+		if err != nil {
+			return err
+		}
+
+		if rows, err := res.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			return models.ErrTeamMemberNotFound
+		}
+		return nil
+	})
+}
+
+// GetExpiredTeamMembers returns the team memberships that are past their expiry, the earliest expiry first
+// The memberships are removed through the team permission service, so that the permissions they grant are revoked too
+func (ss *SQLStore) GetExpiredTeamMembers(ctx context.Context) ([]*models.TeamMember, error) {
+	expired := make([]*models.TeamMember, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		return sess.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).Asc("expires_at", "id").Find(&expired)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+// GetMembersCreatedBy returns the team memberships in the org that were added by the actor, most recent first
+// Memberships added before the actor was recorded, or by an unknown actor, are never returned
+func (ss *SQLStore) GetMembersCreatedBy(ctx context.Context, orgID, actorUserID int64) ([]*models.TeamMemberDTO, error) {
+	result := make([]*models.TeamMemberDTO, 0)
+	err := ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		sess := ss.teamMembersSession(dbSess, nil)
+		sess.Where("team_member.org_id=? AND team_member.created_by=?", orgID, actorUserID)
+		sess.Desc("team_member.created")
+		return sess.Find(&result)
+	})
+
+	return result, err
+}
+
+// FindOrphanedMembers returns the team memberships in the org whose user no longer exists
+// These members are hidden by GetTeamMembers, but still counted in the team's member count
+func (ss *SQLStore) FindOrphanedMembers(ctx context.Context, orgID int64) ([]models.TeamMember, error) {
+	members := make([]models.TeamMember, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		return sess.SQL(`SELECT team_member.* FROM team_member
+			LEFT JOIN `+ss.Dialect.Quote("user")+` AS u ON u.id = team_member.user_id
+			WHERE team_member.org_id=? AND u.id IS NULL`, orgID).Find(&members)
+	})
+
+	return members, err
+}
+
+// CleanupOrphanedMembers deletes the team memberships in the org whose user no longer exists
+// and returns the number of deleted memberships
+func (ss *SQLStore) CleanupOrphanedMembers(ctx context.Context, orgID int64) (int64, error) {
+	var deleted int64
+	err := ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		res, err := sess.Exec(`DELETE FROM team_member WHERE org_id=? AND user_id NOT IN (SELECT id FROM `+ss.Dialect.Quote("user")+`)`, orgID)
+		if err != nil {
+			return err
+		}
+
+		deleted, err = res.RowsAffected()
+		return err
+	})
+
+	return deleted, err
+}
+
 func getTeamMember(sess *DBSession, orgId int64, teamId int64, userId int64) (models.TeamMember, error) {
 	rawSQL := `SELECT * FROM team_member WHERE org_id=? and team_id=? and user_id=?`
 	var member models.TeamMember
@@ -378,6 +1396,48 @@ func (ss *SQLStore) IsTeamMember(orgId int64, teamId int64, userId int64) (bool,
 	return isMember, err
 }
 
+// checkMembershipsBatchSize limits the number of pairs matched per query, to stay below the bind variable limits of the databases
+const checkMembershipsBatchSize = 400
+
+// CheckMemberships reports for each of the pairs whether the user is a member of the team
+// This is equivalent to calling IsTeamMember for each pair, but only needs a query per batch of pairs
+func (ss *SQLStore) CheckMemberships(ctx context.Context, orgID int64, pairs []models.TeamUserPair) (map[models.TeamUserPair]bool, error) {
+	result := make(map[models.TeamUserPair]bool, len(pairs))
+	for _, pair := range pairs {
+		result[pair] = false
+	}
+
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		for start := 0; start < len(pairs); start += checkMembershipsBatchSize {
+			end := start + checkMembershipsBatchSize
+			if end > len(pairs) {
+				end = len(pairs)
+			}
+
+			batch := pairs[start:end]
+			conditions := make([]string, 0, len(batch))
+			params := []interface{}{orgID}
+			for _, pair := range batch {
+				conditions = append(conditions, "(team_id = ? AND user_id = ?)")
+				params = append(params, pair.TeamId, pair.UserId)
+			}
+
+			var members []models.TeamUserPair
+			if err := sess.SQL("SELECT team_id, user_id FROM team_member WHERE org_id = ? AND ("+
+				strings.Join(conditions, " OR ")+")", params...).Find(&members); err != nil {
+				return err
+			}
+			for _, member := range members {
+				result[member] = true
+			}
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
 func isTeamMember(sess *DBSession, orgId int64, teamId int64, userId int64) (bool, error) {
 	if res, err := sess.Query("SELECT 1 FROM team_member WHERE org_id=? and team_id=? and user_id=?", orgId, teamId, userId); err != nil {
 		return false, err
@@ -396,10 +1456,17 @@ func AddOrUpdateTeamMemberHook(sess *DBSession, userID, orgID, teamID int64, isE
 		return err
 	}
 
-	if isMember {
-		err = updateTeamMember(sess, orgID, teamID, userID, permission)
-	} else {
-		err = addTeamMember(sess, orgID, teamID, userID, isExternal, permission)
+	if !isMember {
+		return addTeamMember(sess, orgID, teamID, userID, isExternal, permission)
+	}
+
+	if err := updateTeamMember(sess, orgID, teamID, userID, permission); err != nil {
+		return err
+	}
+	if isExternal {
+		// the external sync sets the permission of its members on every sync
+		_, err = sess.Exec("UPDATE team_member SET external_synced=? WHERE org_id=? AND team_id=? AND user_id=? AND external=?",
+			timeNow(), orgID, teamID, userID, dialect.BooleanStr(true))
 	}
 
 	return err
@@ -410,39 +1477,151 @@ func addTeamMember(sess *DBSession, orgID, teamID, userID int64, isExternal bool
 		return err
 	}
 
+	now := timeNow()
 	entity := models.TeamMember{
 		OrgId:      orgID,
 		TeamId:     teamID,
 		UserId:     userID,
 		External:   isExternal,
-		Created:    time.Now(),
-		Updated:    time.Now(),
+		Created:    now,
+		Updated:    now,
 		Permission: permission,
 	}
+	if isExternal {
+		entity.ExternalSynced = &now
+	}
+
+	_, err := sess.Insert(&entity)
+	return err
+}
+
+func updateTeamMember(sess *DBSession, orgID, teamID, userID int64, permission models.PermissionType) error {
+	member, err := getTeamMember(sess, orgID, teamID, userID)
+	if err != nil {
+		return err
+	}
+
+	if permission != models.PERMISSION_ADMIN {
+		permission = 0 // make sure we don't get invalid permission levels in store
+
+		// protect the last team admin
+		_, err := isLastAdmin(sess, orgID, teamID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// updated is only bumped on an actual change, so that setting the same permission again isn't reported as a change
+	if member.Permission != permission {
+		member.Permission = permission
+		member.Updated = timeNow()
+	}
+	_, err = sess.Cols("permission", "updated").Where("org_id=? and team_id=? and user_id=?", orgID, teamID, userID).Update(member)
+	return err
+}
+
+// SwapMemberPermissions gives each of the two team members the permission of the other in a single transaction
+// The last admin check is skipped, since swapping permissions doesn't change the number of admins of the team
+func (ss *SQLStore) SwapMemberPermissions(ctx context.Context, orgID, teamID, userA, userB int64) error {
+	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		memberA, err := getTeamMember(sess, orgID, teamID, userA)
+		if err != nil {
+			return err
+		}
+		memberB, err := getTeamMember(sess, orgID, teamID, userB)
+		if err != nil {
+			return err
+		}
+
+		if memberA.Permission == memberB.Permission {
+			return nil
+		}
+		memberA.Permission, memberB.Permission = memberB.Permission, memberA.Permission
+		memberA.Updated, memberB.Updated = timeNow(), timeNow()
+		for _, member := range []models.TeamMember{memberA, memberB} {
+			if _, err := sess.Cols("permission", "updated").Where("org_id=? and team_id=? and user_id=?", orgID, teamID, member.UserId).Update(member); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ReplaceTeamAdmin makes the new user an admin of the team in place of the old admin, who stays a member of the team
+// The new user is added to the team if they're not a member yet. Since the new admin is promoted before the old admin is demoted,
+// this works even if the old admin is the last admin of the team
+func (ss *SQLStore) ReplaceTeamAdmin(ctx context.Context, orgID, teamID, oldAdminID, newAdminID int64) error {
+	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		oldAdmin, err := getTeamMember(sess, orgID, teamID, oldAdminID)
+		if err != nil {
+			return err
+		}
+		if oldAdmin.Permission != models.PERMISSION_ADMIN {
+			return models.ErrTeamMemberNotAdmin
+		}
+		if oldAdminID == newAdminID {
+			return nil
+		}
 
-	_, err := sess.Insert(&entity)
-	return err
+		isMember, err := isTeamMember(sess, orgID, teamID, newAdminID)
+		if err != nil {
+			return err
+		}
+		if isMember {
+			err = updateTeamMember(sess, orgID, teamID, newAdminID, models.PERMISSION_ADMIN)
+		} else {
+			err = addTeamMember(sess, orgID, teamID, newAdminID, false, models.PERMISSION_ADMIN)
+		}
+		if err != nil {
+			return err
+		}
+
+		return updateTeamMember(sess, orgID, teamID, oldAdminID, 0)
+	})
 }
 
-func updateTeamMember(sess *DBSession, orgID, teamID, userID int64, permission models.PermissionType) error {
-	member, err := getTeamMember(sess, orgID, teamID, userID)
-	if err != nil {
-		return err
-	}
+// PromoteToAdmin makes the members admins of the team, unless the team would then have more than maxAdmins admins
+// Every user must already be a member of the team, otherwise none of them is promoted
+func (ss *SQLStore) PromoteToAdmin(ctx context.Context, orgID, teamID int64, userIDs []int64, maxAdmins int) error {
+	return ss.WithTransactionalDbSession(ctx, func(sess *DBSession) error {
+		if _, err := teamExists(orgID, teamID, sess); err != nil {
+			return err
+		}
 
-	if permission != models.PERMISSION_ADMIN {
-		permission = 0 // make sure we don't get invalid permission levels in store
+		toPromote := make([]int64, 0, len(userIDs))
+		seen := make(map[int64]bool, len(userIDs))
+		for _, userID := range userIDs {
+			if seen[userID] {
+				continue
+			}
+			seen[userID] = true
 
-		// protect the last team admin
-		_, err := isLastAdmin(sess, orgID, teamID, userID)
+			member, err := getTeamMember(sess, orgID, teamID, userID)
+			if err != nil {
+				return fmt.Errorf("user %d: %w", userID, err)
+			}
+			if member.Permission != models.PERMISSION_ADMIN {
+				toPromote = append(toPromote, userID)
+			}
+		}
+
+		admins, err := sess.Where("org_id=? AND team_id=? AND permission=?", orgID, teamID, models.PERMISSION_ADMIN).Count(&models.TeamMember{})
 		if err != nil {
 			return err
 		}
-	}
+		if total := admins + int64(len(toPromote)); total > int64(maxAdmins) {
+			return fmt.Errorf("%w: the team would have %d admins, at most %d are allowed", models.ErrTeamAdminLimitExceeded, total, maxAdmins)
+		}
 
-	member.Permission = permission
-	_, err = sess.Cols("permission").Where("org_id=? and team_id=? and user_id=?", orgID, teamID, userID).Update(member)
-	return err
+		for _, userID := range toPromote {
+			if err := updateTeamMember(sess, orgID, teamID, userID, models.PERMISSION_ADMIN); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 // RemoveTeamMember removes a member from a team
@@ -474,10 +1653,22 @@ func removeTeamMember(sess *DBSession, cmd *models.RemoveTeamMemberCommand) erro
 		return err
 	}
 	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
 	if rows == 0 {
 		return models.ErrTeamMemberNotFound
 	}
 
+	history := models.TeamMemberHistory{
+		OrgId:   cmd.OrgId,
+		TeamId:  cmd.TeamId,
+		UserId:  cmd.UserId,
+		Action:  models.TeamMemberRemoved,
+		ActorId: cmd.ActorId,
+		Created: time.Now(),
+	}
+	_, err = sess.Insert(&history)
 	return err
 }
 
@@ -520,75 +1711,575 @@ func (ss *SQLStore) GetUserTeamMemberships(ctx context.Context, orgID, userID in
 
 // GetTeamMembers return a list of members for the specified team filtered based on the user's permissions
 func (ss *SQLStore) GetTeamMembers(ctx context.Context, query *models.GetTeamMembersQuery) error {
+	acFilter, err := ss.teamMembersACFilter(query.SignedInUser)
+	if err != nil {
+		return err
+	}
+
+	return ss.getTeamMembers(ctx, query, acFilter)
+}
+
+// GetTeamMembersGrouped returns the admins and the other members of the team separately, filtered based on the user's permissions
+// Both lists keep the order of GetTeamMembers
+func (ss *SQLStore) GetTeamMembersGrouped(ctx context.Context, query *models.GetTeamMembersQuery) ([]*models.TeamMemberDTO, []*models.TeamMemberDTO, error) {
+	if err := ss.GetTeamMembers(ctx, query); err != nil {
+		return nil, nil, err
+	}
+
+	admins := make([]*models.TeamMemberDTO, 0)
+	members := make([]*models.TeamMemberDTO, 0)
+	for _, member := range query.Result {
+		if member.Permission == models.PERMISSION_ADMIN {
+			admins = append(admins, member)
+		} else {
+			members = append(members, member)
+		}
+	}
+
+	return admins, members, nil
+}
+
+// teamMembersACFilter returns the filter restricting team members to the users the signed in user can read
+// With accesscontrol we filter out users based on the SignedInUser's permissions
+// Note we assume that checking SignedInUser is allowed to see team members for this team has already been performed
+// If the signed in user is not set no member will be returned
+func (ss *SQLStore) teamMembersACFilter(signedInUser *models.SignedInUser) (*ac.SQLFilter, error) {
 	acFilter := &ac.SQLFilter{}
+	if ac.IsDisabled(ss.Cfg) {
+		return acFilter, nil
+	}
+
 	var err error
+	sqlID := fmt.Sprintf("%s.%s", ss.engine.Dialect().Quote("user"), ss.engine.Dialect().Quote("id"))
+	*acFilter, err = ac.Filter(signedInUser, sqlID, "users:id:", ac.ActionOrgUsersRead)
+	return acFilter, err
+}
 
-	// With accesscontrol we filter out users based on the SignedInUser's permissions
-	// Note we assume that checking SignedInUser is allowed to see team members for this team has already been performed
-	// If the signed in user is not set no member will be returned
-	if !ac.IsDisabled(ss.Cfg) {
-		sqlID := fmt.Sprintf("%s.%s", ss.engine.Dialect().Quote("user"), ss.engine.Dialect().Quote("id"))
-		*acFilter, err = ac.Filter(query.SignedInUser, sqlID, "users:id:", ac.ActionOrgUsersRead)
-		if err != nil {
-			return err
-		}
+// teamMembersSession returns a session selecting team members joined with their user and most recent auth module
+func (ss *SQLStore) teamMembersSession(dbSess *DBSession, acUserFilter *ac.SQLFilter) *DBSession {
+	sess := dbSess.Table("team_member")
+	sess.Join("INNER", ss.Dialect.Quote("user"),
+		fmt.Sprintf("team_member.user_id=%s.%s", ss.Dialect.Quote("user"), ss.Dialect.Quote("id")),
+	)
+
+	// explicitly check for serviceaccounts
+	sess.Where(fmt.Sprintf("%s.is_service_account=?", ss.Dialect.Quote("user")), ss.Dialect.BooleanStr(false))
+
+	if acUserFilter != nil {
+		sess.Where(acUserFilter.Where, acUserFilter.Args...)
 	}
 
-	return ss.getTeamMembers(ctx, query, acFilter)
+	// Join with only most recent auth module
+	authJoinCondition := `(
+		SELECT id from user_auth
+			WHERE user_auth.user_id = team_member.user_id
+			ORDER BY user_auth.created DESC `
+	authJoinCondition = "user_auth.id=" + authJoinCondition + ss.Dialect.Limit(1) + ")"
+	sess.Join("LEFT", "user_auth", authJoinCondition)
+
+	sess.Cols(
+		"team_member.org_id",
+		"team_member.team_id",
+		"team_member.user_id",
+		"user.email",
+		"user.name",
+		"user.login",
+		"team_member.external",
+		"team_member.permission",
+		"team_member.expires_at",
+		"user_auth.auth_module",
+	)
+
+	return sess
 }
 
 // getTeamMembers return a list of members for the specified team
+// The members are only counted separately when a page of them is requested, otherwise the total is the number of members returned
 func (ss *SQLStore) getTeamMembers(ctx context.Context, query *models.GetTeamMembersQuery, acUserFilter *ac.SQLFilter) error {
 	return ss.WithDbSession(ctx, func(dbSess *DBSession) error {
 		query.Result = make([]*models.TeamMemberDTO, 0)
+		sess := ss.teamMembersSession(dbSess, acUserFilter)
+		ss.filterTeamMembers(sess, query)
+		sess.Asc("user.login", "user.email")
+		if query.Limit > 0 {
+			page := query.Page
+			if page < 1 {
+				page = 1
+			}
+			sess.Limit(query.Limit, (page-1)*query.Limit)
+		}
+
+		if err := ss.findTeamMembers(sess, query); err != nil {
+			return err
+		}
+		if query.Limit <= 0 {
+			query.TotalCount = int64(len(query.Result))
+			return nil
+		}
+
+		countSess := ss.teamMembersSession(dbSess, acUserFilter)
+		ss.filterTeamMembers(countSess, query)
+		count, err := countSess.Count()
+		if err != nil {
+			return err
+		}
+		query.TotalCount = count
+
+		return nil
+	})
+}
+
+// GetTeamMembersAfter returns up to query.Limit members whose user ID is greater than afterUserID, ordered by user ID
+// Passing the user ID of the last member returned as afterUserID gets the next page, which stays efficient however large the team is
+// The total count of members isn't set, since counting them would defeat the purpose on large teams
+func (ss *SQLStore) GetTeamMembersAfter(ctx context.Context, query *models.GetTeamMembersQuery, afterUserID int64) error {
+	acFilter, err := ss.teamMembersACFilter(query.SignedInUser)
+	if err != nil {
+		return err
+	}
+
+	return ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		query.Result = make([]*models.TeamMemberDTO, 0)
+		sess := ss.teamMembersSession(dbSess, acFilter)
+		ss.filterTeamMembers(sess, query)
+		sess.Where("team_member.user_id > ?", afterUserID)
+		sess.Asc("team_member.user_id")
+		if query.Limit > 0 {
+			sess.Limit(query.Limit)
+		}
+
+		return ss.findTeamMembers(sess, query)
+	})
+}
+
+// findTeamMembers finds the members selected by the session into the result of the query
+func (ss *SQLStore) findTeamMembers(sess *DBSession, query *models.GetTeamMembersQuery) error {
+	if query.WithOrgAdmin {
+		sess.Join("LEFT", "org_user", "org_user.user_id = team_member.user_id AND org_user.org_id = team_member.org_id")
+		sess.Cols("org_user.role")
+	}
+
+	if err := sess.Find(&query.Result); err != nil {
+		return err
+	}
+
+	if query.WithOrgAdmin {
+		for _, member := range query.Result {
+			member.IsOrgAdmin = member.OrgRole == models.ROLE_ADMIN
+		}
+	}
+
+	return nil
+}
+
+func (ss *SQLStore) filterTeamMembers(sess *DBSession, query *models.GetTeamMembersQuery) {
+	if query.OrgId != 0 {
+		sess.Where("team_member.org_id=?", query.OrgId)
+	}
+	if query.TeamId != 0 {
+		sess.Where("team_member.team_id=?", query.TeamId)
+	}
+	if query.UserId != 0 {
+		sess.Where("team_member.user_id=?", query.UserId)
+	}
+	if query.External {
+		sess.Where("team_member.external=?", ss.Dialect.BooleanStr(true))
+	}
+	if query.Query != "" {
+		queryWithWildcards := "%" + query.Query + "%"
+		user := ss.Dialect.Quote("user")
+		sess.Where(fmt.Sprintf("(%[1]s.login %[2]s ? OR %[1]s.email %[2]s ? OR %[1]s.name %[2]s ?)", user, ss.Dialect.LikeStr()),
+			queryWithWildcards, queryWithWildcards, queryWithWildcards)
+	}
+}
+
+// GetMembersOfTeams returns one row per membership of the users in any of the teams, tagged with the team ID
+// If distinct is set, users that are members of several of the teams are only returned for the first team they're found in
+func (ss *SQLStore) GetMembersOfTeams(ctx context.Context, orgID int64, teamIDs []int64, distinct bool) ([]*models.TeamMemberDTO, error) {
+	result := make([]*models.TeamMemberDTO, 0)
+	if len(teamIDs) == 0 {
+		return result, nil
+	}
+
+	err := ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		sess := ss.teamMembersSession(dbSess, nil)
+		sess.Where("team_member.org_id=?", orgID)
+		sess.In("team_member.team_id", teamIDs)
+		sess.Asc("user.login", "user.email", "team_member.team_id")
+		return sess.Find(&result)
+	})
+	if err != nil || !distinct {
+		return result, err
+	}
+
+	seen := make(map[int64]struct{}, len(result))
+	members := make([]*models.TeamMemberDTO, 0, len(result))
+	for _, member := range result {
+		if _, ok := seen[member.UserId]; ok {
+			continue
+		}
+		seen[member.UserId] = struct{}{}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// GetAdminsOfUsersTeams returns the admins of each team the user is a member of, grouped by team ID, in a single query
+// The teams and admins are filtered based on the signed in user's permissions, teams without any visible admin are left out
+// If excludeSelf is set, the user isn't listed as an admin of their own teams
+func (ss *SQLStore) GetAdminsOfUsersTeams(ctx context.Context, signedInUser *models.SignedInUser, orgID, userID int64, excludeSelf bool) (map[int64][]*models.TeamMemberDTO, error) {
+	acFilter, err := ss.teamMembersACFilter(signedInUser)
+	if err != nil {
+		return nil, err
+	}
+
+	admins := make([]*models.TeamMemberDTO, 0)
+	err = ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		sess := ss.teamMembersSession(dbSess, acFilter)
+		sess.Where("team_member.org_id=? AND team_member.permission=?", orgID, models.PERMISSION_ADMIN)
+		sess.Where("team_member.team_id IN (SELECT team_id FROM team_member WHERE org_id=? AND user_id=?)", orgID, userID)
+		if excludeSelf {
+			sess.Where("team_member.user_id<>?", userID)
+		}
+		if !ac.IsDisabled(ss.Cfg) {
+			teamFilter, err := ac.Filter(signedInUser, "team_member.team_id", "teams:id:", ac.ActionTeamsRead)
+			if err != nil {
+				return err
+			}
+			sess.Where(teamFilter.Where, teamFilter.Args...)
+		}
+		sess.Asc("team_member.team_id", "user.login", "user.email")
+		return sess.Find(&admins)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64][]*models.TeamMemberDTO)
+	for _, admin := range admins {
+		result[admin.TeamId] = append(result[admin.TeamId], admin)
+	}
+
+	return result, nil
+}
+
+// ExportOrgMemberships returns every membership of the org's teams, sorted by team name, then admins before the other members, then login
+// The order is fully deterministic so that repeated exports can be diffed
+// The memberships are filtered based on the teams and users the signed in user can read
+func (ss *SQLStore) ExportOrgMemberships(ctx context.Context, signedInUser *models.SignedInUser, orgID int64) ([]*models.TeamMembershipExport, error) {
+	userFilter, err := ss.teamMembersACFilter(signedInUser)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.TeamMembershipExport, 0)
+	err = ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		user := ss.Dialect.Quote("user")
 		sess := dbSess.Table("team_member")
-		sess.Join("INNER", ss.Dialect.Quote("user"),
-			fmt.Sprintf("team_member.user_id=%s.%s", ss.Dialect.Quote("user"), ss.Dialect.Quote("id")),
-		)
+		sess.Join("INNER", "team", "team.id = team_member.team_id")
+		sess.Join("INNER", user, fmt.Sprintf("team_member.user_id = %s.id", user))
+		sess.Where("team_member.org_id = ?", orgID)
+		sess.Where(fmt.Sprintf("%s.is_service_account = ?", user), ss.Dialect.BooleanStr(false))
+		sess.Where(userFilter.Where, userFilter.Args...)
+		if !ac.IsDisabled(ss.Cfg) {
+			teamFilter, err := ac.Filter(signedInUser, "team.id", "teams:id:", ac.ActionTeamsRead)
+			if err != nil {
+				return err
+			}
+			sess.Where(teamFilter.Where, teamFilter.Args...)
+		}
+
+		sess.Select(fmt.Sprintf(`team_member.team_id, team.name AS team_name, team_member.user_id,
+			%[1]s.login, %[1]s.email, %[1]s.name, team_member.external, team_member.permission`, user))
+		// the permission of members is either 0 or NULL, so admins are sorted first without relying on where NULLs are sorted
+		sess.OrderBy(fmt.Sprintf("team.name ASC, team.id ASC, CASE WHEN team_member.permission = %d THEN 0 ELSE 1 END ASC, %[2]s.login ASC, %[2]s.id ASC",
+			models.PERMISSION_ADMIN, user))
+		return sess.Find(&result)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// explicitly check for serviceaccounts
-		sess.Where(fmt.Sprintf("%s.is_service_account=?", ss.Dialect.Quote("user")), ss.Dialect.BooleanStr(false))
+	return result, nil
+}
 
-		if acUserFilter != nil {
-			sess.Where(acUserFilter.Where, acUserFilter.Args...)
+// FindMembersWithUnexpectedPermission returns the members of the team whose permission differs from the expected permission
+// of their user ID, including the members that aren't expected at all, sorted by login
+// Expected users that aren't members of the team aren't returned, since there is no membership to report
+func (ss *SQLStore) FindMembersWithUnexpectedPermission(ctx context.Context, orgID, teamID int64, expected map[int64]models.PermissionType) ([]*models.TeamMemberDTO, error) {
+	members := make([]*models.TeamMemberDTO, 0)
+	err := ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		if exists, err := teamExists(orgID, teamID, dbSess); err != nil {
+			return err
+		} else if !exists {
+			return models.ErrTeamNotFound
 		}
 
-		// Join with only most recent auth module
-		authJoinCondition := `(
-		SELECT id from user_auth
-			WHERE user_auth.user_id = team_member.user_id
-			ORDER BY user_auth.created DESC `
-		authJoinCondition = "user_auth.id=" + authJoinCondition + ss.Dialect.Limit(1) + ")"
-		sess.Join("LEFT", "user_auth", authJoinCondition)
-
-		if query.OrgId != 0 {
-			sess.Where("team_member.org_id=?", query.OrgId)
-		}
-		if query.TeamId != 0 {
-			sess.Where("team_member.team_id=?", query.TeamId)
-		}
-		if query.UserId != 0 {
-			sess.Where("team_member.user_id=?", query.UserId)
-		}
-		if query.External {
-			sess.Where("team_member.external=?", ss.Dialect.BooleanStr(true))
-		}
-		sess.Cols(
-			"team_member.org_id",
-			"team_member.team_id",
-			"team_member.user_id",
-			"user.email",
-			"user.name",
-			"user.login",
-			"team_member.external",
-			"team_member.permission",
-			"user_auth.auth_module",
-		)
+		sess := ss.teamMembersSession(dbSess, nil)
+		sess.Where("team_member.org_id=? AND team_member.team_id=?", orgID, teamID)
 		sess.Asc("user.login", "user.email")
+		return sess.Find(&members)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		err := sess.Find(&query.Result)
-		return err
+	unexpected := make([]*models.TeamMemberDTO, 0)
+	for _, member := range members {
+		if permission, ok := expected[member.UserId]; !ok || permission != member.Permission {
+			unexpected = append(unexpected, member)
+		}
+	}
+
+	return unexpected, nil
+}
+
+// GetMembersByPermission returns the memberships with the permission across all the teams of the org, tagged with the team ID
+func (ss *SQLStore) GetMembersByPermission(ctx context.Context, orgID int64, permission models.PermissionType) ([]*models.TeamMemberDTO, error) {
+	result := make([]*models.TeamMemberDTO, 0)
+	err := ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		sess := ss.teamMembersSession(dbSess, nil)
+		sess.Where("team_member.org_id=? AND team_member.permission=?", orgID, permission)
+		sess.Asc("team_member.team_id", "user.login", "user.email")
+		return sess.Find(&result)
+	})
+
+	return result, err
+}
+
+// GetMembersChangedSince returns the memberships across all the teams of the org that were added or updated after since,
+// tagged with the team ID and in the order they changed. Removed memberships are not included.
+func (ss *SQLStore) GetMembersChangedSince(ctx context.Context, orgID int64, since time.Time) ([]*models.TeamMemberDTO, error) {
+	result := make([]*models.TeamMemberDTO, 0)
+	err := ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		sess := ss.teamMembersSession(dbSess, nil)
+		sess.Where("team_member.org_id=? AND team_member.updated>?", orgID, since)
+		sess.Asc("team_member.updated", "team_member.id")
+		return sess.Find(&result)
+	})
+
+	return result, err
+}
+
+// GetRecentMembers returns the members that joined the team after since, most recent first
+// The members are filtered based on the signed in user's permissions
+func (ss *SQLStore) GetRecentMembers(ctx context.Context, signedInUser *models.SignedInUser, orgID, teamID int64, since time.Time, limit int) ([]*models.TeamMemberDTO, error) {
+	acFilter, err := ss.teamMembersACFilter(signedInUser)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.TeamMemberDTO, 0)
+	err = ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		sess := ss.teamMembersSession(dbSess, acFilter)
+		sess.Where("team_member.org_id=? AND team_member.team_id=? AND team_member.created>?", orgID, teamID, since)
+		sess.Desc("team_member.created")
+		if limit > 0 {
+			sess.Limit(limit)
+		}
+
+		return sess.Find(&result)
+	})
+
+	return result, err
+}
+
+// GetMembersJoinedBetween returns the members that joined the team between from and to, inclusive, in the order they joined
+// The members are filtered based on the signed in user's permissions
+func (ss *SQLStore) GetMembersJoinedBetween(ctx context.Context, signedInUser *models.SignedInUser, orgID, teamID int64, from, to time.Time) ([]*models.TeamMemberDTO, error) {
+	if from.After(to) {
+		return nil, models.ErrInvalidTimeRange
+	}
+
+	acFilter, err := ss.teamMembersACFilter(signedInUser)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.TeamMemberDTO, 0)
+	err = ss.WithDbSession(ctx, func(dbSess *DBSession) error {
+		sess := ss.teamMembersSession(dbSess, acFilter)
+		sess.Where("team_member.org_id=? AND team_member.team_id=? AND team_member.created>=? AND team_member.created<=?", orgID, teamID, from, to)
+		sess.Asc("team_member.created", "team_member.id")
+		return sess.Find(&result)
+	})
+
+	return result, err
+}
+
+// GetMembershipOverlap returns the number of users that are members of both teams,
+// and the number of users that are only members of teamA or only members of teamB
+func (ss *SQLStore) GetMembershipOverlap(ctx context.Context, orgID, teamA, teamB int64) (int64, int64, int64, error) {
+	type membershipOverlap struct {
+		Overlap int64
+		OnlyA   int64 `xorm:"only_a"`
+		OnlyB   int64 `xorm:"only_b"`
+	}
+
+	resp := make([]*membershipOverlap, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		builder := &SQLBuilder{}
+		builder.Write(`SELECT
+			COALESCE(SUM(CASE WHEN m.in_a > 0 AND m.in_b > 0 THEN 1 ELSE 0 END), 0) AS overlap,
+			COALESCE(SUM(CASE WHEN m.in_a > 0 AND m.in_b = 0 THEN 1 ELSE 0 END), 0) AS only_a,
+			COALESCE(SUM(CASE WHEN m.in_a = 0 AND m.in_b > 0 THEN 1 ELSE 0 END), 0) AS only_b
+			FROM (
+				SELECT
+					team_member.user_id,
+					SUM(CASE WHEN team_member.team_id = ? THEN 1 ELSE 0 END) AS in_a,
+					SUM(CASE WHEN team_member.team_id = ? THEN 1 ELSE 0 END) AS in_b
+				FROM team_member
+				WHERE team_member.org_id = ? AND team_member.team_id IN (?, ?)
+				GROUP BY team_member.user_id
+			) AS m`, teamA, teamB, orgID, teamA, teamB)
+
+		return sess.SQL(builder.GetSQLString(), builder.params...).Find(&resp)
+	})
+	if err != nil || len(resp) == 0 {
+		return 0, 0, 0, err
+	}
+
+	return resp[0].Overlap, resp[0].OnlyA, resp[0].OnlyB, nil
+}
+
+// GetTeamDashboardAclCounts returns the number of dashboard and folder permissions granted to each team of the org
+// Teams without any permission are left out
+func (ss *SQLStore) GetTeamDashboardAclCounts(ctx context.Context, orgID int64) (map[int64]int64, error) {
+	type teamACLCount struct {
+		TeamId int64
+		Count  int64
+	}
+
+	resp := make([]*teamACLCount, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		rawSQL := "SELECT team_id, COUNT(*) AS count FROM dashboard_acl WHERE org_id=? AND team_id IS NOT NULL AND team_id<>0 GROUP BY team_id"
+		return sess.SQL(rawSQL, orgID).Find(&resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int64, len(resp))
+	for _, c := range resp {
+		counts[c.TeamId] = c.Count
+	}
+
+	return counts, nil
+}
+
+// GetOrgTeamStats returns the number of teams and memberships of the org along with the average and largest team size,
+// and the number of teams without any member or without an admin. Service accounts aren't counted as members
+func (ss *SQLStore) GetOrgTeamStats(ctx context.Context, orgID int64) (*models.TeamStats, error) {
+	resp := make([]*models.TeamStats, 0)
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		builder := &SQLBuilder{}
+		builder.Write(`SELECT
+			COUNT(*) AS team_count,
+			COALESCE(SUM(t.member_count), 0) AS total_memberships,
+			COALESCE(MAX(t.member_count), 0) AS max_team_size,
+			COALESCE(SUM(CASE WHEN t.member_count = 0 THEN 1 ELSE 0 END), 0) AS empty_teams,
+			COALESCE(SUM(CASE WHEN t.admin_count = 0 THEN 1 ELSE 0 END), 0) AS teams_without_admin
+			FROM (
+				SELECT
+					team.id,
+					COUNT(team_member.id) AS member_count,
+					SUM(CASE WHEN team_member.permission = ? THEN 1 ELSE 0 END) AS admin_count
+				FROM team
+				LEFT JOIN team_member ON team_member.team_id = team.id
+					AND team_member.user_id IN (SELECT id FROM `+ss.Dialect.Quote("user")+` WHERE is_service_account = ?)
+				WHERE team.org_id = ?
+				GROUP BY team.id
+			) AS t`, models.PERMISSION_ADMIN, ss.Dialect.BooleanStr(false), orgID)
+
+		return sess.SQL(builder.GetSQLString(), builder.params...).Find(&resp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.TeamStats{}
+	if len(resp) > 0 {
+		stats = resp[0]
+	}
+	if stats.TeamCount > 0 {
+		stats.AverageTeamSize = float64(stats.TotalMemberships) / float64(stats.TeamCount)
+	}
+
+	return stats, nil
+}
+
+// CountMembershipsByAuthModule returns the number of team memberships of the org per auth module of the member,
+// using the most recent auth module of each user. Memberships of users without one are counted under the empty string,
+// and memberships of service accounts aren't counted
+func (ss *SQLStore) CountMembershipsByAuthModule(ctx context.Context, orgID int64) (map[string]int64, error) {
+	var rows []struct {
+		AuthModule string
+		Count      int64
+	}
+	err := ss.WithDbSession(ctx, func(sess *DBSession) error {
+		user := ss.Dialect.Quote("user")
+		sql := `SELECT COALESCE(user_auth.auth_module, '') AS auth_module, COUNT(*) AS count
+			FROM team_member
+			INNER JOIN ` + user + ` ON ` + user + `.id = team_member.user_id
+			LEFT JOIN user_auth ON user_auth.id = (
+				SELECT id FROM user_auth
+					WHERE user_auth.user_id = team_member.user_id
+					ORDER BY user_auth.created DESC ` + ss.Dialect.Limit(1) + `)
+			WHERE team_member.org_id = ? AND ` + user + `.is_service_account = ?
+			GROUP BY COALESCE(user_auth.auth_module, '')`
+
+		return sess.SQL(sql, orgID, ss.Dialect.BooleanStr(false)).Find(&rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.AuthModule] = row.Count
+	}
+
+	return counts, nil
+}
+
+// CheckConsistency reports the number of teams of the org without members or without an admin, the team memberships
+// whose user no longer exists, and the teams whose names only differ by case
+func (ss *SQLStore) CheckConsistency(ctx context.Context, orgID int64) (*models.TeamConsistencyReport, error) {
+	stats, err := ss.GetOrgTeamStats(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	orphaned, err := ss.FindOrphanedMembers(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := make([]*models.TeamDTO, 0)
+	err = ss.WithDbSession(ctx, func(sess *DBSession) error {
+		return sess.SQL(`SELECT team.id, team.org_id, team.name, team.email
+			FROM team
+			WHERE team.org_id = ? AND LOWER(team.name) IN (
+				SELECT LOWER(name) FROM team WHERE org_id = ? GROUP BY LOWER(name) HAVING COUNT(*) > 1
+			)
+			ORDER BY team.id ASC`, orgID, orgID).Find(&duplicates)
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.TeamConsistencyReport{
+		Stats:           stats,
+		OrphanedMembers: orphaned,
+		DuplicateNames:  make(map[string][]*models.TeamDTO),
+	}
+	for _, team := range duplicates {
+		name := strings.ToLower(team.Name)
+		report.DuplicateNames[name] = append(report.DuplicateNames[name], team)
+	}
+
+	return report, nil
 }
 
 func (ss *SQLStore) IsAdminOfTeams(ctx context.Context, query *models.IsAdminOfTeamsQuery) error {
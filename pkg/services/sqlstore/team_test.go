@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
 	ac "github.com/grafana/grafana/pkg/services/accesscontrol"
 	"github.com/grafana/grafana/pkg/services/serviceaccounts"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
 	"github.com/grafana/grafana/pkg/services/user"
 )
 
@@ -216,98 +219,1600 @@ func TestIntegrationTeamCommandsAndQueries(t *testing.T) {
 				require.Equal(t, len(query2.Result.Teams), 2)
 			})
 
-			t.Run("Should be able to return all teams a user is member of", func(t *testing.T) {
+			t.Run("Should be able to exclude teams a user is member of when searching", func(t *testing.T) {
 				sqlStore = InitTestDB(t)
 				setup()
-				groupId := team2.Id
-				err := sqlStore.AddTeamMember(userIds[0], testOrgID, groupId, false, 0)
+				err := sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, 0)
 				require.NoError(t, err)
 
-				query := &models.GetTeamsByUserQuery{
-					OrgId:  testOrgID,
-					UserId: userIds[0],
-					SignedInUser: &models.SignedInUser{
-						OrgId:       testOrgID,
-						Permissions: map[int64]map[string][]string{testOrgID: {ac.ActionOrgUsersRead: {ac.ScopeUsersAll}, ac.ActionTeamsRead: {ac.ScopeTeamsAll}}},
-					},
-				}
-				err = sqlStore.GetTeamsByUser(context.Background(), query)
+				query := &models.SearchTeamsQuery{OrgId: testOrgID, Page: 1, Limit: 10, ExcludeUserIdMemberships: userIds[0], SignedInUser: testUser}
+				err = sqlStore.SearchTeams(context.Background(), query)
 				require.NoError(t, err)
-				require.Equal(t, len(query.Result), 1)
-				require.Equal(t, query.Result[0].Name, "group2 name")
-				require.Equal(t, query.Result[0].Email, "test2@test.com")
+				require.Len(t, query.Result.Teams, 1)
+				require.EqualValues(t, query.Result.TotalCount, 1)
+				require.Equal(t, team2.Id, query.Result.Teams[0].Id)
 			})
 
-			t.Run("Should be able to remove users from a group", func(t *testing.T) {
-				err = sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, 0)
+			t.Run("Should be able to return members that recently joined a team", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				err := sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, 0)
 				require.NoError(t, err)
 
-				err = sqlStore.RemoveTeamMember(context.Background(), &models.RemoveTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0]})
+				members, err := sqlStore.GetRecentMembers(context.Background(), testUser, testOrgID, team1.Id, time.Now().Add(-time.Hour), 10)
 				require.NoError(t, err)
+				require.Len(t, members, 2)
 
-				q2 := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, SignedInUser: testUser}
-				err = sqlStore.GetTeamMembers(context.Background(), q2)
+				members, err = sqlStore.GetRecentMembers(context.Background(), testUser, testOrgID, team1.Id, time.Now().Add(-time.Hour), 1)
 				require.NoError(t, err)
-				require.Equal(t, len(q2.Result), 0)
+				require.Len(t, members, 1)
+
+				members, err = sqlStore.GetRecentMembers(context.Background(), testUser, testOrgID, team1.Id, time.Now().Add(time.Hour), 10)
+				require.NoError(t, err)
+				require.Len(t, members, 0)
 			})
 
-			t.Run("Should never remove the last admin of a team", func(t *testing.T) {
-				err = sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+			t.Run("Should be able to return members that joined a team between two dates", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				err := sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[2], testOrgID, team2.Id, false, 0)
 				require.NoError(t, err)
 
-				t.Run("A user should not be able to remove the last admin", func(t *testing.T) {
-					err = sqlStore.RemoveTeamMember(context.Background(), &models.RemoveTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0]})
-					require.Equal(t, err, models.ErrLastTeamAdmin)
+				members, err := sqlStore.GetMembersJoinedBetween(context.Background(), testUser, testOrgID, team1.Id, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+				require.NoError(t, err)
+				require.Len(t, members, 2)
+
+				members, err = sqlStore.GetMembersJoinedBetween(context.Background(), testUser, testOrgID, team1.Id, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+				require.NoError(t, err)
+				require.NotNil(t, members)
+				require.Len(t, members, 0)
+
+				_, err = sqlStore.GetMembersJoinedBetween(context.Background(), testUser, testOrgID, team1.Id, time.Now(), time.Now().Add(-time.Hour))
+				require.ErrorIs(t, err, models.ErrInvalidTimeRange)
+			})
+
+			t.Run("Should be able to return members of all teams that changed since a timestamp", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				err := sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[1], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+
+				members, err := sqlStore.GetMembersChangedSince(context.Background(), testOrgID, time.Now().Add(-time.Hour))
+				require.NoError(t, err)
+				require.Len(t, members, 2)
+				teamIDs := []int64{members[0].TeamId, members[1].TeamId}
+				require.ElementsMatch(t, []int64{team1.Id, team2.Id}, teamIDs)
+
+				members, err = sqlStore.GetMembersChangedSince(context.Background(), testOrgID, time.Now().Add(time.Hour))
+				require.NoError(t, err)
+				require.Len(t, members, 0)
+			})
+
+			t.Run("Should return members whose permission changed since a timestamp", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				oldTimeNow := timeNow
+				defer func() { timeNow = oldTimeNow }()
+				timeNow = func() time.Time { return time.Now().Add(-48 * time.Hour) }
+				err := sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[2], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[3], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				timeNow = oldTimeNow
+
+				since := time.Now().Add(-24 * time.Hour)
+				members, err := sqlStore.GetMembersChangedSince(context.Background(), testOrgID, since)
+				require.NoError(t, err)
+				require.Len(t, members, 0)
+
+				err = sqlStore.UpdateTeamMember(context.Background(), &models.UpdateTeamMemberCommand{
+					OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0], Permission: models.PERMISSION_ADMIN,
+				})
+				require.NoError(t, err)
+				err = sqlStore.SwapMemberPermissions(context.Background(), testOrgID, team2.Id, userIds[2], userIds[3])
+				require.NoError(t, err)
+				// setting the same permission again isn't a change
+				err = sqlStore.UpdateTeamMember(context.Background(), &models.UpdateTeamMemberCommand{
+					OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[1], Permission: models.PERMISSION_ADMIN,
 				})
+				require.NoError(t, err)
 
-				t.Run("A user should be able to remove an admin if there are other admins", func(t *testing.T) {
-					err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				members, err = sqlStore.GetMembersChangedSince(context.Background(), testOrgID, since)
+				require.NoError(t, err)
+				require.Len(t, members, 3)
+				permissions := make(map[int64]models.PermissionType, len(members))
+				for _, member := range members {
+					permissions[member.UserId] = member.Permission
+				}
+				require.Equal(t, map[int64]models.PermissionType{
+					userIds[0]: models.PERMISSION_ADMIN,
+					userIds[2]: models.PERMISSION_ADMIN,
+					userIds[3]: 0,
+				}, permissions)
+			})
+
+			t.Run("Should be able to return the admins and the members of a team separately", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				err := sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[2], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+
+				query := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, SignedInUser: testUser}
+				admins, members, err := sqlStore.GetTeamMembersGrouped(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, admins, 1)
+				require.Equal(t, userIds[0], admins[0].UserId)
+				require.Len(t, members, 2)
+				require.Equal(t, userIds[1], members[0].UserId)
+				require.Equal(t, userIds[2], members[1].UserId)
+			})
+
+			t.Run("Should be able to return the teams of a user in every org", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				otherOrgTeam, err := sqlStore.CreateTeam("other org group", "", testOrgID+1)
+				require.NoError(t, err)
+				for _, teamID := range []int64{team2.Id, team1.Id} {
+					err = sqlStore.AddTeamMember(userIds[0], testOrgID, teamID, false, 0)
 					require.NoError(t, err)
-					err = sqlStore.RemoveTeamMember(context.Background(), &models.RemoveTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[1]})
+				}
+				err = sqlStore.AddTeamMember(userIds[0], testOrgID+1, otherOrgTeam.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+
+				memberships, err := sqlStore.GetUserOrgTeamMemberships(context.Background(), userIds[0])
+				require.NoError(t, err)
+				require.Len(t, memberships, 2)
+				require.Len(t, memberships[testOrgID], 2)
+				require.Equal(t, team1.Id, memberships[testOrgID][0].Id)
+				require.Equal(t, team2.Id, memberships[testOrgID][1].Id)
+				require.Len(t, memberships[testOrgID+1], 1)
+				require.Equal(t, otherOrgTeam.Id, memberships[testOrgID+1][0].Id)
+
+				memberships, err = sqlStore.GetUserOrgTeamMemberships(context.Background(), userIds[2])
+				require.NoError(t, err)
+				require.Empty(t, memberships)
+			})
+
+			t.Run("Should be able to list teams whose name matches a pattern", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				for _, name := range []string{"svc-billing-old", "svc-search-old", "svc-search", "old-svc-billing"} {
+					_, err := sqlStore.CreateTeam(name, "", testOrgID)
 					require.NoError(t, err)
-				})
+				}
 
-				t.Run("A user should not be able to remove the admin permission for the last admin", func(t *testing.T) {
-					err = sqlStore.UpdateTeamMember(context.Background(), &models.UpdateTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0], Permission: 0})
-					require.Error(t, err, models.ErrLastTeamAdmin)
+				teams, err := sqlStore.ListTeamsByNamePattern(context.Background(), testUser, testOrgID, `^svc-.*-old$`)
+				require.NoError(t, err)
+				require.Len(t, teams, 2)
+				require.Equal(t, "svc-billing-old", teams[0].Name)
+				require.Equal(t, "svc-search-old", teams[1].Name)
+
+				teams, err = sqlStore.ListTeamsByNamePattern(context.Background(), testUser, testOrgID, `svc-billing`)
+				require.NoError(t, err)
+				require.Len(t, teams, 2)
+
+				teams, err = sqlStore.ListTeamsByNamePattern(context.Background(), testUser, testOrgID, `^group\d name$`)
+				require.NoError(t, err)
+				require.Len(t, teams, 2)
+
+				_, err = sqlStore.ListTeamsByNamePattern(context.Background(), testUser, testOrgID, `svc-(`)
+				require.ErrorIs(t, err, models.ErrInvalidTeamNamePattern)
+			})
+
+			t.Run("Should be able to return the teams a user was removed from", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				for _, teamID := range []int64{team1.Id, team2.Id} {
+					err := sqlStore.AddTeamMember(ids[0], testOrgID, teamID, false, 0)
+					require.NoError(t, err)
+				}
+				err := sqlStore.RemoveTeamMember(context.Background(), &models.RemoveTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: ids[0], ActorId: ids[1]})
+				require.NoError(t, err)
+
+				removals, err := sqlStore.GetTeamsUserRemovedFrom(context.Background(), testOrgID, ids[0], time.Now().Add(-time.Hour))
+				require.NoError(t, err)
+				require.Len(t, removals, 1)
+				require.Equal(t, team1.Id, removals[0].TeamId)
+				require.Equal(t, team1.Name, removals[0].TeamName)
+				require.Equal(t, ids[1], removals[0].ActorId)
+				require.Equal(t, "loginuser1", removals[0].ActorLogin)
+
+				removals, err = sqlStore.GetTeamsUserRemovedFrom(context.Background(), testOrgID, ids[0], time.Now().Add(time.Hour))
+				require.NoError(t, err)
+				require.Len(t, removals, 0)
+			})
+
+			t.Run("Should be able to check the consistency of the teams of an org", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+				_, err = sqlStore.CreateTeam("empty team", "", testOrgID)
+				require.NoError(t, err)
+				err = sqlStore.WithDbSession(context.Background(), func(sess *DBSession) error {
+					_, err := sess.Exec("DELETE FROM "+sqlStore.Dialect.Quote("user")+" WHERE id=?", ids[0])
+					return err
 				})
+				require.NoError(t, err)
 
-				t.Run("A user should be able to remove the admin permission if there are other admins", func(t *testing.T) {
-					sqlStore = InitTestDB(t)
-					setup()
+				report, err := sqlStore.CheckConsistency(context.Background(), testOrgID)
+				require.NoError(t, err)
+				require.False(t, report.IsConsistent())
+				stats, err := sqlStore.GetOrgTeamStats(context.Background(), testOrgID)
+				require.NoError(t, err)
+				require.Equal(t, stats, report.Stats)
+				require.Equal(t, int64(1), report.Stats.EmptyTeams)
+				// the empty team doesn't have an admin either
+				require.Equal(t, int64(2), report.Stats.TeamsWithoutAdmin)
+				require.Len(t, report.OrphanedMembers, 1)
+				require.Equal(t, ids[0], report.OrphanedMembers[0].UserId)
+				require.Empty(t, report.DuplicateNames)
+
+				// MySQL compares names case-insensitively, so the unique index prevents names that only differ by case
+				if sqlStore.Dialect.DriverName() != migrator.MySQL {
+					duplicate, err := sqlStore.CreateTeam("GROUP1 NAME", "", testOrgID)
+					require.NoError(t, err)
+					err = sqlStore.AddTeamMember(ids[3], testOrgID, duplicate.Id, false, models.PERMISSION_ADMIN)
+					require.NoError(t, err)
 
-					err = sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+					report, err = sqlStore.CheckConsistency(context.Background(), testOrgID)
 					require.NoError(t, err)
+					require.Len(t, report.DuplicateNames, 1)
+					require.Len(t, report.DuplicateNames["group1 name"], 2)
+					require.Equal(t, team1.Id, report.DuplicateNames["group1 name"][0].Id)
+					require.Equal(t, duplicate.Id, report.DuplicateNames["group1 name"][1].Id)
+				}
 
-					err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				report, err = sqlStore.CheckConsistency(context.Background(), testOrgID+1)
+				require.NoError(t, err)
+				require.True(t, report.IsConsistent())
+			})
+
+			t.Run("Should be able to mark the team members that are org admins", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				for _, userID := range ids[:2] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
 					require.NoError(t, err)
-					err = sqlStore.UpdateTeamMember(context.Background(), &models.UpdateTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0], Permission: 0})
+				}
+				err := sqlStore.UpdateOrgUser(context.Background(), &models.UpdateOrgUserCommand{Role: models.ROLE_ADMIN, OrgId: testOrgID, UserId: ids[0]})
+				require.NoError(t, err)
+				err = sqlStore.UpdateOrgUser(context.Background(), &models.UpdateOrgUserCommand{Role: models.ROLE_VIEWER, OrgId: testOrgID, UserId: ids[1]})
+				require.NoError(t, err)
+
+				query := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, WithOrgAdmin: true, SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 2)
+				require.EqualValues(t, 2, query.TotalCount)
+				require.Equal(t, ids[0], query.Result[0].UserId)
+				require.True(t, query.Result[0].IsOrgAdmin)
+				require.Equal(t, ids[1], query.Result[1].UserId)
+				require.False(t, query.Result[1].IsOrgAdmin)
+
+				query = &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 2)
+				require.False(t, query.Result[0].IsOrgAdmin)
+
+				restrictedUser := &models.SignedInUser{
+					OrgId: testOrgID,
+					Permissions: map[int64]map[string][]string{
+						testOrgID: {ac.ActionOrgUsersRead: {ac.Scope("users", "id", fmt.Sprint(ids[1]))}},
+					},
+				}
+				query = &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, WithOrgAdmin: true, SignedInUser: restrictedUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 1)
+				require.Equal(t, ids[1], query.Result[0].UserId)
+				require.False(t, query.Result[0].IsOrgAdmin)
+			})
+
+			t.Run("Should be able to get the effective team permission of a user", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.UpdateOrgUser(context.Background(), &models.UpdateOrgUserCommand{Role: models.ROLE_ADMIN, OrgId: testOrgID, UserId: ids[0]})
+				require.NoError(t, err)
+				for _, userID := range ids[1:4] {
+					err = sqlStore.UpdateOrgUser(context.Background(), &models.UpdateOrgUserCommand{Role: models.ROLE_VIEWER, OrgId: testOrgID, UserId: userID})
 					require.NoError(t, err)
-				})
+				}
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+
+				permission, found, err := sqlStore.GetEffectiveTeamPermission(context.Background(), testOrgID, team1.Id, ids[0])
+				require.NoError(t, err)
+				require.True(t, found)
+				require.Equal(t, models.PERMISSION_ADMIN, permission)
+
+				permission, found, err = sqlStore.GetEffectiveTeamPermission(context.Background(), testOrgID, team1.Id, ids[1])
+				require.NoError(t, err)
+				require.True(t, found)
+				require.Equal(t, models.PERMISSION_ADMIN, permission)
+
+				permission, found, err = sqlStore.GetEffectiveTeamPermission(context.Background(), testOrgID, team1.Id, ids[2])
+				require.NoError(t, err)
+				require.True(t, found)
+				require.Equal(t, models.PermissionType(0), permission)
+
+				_, found, err = sqlStore.GetEffectiveTeamPermission(context.Background(), testOrgID, team1.Id, ids[3])
+				require.NoError(t, err)
+				require.False(t, found)
+
+				_, _, err = sqlStore.GetEffectiveTeamPermission(context.Background(), testOrgID, team1.Id+team2.Id, ids[0])
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
 			})
 
-			t.Run("Should be able to remove a group with users and permissions", func(t *testing.T) {
-				groupId := team2.Id
-				err := sqlStore.AddTeamMember(userIds[1], testOrgID, groupId, false, 0)
+			t.Run("Should be able to paginate the members of a team by user ID", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				for _, userID := range ids {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team2.Id, false, 0)
 				require.NoError(t, err)
-				err = sqlStore.AddTeamMember(userIds[2], testOrgID, groupId, false, 0)
+
+				var pages [][]int64
+				var afterUserID int64
+				for {
+					query := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, Limit: 2, SignedInUser: testUser}
+					err := sqlStore.GetTeamMembersAfter(context.Background(), query, afterUserID)
+					require.NoError(t, err)
+					if len(query.Result) == 0 {
+						break
+					}
+					var page []int64
+					for _, member := range query.Result {
+						require.Equal(t, team1.Id, member.TeamId)
+						page = append(page, member.UserId)
+					}
+					pages = append(pages, page)
+					afterUserID = page[len(page)-1]
+				}
+				require.Equal(t, [][]int64{{ids[0], ids[1]}, {ids[2], ids[3]}, {ids[4]}}, pages)
+
+				query := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, SignedInUser: testUser}
+				err = sqlStore.GetTeamMembersAfter(context.Background(), query, ids[1])
 				require.NoError(t, err)
-				err = updateDashboardACL(t, sqlStore, 1, &models.DashboardACL{
-					DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_EDIT, TeamID: groupId,
+				require.Len(t, query.Result, 3)
+			})
+
+			t.Run("Should be able to get or create a team by name", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+
+				team, created, err := sqlStore.GetOrCreateTeamByName(context.Background(), testOrgID, "GROUP1 NAME", "")
+				require.NoError(t, err)
+				require.False(t, created)
+				require.Equal(t, team1.Id, team.Id)
+				require.Equal(t, "group1 name", team.Name)
+
+				team, created, err = sqlStore.GetOrCreateTeamByName(context.Background(), testOrgID, "group3 name", "test3@test.com")
+				require.NoError(t, err)
+				require.True(t, created)
+				require.Equal(t, "group3 name", team.Name)
+				require.Equal(t, "test3@test.com", team.Email)
+				require.EqualValues(t, 0, team.MemberCount)
+
+				again, created, err := sqlStore.GetOrCreateTeamByName(context.Background(), testOrgID, "group3 name", "")
+				require.NoError(t, err)
+				require.False(t, created)
+				require.Equal(t, team.Id, again.Id)
+
+				otherOrgTeam, created, err := sqlStore.GetOrCreateTeamByName(context.Background(), testOrgID+1, "group1 name", "")
+				require.NoError(t, err)
+				require.True(t, created)
+				require.NotEqual(t, team1.Id, otherOrgTeam.Id)
+			})
+
+			t.Run("Should be able to get a team by its exact name when names only differ in case", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				if sqlStore.Dialect.DriverName() == migrator.MySQL {
+					t.Skip("MySQL compares the names case-insensitively, so they can't only differ in case")
+				}
+				// the team is inserted directly, since creating a team rejects names only differing in case
+				upper := models.Team{Name: "GROUP1 NAME", OrgId: testOrgID, Created: time.Now(), Updated: time.Now()}
+				err := sqlStore.WithDbSession(context.Background(), func(sess *DBSession) error {
+					_, err := sess.Insert(&upper)
+					return err
 				})
 				require.NoError(t, err)
-				err = sqlStore.DeleteTeam(context.Background(), &models.DeleteTeamCommand{OrgId: testOrgID, Id: groupId})
+
+				team, err := sqlStore.getTeamByName(context.Background(), testOrgID, "GROUP1 NAME", true)
 				require.NoError(t, err)
+				require.Equal(t, upper.Id, team.Id)
 
-				query := &models.GetTeamByIdQuery{OrgId: testOrgID, Id: groupId}
-				err = sqlStore.GetTeamById(context.Background(), query)
-				require.Equal(t, err, models.ErrTeamNotFound)
+				team, err = sqlStore.getTeamByName(context.Background(), testOrgID, "GROUP1 NAME", false)
+				require.NoError(t, err)
+				require.Equal(t, team1.Id, team.Id)
+			})
 
-				permQuery := &models.GetDashboardACLInfoListQuery{DashboardID: 1, OrgID: testOrgID}
-				err = getDashboardACLInfoList(sqlStore, permQuery)
+			t.Run("Should be able to sort teams by the number of dashboard permissions granted to them", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				_, err := sqlStore.CreateTeam("group3 name", "", testOrgID)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, 1,
+					&models.DashboardACL{DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_VIEW, TeamID: team1.Id},
+					&models.DashboardACL{DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_EDIT, TeamID: team2.Id},
+				)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, 2,
+					&models.DashboardACL{DashboardID: 2, OrgID: testOrgID, Permission: models.PERMISSION_VIEW, TeamID: team2.Id},
+				)
 				require.NoError(t, err)
 
-				require.Equal(t, len(permQuery.Result), 0)
+				query := &models.SearchTeamsQuery{OrgId: testOrgID, SortBy: models.TeamSortAclCountDesc, Page: 1, Limit: 2, SignedInUser: testUser}
+				err = sqlStore.SearchTeams(context.Background(), query)
+				require.NoError(t, err)
+				require.EqualValues(t, 3, query.Result.TotalCount)
+				require.Len(t, query.Result.Teams, 2)
+				require.Equal(t, team2.Id, query.Result.Teams[0].Id)
+				require.EqualValues(t, 2, query.Result.Teams[0].AclCount)
+				require.Equal(t, team1.Id, query.Result.Teams[1].Id)
+				require.EqualValues(t, 1, query.Result.Teams[1].AclCount)
+
+				query = &models.SearchTeamsQuery{OrgId: testOrgID, SortBy: models.TeamSortAclCountDesc, Page: 2, Limit: 2, SignedInUser: testUser}
+				err = sqlStore.SearchTeams(context.Background(), query)
+				require.NoError(t, err)
+				require.EqualValues(t, 3, query.Result.TotalCount)
+				require.Len(t, query.Result.Teams, 1)
+				require.Equal(t, "group3 name", query.Result.Teams[0].Name)
+				require.EqualValues(t, 0, query.Result.Teams[0].AclCount)
+
+				query = &models.SearchTeamsQuery{OrgId: testOrgID, SortBy: "members-desc", SignedInUser: testUser}
+				err = sqlStore.SearchTeams(context.Background(), query)
+				require.ErrorIs(t, err, models.ErrInvalidTeamSort)
+			})
+
+			t.Run("Should be able to list and join teams that allow users to join by themselves", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				team3, err := sqlStore.CreateTeam("group3 name", "", testOrgID)
+				require.NoError(t, err)
+				ids := userIds[len(userIds)-5:]
+				err = sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.SetTeamOpenJoin(context.Background(), testOrgID, team1.Id, true)
+				require.NoError(t, err)
+				err = sqlStore.SetTeamOpenJoin(context.Background(), testOrgID, team3.Id, true)
+				require.NoError(t, err)
+
+				teams, err := sqlStore.ListJoinableTeams(context.Background(), testOrgID, ids[0])
+				require.NoError(t, err)
+				require.Len(t, teams, 1)
+				require.Equal(t, team3.Id, teams[0].Id)
+
+				teams, err = sqlStore.ListJoinableTeams(context.Background(), testOrgID, ids[1])
+				require.NoError(t, err)
+				require.Len(t, teams, 2)
+				require.Equal(t, team1.Id, teams[0].Id)
+				require.Equal(t, team3.Id, teams[1].Id)
+
+				err = sqlStore.JoinTeam(context.Background(), testOrgID, team3.Id, ids[0])
+				require.NoError(t, err)
+
+				teams, err = sqlStore.ListJoinableTeams(context.Background(), testOrgID, ids[0])
+				require.NoError(t, err)
+				require.Empty(t, teams)
+
+				err = sqlStore.JoinTeam(context.Background(), testOrgID, team3.Id, ids[0])
+				require.ErrorIs(t, err, models.ErrTeamMemberAlreadyAdded)
+				err = sqlStore.JoinTeam(context.Background(), testOrgID, team2.Id, ids[0])
+				require.ErrorIs(t, err, models.ErrTeamNotOpenJoin)
+				err = sqlStore.JoinTeam(context.Background(), testOrgID, 999, ids[0])
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+			})
+
+			t.Run("Should be able to count team memberships per auth module", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				for _, userID := range ids[:3] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+				serviceAccount, err := sqlStore.CreateUser(context.Background(), user.CreateUserCommand{
+					Login:            "login-sa",
+					IsServiceAccount: true,
+				})
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(serviceAccount.ID, testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.WithDbSession(context.Background(), func(sess *DBSession) error {
+					_, err := sess.Insert(
+						&models.UserAuth{UserId: ids[0], AuthModule: "oauth_github", AuthId: "1", Created: time.Now().Add(-time.Hour)},
+						&models.UserAuth{UserId: ids[0], AuthModule: "ldap", AuthId: "1", Created: time.Now()},
+						&models.UserAuth{UserId: ids[1], AuthModule: "oauth_github", AuthId: "2", Created: time.Now()},
+					)
+					return err
+				})
+				require.NoError(t, err)
+
+				counts, err := sqlStore.CountMembershipsByAuthModule(context.Background(), testOrgID)
+				require.NoError(t, err)
+				require.Equal(t, map[string]int64{"ldap": 2, "oauth_github": 1, "": 1}, counts)
+			})
+
+			t.Run("Should not be able to create more teams than the org limit", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				sqlStore.Cfg.MaxTeamsPerOrg = 3
+				t.Cleanup(func() { sqlStore.Cfg.MaxTeamsPerOrg = 0 })
+
+				_, err := sqlStore.CreateTeam("group3 name", "", testOrgID)
+				require.NoError(t, err)
+				_, err = sqlStore.CreateTeam("group4 name", "", testOrgID)
+				require.ErrorIs(t, err, models.ErrOrgTeamLimitReached)
+
+				team, created, err := sqlStore.GetOrCreateTeamByName(context.Background(), testOrgID, "group1 name", "")
+				require.NoError(t, err)
+				require.False(t, created)
+				require.Equal(t, team1.Id, team.Id)
+				_, _, err = sqlStore.GetOrCreateTeamByName(context.Background(), testOrgID, "group4 name", "")
+				require.ErrorIs(t, err, models.ErrOrgTeamLimitReached)
+
+				_, err = sqlStore.CreateTeam("group4 name", "", 2)
+				require.NoError(t, err)
+			})
+
+			t.Run("Should be able to promote members to admin up to a maximum number of admins", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				for _, userID := range ids[1:4] {
+					err = sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+				adminIDs := func() []int64 {
+					members, err := sqlStore.GetMembersByPermission(context.Background(), testOrgID, models.PERMISSION_ADMIN)
+					require.NoError(t, err)
+					userIDs := make([]int64, 0, len(members))
+					for _, member := range members {
+						userIDs = append(userIDs, member.UserId)
+					}
+					return userIDs
+				}
+
+				err = sqlStore.PromoteToAdmin(context.Background(), testOrgID, team1.Id, []int64{ids[1], ids[2]}, 2)
+				require.ErrorIs(t, err, models.ErrTeamAdminLimitExceeded)
+				require.ElementsMatch(t, []int64{ids[0]}, adminIDs())
+
+				err = sqlStore.PromoteToAdmin(context.Background(), testOrgID, team1.Id, []int64{ids[1], ids[4]}, 3)
+				require.ErrorIs(t, err, models.ErrTeamMemberNotFound)
+				require.ElementsMatch(t, []int64{ids[0]}, adminIDs())
+
+				err = sqlStore.PromoteToAdmin(context.Background(), testOrgID, team1.Id, []int64{ids[0], ids[1], ids[2], ids[1]}, 3)
+				require.NoError(t, err)
+				require.ElementsMatch(t, []int64{ids[0], ids[1], ids[2]}, adminIDs())
+			})
+
+			t.Run("Should be able to search for members within a team", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				for _, userID := range userIds[len(userIds)-5 : len(userIds)-2] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+
+				query := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, Query: "user1", SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 1)
+				require.Equal(t, "loginuser1", query.Result[0].Login)
+				require.EqualValues(t, 1, query.TotalCount)
+
+				query = &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, Query: "@test.com", SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 3)
+				require.EqualValues(t, 3, query.TotalCount)
+
+				query = &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, Query: "user4", SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 0)
+				require.EqualValues(t, 0, query.TotalCount)
+			})
+
+			t.Run("Should be able to get a page of the members of a team along with the total count", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				for _, userID := range userIds[:3] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+
+				query := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, Limit: 2, Page: 2, SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 1)
+				require.Equal(t, "loginuser2", query.Result[0].Login)
+				require.EqualValues(t, 3, query.TotalCount)
+			})
+
+			t.Run("Should be able to compute the membership overlap of two teams", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				for _, userID := range ids[:3] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+				for _, userID := range ids[2:] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team2.Id, false, 0)
+					require.NoError(t, err)
+				}
+
+				overlap, onlyA, onlyB, err := sqlStore.GetMembershipOverlap(context.Background(), testOrgID, team1.Id, team2.Id)
+				require.NoError(t, err)
+				require.EqualValues(t, 1, overlap)
+				require.EqualValues(t, 2, onlyA)
+				require.EqualValues(t, 2, onlyB)
+
+				overlap, onlyA, onlyB, err = sqlStore.GetMembershipOverlap(context.Background(), testOrgID+1, team1.Id, team2.Id)
+				require.NoError(t, err)
+				require.EqualValues(t, 0, overlap)
+				require.EqualValues(t, 0, onlyA)
+				require.EqualValues(t, 0, onlyB)
+			})
+
+			t.Run("Should be able to return all teams a user is member of", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				groupId := team2.Id
+				err := sqlStore.AddTeamMember(userIds[0], testOrgID, groupId, false, 0)
+				require.NoError(t, err)
+
+				query := &models.GetTeamsByUserQuery{
+					OrgId:  testOrgID,
+					UserId: userIds[0],
+					SignedInUser: &models.SignedInUser{
+						OrgId:       testOrgID,
+						Permissions: map[int64]map[string][]string{testOrgID: {ac.ActionOrgUsersRead: {ac.ScopeUsersAll}, ac.ActionTeamsRead: {ac.ScopeTeamsAll}}},
+					},
+				}
+				err = sqlStore.GetTeamsByUser(context.Background(), query)
+				require.NoError(t, err)
+				require.Equal(t, len(query.Result), 1)
+				require.Equal(t, query.Result[0].Name, "group2 name")
+				require.Equal(t, query.Result[0].Email, "test2@test.com")
+			})
+
+			t.Run("Should be able to remove users from a group", func(t *testing.T) {
+				err = sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+
+				err = sqlStore.RemoveTeamMember(context.Background(), &models.RemoveTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0]})
+				require.NoError(t, err)
+
+				q2 := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), q2)
+				require.NoError(t, err)
+				require.Equal(t, len(q2.Result), 0)
+			})
+
+			t.Run("Should never remove the last admin of a team", func(t *testing.T) {
+				err = sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+
+				t.Run("A user should not be able to remove the last admin", func(t *testing.T) {
+					err = sqlStore.RemoveTeamMember(context.Background(), &models.RemoveTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0]})
+					require.Equal(t, err, models.ErrLastTeamAdmin)
+				})
+
+				t.Run("A user should be able to remove an admin if there are other admins", func(t *testing.T) {
+					err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+					require.NoError(t, err)
+					err = sqlStore.RemoveTeamMember(context.Background(), &models.RemoveTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[1]})
+					require.NoError(t, err)
+				})
+
+				t.Run("A user should not be able to remove the admin permission for the last admin", func(t *testing.T) {
+					err = sqlStore.UpdateTeamMember(context.Background(), &models.UpdateTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0], Permission: 0})
+					require.Error(t, err, models.ErrLastTeamAdmin)
+				})
+
+				t.Run("A user should be able to remove the admin permission if there are other admins", func(t *testing.T) {
+					sqlStore = InitTestDB(t)
+					setup()
+
+					err = sqlStore.AddTeamMember(userIds[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+					require.NoError(t, err)
+
+					err = sqlStore.AddTeamMember(userIds[1], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+					require.NoError(t, err)
+					err = sqlStore.UpdateTeamMember(context.Background(), &models.UpdateTeamMemberCommand{OrgId: testOrgID, TeamId: team1.Id, UserId: userIds[0], Permission: 0})
+					require.NoError(t, err)
+				})
+			})
+
+			t.Run("Should be able to remove a group with users and permissions", func(t *testing.T) {
+				groupId := team2.Id
+				err := sqlStore.AddTeamMember(userIds[1], testOrgID, groupId, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(userIds[2], testOrgID, groupId, false, 0)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, 1, &models.DashboardACL{
+					DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_EDIT, TeamID: groupId,
+				})
+				require.NoError(t, err)
+				err = sqlStore.DeleteTeam(context.Background(), &models.DeleteTeamCommand{OrgId: testOrgID, Id: groupId})
+				require.NoError(t, err)
+
+				query := &models.GetTeamByIdQuery{OrgId: testOrgID, Id: groupId}
+				err = sqlStore.GetTeamById(context.Background(), query)
+				require.Equal(t, err, models.ErrTeamNotFound)
+
+				permQuery := &models.GetDashboardACLInfoListQuery{DashboardID: 1, OrgID: testOrgID}
+				err = getDashboardACLInfoList(sqlStore, permQuery)
+				require.NoError(t, err)
+
+				require.Equal(t, len(permQuery.Result), 0)
+			})
+
+			t.Run("Should be able to merge a team into another team", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, 1,
+					&models.DashboardACL{DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_VIEW, TeamID: team1.Id},
+					&models.DashboardACL{DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_EDIT, TeamID: team2.Id},
+				)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, 2,
+					&models.DashboardACL{DashboardID: 2, OrgID: testOrgID, Permission: models.PERMISSION_VIEW, TeamID: team2.Id},
+				)
+				require.NoError(t, err)
+
+				result, err := sqlStore.MergeTeams(context.Background(), testOrgID, team2.Id, team1.Id)
+				require.NoError(t, err)
+				require.EqualValues(t, 1, result.MembersMoved)
+				require.EqualValues(t, 1, result.MembersAlreadyPresent)
+
+				query := &models.GetTeamByIdQuery{OrgId: testOrgID, Id: team2.Id}
+				err = sqlStore.GetTeamById(context.Background(), query)
+				require.Equal(t, models.ErrTeamNotFound, err)
+
+				membersQuery := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), membersQuery)
+				require.NoError(t, err)
+				require.Len(t, membersQuery.Result, 3)
+				for _, member := range membersQuery.Result {
+					if member.UserId == ids[1] {
+						require.Equal(t, models.PERMISSION_ADMIN, member.Permission)
+					}
+				}
+
+				var acl []models.DashboardACL
+				err = sqlStore.WithDbSession(context.Background(), func(sess *DBSession) error {
+					return sess.Table("dashboard_acl").Where("org_id=?", testOrgID).Asc("dashboard_id").Find(&acl)
+				})
+				require.NoError(t, err)
+				require.Len(t, acl, 2)
+				require.Equal(t, team1.Id, acl[0].TeamID)
+				require.Equal(t, models.PERMISSION_EDIT, acl[0].Permission)
+				require.Equal(t, team1.Id, acl[1].TeamID)
+				require.Equal(t, int64(2), acl[1].DashboardID)
+			})
+
+			t.Run("Should not be able to merge a team into itself", func(t *testing.T) {
+				_, err := sqlStore.MergeTeams(context.Background(), testOrgID, team1.Id, team1.Id)
+				require.Equal(t, models.ErrTeamMergeIntoItself, err)
+			})
+
+			t.Run("Should be able to count the dashboard permissions of each team", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				err := updateDashboardACL(t, sqlStore, 1,
+					&models.DashboardACL{DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_VIEW, TeamID: team1.Id},
+					&models.DashboardACL{DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_EDIT, TeamID: team2.Id},
+					&models.DashboardACL{DashboardID: 1, OrgID: testOrgID, Permission: models.PERMISSION_EDIT, UserID: userIds[0]},
+				)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, 2,
+					&models.DashboardACL{DashboardID: 2, OrgID: testOrgID, Permission: models.PERMISSION_VIEW, TeamID: team2.Id},
+				)
+				require.NoError(t, err)
+
+				counts, err := sqlStore.GetTeamDashboardAclCounts(context.Background(), testOrgID)
+				require.NoError(t, err)
+				require.Equal(t, map[int64]int64{team1.Id: 1, team2.Id: 2}, counts)
+			})
+
+			t.Run("Should be able to return the members added by an actor", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				actorID := ids[4]
+				for _, userID := range ids[:2] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+					err = sqlStore.SetTeamMemberCreatedBy(context.Background(), testOrgID, team1.Id, userID, actorID)
+					require.NoError(t, err)
+				}
+				// members without a recorded actor are ignored
+				err := sqlStore.AddTeamMember(ids[2], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+
+				// the first recorded actor is kept
+				err = sqlStore.SetTeamMemberCreatedBy(context.Background(), testOrgID, team1.Id, ids[0], ids[3])
+				require.NoError(t, err)
+
+				members, err := sqlStore.GetMembersCreatedBy(context.Background(), testOrgID, actorID)
+				require.NoError(t, err)
+				require.Len(t, members, 2)
+
+				members, err = sqlStore.GetMembersCreatedBy(context.Background(), testOrgID, ids[3])
+				require.NoError(t, err)
+				require.Len(t, members, 0)
+			})
+
+			t.Run("Should be able to find and clean up members whose user no longer exists", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				for _, userID := range ids[:2] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+				err := sqlStore.WithDbSession(context.Background(), func(sess *DBSession) error {
+					_, err := sess.Exec("DELETE FROM "+sqlStore.Dialect.Quote("user")+" WHERE id=?", ids[1])
+					return err
+				})
+				require.NoError(t, err)
+
+				orphans, err := sqlStore.FindOrphanedMembers(context.Background(), testOrgID)
+				require.NoError(t, err)
+				require.Len(t, orphans, 1)
+				require.Equal(t, ids[1], orphans[0].UserId)
+				require.Equal(t, team1.Id, orphans[0].TeamId)
+
+				deleted, err := sqlStore.CleanupOrphanedMembers(context.Background(), testOrgID)
+				require.NoError(t, err)
+				require.EqualValues(t, 1, deleted)
+
+				orphans, err = sqlStore.FindOrphanedMembers(context.Background(), testOrgID)
+				require.NoError(t, err)
+				require.Len(t, orphans, 0)
+
+				query := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 1)
+			})
+
+			t.Run("Should be able to get the folders a team has access to", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				folderB := insertTestDashboard(t, sqlStore, "b folder", testOrgID, 0, true)
+				folderA := insertTestDashboard(t, sqlStore, "a folder", testOrgID, 0, true)
+				dash := insertTestDashboard(t, sqlStore, "not a folder", testOrgID, folderA.Id, false)
+
+				team, err := sqlStore.CreateTeam("team with folders", "", testOrgID)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, folderB.Id,
+					&models.DashboardACL{DashboardID: folderB.Id, OrgID: testOrgID, Permission: models.PERMISSION_VIEW, TeamID: team.Id},
+				)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, folderA.Id,
+					&models.DashboardACL{DashboardID: folderA.Id, OrgID: testOrgID, Permission: models.PERMISSION_ADMIN, TeamID: team.Id},
+				)
+				require.NoError(t, err)
+				err = updateDashboardACL(t, sqlStore, dash.Id,
+					&models.DashboardACL{DashboardID: dash.Id, OrgID: testOrgID, Permission: models.PERMISSION_EDIT, TeamID: team.Id},
+				)
+				require.NoError(t, err)
+
+				access, err := sqlStore.GetTeamFolderAccess(context.Background(), testOrgID, team.Id)
+				require.NoError(t, err)
+				require.Equal(t, []models.FolderPermission{
+					{FolderID: folderA.Id, Permission: models.PERMISSION_ADMIN, FolderUID: folderA.Uid, FolderTitle: "a folder"},
+					{FolderID: folderB.Id, Permission: models.PERMISSION_VIEW, FolderUID: folderB.Uid, FolderTitle: "b folder"},
+				}, access)
+
+				access, err = sqlStore.GetTeamFolderAccess(context.Background(), testOrgID, team1.Id)
+				require.NoError(t, err)
+				require.Empty(t, access)
+
+				_, err = sqlStore.GetTeamFolderAccess(context.Background(), testOrgID, 999)
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+			})
+
+			t.Run("Should be able to snapshot a team", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, true, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.SetTeamLabels(context.Background(), testOrgID, team1.Id, map[string]string{"env": "prod"})
+				require.NoError(t, err)
+				settings := simplejson.NewFromAny(map[string]interface{}{"key": "value"})
+				err = sqlStore.SetTeamSettings(context.Background(), testOrgID, team1.Id, settings)
+				require.NoError(t, err)
+				folder := insertTestDashboard(t, sqlStore, "a folder", testOrgID, 0, true)
+				err = updateDashboardACL(t, sqlStore, folder.Id,
+					&models.DashboardACL{DashboardID: folder.Id, OrgID: testOrgID, Permission: models.PERMISSION_EDIT, TeamID: team1.Id},
+				)
+				require.NoError(t, err)
+
+				snapshot, err := sqlStore.SnapshotTeam(context.Background(), testOrgID, team1.Id)
+				require.NoError(t, err)
+				require.Equal(t, team1.Id, snapshot.Team.Id)
+				require.Equal(t, team1.Name, snapshot.Team.Name)
+				require.Equal(t, "value", snapshot.Team.Settings.Get("key").MustString())
+				require.Len(t, snapshot.Members, 2)
+				require.Equal(t, ids[0], snapshot.Members[0].UserId)
+				require.Equal(t, "loginuser0", snapshot.Members[0].Login)
+				require.False(t, snapshot.Members[0].External)
+				require.Equal(t, ids[1], snapshot.Members[1].UserId)
+				require.True(t, snapshot.Members[1].External)
+				require.Equal(t, models.PERMISSION_ADMIN, snapshot.Members[1].Permission)
+				require.Equal(t, map[string]string{"env": "prod"}, snapshot.Labels)
+				require.Equal(t, []*models.TeamSnapshotPermission{
+					{DashboardId: folder.Id, DashboardUid: folder.Uid, IsFolder: true, Permission: models.PERMISSION_EDIT},
+				}, snapshot.Permissions)
+
+				_, err = sqlStore.SnapshotTeam(context.Background(), testOrgID, 999)
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+			})
+
+			t.Run("Should be able to get the expired team memberships", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				expired := time.Now().Add(-time.Hour)
+				future := time.Now().Add(time.Hour)
+
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.SetTeamMemberExpiry(context.Background(), testOrgID, team1.Id, ids[0], &expired)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.SetTeamMemberExpiry(context.Background(), testOrgID, team1.Id, ids[1], &future)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.SetTeamMemberExpiry(context.Background(), testOrgID, team2.Id, ids[2], &expired)
+				require.NoError(t, err)
+
+				err = sqlStore.SetTeamMemberExpiry(context.Background(), testOrgID, team2.Id, ids[3], &future)
+				require.ErrorIs(t, err, models.ErrTeamMemberNotFound)
+
+				expiredMembers, err := sqlStore.GetExpiredTeamMembers(context.Background())
+				require.NoError(t, err)
+				require.Len(t, expiredMembers, 2)
+				require.ElementsMatch(t, []int64{ids[0], ids[2]}, []int64{expiredMembers[0].UserId, expiredMembers[1].UserId})
+
+				query := &models.GetTeamMembersQuery{OrgId: testOrgID, TeamId: team1.Id, SignedInUser: testUser}
+				err = sqlStore.GetTeamMembers(context.Background(), query)
+				require.NoError(t, err)
+				require.Len(t, query.Result, 2)
+				for _, member := range query.Result {
+					require.NotNil(t, member.ExpiresAt)
+					if member.UserId == ids[1] {
+						require.WithinDuration(t, future, *member.ExpiresAt, time.Second)
+					}
+				}
+			})
+
+			t.Run("Should be able to search teams by name prefix", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				for _, name := range []string{"ops-oncall", "devops", "ops"} {
+					_, err := sqlStore.CreateTeam(name, "", testOrgID)
+					require.NoError(t, err)
+				}
+
+				query := &models.SearchTeamsQuery{OrgId: testOrgID, Query: "ops", PrefixQuery: true, SignedInUser: testUser}
+				err := sqlStore.SearchTeams(context.Background(), query)
+				require.NoError(t, err)
+				require.EqualValues(t, 2, query.Result.TotalCount)
+				require.Len(t, query.Result.Teams, 2)
+				require.Equal(t, "ops", query.Result.Teams[0].Name)
+				require.Equal(t, "ops-oncall", query.Result.Teams[1].Name)
+			})
+
+			t.Run("Should be able to get the team stats of an org", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				for _, userID := range ids[:3] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+				err := sqlStore.AddTeamMember(ids[3], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				_, err = sqlStore.CreateTeam("empty team", "", testOrgID)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[4], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+				serviceAccount, err := sqlStore.CreateUser(context.Background(), user.CreateUserCommand{
+					Login:            "login-sa",
+					IsServiceAccount: true,
+				})
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(serviceAccount.ID, testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+
+				stats, err := sqlStore.GetOrgTeamStats(context.Background(), testOrgID)
+				require.NoError(t, err)
+				require.Equal(t, &models.TeamStats{
+					TeamCount:         3,
+					TotalMemberships:  5,
+					AverageTeamSize:   5.0 / 3.0,
+					MaxTeamSize:       4,
+					EmptyTeams:        1,
+					TeamsWithoutAdmin: 2,
+				}, stats)
+			})
+
+			t.Run("Should be able to get the members of several teams", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				for _, userID := range ids[:2] {
+					err := sqlStore.AddTeamMember(userID, testOrgID, team1.Id, false, 0)
+					require.NoError(t, err)
+				}
+				err := sqlStore.AddTeamMember(ids[1], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				team3, err := sqlStore.CreateTeam("group3 name", "", testOrgID)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team3.Id, false, 0)
+				require.NoError(t, err)
+
+				members, err := sqlStore.GetMembersOfTeams(context.Background(), testOrgID, []int64{team1.Id, team2.Id}, false)
+				require.NoError(t, err)
+				require.Len(t, members, 3)
+				require.Equal(t, ids[1], members[1].UserId)
+				require.Equal(t, team1.Id, members[1].TeamId)
+				require.Equal(t, ids[1], members[2].UserId)
+				require.Equal(t, team2.Id, members[2].TeamId)
+
+				members, err = sqlStore.GetMembersOfTeams(context.Background(), testOrgID, []int64{team1.Id, team2.Id}, true)
+				require.NoError(t, err)
+				require.Len(t, members, 2)
+				require.Equal(t, ids[0], members[0].UserId)
+				require.Equal(t, ids[1], members[1].UserId)
+			})
+
+			t.Run("Should be able to get the admins of the teams a user belongs to", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				team3, err := sqlStore.CreateTeam("group3 name", "", testOrgID)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team3.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+
+				admins, err := sqlStore.GetAdminsOfUsersTeams(context.Background(), testUser, testOrgID, ids[1], false)
+				require.NoError(t, err)
+				require.Len(t, admins, 2)
+				require.Len(t, admins[team1.Id], 1)
+				require.Equal(t, ids[0], admins[team1.Id][0].UserId)
+				require.Len(t, admins[team2.Id], 1)
+				require.Equal(t, ids[1], admins[team2.Id][0].UserId)
+
+				admins, err = sqlStore.GetAdminsOfUsersTeams(context.Background(), testUser, testOrgID, ids[1], true)
+				require.NoError(t, err)
+				require.Len(t, admins, 1)
+				require.Equal(t, ids[0], admins[team1.Id][0].UserId)
+
+				admins, err = sqlStore.GetAdminsOfUsersTeams(context.Background(), testUser, testOrgID, ids[3], false)
+				require.NoError(t, err)
+				require.Empty(t, admins)
+
+				// admins the signed in user can't read are left out
+				restrictedUser := &models.SignedInUser{
+					OrgId: testOrgID,
+					Permissions: map[int64]map[string][]string{testOrgID: {
+						ac.ActionTeamsRead:    {ac.ScopeTeamsAll},
+						ac.ActionOrgUsersRead: {ac.Scope("users", "id", fmt.Sprintf("%d", ids[1]))},
+					}},
+				}
+				admins, err = sqlStore.GetAdminsOfUsersTeams(context.Background(), restrictedUser, testOrgID, ids[1], false)
+				require.NoError(t, err)
+				require.Len(t, admins, 1)
+				require.Equal(t, ids[1], admins[team2.Id][0].UserId)
+
+				// so are the teams the signed in user can't read
+				restrictedUser = &models.SignedInUser{
+					OrgId: testOrgID,
+					Permissions: map[int64]map[string][]string{testOrgID: {
+						ac.ActionTeamsRead:    {ac.Scope("teams", "id", fmt.Sprintf("%d", team1.Id))},
+						ac.ActionOrgUsersRead: {ac.ScopeUsersAll},
+					}},
+				}
+				admins, err = sqlStore.GetAdminsOfUsersTeams(context.Background(), restrictedUser, testOrgID, ids[1], false)
+				require.NoError(t, err)
+				require.Len(t, admins, 1)
+				require.Equal(t, ids[0], admins[team1.Id][0].UserId)
+			})
+
+			t.Run("Should be able to list teams by label selector", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				team3, err := sqlStore.CreateTeam("group3 name", "", testOrgID)
+				require.NoError(t, err)
+				err = sqlStore.SetTeamLabels(context.Background(), testOrgID, team1.Id, map[string]string{"env": "prod", "tier": "critical"})
+				require.NoError(t, err)
+				err = sqlStore.SetTeamLabels(context.Background(), testOrgID, team2.Id, map[string]string{"env": "prod"})
+				require.NoError(t, err)
+				err = sqlStore.SetTeamLabels(context.Background(), testOrgID, team3.Id, map[string]string{"env": "dev", "tier": "critical"})
+				require.NoError(t, err)
+
+				teams, err := sqlStore.ListTeamsByLabelSelector(context.Background(), testUser, testOrgID, map[string]string{"env": "prod", "tier": "critical"})
+				require.NoError(t, err)
+				require.Len(t, teams, 1)
+				require.Equal(t, team1.Id, teams[0].Id)
+
+				teams, err = sqlStore.ListTeamsByLabelSelector(context.Background(), testUser, testOrgID, map[string]string{"env": "prod"})
+				require.NoError(t, err)
+				require.Len(t, teams, 2)
+				require.Equal(t, team1.Id, teams[0].Id)
+				require.Equal(t, team2.Id, teams[1].Id)
+
+				err = sqlStore.SetTeamLabels(context.Background(), testOrgID, team1.Id, map[string]string{"env": "staging"})
+				require.NoError(t, err)
+				teams, err = sqlStore.ListTeamsByLabelSelector(context.Background(), testUser, testOrgID, map[string]string{"tier": "critical"})
+				require.NoError(t, err)
+				require.Len(t, teams, 1)
+				require.Equal(t, team3.Id, teams[0].Id)
+
+				_, err = sqlStore.ListTeamsByLabelSelector(context.Background(), testUser, testOrgID, map[string]string{})
+				require.ErrorIs(t, err, models.ErrInvalidTeamLabel)
+				err = sqlStore.SetTeamLabels(context.Background(), testOrgID, 999, map[string]string{"env": "prod"})
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+			})
+
+			t.Run("Should be able to export the memberships of the org sorted by team, permission and login", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[3], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, true, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+
+				memberships, err := sqlStore.ExportOrgMemberships(context.Background(), testUser, testOrgID)
+				require.NoError(t, err)
+				require.Len(t, memberships, 4)
+				expected := []struct {
+					teamID int64
+					userID int64
+				}{{team1.Id, ids[1]}, {team1.Id, ids[0]}, {team1.Id, ids[2]}, {team2.Id, ids[3]}}
+				for i, e := range expected {
+					require.Equal(t, e.teamID, memberships[i].TeamId)
+					require.Equal(t, e.userID, memberships[i].UserId)
+				}
+				require.Equal(t, "group1 name", memberships[0].TeamName)
+				require.Equal(t, "loginuser1", memberships[0].Login)
+				require.True(t, memberships[0].External)
+				require.Equal(t, models.PERMISSION_ADMIN, memberships[0].Permission)
+			})
+
+			t.Run("Should be able to find the teams sharing an email", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				team3, err := sqlStore.CreateTeam("group3 name", "Test1@Test.com", testOrgID)
+				require.NoError(t, err)
+				_, err = sqlStore.CreateTeam("group4 name", "", testOrgID)
+				require.NoError(t, err)
+
+				teams, err := sqlStore.FindTeamsByEmail(context.Background(), testOrgID, "TEST1@test.com")
+				require.NoError(t, err)
+				require.Len(t, teams, 2)
+				require.Equal(t, team1.Id, teams[0].Id)
+				require.Equal(t, team3.Id, teams[1].Id)
+
+				teams, err = sqlStore.FindTeamsByEmail(context.Background(), testOrgID, "")
+				require.NoError(t, err)
+				require.Empty(t, teams)
+
+				teams, err = sqlStore.FindTeamsByEmail(context.Background(), 2, "test1@test.com")
+				require.NoError(t, err)
+				require.Empty(t, teams)
+			})
+
+			t.Run("Should be able to find the members whose permission differs from the expected one", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[3], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+
+				expected := map[int64]models.PermissionType{
+					ids[0]: models.PERMISSION_ADMIN,
+					ids[1]: 0,
+					ids[2]: 0,
+					ids[4]: models.PERMISSION_ADMIN,
+				}
+				members, err := sqlStore.FindMembersWithUnexpectedPermission(context.Background(), testOrgID, team1.Id, expected)
+				require.NoError(t, err)
+				require.Len(t, members, 2)
+				require.Equal(t, ids[2], members[0].UserId)
+				require.Equal(t, models.PERMISSION_ADMIN, members[0].Permission)
+				require.Equal(t, ids[3], members[1].UserId)
+
+				_, err = sqlStore.FindMembersWithUnexpectedPermission(context.Background(), testOrgID, 999, expected)
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+			})
+
+			t.Run("Should be able to get the members with a permission across all teams", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+
+				admins, err := sqlStore.GetMembersByPermission(context.Background(), testOrgID, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				require.Len(t, admins, 2)
+				require.Equal(t, ids[0], admins[0].UserId)
+				require.Equal(t, team1.Id, admins[0].TeamId)
+				require.Equal(t, ids[1], admins[1].UserId)
+				require.Equal(t, team2.Id, admins[1].TeamId)
+
+				admins, err = sqlStore.GetMembersByPermission(context.Background(), testOrgID+1, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				require.Empty(t, admins)
+			})
+
+			t.Run("Should be able to swap the permissions of two team members", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+
+				err = sqlStore.SwapMemberPermissions(context.Background(), testOrgID, team1.Id, ids[0], ids[1])
+				require.NoError(t, err)
+
+				admins, err := sqlStore.GetMembersByPermission(context.Background(), testOrgID, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				require.Len(t, admins, 1)
+				require.Equal(t, ids[1], admins[0].UserId)
+
+				err = sqlStore.SwapMemberPermissions(context.Background(), testOrgID, team1.Id, ids[1], ids[2])
+				require.ErrorIs(t, err, models.ErrTeamMemberNotFound)
+				admins, err = sqlStore.GetMembersByPermission(context.Background(), testOrgID, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				require.Len(t, admins, 1)
+				require.Equal(t, ids[1], admins[0].UserId)
+			})
+
+			t.Run("Should be able to check whether a team name is available", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+
+				available, err := sqlStore.IsTeamNameAvailable(context.Background(), testOrgID, "GROUP1 NAME", 0)
+				require.NoError(t, err)
+				require.False(t, available)
+
+				available, err = sqlStore.IsTeamNameAvailable(context.Background(), testOrgID, "group1 name", team1.Id)
+				require.NoError(t, err)
+				require.True(t, available)
+
+				available, err = sqlStore.IsTeamNameAvailable(context.Background(), testOrgID, "group3 name", 0)
+				require.NoError(t, err)
+				require.True(t, available)
+
+				available, err = sqlStore.IsTeamNameAvailable(context.Background(), testOrgID+1, "group1 name", 0)
+				require.NoError(t, err)
+				require.True(t, available)
+			})
+
+			t.Run("Should be able to get the primary team a user is an admin of", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+
+				_, err := sqlStore.GetPrimaryAdminTeam(context.Background(), testOrgID, ids[0])
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+
+				err = sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[0], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+
+				// the teams have as many members, so the oldest one is returned
+				team, err := sqlStore.GetPrimaryAdminTeam(context.Background(), testOrgID, ids[0])
+				require.NoError(t, err)
+				require.Equal(t, team1.Id, team.Id)
+
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+				team, err = sqlStore.GetPrimaryAdminTeam(context.Background(), testOrgID, ids[0])
+				require.NoError(t, err)
+				require.Equal(t, team2.Id, team.Id)
+				require.Equal(t, int64(2), team.MemberCount)
+
+				_, err = sqlStore.GetPrimaryAdminTeam(context.Background(), testOrgID, ids[1])
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+			})
+
+			t.Run("Should be able to page through the teams with a cursor", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				team3, err := sqlStore.CreateTeam("group3 name", "", testOrgID)
+				require.NoError(t, err)
+				_, err = sqlStore.CreateTeam("other org group", "", testOrgID+1)
+				require.NoError(t, err)
+
+				teams, err := sqlStore.ListTeamsAfter(context.Background(), testOrgID, 0, 2)
+				require.NoError(t, err)
+				require.Len(t, teams, 2)
+				require.Equal(t, team1.Id, teams[0].Id)
+				require.Equal(t, team2.Id, teams[1].Id)
+
+				teams, err = sqlStore.ListTeamsAfter(context.Background(), testOrgID, teams[1].Id, 2)
+				require.NoError(t, err)
+				require.Len(t, teams, 1)
+				require.Equal(t, team3.Id, teams[0].Id)
+
+				teams, err = sqlStore.ListTeamsAfter(context.Background(), testOrgID, team3.Id, 2)
+				require.NoError(t, err)
+				require.Empty(t, teams)
+			})
+
+			t.Run("Should be able to replace the last admin of a team", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+
+				err = sqlStore.ReplaceTeamAdmin(context.Background(), testOrgID, team1.Id, ids[1], ids[2])
+				require.ErrorIs(t, err, models.ErrTeamMemberNotAdmin)
+
+				err = sqlStore.ReplaceTeamAdmin(context.Background(), testOrgID, team1.Id, ids[0], ids[2])
+				require.NoError(t, err)
+
+				_, admins, err := sqlStore.GetTeamWithAdmins(context.Background(), testOrgID, team1.Id)
+				require.NoError(t, err)
+				require.Len(t, admins, 1)
+				require.Equal(t, ids[2], admins[0].UserId)
+				isMember, err := sqlStore.IsTeamMember(testOrgID, team1.Id, ids[0])
+				require.NoError(t, err)
+				require.True(t, isMember)
+
+				err = sqlStore.ReplaceTeamAdmin(context.Background(), testOrgID, team1.Id, ids[2], ids[1])
+				require.NoError(t, err)
+				_, admins, err = sqlStore.GetTeamWithAdmins(context.Background(), testOrgID, team1.Id)
+				require.NoError(t, err)
+				require.Len(t, admins, 1)
+				require.Equal(t, ids[1], admins[0].UserId)
+			})
+
+			t.Run("Should be able to get the union of the teams of several users", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+				team3, err := sqlStore.CreateTeam("group3 name", "", testOrgID)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team3.Id, false, 0)
+				require.NoError(t, err)
+
+				teams, err := sqlStore.GetTeamsForUsersUnion(context.Background(), testUser, testOrgID, ids[:2])
+				require.NoError(t, err)
+				require.Len(t, teams, 2)
+				require.Equal(t, team1.Id, teams[0].Id)
+				require.EqualValues(t, 2, teams[0].MemberCount)
+				require.Equal(t, team2.Id, teams[1].Id)
+
+				teams, err = sqlStore.GetTeamsForUsersUnion(context.Background(), testUser, testOrgID, []int64{})
+				require.NoError(t, err)
+				require.Empty(t, teams)
+			})
+
+			t.Run("Should be able to set the settings of a team without them being clobbered by updates", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				settings, err := sqlStore.GetTeamSettings(context.Background(), testOrgID, team1.Id)
+				require.NoError(t, err)
+				require.Empty(t, settings.MustMap())
+
+				settings = simplejson.NewFromAny(map[string]interface{}{"alertThrottle": "5m"})
+				err = sqlStore.SetTeamSettings(context.Background(), testOrgID, team1.Id, settings)
+				require.NoError(t, err)
+
+				err = sqlStore.UpdateTeam(context.Background(), &models.UpdateTeamCommand{OrgId: testOrgID, Id: team1.Id, Name: "group1 renamed"})
+				require.NoError(t, err)
+
+				settings, err = sqlStore.GetTeamSettings(context.Background(), testOrgID, team1.Id)
+				require.NoError(t, err)
+				require.Equal(t, "5m", settings.Get("alertThrottle").MustString())
+
+				query := &models.GetTeamByIdQuery{OrgId: testOrgID, Id: team1.Id, SignedInUser: testUser, WithSettings: true}
+				err = sqlStore.GetTeamById(context.Background(), query)
+				require.NoError(t, err)
+				require.Equal(t, "5m", query.Result.Settings.Get("alertThrottle").MustString())
+
+				query.WithSettings = false
+				err = sqlStore.GetTeamById(context.Background(), query)
+				require.NoError(t, err)
+				require.Nil(t, query.Result.Settings)
+
+				err = sqlStore.SetTeamSettings(context.Background(), testOrgID, 999, settings)
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+			})
+
+			t.Run("Should be able to check several memberships at once", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+
+				pairs := []models.TeamUserPair{
+					{TeamId: team1.Id, UserId: ids[0]},
+					{TeamId: team1.Id, UserId: ids[1]},
+					{TeamId: team2.Id, UserId: ids[1]},
+				}
+				memberships, err := sqlStore.CheckMemberships(context.Background(), testOrgID, pairs)
+				require.NoError(t, err)
+				require.Equal(t, map[models.TeamUserPair]bool{
+					pairs[0]: true,
+					pairs[1]: false,
+					pairs[2]: true,
+				}, memberships)
+
+				memberships, err = sqlStore.CheckMemberships(context.Background(), testOrgID+1, pairs)
+				require.NoError(t, err)
+				require.False(t, memberships[pairs[0]])
+			})
+
+			t.Run("Should be able to search teams with stale external members", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				oldTimeNow := timeNow
+				defer func() { timeNow = oldTimeNow }()
+				timeNow = func() time.Time { return time.Now().Add(-48 * time.Hour) }
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, true, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team2.Id, true, 0)
+				require.NoError(t, err)
+				timeNow = oldTimeNow
+
+				// the external sync of team2 sets the permission of its existing member again
+				err = sqlStore.WithTransactionalDbSession(context.Background(), func(sess *DBSession) error {
+					return AddOrUpdateTeamMemberHook(sess, ids[1], testOrgID, team2.Id, true, 0)
+				})
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team2.Id, false, 0)
+				require.NoError(t, err)
+
+				bound := time.Now().Add(-24 * time.Hour)
+				query := &models.SearchTeamsQuery{OrgId: testOrgID, StaleExternalBefore: &bound, SignedInUser: testUser}
+				err = sqlStore.SearchTeams(context.Background(), query)
+				require.NoError(t, err)
+				require.EqualValues(t, 1, query.Result.TotalCount)
+				require.Len(t, query.Result.Teams, 1)
+				require.Equal(t, team1.Id, query.Result.Teams[0].Id)
+			})
+
+			t.Run("Should be able to get a team with only its admins", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				ids := userIds[len(userIds)-5:]
+				err := sqlStore.AddTeamMember(ids[0], testOrgID, team1.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[1], testOrgID, team1.Id, false, 0)
+				require.NoError(t, err)
+				err = sqlStore.AddTeamMember(ids[2], testOrgID, team2.Id, false, models.PERMISSION_ADMIN)
+				require.NoError(t, err)
+
+				team, admins, err := sqlStore.GetTeamWithAdmins(context.Background(), testOrgID, team1.Id)
+				require.NoError(t, err)
+				require.Equal(t, "group1 name", team.Name)
+				require.EqualValues(t, 2, team.MemberCount)
+				require.Len(t, admins, 1)
+				require.Equal(t, ids[0], admins[0].UserId)
+
+				_, _, err = sqlStore.GetTeamWithAdmins(context.Background(), testOrgID+1, team1.Id)
+				require.ErrorIs(t, err, models.ErrTeamNotFound)
+			})
+
+			t.Run("Should record a tombstone when a team is deleted", func(t *testing.T) {
+				sqlStore = InitTestDB(t)
+				setup()
+				since := time.Now().Add(-time.Minute)
+				err := sqlStore.DeleteTeam(context.Background(), &models.DeleteTeamCommand{OrgId: testOrgID, Id: team2.Id})
+				require.NoError(t, err)
+
+				tombstones, err := sqlStore.GetTombstonesSince(context.Background(), testOrgID, since)
+				require.NoError(t, err)
+				require.Len(t, tombstones, 1)
+				require.Equal(t, team2.Id, tombstones[0].TeamId)
+				require.Equal(t, "group2 name", tombstones[0].Name)
+
+				tombstones, err = sqlStore.GetTombstonesSince(context.Background(), testOrgID, time.Now().Add(time.Minute))
+				require.NoError(t, err)
+				require.Len(t, tombstones, 0)
 			})
 
 			t.Run("Should be able to return if user is admin of teams or not", func(t *testing.T) {
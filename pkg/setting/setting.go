@@ -269,6 +269,8 @@ type Cfg struct {
 	PluginAdminExternalManageEnabled bool
 	DisableSanitizeHtml              bool
 	EnterpriseLicensePath            string
+	// LibraryElementNameUniqueness is the scope in which library element names must be unique, either "org" or "folder"
+	LibraryElementNameUniqueness string
 
 	// Metrics
 	MetricsEndpointEnabled           bool
@@ -344,6 +346,8 @@ type Cfg struct {
 	RemoteCacheOptions *RemoteCacheOptions
 
 	EditorsCanAdmin bool
+	// MaxTeamsPerOrg is the maximum number of teams in an org, or 0 for no limit
+	MaxTeamsPerOrg int64
 
 	ApiKeyMaxSecondsToLive int64
 
@@ -984,6 +988,7 @@ func (cfg *Cfg) Load(args CommandLineArgs) error {
 
 	panelsSection := iniFile.Section("panels")
 	cfg.DisableSanitizeHtml = panelsSection.Key("disable_sanitize_html").MustBool(false)
+	cfg.LibraryElementNameUniqueness = panelsSection.Key("library_element_name_uniqueness").In("org", []string{"org", "folder"})
 
 	if err := cfg.readPluginSettings(iniFile); err != nil {
 		return err
@@ -1377,6 +1382,7 @@ func readUserSettings(iniFile *ini.File, cfg *Cfg) error {
 
 	ViewersCanEdit = users.Key("viewers_can_edit").MustBool(false)
 	cfg.EditorsCanAdmin = users.Key("editors_can_admin").MustBool(false)
+	cfg.MaxTeamsPerOrg = users.Key("max_teams_per_org").MustInt64(0)
 
 	userInviteMaxLifetimeVal := valueAsString(users, "user_invite_max_lifetime_duration", "24h")
 	userInviteMaxLifetimeDuration, err := gtime.ParseDuration(userInviteMaxLifetimeVal)